@@ -55,8 +55,14 @@ const (
 // GenericOptions is used as an extendable way to support
 type GenericOptions func(i interface{})
 
+// HTTPServer is implemented by those who add their own handlers to the generic endpoint
+type HTTPServer interface {
+	Serve(mux *http.ServeMux)
+}
+
 type GenericContext struct {
 	*http.Server
+	mux           *http.ServeMux
 	httpHandler   *process.HTTPHandler
 	healthChecker *HealthzChecker
 
@@ -184,6 +190,7 @@ func NewGenericContext(
 	}
 
 	c := &GenericContext{
+		mux:         mux,
 		httpHandler: httpHandler,
 		Server: &http.Server{
 			Handler: httpHandler.WithHandleChain(mux),
@@ -220,6 +227,14 @@ func (c *GenericContext) SetDefaultMetricsEmitter(metricEmitter metrics.MetricEm
 	c.EmitterPool.SetDefaultMetricsEmitter(metricEmitter)
 }
 
+// ServeHTTPHandlers adds handlers of the given servers listening on generic endpoint, along with
+// those for profiling and health check.
+func (c *GenericContext) ServeHTTPHandlers(servers ...HTTPServer) {
+	for _, server := range servers {
+		server.Serve(c.mux)
+	}
+}
+
 // Run starts the generic components
 func (c *GenericContext) Run(ctx context.Context) {
 	c.httpHandler.Run(ctx)
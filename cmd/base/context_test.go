@@ -0,0 +1,68 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package katalyst_base
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kubewharf/katalyst-core/pkg/consts"
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/metric/malachite"
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/pod"
+	"github.com/kubewharf/katalyst-core/pkg/metrics"
+	utilmetric "github.com/kubewharf/katalyst-core/pkg/util/metric"
+)
+
+func TestGenericContext_ServeHTTPHandlers(t *testing.T) {
+	t.Parallel()
+
+	c, err := GenerateFakeGenericContext()
+	assert.NoError(t, err)
+
+	fetcher := malachite.NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*malachite.MalachiteMetricsFetcher)
+	c.ServeHTTPHandlers(fetcher)
+
+	store, err := fetcher.GetMetricStore("")
+	assert.NoError(t, err)
+	now := time.Now()
+	store.SetContainerMetric("pod1", "c1", consts.MetricCPUUsageContainer, utilmetric.MetricData{Value: 1, Time: &now})
+
+	for _, tt := range []struct {
+		path string
+		code int
+	}{
+		{path: healthZPath, code: http.StatusOK},
+		{path: malachite.ServingMetricConfigPath, code: http.StatusOK},
+	} {
+		recorder := httptest.NewRecorder()
+		c.Handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		assert.Equal(t, tt.code, recorder.Code, tt.path)
+	}
+
+	// container metrics are served by the fetcher through the generic endpoint
+	recorder := httptest.NewRecorder()
+	c.Handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, malachite.ServingContainerMetricsPath+"?pod=pod1", nil))
+	var entries []malachite.ContainerMetricEntry
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &entries))
+	assert.Len(t, entries, 1)
+	assert.Equal(t, consts.MetricCPUUsageContainer, entries[0].MetricName)
+}
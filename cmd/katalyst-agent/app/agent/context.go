@@ -90,6 +90,11 @@ func NewGenericContext(base *katalystbase.GenericContext, conf *katalystconfig.C
 		return nil, fmt.Errorf("failed init meta server: %s", err)
 	}
 
+	// metrics fetcher may serve its container metrics and configuration for debugging
+	if server, ok := metaServer.MetricsFetcher.(katalystbase.HTTPServer); ok {
+		base.ServeHTTPHandlers(server)
+	}
+
 	pluginMgr, err := newPluginManager(conf)
 	if err != nil {
 		return nil, fmt.Errorf("failed init plugin manager: %s", err)
@@ -59,6 +59,8 @@ const (
 )
 
 type MetaServerOptions struct {
+	*MetricOptions
+
 	CNRCacheTTL                    time.Duration
 	CustomNodeConfigCacheTTL       time.Duration
 	ServiceProfileCacheTTL         time.Duration
@@ -88,6 +90,8 @@ type MetaServerOptions struct {
 
 func NewMetaServerOptions() *MetaServerOptions {
 	return &MetaServerOptions{
+		MetricOptions: NewMetricOptions(),
+
 		CNRCacheTTL:                    defaultCustomNodeResourceCacheTTL,
 		CustomNodeConfigCacheTTL:       defaultCustomNodeConfigCacheTTL,
 		ServiceProfileCacheTTL:         defaultServiceProfileCacheTTL,
@@ -114,6 +118,8 @@ func NewMetaServerOptions() *MetaServerOptions {
 
 // AddFlags adds flags to the specified FlagSet.
 func (o *MetaServerOptions) AddFlags(fss *cliflag.NamedFlagSets) {
+	o.MetricOptions.AddFlags(fss)
+
 	fs := fss.FlagSet("meta-server")
 
 	fs.DurationVar(&o.CNRCacheTTL, "cnr-cache-ttl", o.CNRCacheTTL,
@@ -184,5 +190,5 @@ func (o *MetaServerOptions) ApplyTo(c *global.MetaServerConfiguration) error {
 	c.KubeletPodsEndpoint = o.KubeletPodsEndpoint
 	c.APIAuthTokenFile = o.APIAuthTokenFile
 
-	return nil
+	return o.MetricOptions.ApplyTo(c.MetricConfiguration)
 }
@@ -0,0 +1,511 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package global
+
+import (
+	"fmt"
+	"time"
+
+	cliflag "k8s.io/component-base/cli/flag"
+
+	"github.com/kubewharf/katalyst-core/pkg/config/agent/global"
+	"github.com/kubewharf/katalyst-core/pkg/consts"
+	"github.com/kubewharf/katalyst-core/pkg/util/metric"
+)
+
+const (
+	defaultContainerStartupBaselineGracePeriod = 30 * time.Second
+
+	defaultNotifierEmitOnChange      = false
+	defaultNotifierChangeTolerance   = 0
+	defaultNotifierKeepAliveInterval = 1 * time.Minute
+
+	defaultMetricSnapshotFile        = ""
+	defaultMetricSnapshotPreload     = false
+	defaultMetricSnapshotMaxAge      = 5 * time.Minute
+	defaultMetricSnapshotCompression = false
+
+	defaultMemBandwidthUnit             = metric.DefaultMemBandwidthUnit
+	defaultMemBandwidthConsistencyCheck = false
+	defaultMemBandwidthNumaAttribution  = global.MemBandwidthNumaAttributionCPUBinding
+
+	defaultMemChannelCount         = 0
+	defaultMemChannelPeakBandwidth = 0
+
+	defaultMemBandwidthReplayCycles = 0
+
+	defaultStoreRoundingMode   = metric.RoundingModeNone
+	defaultStoreRoundingDigits = 0
+
+	defaultUnknownSchemaVersionPolicy = global.UnknownSchemaVersionPolicyWarn
+
+	defaultNodeMetricRetention = 0
+	defaultMetricStoreMaxKeys  = 0
+
+	defaultCPUContentionPSIThreshold           = 10
+	defaultCPUContentionThrottleRatioThreshold = 0.1
+
+	defaultRateSmoothedInterval = 0
+
+	defaultMemBandwidthAnomalyBaselineCycles = 0
+
+	defaultMetricExportSocketPath = ""
+
+	defaultRateWarmUpPeriod = 0
+
+	defaultMetricNamePrefix = ""
+
+	defaultRateClockJumpFactor = 0
+
+	defaultRateMonotonicInterval = false
+
+	defaultNodePool         = ""
+	defaultNodePoolLabelKey = ""
+
+	defaultSnapshotMaxTimeSkew = 0
+	defaultSnapshotSettleDelay = 0
+
+	defaultDebugCaptureSize = 10
+
+	defaultMemBandwidthNodeDecayFactor = 0
+	defaultMemBandwidthNodeIdleFloor   = 0
+	defaultMemChannelPeakBaseFrequency = 0
+	defaultPodMetricGCGracePeriod      = 0
+	defaultMemBandwidthWorkloadLabel   = ""
+
+	defaultMetricRemoteWriteURL       = ""
+	defaultMetricRemoteWriteInterval  = 30 * time.Second
+	defaultMetricRemoteWriteQueueSize = 10
+
+	defaultMalachiteCgroupStatsParser     = "default"
+	defaultMemBandwidthSharedCgroupPolicy = global.MemBandwidthSharedCgroupPolicyNamed
+
+	defaultMemBandwidthTrendWindow = 0
+
+	defaultMemBandwidthTrendMinSlope = 0
+)
+
+var defaultCgroupVersionAllowList = []string{global.CgroupVersionV1, global.CgroupVersionV2}
+
+var defaultMetricSnapshotBaselineMetrics = []string{consts.MetricMemBandwidthReadContainer, consts.MetricMemBandwidthWriteContainer}
+
+// MetricOptions holds the configurations for metrics fetcher in meta-server.
+type MetricOptions struct {
+	ContainerStartupBaselineGracePeriod time.Duration
+
+	NotifierEmitOnChange      bool
+	NotifierChangeTolerance   float64
+	NotifierKeepAliveInterval time.Duration
+
+	MetricSnapshotFile        string
+	MetricSnapshotPreload     bool
+	MetricSnapshotMaxAge      time.Duration
+	MetricSnapshotCompression bool
+
+	MemBandwidthUnit             string
+	MemBandwidthConsistencyCheck bool
+	MemBandwidthNumaAttribution  string
+
+	MemChannelCount         int
+	MemChannelPeakBandwidth float64
+
+	MemBandwidthReplayCycles int
+
+	StoreRoundingMode   string
+	StoreRoundingDigits int
+
+	UnknownSchemaVersionPolicy string
+
+	NodeMetricRetention time.Duration
+	MetricStoreMaxKeys  int
+
+	CPUContentionPSIThreshold           float64
+	CPUContentionThrottleRatioThreshold float64
+
+	RateSmoothedInterval time.Duration
+
+	MemBandwidthAnomalyBaselineCycles int
+
+	CgroupVersionAllowList []string
+
+	MetricExportSocketPath string
+
+	RateWarmUpPeriod time.Duration
+
+	MetricNamePrefix string
+
+	CounterDeltaStrategies map[string]string
+
+	MemBandwidthNodeExcludedCgroupPaths []string
+	MemBandwidthNodeExcludedPodSelector string
+	MemBandwidthNodeIdleFloor           float64
+
+	RateClockJumpFactor float64
+
+	MemBandwidthPressureClassBands []float64
+
+	NodeMetricRetentionOverrides map[string]string
+
+	RateMonotonicInterval bool
+
+	NodePool string
+
+	NodePoolLabelKey string
+
+	NodePoolStoreMetrics []string
+
+	SnapshotMaxTimeSkew time.Duration
+
+	SnapshotSettleDelay time.Duration
+
+	SampleInterval time.Duration
+
+	DisabledMetrics []string
+
+	MemBandwidthHistogramBuckets []float64
+
+	DebugCaptureContainers []string
+
+	DebugCaptureSize int
+
+	MemBandwidthNodeDecayFactor float64
+
+	MemChannelPeakBaseFrequency float64
+
+	MetricSnapshotBaselineMetrics []string
+
+	PodMetricGCGracePeriod time.Duration
+
+	MemBandwidthWorkloadLabel string
+
+	MetricRemoteWriteURL string
+
+	MetricRemoteWriteInterval time.Duration
+
+	MetricRemoteWriteQueueSize int
+
+	MetricMinWriteIntervals map[string]string
+
+	MalachiteCgroupStatsParser string
+
+	DerivedMetricCycleIntervals map[string]int
+
+	MemBandwidthSharedCgroupPolicy string
+
+	MemBandwidthTrendWindow time.Duration
+
+	MemBandwidthTrendMinSlope float64
+}
+
+func NewMetricOptions() *MetricOptions {
+	return &MetricOptions{
+		ContainerStartupBaselineGracePeriod: defaultContainerStartupBaselineGracePeriod,
+		NotifierEmitOnChange:                defaultNotifierEmitOnChange,
+		NotifierChangeTolerance:             defaultNotifierChangeTolerance,
+		NotifierKeepAliveInterval:           defaultNotifierKeepAliveInterval,
+		MetricSnapshotFile:                  defaultMetricSnapshotFile,
+		MetricSnapshotPreload:               defaultMetricSnapshotPreload,
+		MetricSnapshotMaxAge:                defaultMetricSnapshotMaxAge,
+		MetricSnapshotCompression:           defaultMetricSnapshotCompression,
+		MemBandwidthUnit:                    defaultMemBandwidthUnit,
+		MemBandwidthConsistencyCheck:        defaultMemBandwidthConsistencyCheck,
+		MemBandwidthNumaAttribution:         defaultMemBandwidthNumaAttribution,
+		MemChannelCount:                     defaultMemChannelCount,
+		MemChannelPeakBandwidth:             defaultMemChannelPeakBandwidth,
+		MemBandwidthReplayCycles:            defaultMemBandwidthReplayCycles,
+		StoreRoundingMode:                   defaultStoreRoundingMode,
+		StoreRoundingDigits:                 defaultStoreRoundingDigits,
+		UnknownSchemaVersionPolicy:          defaultUnknownSchemaVersionPolicy,
+		NodeMetricRetention:                 defaultNodeMetricRetention,
+		MetricStoreMaxKeys:                  defaultMetricStoreMaxKeys,
+		CPUContentionPSIThreshold:           defaultCPUContentionPSIThreshold,
+		CPUContentionThrottleRatioThreshold: defaultCPUContentionThrottleRatioThreshold,
+		RateSmoothedInterval:                defaultRateSmoothedInterval,
+		MemBandwidthAnomalyBaselineCycles:   defaultMemBandwidthAnomalyBaselineCycles,
+		CgroupVersionAllowList:              defaultCgroupVersionAllowList,
+		MetricExportSocketPath:              defaultMetricExportSocketPath,
+		RateWarmUpPeriod:                    defaultRateWarmUpPeriod,
+		MetricNamePrefix:                    defaultMetricNamePrefix,
+		CounterDeltaStrategies:              map[string]string{},
+		MemBandwidthNodeExcludedCgroupPaths: []string{},
+		MemBandwidthNodeExcludedPodSelector: "",
+		MemBandwidthNodeIdleFloor:           defaultMemBandwidthNodeIdleFloor,
+		RateClockJumpFactor:                 defaultRateClockJumpFactor,
+		MemBandwidthPressureClassBands:      []float64{},
+		NodeMetricRetentionOverrides:        map[string]string{},
+		RateMonotonicInterval:               defaultRateMonotonicInterval,
+		NodePool:                            defaultNodePool,
+		NodePoolLabelKey:                    defaultNodePoolLabelKey,
+		NodePoolStoreMetrics:                []string{},
+		SnapshotMaxTimeSkew:                 defaultSnapshotMaxTimeSkew,
+		SnapshotSettleDelay:                 defaultSnapshotSettleDelay,
+		SampleInterval:                      global.DefaultMetricSampleInterval,
+		DisabledMetrics:                     []string{},
+		MemBandwidthHistogramBuckets:        []float64{},
+		DebugCaptureContainers:              []string{},
+		DebugCaptureSize:                    defaultDebugCaptureSize,
+		MemBandwidthNodeDecayFactor:         defaultMemBandwidthNodeDecayFactor,
+		MemChannelPeakBaseFrequency:         defaultMemChannelPeakBaseFrequency,
+		MetricSnapshotBaselineMetrics:       defaultMetricSnapshotBaselineMetrics,
+		PodMetricGCGracePeriod:              defaultPodMetricGCGracePeriod,
+		MemBandwidthWorkloadLabel:           defaultMemBandwidthWorkloadLabel,
+		MetricRemoteWriteURL:                defaultMetricRemoteWriteURL,
+		MetricRemoteWriteInterval:           defaultMetricRemoteWriteInterval,
+		MetricRemoteWriteQueueSize:          defaultMetricRemoteWriteQueueSize,
+		MetricMinWriteIntervals:             map[string]string{},
+		MalachiteCgroupStatsParser:          defaultMalachiteCgroupStatsParser,
+		DerivedMetricCycleIntervals:         map[string]int{},
+		MemBandwidthSharedCgroupPolicy:      defaultMemBandwidthSharedCgroupPolicy,
+		MemBandwidthTrendWindow:             defaultMemBandwidthTrendWindow,
+		MemBandwidthTrendMinSlope:           defaultMemBandwidthTrendMinSlope,
+	}
+}
+
+// AddFlags adds flags to the specified FlagSet.
+func (o *MetricOptions) AddFlags(fss *cliflag.NamedFlagSets) {
+	fs := fss.FlagSet("meta-server-metric")
+
+	fs.DurationVar(&o.ContainerStartupBaselineGracePeriod, "metric-container-startup-baseline-grace-period",
+		o.ContainerStartupBaselineGracePeriod, "The period after container starts, within which the first sample "+
+			"is only used as the baseline of counters rather than to calculate rates, set zero to disable")
+	fs.BoolVar(&o.NotifierEmitOnChange, "metric-notifier-emit-on-change", o.NotifierEmitOnChange,
+		"Whether to send metrics to registered notifiers only when they change")
+	fs.Float64Var(&o.NotifierChangeTolerance, "metric-notifier-change-tolerance", o.NotifierChangeTolerance,
+		"The max difference between metric values that are treated as unchanged for notifiers")
+	fs.DurationVar(&o.NotifierKeepAliveInterval, "metric-notifier-keepalive-interval", o.NotifierKeepAliveInterval,
+		"The interval to send unchanged metrics to notifiers if emit-on-change is enabled")
+	fs.StringVar(&o.MetricSnapshotFile, "metric-snapshot-file", o.MetricSnapshotFile,
+		"The file to persist all metrics after each sampling cycle, set empty to disable")
+	fs.BoolVar(&o.MetricSnapshotPreload, "metric-snapshot-preload", o.MetricSnapshotPreload,
+		"Whether to load metrics from the snapshot file at startup")
+	fs.DurationVar(&o.MetricSnapshotMaxAge, "metric-snapshot-max-age", o.MetricSnapshotMaxAge,
+		"The max age of metrics to be loaded from the snapshot file, older ones will be dropped")
+	fs.BoolVar(&o.MetricSnapshotCompression, "metric-snapshot-compression", o.MetricSnapshotCompression,
+		"Whether to compress the snapshot file with gzip, and compressed snapshots are always detected when loading")
+	fs.StringVar(&o.MemBandwidthUnit, "metric-mem-bandwidth-unit", o.MemBandwidthUnit,
+		"The unit of memory bandwidth metrics in per second, one of bytes, KiB, MiB and GiB")
+	fs.BoolVar(&o.MemBandwidthConsistencyCheck, "metric-mem-bandwidth-consistency-check", o.MemBandwidthConsistencyCheck,
+		"Whether to compare the sum of estimated container write bandwidth with the write bandwidth measured by IMC")
+	fs.StringVar(&o.MemBandwidthNumaAttribution, "metric-mem-bandwidth-numa-attribution", o.MemBandwidthNumaAttribution,
+		"The method to attribute container memory bandwidth to numa nodes, one of cpu-binding and access-counter, "+
+			"and access-counter falls back to cpu-binding if per-numa access counters are not reported")
+	fs.IntVar(&o.MemChannelCount, "metric-mem-channel-count", o.MemChannelCount,
+		"The number of memory channels of the node, set zero to disable the channels utilized metric")
+	fs.Float64Var(&o.MemChannelPeakBandwidth, "metric-mem-channel-peak-bandwidth", o.MemChannelPeakBandwidth,
+		"The peak bandwidth of each memory channel in the unit of metric-mem-bandwidth-unit per second, "+
+			"set zero to disable the channels utilized metric")
+	fs.IntVar(&o.MemBandwidthReplayCycles, "metric-mem-bandwidth-replay-cycles", o.MemBandwidthReplayCycles,
+		"The number of the last sampling cycles whose raw memory bandwidth counters are retained to re-derive "+
+			"bandwidth into a scratch store for what-if analysis, set zero to disable")
+	fs.StringVar(&o.StoreRoundingMode, "metric-store-rounding-mode", o.StoreRoundingMode,
+		"The mode to round non-integral metric values before stored, one of decimal-places and significant-figures, "+
+			"set empty to disable")
+	fs.IntVar(&o.StoreRoundingDigits, "metric-store-rounding-digits", o.StoreRoundingDigits,
+		"The number of decimal places or significant figures to keep for metric values")
+	fs.StringVar(&o.UnknownSchemaVersionPolicy, "metric-unknown-schema-version-policy", o.UnknownSchemaVersionPolicy,
+		"The policy to handle malachite responses with unrecognized schema version, one of warn and hold, "+
+			"and hold means to stop collecting metrics and keep the last values")
+	fs.DurationVar(&o.NodeMetricRetention, "metric-node-metric-retention", o.NodeMetricRetention,
+		"How long samples of node metrics are retained in memory to be queried as time series, set zero to disable")
+	fs.IntVar(&o.MetricStoreMaxKeys, "metric-store-max-keys", o.MetricStoreMaxKeys,
+		"The max number of metric keys in metric store, the least-recently-updated keys will be evicted "+
+			"once it's exceeded, set zero to disable")
+	fs.Float64Var(&o.CPUContentionPSIThreshold, "metric-cpu-contention-psi-threshold", o.CPUContentionPSIThreshold,
+		"The threshold of avg10 of cpu pressure some (in percentage) above which the container may be in cpu contention")
+	fs.Float64Var(&o.CPUContentionThrottleRatioThreshold, "metric-cpu-contention-throttle-ratio-threshold",
+		o.CPUContentionThrottleRatioThreshold, "The threshold of throttled periods to elapsed periods above which "+
+			"the container may be in cpu contention")
+	fs.DurationVar(&o.RateSmoothedInterval, "metric-rate-smoothed-interval", o.RateSmoothedInterval,
+		"The nominal interval of malachite updates, the delta of update times will be rounded to its multiples "+
+			"when calculating rates to absorb the jitter, set zero to use raw delta")
+	fs.IntVar(&o.MemBandwidthAnomalyBaselineCycles, "metric-mem-bandwidth-anomaly-baseline-cycles",
+		o.MemBandwidthAnomalyBaselineCycles, "The number of the last sampling cycles whose memory bandwidth is used "+
+			"as the baseline to calculate the bandwidth anomaly score of containers, set zero to disable")
+	fs.StringSliceVar(&o.CgroupVersionAllowList, "metric-cgroup-version-allow-list", o.CgroupVersionAllowList,
+		"The cgroup versions of containers to be processed, containers of other versions will be skipped, "+
+			"set empty to process all versions")
+	fs.StringVar(&o.MetricExportSocketPath, "metric-export-socket-path", o.MetricExportSocketPath,
+		"The path of unix socket to export all metrics as newline-delimited \"key value timestamp\" lines "+
+			"on each connection, set empty to disable")
+	fs.DurationVar(&o.RateWarmUpPeriod, "metric-rate-warm-up-period", o.RateWarmUpPeriod,
+		"The period after startup, within which rate metrics are calculated but not published, set zero to disable")
+	fs.StringVar(&o.MetricNamePrefix, "metric-name-prefix", o.MetricNamePrefix,
+		"The prefix prepended to names of all metrics stored by the fetcher (e.g. teamA_), and exporters "+
+			"will emit those prefixed names, set empty to disable")
+	fs.StringToStringVar(&o.CounterDeltaStrategies, "metric-counter-delta-strategies", o.CounterDeltaStrategies,
+		"The strategies to diff counters of derived metrics, in the format of metricName=strategy, and built-in "+
+			"strategies are saturating, reset-as-zero, wrap-48 and wrap-64, saturating is used by default")
+	fs.StringSliceVar(&o.MemBandwidthNodeExcludedCgroupPaths, "metric-mem-bandwidth-node-excluded-cgroup-paths",
+		o.MemBandwidthNodeExcludedCgroupPaths, "The prefixes of cgroup paths of containers excluded from the tenant "+
+			"memory bandwidth of the node")
+	fs.StringVar(&o.MemBandwidthNodeExcludedPodSelector, "metric-mem-bandwidth-node-excluded-pod-selector",
+		o.MemBandwidthNodeExcludedPodSelector, "The label selector of pods excluded from the tenant memory bandwidth "+
+			"of the node, i.e. app=infra")
+	fs.Float64Var(&o.MemBandwidthNodeIdleFloor, "metric-mem-bandwidth-node-idle-floor", o.MemBandwidthNodeIdleFloor,
+		"The floor of total memory bandwidth of a container in the unit of metric-mem-bandwidth-unit per second, "+
+			"below which the container is excluded from the tenant memory bandwidth of the node, set zero to include all")
+	fs.Float64Var(&o.RateClockJumpFactor, "metric-rate-clock-jump-factor", o.RateClockJumpFactor,
+		"The factor of the interval between updates to metric-sample-interval, beyond which (in either "+
+			"direction) the clock is regarded as jumped and the sample is dropped when calculating rates, set zero to disable")
+	fs.Float64SliceVar(&o.MemBandwidthPressureClassBands, "metric-mem-bandwidth-pressure-class-bands",
+		o.MemBandwidthPressureClassBands, "The ascending thresholds of container memory bandwidth utilization to "+
+			"classify the bandwidth pressure, i.e. 0.3,0.6,0.9 for low/medium/high/critical, set empty to disable")
+	fs.StringToStringVar(&o.NodeMetricRetentionOverrides, "metric-node-metric-retention-overrides",
+		o.NodeMetricRetentionOverrides, "The retention of samples for each node metric in the format of metricName=retention, "+
+			"where retention is a duration (i.e. 10m) or the number of samples (i.e. 300), metric-node-metric-retention is used by default")
+	fs.BoolVar(&o.RateMonotonicInterval, "metric-rate-monotonic-interval", o.RateMonotonicInterval,
+		"Whether to calculate rates with intervals of the monotonic clock of source if they are provided, rather than wall-clock")
+	fs.StringVar(&o.NodePool, "metric-node-pool", o.NodePool,
+		"The pool (or zone) of this node to tag exported metrics with, and it takes precedence over metric-node-pool-label-key")
+	fs.StringVar(&o.NodePoolLabelKey, "metric-node-pool-label-key", o.NodePoolLabelKey,
+		"The label of node to read the pool of this node from if metric-node-pool is not set")
+	fs.StringSliceVar(&o.NodePoolStoreMetrics, "metric-node-pool-store-metrics", o.NodePoolStoreMetrics,
+		"The node metrics to store an extra copy tagged with the pool of this node")
+	fs.DurationVar(&o.SnapshotMaxTimeSkew, "metric-snapshot-max-time-skew", o.SnapshotMaxTimeSkew,
+		"The max skew among update times of fields of a container in the snapshot, and partially updated containers are rejected, zero means no check")
+	fs.DurationVar(&o.SnapshotSettleDelay, "metric-snapshot-settle-delay", o.SnapshotSettleDelay,
+		"The delay to let the source settle before reading the snapshot again if it's inconsistent, zero means no re-read")
+	fs.DurationVar(&o.SampleInterval, "metric-sample-interval", o.SampleInterval,
+		"The interval between sampling cycles of metrics")
+	fs.StringSliceVar(&o.DisabledMetrics, "metric-disabled-metrics", o.DisabledMetrics,
+		"The metrics not to be stored, and raw counters should not be disabled since derived metrics are based on them")
+	fs.Float64SliceVar(&o.MemBandwidthHistogramBuckets, "metric-mem-bandwidth-histogram-buckets",
+		o.MemBandwidthHistogramBuckets, "The ascending upper bounds of buckets of the histogram of container memory bandwidth "+
+			"exported on each scrape, i.e. 100,1000,10000, set empty to disable")
+	fs.StringSliceVar(&o.DebugCaptureContainers, "metric-debug-capture-containers", o.DebugCaptureContainers,
+		"The containers in the form of <podUID>/<containerName> whose raw cgroup info and resulting metrics are captured "+
+			"in each cycle, which can be queried via http for debugging")
+	fs.IntVar(&o.DebugCaptureSize, "metric-debug-capture-size", o.DebugCaptureSize,
+		"The max number of the latest captures kept for each container in metric-debug-capture-containers")
+	fs.Float64Var(&o.MemBandwidthNodeDecayFactor, "metric-mem-bandwidth-node-decay-factor", o.MemBandwidthNodeDecayFactor,
+		"The weight of the previous estimate of the decayed node bandwidth in each cycle, which follows spikes "+
+			"immediately but decays smoothly, it must be in [0, 1) and 0 disables it")
+	fs.Float64Var(&o.MemChannelPeakBaseFrequency, "metric-mem-channel-peak-base-frequency", o.MemChannelPeakBaseFrequency,
+		"The cpu frequency in MHz at which metric-mem-channel-peak-bandwidth is measured, and the peak is scaled by "+
+			"current frequency against it if it's set, 0 means the static peak is always used")
+	fs.StringSliceVar(&o.MetricSnapshotBaselineMetrics, "metric-snapshot-baseline-metrics", o.MetricSnapshotBaselineMetrics,
+		"The derived container metrics whose raw counters are kept in the snapshot file as baselines across restarts, "+
+			"i.e. mem.bandwidth.read.container, mem.bandwidth.write.container and cpu.cpi.container")
+	fs.DurationVar(&o.PodMetricGCGracePeriod, "metric-pod-gc-grace-period", o.PodMetricGCGracePeriod,
+		"The period to keep metrics of pods not reported any more as tombstones before deleting them, "+
+			"0 means they are deleted at once")
+	fs.StringVar(&o.MemBandwidthWorkloadLabel, "metric-mem-bandwidth-workload-label", o.MemBandwidthWorkloadLabel,
+		"The pod label identifying the workload when aggregating memory bandwidth by workload, "+
+			"and the controller owner of the pod is used if it's empty")
+	fs.StringVar(&o.MetricRemoteWriteURL, "metric-remote-write-url", o.MetricRemoteWriteURL,
+		"The Prometheus remote write endpoint to POST batches of all metrics periodically, set empty to disable")
+	fs.DurationVar(&o.MetricRemoteWriteInterval, "metric-remote-write-interval", o.MetricRemoteWriteInterval,
+		"The interval to build a batch of all metrics for the remote write")
+	fs.IntVar(&o.MetricRemoteWriteQueueSize, "metric-remote-write-queue-size", o.MetricRemoteWriteQueueSize,
+		"The max number of batches waiting to be sent, and the oldest one is dropped when it's full")
+	fs.StringToStringVar(&o.MetricMinWriteIntervals, "metric-min-write-intervals", o.MetricMinWriteIntervals,
+		"The min interval between writes of each metric in the format of metricName=duration, and unchanged values "+
+			"written within the interval are skipped, metrics not listed are written in each cycle")
+	fs.StringVar(&o.MalachiteCgroupStatsParser, "metric-malachite-cgroup-stats-parser", o.MalachiteCgroupStatsParser,
+		"The name of the registered parser for cgroup stats responses of malachite")
+	fs.StringToIntVar(&o.DerivedMetricCycleIntervals, "metric-derived-cycle-intervals", o.DerivedMetricCycleIntervals,
+		"The number of sampling cycles between calculations of each derived metric in the format of metricName=N, "+
+			"and the last values are kept in between, metrics not listed are calculated in each cycle")
+	fs.StringVar(&o.MemBandwidthSharedCgroupPolicy, "metric-mem-bandwidth-shared-cgroup-policy", o.MemBandwidthSharedCgroupPolicy,
+		"The policy to attribute memory bandwidth of a cgroup shared by multiple containers of a pod, "+
+			"one of named, primary and split-by-cpu, and named keeps the bandwidth reported for each container")
+	fs.DurationVar(&o.MemBandwidthTrendWindow, "metric-mem-bandwidth-trend-window", o.MemBandwidthTrendWindow,
+		"The window of memory bandwidth samples used to fit the bandwidth trend of containers, set zero to disable")
+	fs.Float64Var(&o.MemBandwidthTrendMinSlope, "metric-mem-bandwidth-trend-min-slope", o.MemBandwidthTrendMinSlope,
+		"The minimum absolute slope of memory bandwidth per second for the trend of containers to be regarded as rising or falling")
+}
+
+// ApplyTo fills up config with options
+func (o *MetricOptions) ApplyTo(c *global.MetricConfiguration) error {
+	c.ContainerStartupBaselineGracePeriod = o.ContainerStartupBaselineGracePeriod
+	c.NotifierEmitOnChange = o.NotifierEmitOnChange
+	c.NotifierChangeTolerance = o.NotifierChangeTolerance
+	c.NotifierKeepAliveInterval = o.NotifierKeepAliveInterval
+	c.MetricSnapshotFile = o.MetricSnapshotFile
+	c.MetricSnapshotPreload = o.MetricSnapshotPreload
+	c.MetricSnapshotMaxAge = o.MetricSnapshotMaxAge
+	c.MetricSnapshotCompression = o.MetricSnapshotCompression
+	c.MemBandwidthUnit = o.MemBandwidthUnit
+	c.MemBandwidthConsistencyCheck = o.MemBandwidthConsistencyCheck
+	c.MemBandwidthNumaAttribution = o.MemBandwidthNumaAttribution
+	c.MemChannelCount = o.MemChannelCount
+	c.MemChannelPeakBandwidth = o.MemChannelPeakBandwidth
+	c.MemBandwidthReplayCycles = o.MemBandwidthReplayCycles
+	c.StoreRoundingMode = o.StoreRoundingMode
+	c.StoreRoundingDigits = o.StoreRoundingDigits
+	c.UnknownSchemaVersionPolicy = o.UnknownSchemaVersionPolicy
+	c.NodeMetricRetention = o.NodeMetricRetention
+	c.MetricStoreMaxKeys = o.MetricStoreMaxKeys
+	c.CPUContentionPSIThreshold = o.CPUContentionPSIThreshold
+	c.CPUContentionThrottleRatioThreshold = o.CPUContentionThrottleRatioThreshold
+	c.RateSmoothedInterval = o.RateSmoothedInterval
+	c.MemBandwidthAnomalyBaselineCycles = o.MemBandwidthAnomalyBaselineCycles
+	c.CgroupVersionAllowList = o.CgroupVersionAllowList
+	c.MetricExportSocketPath = o.MetricExportSocketPath
+	c.RateWarmUpPeriod = o.RateWarmUpPeriod
+	c.MetricNamePrefix = o.MetricNamePrefix
+	c.CounterDeltaStrategies = o.CounterDeltaStrategies
+	c.MemBandwidthNodeExcludedCgroupPaths = o.MemBandwidthNodeExcludedCgroupPaths
+	c.MemBandwidthNodeExcludedPodSelector = o.MemBandwidthNodeExcludedPodSelector
+	c.MemBandwidthNodeIdleFloor = o.MemBandwidthNodeIdleFloor
+	c.RateClockJumpFactor = o.RateClockJumpFactor
+	c.MemBandwidthPressureClassBands = o.MemBandwidthPressureClassBands
+	c.NodeMetricRetentionOverrides = o.NodeMetricRetentionOverrides
+	c.RateMonotonicInterval = o.RateMonotonicInterval
+	c.NodePool = o.NodePool
+	c.NodePoolLabelKey = o.NodePoolLabelKey
+	c.NodePoolStoreMetrics = o.NodePoolStoreMetrics
+	c.SnapshotMaxTimeSkew = o.SnapshotMaxTimeSkew
+	c.SnapshotSettleDelay = o.SnapshotSettleDelay
+	c.SampleInterval = o.SampleInterval
+	c.DisabledMetrics = o.DisabledMetrics
+	c.MemBandwidthHistogramBuckets = o.MemBandwidthHistogramBuckets
+	c.DebugCaptureContainers = o.DebugCaptureContainers
+	c.DebugCaptureSize = o.DebugCaptureSize
+	c.MemBandwidthNodeDecayFactor = o.MemBandwidthNodeDecayFactor
+	c.MemChannelPeakBaseFrequency = o.MemChannelPeakBaseFrequency
+	c.MetricSnapshotBaselineMetrics = o.MetricSnapshotBaselineMetrics
+	c.PodMetricGCGracePeriod = o.PodMetricGCGracePeriod
+	c.MemBandwidthWorkloadLabel = o.MemBandwidthWorkloadLabel
+
+	c.MetricRemoteWriteURL = o.MetricRemoteWriteURL
+	if o.MetricRemoteWriteInterval <= 0 {
+		return fmt.Errorf("invalid metric-remote-write-interval %v", o.MetricRemoteWriteInterval)
+	}
+	c.MetricRemoteWriteInterval = o.MetricRemoteWriteInterval
+	if o.MetricRemoteWriteQueueSize <= 0 {
+		return fmt.Errorf("invalid metric-remote-write-queue-size %v", o.MetricRemoteWriteQueueSize)
+	}
+	c.MetricRemoteWriteQueueSize = o.MetricRemoteWriteQueueSize
+
+	c.MetricMinWriteIntervals = make(map[string]time.Duration, len(o.MetricMinWriteIntervals))
+	for metricName, value := range o.MetricMinWriteIntervals {
+		interval, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid metric-min-write-intervals %v for %v", value, metricName)
+		}
+		c.MetricMinWriteIntervals[metricName] = interval
+	}
+
+	c.MalachiteCgroupStatsParser = o.MalachiteCgroupStatsParser
+	c.DerivedMetricCycleIntervals = o.DerivedMetricCycleIntervals
+	c.MemBandwidthSharedCgroupPolicy = o.MemBandwidthSharedCgroupPolicy
+	c.MemBandwidthTrendWindow = o.MemBandwidthTrendWindow
+	c.MemBandwidthTrendMinSlope = o.MemBandwidthTrendMinSlope
+
+	return c.Validate()
+}
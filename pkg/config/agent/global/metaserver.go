@@ -23,6 +23,8 @@ import (
 )
 
 type MetaServerConfiguration struct {
+	*MetricConfiguration
+
 	CNRCacheTTL                    time.Duration
 	CustomNodeConfigCacheTTL       time.Duration
 	ServiceProfileCacheTTL         time.Duration
@@ -51,5 +53,7 @@ type MetaServerConfiguration struct {
 }
 
 func NewMetaServerConfiguration() *MetaServerConfiguration {
-	return &MetaServerConfiguration{}
+	return &MetaServerConfiguration{
+		MetricConfiguration: NewMetricConfiguration(),
+	}
 }
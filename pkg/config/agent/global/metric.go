@@ -0,0 +1,468 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package global
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// DefaultMetricSampleInterval is the interval between sampling cycles if SampleInterval is not positive
+const DefaultMetricSampleInterval = 5 * time.Second
+
+// those policies decide how to handle unrecognized schema version of malachite response
+const (
+	// UnknownSchemaVersionPolicyWarn only logs a warning and keeps on collecting metrics
+	UnknownSchemaVersionPolicyWarn = "warn"
+	// UnknownSchemaVersionPolicyHold stops collecting metrics and holds the last values
+	UnknownSchemaVersionPolicyHold = "hold"
+)
+
+// those methods decide how memory bandwidth of containers is attributed to numa nodes
+const (
+	// MemBandwidthNumaAttributionCPUBinding splits bandwidth evenly among numa nodes bound by cpuset
+	MemBandwidthNumaAttributionCPUBinding = "cpu-binding"
+	// MemBandwidthNumaAttributionAccessCounter splits bandwidth by per-numa memory access counters,
+	// and falls back to MemBandwidthNumaAttributionCPUBinding if those counters are not reported
+	MemBandwidthNumaAttributionAccessCounter = "access-counter"
+)
+
+// those policies decide how memory bandwidth of a cgroup shared by multiple containers of a pod is attributed
+const (
+	// MemBandwidthSharedCgroupPolicyNamed keeps the bandwidth reported by malachite for each container as is
+	MemBandwidthSharedCgroupPolicyNamed = "named"
+	// MemBandwidthSharedCgroupPolicyPrimary attributes the shared bandwidth to the container with the most
+	// cpu usage among those sharing the cgroup, and the others get zero
+	MemBandwidthSharedCgroupPolicyPrimary = "primary"
+	// MemBandwidthSharedCgroupPolicySplitByCPU splits the shared bandwidth among containers sharing the cgroup
+	// by their cpu usage, and it's split evenly if none of them has cpu usage
+	MemBandwidthSharedCgroupPolicySplitByCPU = "split-by-cpu"
+)
+
+// those are names of the built-in strategies to diff counters of derived metrics
+const (
+	// CounterDeltaStrategySaturating makes the delta zero if the counter goes backwards
+	CounterDeltaStrategySaturating = "saturating"
+	// CounterDeltaStrategyResetAsZero regards the counter as reset and restarted from zero if it goes backwards
+	CounterDeltaStrategyResetAsZero = "reset-as-zero"
+	// CounterDeltaStrategyWrap48 and CounterDeltaStrategyWrap64 regard the counter as wrapped around at its width
+	CounterDeltaStrategyWrap48 = "wrap-48"
+	CounterDeltaStrategyWrap64 = "wrap-64"
+)
+
+// MalachiteCgroupStatsParserDefault is the name of the parser for the cgroup stats response format of upstream malachite
+const MalachiteCgroupStatsParserDefault = "default"
+
+// those are cgroup versions that can be reported by malachite
+const (
+	CgroupVersionV1 = "V1"
+	CgroupVersionV2 = "V2"
+)
+
+// MetricConfiguration stores configurations used by metrics fetcher in meta-server
+type MetricConfiguration struct {
+	// ContainerStartupBaselineGracePeriod is the period after container starts, within which
+	// the first sample is only used as baseline for counters rather than calculating rates.
+	ContainerStartupBaselineGracePeriod time.Duration
+
+	// NotifierEmitOnChange makes registered notifiers only receive metrics when they change,
+	// values within NotifierChangeTolerance are treated as unchanged, and unchanged metrics
+	// will still be sent once per NotifierKeepAliveInterval.
+	NotifierEmitOnChange      bool
+	NotifierChangeTolerance   float64
+	NotifierKeepAliveInterval time.Duration
+
+	// MetricSnapshotFile is the file to persist all metrics after each sampling cycle,
+	// and if MetricSnapshotPreload is enabled, metrics in it will be loaded at startup,
+	// except for those collected longer than MetricSnapshotMaxAge ago. The snapshot is compressed with gzip if
+	// MetricSnapshotCompression is enabled, and compressed snapshots are detected and decompressed when loading.
+	MetricSnapshotFile        string
+	MetricSnapshotPreload     bool
+	MetricSnapshotMaxAge      time.Duration
+	MetricSnapshotCompression bool
+
+	// MemBandwidthUnit is the unit of memory bandwidth metrics (in per second),
+	// including bytes, KiB, MiB and GiB, and MiB is used if it's empty.
+	MemBandwidthUnit string
+
+	// MemBandwidthConsistencyCheck enables comparing the sum of estimated write bandwidth
+	// of all containers with the write bandwidth measured by IMC in each sampling cycle.
+	MemBandwidthConsistencyCheck bool
+
+	// MemBandwidthNumaAttribution is the method to attribute memory bandwidth of containers
+	// to numa nodes, and MemBandwidthNumaAttributionCPUBinding is used if it's empty.
+	MemBandwidthNumaAttribution string
+
+	// MemChannelCount and MemChannelPeakBandwidth (in MemBandwidthUnit per second) describe
+	// memory channels of the node, which are used to express node bandwidth in the number of
+	// channels utilized and the bandwidth headroom, and it's disabled if any of them is zero.
+	MemChannelCount         int
+	MemChannelPeakBandwidth float64
+
+	// MemBandwidthReplayCycles is the number of the last sampling cycles whose raw memory bandwidth
+	// counters are retained to re-derive bandwidth for what-if analysis, and it's disabled if zero.
+	MemBandwidthReplayCycles int
+
+	// StoreRoundingMode and StoreRoundingDigits decide how non-integral metric values are
+	// rounded before stored, i.e. to decimal places or significant figures, and no rounding
+	// is applied if the mode is empty.
+	StoreRoundingMode   string
+	StoreRoundingDigits int
+
+	// UnknownSchemaVersionPolicy decides how to handle malachite responses with unrecognized
+	// schema version, and UnknownSchemaVersionPolicyWarn is used if it's empty.
+	UnknownSchemaVersionPolicy string
+
+	// NodeMetricRetention is how long samples of node metrics are retained in memory
+	// to be queried as time series, and no sample will be retained if it's zero.
+	NodeMetricRetention time.Duration
+
+	// MetricStoreMaxKeys is the max number of metric keys in metric store, and the least-recently-updated
+	// keys will be evicted once it's exceeded, and no limit is applied if it's zero.
+	MetricStoreMaxKeys int
+
+	// CPUContentionPSIThreshold (avg10 of cpu pressure "some" in percentage) and
+	// CPUContentionThrottleRatioThreshold (throttled periods to elapsed periods) decide
+	// whether the container is in cpu contention, which requires both of them are exceeded.
+	CPUContentionPSIThreshold           float64
+	CPUContentionThrottleRatioThreshold float64
+
+	// RateSmoothedInterval is the nominal interval of malachite updates, and if it's set, the raw delta
+	// of update times is rounded to its multiples when calculating rates, to avoid rates wobbling with
+	// jittered update times, and raw delta is used directly if it's zero.
+	RateSmoothedInterval time.Duration
+
+	// MemBandwidthAnomalyBaselineCycles is the number of the last sampling cycles whose memory bandwidth
+	// is used as the baseline of the container, and the anomaly score (current bandwidth to the median of
+	// the baseline) is only calculated once the baseline is full, and it's disabled if zero.
+	MemBandwidthAnomalyBaselineCycles int
+
+	// CgroupVersionAllowList is the cgroup versions (CgroupType reported by malachite, i.e. V1 and V2)
+	// of containers to be processed, containers of other versions are skipped as a whole, and all
+	// versions are processed if it's empty.
+	CgroupVersionAllowList []string
+
+	// MetricExportSocketPath is the path of unix socket to export all metrics in line protocol, and each
+	// connection receives the current metrics as newline-delimited "key value timestamp" lines, and then
+	// it's closed. The export is disabled if it's empty.
+	MetricExportSocketPath string
+
+	// RateWarmUpPeriod is the period after the fetcher starts, within which rate metrics are calculated to
+	// establish baselines but not published, to avoid consumers acting on the noise at startup, while gauges
+	// are still published immediately. Rates are published from the start if it's zero.
+	RateWarmUpPeriod time.Duration
+
+	// MetricNamePrefix is prepended to names of all metrics stored by the fetcher to namespace them
+	// in a shared monitoring system, and it's transparent to internal readers.
+	MetricNamePrefix string
+
+	// CounterDeltaStrategies selects how counters of the derived metric are diffed by the name of built-in
+	// strategies, i.e. saturating, reset-as-zero, wrap-48 and wrap-64, map[metricName]strategy, and the
+	// saturating strategy is used for metrics not in it.
+	CounterDeltaStrategies map[string]string
+
+	// MemBandwidthNodeExcludedCgroupPaths and MemBandwidthNodeExcludedPodSelector tell containers excluded from
+	// the tenant bandwidth of the node, i.e. the agent itself and infra daemons, by the prefix of cgroup paths or
+	// the label selector of pods, and nothing is excluded if both are empty.
+	MemBandwidthNodeExcludedCgroupPaths []string
+	MemBandwidthNodeExcludedPodSelector string
+
+	// MemBandwidthNodeIdleFloor is the floor of the total (read and write) memory bandwidth of a container, below
+	// which the container is regarded as idle and excluded from the tenant bandwidth of the node, in the unit of
+	// MemBandwidthUnit per second. Nothing is excluded if it's zero.
+	MemBandwidthNodeIdleFloor float64
+
+	// RateClockJumpFactor decides whether the interval between updates is implausible compared with
+	// SampleInterval, i.e. the clock is stepped by NTP, if it's more than RateClockJumpFactor times of
+	// the sampling interval or less than 1/RateClockJumpFactor of it, and those samples are dropped when
+	// calculating rates. It's disabled if it's zero.
+	RateClockJumpFactor float64
+
+	// MemBandwidthPressureClassBands are the ascending thresholds of container bandwidth utilization (the total
+	// bandwidth to the peak bandwidth of all memory channels), and the pressure class of the container is the number
+	// of thresholds not greater than its utilization, i.e. 0 (low) to len(bands) (critical). It's disabled if empty.
+	MemBandwidthPressureClassBands []float64
+
+	// NodeMetricRetentionOverrides overrides NodeMetricRetention for each node metric, map[metricName]retention,
+	// and the retention is either a duration (i.e. 10m) or the number of samples (i.e. 1 for the latest only).
+	NodeMetricRetentionOverrides map[string]string
+
+	// RateMonotonicInterval decides whether to calculate rates with the interval measured by the monotonic clock
+	// of source when it's provided, which is immune to wall-clock steps, and wall-clock is used as fallback.
+	RateMonotonicInterval bool
+
+	// NodePool is the pool (or zone) this node belongs to, and exported metrics are tagged with it if it's not empty
+	NodePool string
+
+	// NodePoolLabelKey is the label of node metadata to read the pool from if NodePool is empty
+	NodePoolLabelKey string
+
+	// NodePoolStoreMetrics are node metrics to store an extra copy tagged with the pool,
+	// i.e. named as <metricName>.pool.<pool>, and it's useful for consumers rolling up by pools
+	NodePoolStoreMetrics []string
+
+	// SnapshotMaxTimeSkew is the max skew among update times of fields of a container in the snapshot of source,
+	// and containers exceeding it are regarded as partially updated and rejected in the cycle. The check is disabled if it's zero.
+	SnapshotMaxTimeSkew time.Duration
+
+	// SnapshotSettleDelay is the delay to let the source settle before reading the snapshot again if it's inconsistent
+	// per SnapshotMaxTimeSkew, and inconsistent containers are rejected without reading again if it's zero.
+	SnapshotSettleDelay time.Duration
+
+	// SampleInterval is the interval between sampling cycles of metrics
+	SampleInterval time.Duration
+
+	// DisabledMetrics are metrics not to be stored, and raw counters should not be disabled,
+	// otherwise derived metrics based on their deltas will be missing
+	DisabledMetrics []string
+
+	// MemBandwidthHistogramBuckets are the ascending upper bounds (in the unit of MemBandwidthUnit per second) of buckets
+	// of the histogram of container memory bandwidth exported on each scrape, and the histogram is disabled if it's empty.
+	MemBandwidthHistogramBuckets []float64
+
+	// DebugCaptureContainers are containers (in the form of <podUID>/<containerName>) whose raw cgroup info and
+	// resulting metrics are captured in each cycle for debugging, and nothing is captured if it's empty.
+	DebugCaptureContainers []string
+
+	// DebugCaptureSize is the max number of the latest captures kept for each container in DebugCaptureContainers
+	DebugCaptureSize int
+
+	// MemBandwidthNodeDecayFactor is the weight of the previous estimate when the decayed tenant bandwidth of the node is
+	// updated in each cycle, and the estimate follows increases immediately but decays with it otherwise. It must be in
+	// [0, 1), and the decayed bandwidth is not calculated if it's 0.
+	MemBandwidthNodeDecayFactor float64
+
+	// MemChannelPeakBaseFrequency is the cpu frequency (in MHz) at which MemChannelPeakBandwidth is measured, and if it's
+	// set, the peak is scaled by the current average cpu frequency of the node against it, since achievable bandwidth
+	// varies with frequency scaling. The static peak is used if it's zero or the current frequency is unknown.
+	MemChannelPeakBaseFrequency float64
+
+	// MetricSnapshotBaselineMetrics are derived container metrics whose raw counters are kept in the snapshot file as
+	// baselines, so that they are calculated against the counters before restarting, while counters of other derived
+	// metrics are dropped from the snapshot and those metrics start fresh after restarting.
+	MetricSnapshotBaselineMetrics []string
+
+	// PodMetricGCGracePeriod is how long metrics and states of pods not reported by malachite are tombstoned before
+	// they are deleted, so that they are still readable as stale metrics and baselines are kept if pods are reported
+	// again within it. They are deleted in the same cycle if it's zero.
+	PodMetricGCGracePeriod time.Duration
+
+	// MemBandwidthWorkloadLabel is the pod label whose value identifies the workload of the pod when aggregating
+	// bandwidth by workload, and the controller owner of the pod is used if it's empty or not labeled.
+	MemBandwidthWorkloadLabel string
+
+	// MetricRemoteWriteURL is the Prometheus remote write endpoint to which batches of all metrics are POSTed
+	// periodically, and the remote write is disabled if it's empty.
+	MetricRemoteWriteURL string
+
+	// MetricRemoteWriteInterval is the interval to build a batch of all metrics for the remote write.
+	MetricRemoteWriteInterval time.Duration
+
+	// MetricRemoteWriteQueueSize is the max number of batches waiting to be sent, and the oldest batch is
+	// dropped when a new one is built with the queue full, i.e. the endpoint is slow.
+	MetricRemoteWriteQueueSize int
+
+	// MetricMinWriteIntervals is the min interval between writes of each metric, map[metricName]interval,
+	// and a write is skipped if the value is unchanged and the stored one was collected within the interval.
+	// Metrics not in it are written in each cycle.
+	MetricMinWriteIntervals map[string]time.Duration
+
+	// MalachiteCgroupStatsParser selects the parser of cgroup stats responses by the name it's registered with,
+	// so that response formats of other malachite versions or forks can be supported.
+	MalachiteCgroupStatsParser string
+
+	// DerivedMetricCycleIntervals makes expensive derived metrics calculated every N sampling cycles rather than every
+	// cycle, map[metricName]N, and the last values are kept between calculations. It's supported by memory bandwidth
+	// anomaly (whose baseline is sampled only when it's calculated), weighted memory bandwidth cost and sched latency
+	// percentiles. Metrics not in it or with N not greater than 1 are calculated in each cycle.
+	DerivedMetricCycleIntervals map[string]int
+
+	// MemBandwidthSharedCgroupPolicy decides how memory bandwidth is attributed if multiple containers of a pod
+	// are reported with the same cgroup, and MemBandwidthSharedCgroupPolicyNamed is used if it's empty.
+	MemBandwidthSharedCgroupPolicy string
+
+	// MemBandwidthTrendWindow is the window of total memory bandwidth samples of a container retained to
+	// fit the linear trend, and the trend is skipped until enough samples are retained. It's disabled if zero.
+	MemBandwidthTrendWindow time.Duration
+
+	// MemBandwidthTrendMinSlope is the minimum absolute slope of the fitted bandwidth trend, in the unit of
+	// MemBandwidthUnit per second per second, for the trend to be regarded as rising or falling rather than flat.
+	MemBandwidthTrendMinSlope float64
+}
+
+func NewMetricConfiguration() *MetricConfiguration {
+	return &MetricConfiguration{}
+}
+
+// metricConfigurationValidators validate settings parsed by packages depending on this one,
+// i.e. the unit and rounding of metric store, which can't be checked here without import cycles.
+var metricConfigurationValidators []func(c *MetricConfiguration) error
+
+// RegisterMetricConfigurationValidator registers a validator called by Validate,
+// and it should only be called in init.
+func RegisterMetricConfigurationValidator(validator func(c *MetricConfiguration) error) {
+	metricConfigurationValidators = append(metricConfigurationValidators, validator)
+}
+
+var (
+	malachiteCgroupStatsParserLock sync.RWMutex
+	// malachiteCgroupStatsParsers are names of the parsers can be selected by MalachiteCgroupStatsParser
+	malachiteCgroupStatsParsers = map[string]bool{MalachiteCgroupStatsParserDefault: true}
+)
+
+// RegisterMalachiteCgroupStatsParserName makes the name of a parser of cgroup stats valid for
+// MalachiteCgroupStatsParser, and it's called when the parser is registered.
+func RegisterMalachiteCgroupStatsParserName(name string) {
+	malachiteCgroupStatsParserLock.Lock()
+	defer malachiteCgroupStatsParserLock.Unlock()
+	malachiteCgroupStatsParsers[name] = true
+}
+
+func isMalachiteCgroupStatsParserRegistered(name string) bool {
+	malachiteCgroupStatsParserLock.RLock()
+	defer malachiteCgroupStatsParserLock.RUnlock()
+	return malachiteCgroupStatsParsers[name]
+}
+
+// Validate checks the configuration, and it's shared by both the configuration parsed from flags
+// at startup and those updated at runtime, so that no invalid configuration can be activated.
+func (c *MetricConfiguration) Validate() error {
+	switch c.MemBandwidthNumaAttribution {
+	case "", MemBandwidthNumaAttributionCPUBinding, MemBandwidthNumaAttributionAccessCounter:
+	default:
+		return fmt.Errorf("invalid metric-mem-bandwidth-numa-attribution %q", c.MemBandwidthNumaAttribution)
+	}
+
+	if c.MemChannelCount < 0 || c.MemChannelPeakBandwidth < 0 {
+		return fmt.Errorf("invalid memory channel count %v or peak bandwidth %v", c.MemChannelCount, c.MemChannelPeakBandwidth)
+	}
+
+	if c.MemBandwidthReplayCycles < 0 {
+		return fmt.Errorf("invalid metric-mem-bandwidth-replay-cycles %v", c.MemBandwidthReplayCycles)
+	}
+
+	switch c.UnknownSchemaVersionPolicy {
+	case "", UnknownSchemaVersionPolicyWarn, UnknownSchemaVersionPolicyHold:
+	default:
+		return fmt.Errorf("invalid metric-unknown-schema-version-policy %q", c.UnknownSchemaVersionPolicy)
+	}
+
+	if c.MetricStoreMaxKeys < 0 {
+		return fmt.Errorf("invalid metric-store-max-keys %v", c.MetricStoreMaxKeys)
+	}
+
+	if c.RateSmoothedInterval < 0 {
+		return fmt.Errorf("invalid metric-rate-smoothed-interval %v", c.RateSmoothedInterval)
+	}
+
+	if c.MemBandwidthAnomalyBaselineCycles < 0 {
+		return fmt.Errorf("invalid metric-mem-bandwidth-anomaly-baseline-cycles %v", c.MemBandwidthAnomalyBaselineCycles)
+	}
+
+	for _, version := range c.CgroupVersionAllowList {
+		if version != CgroupVersionV1 && version != CgroupVersionV2 {
+			return fmt.Errorf("invalid cgroup version %q in metric-cgroup-version-allow-list", version)
+		}
+	}
+
+	if c.RateWarmUpPeriod < 0 {
+		return fmt.Errorf("invalid metric-rate-warm-up-period %v", c.RateWarmUpPeriod)
+	}
+
+	if _, err := labels.Parse(c.MemBandwidthNodeExcludedPodSelector); err != nil {
+		return fmt.Errorf("invalid metric-mem-bandwidth-node-excluded-pod-selector: %v", err)
+	}
+
+	if c.MemBandwidthNodeIdleFloor < 0 {
+		return fmt.Errorf("invalid metric-mem-bandwidth-node-idle-floor %v", c.MemBandwidthNodeIdleFloor)
+	}
+
+	if c.RateClockJumpFactor != 0 && c.RateClockJumpFactor <= 1 {
+		return fmt.Errorf("invalid metric-rate-clock-jump-factor %v", c.RateClockJumpFactor)
+	}
+
+	for i := 1; i < len(c.MemBandwidthPressureClassBands); i++ {
+		if c.MemBandwidthPressureClassBands[i] <= c.MemBandwidthPressureClassBands[i-1] {
+			return fmt.Errorf("invalid metric-mem-bandwidth-pressure-class-bands %v: not ascending", c.MemBandwidthPressureClassBands)
+		}
+	}
+
+	if c.SampleInterval < 0 {
+		return fmt.Errorf("invalid metric-sample-interval %v", c.SampleInterval)
+	}
+
+	for i := 1; i < len(c.MemBandwidthHistogramBuckets); i++ {
+		if c.MemBandwidthHistogramBuckets[i] <= c.MemBandwidthHistogramBuckets[i-1] {
+			return fmt.Errorf("invalid metric-mem-bandwidth-histogram-buckets %v: not ascending", c.MemBandwidthHistogramBuckets)
+		}
+	}
+
+	if c.MemBandwidthNodeDecayFactor < 0 || c.MemBandwidthNodeDecayFactor >= 1 {
+		return fmt.Errorf("invalid metric-mem-bandwidth-node-decay-factor %v", c.MemBandwidthNodeDecayFactor)
+	}
+
+	if c.MetricRemoteWriteInterval < 0 || (c.MetricRemoteWriteURL != "" && c.MetricRemoteWriteInterval == 0) {
+		return fmt.Errorf("invalid metric-remote-write-interval %v", c.MetricRemoteWriteInterval)
+	}
+	if c.MetricRemoteWriteQueueSize < 0 || (c.MetricRemoteWriteURL != "" && c.MetricRemoteWriteQueueSize == 0) {
+		return fmt.Errorf("invalid metric-remote-write-queue-size %v", c.MetricRemoteWriteQueueSize)
+	}
+
+	for metricName, interval := range c.MetricMinWriteIntervals {
+		if interval < 0 {
+			return fmt.Errorf("invalid metric-min-write-intervals %v for %v", interval, metricName)
+		}
+	}
+
+	switch c.MemBandwidthSharedCgroupPolicy {
+	case "", MemBandwidthSharedCgroupPolicyNamed, MemBandwidthSharedCgroupPolicyPrimary,
+		MemBandwidthSharedCgroupPolicySplitByCPU:
+	default:
+		return fmt.Errorf("invalid metric-mem-bandwidth-shared-cgroup-policy %q", c.MemBandwidthSharedCgroupPolicy)
+	}
+
+	if c.MemBandwidthTrendWindow < 0 {
+		return fmt.Errorf("invalid metric-mem-bandwidth-trend-window %v", c.MemBandwidthTrendWindow)
+	}
+
+	if c.MemBandwidthTrendMinSlope < 0 {
+		return fmt.Errorf("invalid metric-mem-bandwidth-trend-min-slope %v", c.MemBandwidthTrendMinSlope)
+	}
+
+	for metricName, strategy := range c.CounterDeltaStrategies {
+		switch strategy {
+		case CounterDeltaStrategySaturating, CounterDeltaStrategyResetAsZero,
+			CounterDeltaStrategyWrap48, CounterDeltaStrategyWrap64:
+		default:
+			return fmt.Errorf("invalid metric-counter-delta-strategies %q for %v", strategy, metricName)
+		}
+	}
+
+	if c.MalachiteCgroupStatsParser != "" && !isMalachiteCgroupStatsParserRegistered(c.MalachiteCgroupStatsParser) {
+		return fmt.Errorf("invalid metric-malachite-cgroup-stats-parser %q", c.MalachiteCgroupStatsParser)
+	}
+
+	for _, validator := range metricConfigurationValidators {
+		if err := validator(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
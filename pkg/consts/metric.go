@@ -48,6 +48,33 @@ const (
 	MetricMemSlabReclaimableSystem = "mem.slab.reclaimable.system"
 
 	MetricMemScaleFactorSystem = "mem.scale.factor.system"
+
+	// MetricMemChannelsUtilizedSystem is the node bandwidth expressed in the number of memory
+	// channels running at peak bandwidth, assuming bandwidth is evenly distributed among channels
+	MetricMemChannelsUtilizedSystem = "mem.channels.utilized.system"
+
+	// MetricMemBandwidthHeadroomNode is the node bandwidth remained before all memory
+	// channels run at peak bandwidth, in the configured memory bandwidth unit
+	MetricMemBandwidthHeadroomNode = "mem.bandwidth.headroom.node"
+
+	// MetricMemBandwidthTenantNode is the sum of read and write bandwidth of containers in the node,
+	// except for those configured to be excluded, in the configured memory bandwidth unit
+	MetricMemBandwidthTenantNode = "mem.bandwidth.tenant.node"
+
+	// MetricMemBandwidthDecayedNode is the tenant bandwidth of the node with exponential decay across cycles,
+	// which follows increases immediately but decreases smoothly, in the configured memory bandwidth unit
+	MetricMemBandwidthDecayedNode = "mem.bandwidth.decayed.node"
+
+	// MetricMemBandwidthHistogramNode is the histogram of total memory bandwidth of containers in the node,
+	// and it's only computed on export as "_bucket", "_sum" and "_count" series instead of being stored
+	MetricMemBandwidthHistogramNode = "mem.bandwidth.histogram.node"
+)
+
+// Workload memory metrics, which are aggregated from containers of pods with the same workload identity
+const (
+	// MetricMemBandwidthReadWorkload is the sum of read bandwidth of containers in the workload,
+	// in the configured memory bandwidth unit
+	MetricMemBandwidthReadWorkload = "mem.bandwidth.read.workload"
 )
 
 // System blkio metrics
@@ -80,11 +107,36 @@ const (
 	MetricMemLatencyWriteNuma = "mem.latency.write.numa"
 )
 
+// System socket metrics
+const (
+	MetricMemLocalDRAMReadsSocket  = "mem.local.drams.socket"
+	MetricMemRemoteDRAMReadsSocket = "mem.remote.drams.socket"
+
+	MetricMemBandwidthLocalSocket  = "mem.bandwidth.local.socket"
+	MetricMemBandwidthRemoteSocket = "mem.bandwidth.remote.socket"
+
+	// MetricEnergyCounterSocket is the accumulated package energy of the socket in microjoules,
+	// and MetricEnergyJoulesSocket is the energy consumed per second, i.e. power in watts
+	MetricEnergyCounterSocket = "energy.counter.socket"
+	MetricEnergyJoulesSocket  = "energy.joules.socket"
+)
+
 // System cpu compute metrics
 const (
 	MetricCPUSchedwait   = "cpu.schedwait.cpu"
 	MetricCPUUsageRatio  = "cpu.usage.ratio.cpu"
 	MetricCPUIOWaitRatio = "cpu.iowait.ratio.cpu"
+
+	// MetricCPUFrequencyCPU is the current frequency (in MHz) of the cpu, and MetricCPUFrequencyNode is the
+	// average of all cpus reporting it, which are only reported on hosts exposing cpufreq
+	MetricCPUFrequencyCPU  = "cpu.frequency.cpu"
+	MetricCPUFrequencyNode = "cpu.frequency.node"
+)
+
+// System cpu steal metrics
+const (
+	MetricCPUStealTimeNode = "cpu.steal.time.node"
+	MetricCPUStealNode     = "cpu.steal.node"
 )
 
 // container cpu metrics
@@ -115,10 +167,40 @@ const (
 	MetricStoreInsContainer     = "cpu.store.ins.container"
 
 	MetricCPUUpdateTimeContainer = "cpu.updatetime.container"
+	// MetricCPUMonotonicTimeContainer is the boot-relative nanoseconds when cpu counters are sampled
+	MetricCPUMonotonicTimeContainer = "cpu.monotonictime.container"
+	// MetricCPUUpdateTimeNanoContainer is the unix nanoseconds when cpu counters are sampled, and it's
+	// only precise to sub-microseconds since it's stored as float64
+	MetricCPUUpdateTimeNanoContainer = "cpu.updatetime.nano.container"
+
+	// MetricCPUContentionContainer is 1 if both cpu pressure and throttling ratio of the container
+	// are elevated, which indicates genuine contention rather than self-imposed idling, otherwise 0
+	MetricCPUContentionContainer = "cpu.contention.container"
+
+	// MetricCPUWeightContainer is the cpu weight of the container in the range of cgroup v2 cpu.weight
+	// [1, 10000], and cpu.shares of cgroup v1 is converted into this range to keep the same scale
+	MetricCPUWeightContainer = "cpu.weight.container"
+
+	// MetricCPUThrottleToUsageRatioContainer is throttled time rate / (usage rate + throttled time rate)
+	// of the container, and high value means the container wants more cpu than its quota allows
+	MetricCPUThrottleToUsageRatioContainer = "cpu.throttle.usage.ratio.container"
+
+	// MetricSchedLatencyP50Container and MetricSchedLatencyP99Container are percentiles (in nanoseconds) of
+	// the runqueue wait of tasks in the container, which are only reported if schedstats are enabled
+	MetricSchedLatencyP50Container = "cpu.sched.latency.p50.container"
+	MetricSchedLatencyP99Container = "cpu.sched.latency.p99.container"
+
+	// MetricCounterStalenessContainer is the seconds since any cumulative counter of the container advanced
+	// last time, and it grows if counters stay flat though they are updated, e.g. idle or broken counters
+	MetricCounterStalenessContainer = "counter.staleness.container"
+
+	// MetricCgroupFrozenContainer is 1 if the cgroup of the container is frozen, in which counters won't advance
+	MetricCgroupFrozenContainer = "cgroup.frozen.container"
 )
 
 // container memory metrics
 const (
+	// MetricMemLimitContainer is not stored for containers without memory limit
 	MetricMemLimitContainer     = "mem.limit.container"
 	MetricMemTCPLimitContainer  = "mem.tcp.limit.container"
 	MetricMemUsageContainer     = "mem.usage.container"
@@ -135,11 +217,83 @@ const (
 	MetricMemAllocstallContainer  = "mem.allocstall.container"
 	MetricMemKswapdstealContainer = "mem.kswapdstall.container"
 
+	// MetricPageFaultRateContainer and MetricMajorPageFaultRateContainer are page faults per second
+	MetricPageFaultRateContainer      = "mem.pgfault.rate.container"
+	MetricMajorPageFaultRateContainer = "mem.pgmajfault.rate.container"
+
 	MetricMemOomContainer         = "mem.oom.container"
 	MetricMemScaleFactorContainer = "mem.scalefactor.container"
 
+	// MetricOOMKillRateContainer is the number of oom kills per second derived from MetricMemOomContainer
+	MetricOOMKillRateContainer = "mem.oom.kill.rate.container"
+
+	// MetricSwapUsageContainer is the swap usage in bytes of the container, the count metrics are the cumulative
+	// numbers of pages swapped in and out, and the rate metrics are the number of them per second
+	MetricSwapUsageContainer    = "mem.swap.usage.container"
+	MetricSwapInCountContainer  = "mem.swap.in.count.container"
+	MetricSwapOutCountContainer = "mem.swap.out.count.container"
+	MetricSwapInRateContainer   = "mem.swap.in.rate.container"
+	MetricSwapOutRateContainer  = "mem.swap.out.rate.container"
+
+	MetricMemUtilizationContainer = "mem.utilization.container"
+	MetricMemWorkingSetContainer  = "mem.workingset.container"
+
 	MetricMemBandwidthReadContainer  = "mem.bandwidth.read.container"
 	MetricMemBandwidthWriteContainer = "mem.bandwidth.write.container"
+	MetricMemBandwidthLimitContainer = "mem.bandwidth.limit.container"
+
+	// MetricMemBandwidthIntensityContainer is the total memory bandwidth (in bytes/s) per byte of working set
+	MetricMemBandwidthIntensityContainer = "mem.bandwidth.intensity.container"
+
+	// MetricBandwidthPerInstructionContainer is the memory traffic (in bytes) per instruction retired,
+	// and high values indicate streaming or memory-bound code
+	MetricBandwidthPerInstructionContainer = "mem.bandwidth.per.instruction.container"
+
+	// MetricMemBandwidthAnomalyContainer is the total memory bandwidth relative to the median of
+	// the container's bandwidth in the last cycles, i.e. 2.5 means 2.5x its typical bandwidth
+	MetricMemBandwidthAnomalyContainer = "mem.bandwidth.anomaly.container"
+
+	// MetricMemBandwidthTrendContainer is the direction of the linear trend of the container's total memory
+	// bandwidth in the retained window, i.e. 1 for rising, -1 for falling and 0 for flat
+	MetricMemBandwidthTrendContainer = "mem.bandwidth.trend.container"
+
+	// MetricMemBandwidthUtilizationContainer is the total memory bandwidth of the container
+	// relative to the peak bandwidth of all memory channels in the node
+	MetricMemBandwidthUtilizationContainer = "mem.bandwidth.utilization.container"
+
+	// MetricMemBandwidthPressureClassContainer is the discrete level of bandwidth utilization of the
+	// container classified by the configured bands, from 0 (lowest) to the number of bands (highest)
+	MetricMemBandwidthPressureClassContainer = "mem.bandwidth.pressure.class.container"
+
+	// MetricMemBandwidthShareContainer is the total memory bandwidth of the container relative
+	// to the sum of all containers in the node, from 0 to 1
+	MetricMemBandwidthShareContainer = "mem.bandwidth.share.container"
+
+	// MetricEnergyJoulesContainer is the estimated power of the container in watts, i.e. power of all
+	// sockets attributed to containers by their cpu usage
+	MetricEnergyJoulesContainer = "energy.joules.container"
+
+	// MetricMemBandwidthWeightedCostContainer is the read bandwidth of the container weighted by the
+	// distance from numa nodes of its cpus to numa nodes accessed, relative to the local distance, so
+	// it equals to the read bandwidth if all accesses are local, and grows with remote accesses
+	MetricMemBandwidthWeightedCostContainer = "mem.bandwidth.weighted.cost.container"
+
+	// MetricMemRemoteReadRatioContainer is the share of read bandwidth of the container from numa nodes
+	// other than those of its cpus, from 0 (all local) to 1 (all remote). Write bandwidth is excluded
+	// since it's not attributed to numa nodes.
+	MetricMemRemoteReadRatioContainer = "mem.remote.read.ratio.container"
+)
+
+// container pids metrics
+const (
+	MetricThreadCountContainer = "pids.current.container"
+)
+
+// container hugetlb metrics
+const (
+	// MetricHugePageUsageContainer is keyed by page size, and the metric
+	// name is suffixed with it, e.g. hugepage.usage.container.2Mi
+	MetricHugePageUsageContainer = "hugepage.usage.container"
 )
 
 // container blkio metrics
@@ -150,6 +304,25 @@ const (
 	MetricBlkioWriteBpsContainer  = "blkio.write.bps.container"
 
 	MetricBlkioUpdateTimeContainer = "blkio.updatetime.container"
+
+	// MetricIOLimitReadBpsContainer and other io limit metrics are the throttle configured for the container
+	// (blkio.throttle.* on cgroup v1 and io.max on cgroup v2), which are keyed by device and suffixed with
+	// its major:minor number, e.g. io.limit.read.bps.container.8:16, and 0 means no limit. Since 0 is also the
+	// value of a missing sample, readers should check the metric exists (with its time) before treating 0 as
+	// no limit, and limits of devices whose throttles are removed are set to 0 as well.
+	MetricIOLimitReadBpsContainer   = "io.limit.read.bps.container"
+	MetricIOLimitWriteBpsContainer  = "io.limit.write.bps.container"
+	MetricIOLimitReadIopsContainer  = "io.limit.read.iops.container"
+	MetricIOLimitWriteIopsContainer = "io.limit.write.iops.container"
+
+	// MetricIOPressureSomeContainer and MetricIOPressureFullContainer are avg10 of io pressure
+	// "some" and "full" of the container in percentage, and they are only reported on cgroup v2
+	MetricIOPressureSomeContainer       = "io.pressure.some.container"
+	MetricIOPressureSomeAvg60Container  = "io.pressure.some.avg60.container"
+	MetricIOPressureSomeAvg300Container = "io.pressure.some.avg300.container"
+	MetricIOPressureFullContainer       = "io.pressure.full.container"
+	MetricIOPressureFullAvg60Container  = "io.pressure.full.avg60.container"
+	MetricIOPressureFullAvg300Container = "io.pressure.full.avg300.container"
 )
 
 // container net metrics
@@ -160,6 +333,13 @@ const (
 	MetricNetTcpRecvPpsContainer  = "net.tcp.recv.pps.container"
 )
 
+// metrics in self namespace describe the collection of the fetcher itself rather than workloads
+const (
+	// MetricRateSkipCountContainer is the cumulative number of samples of the container skipped in rate
+	// calculations for not being updated by source, i.e. the update time doesn't advance.
+	MetricRateSkipCountContainer = "self.rate.skip.count.container"
+)
+
 // container perf metrics
 const (
 	MetricCPUCPIContainer          = "cpu.cpi.container"
@@ -168,6 +348,12 @@ const (
 	MetricCPUICacheMissContainer   = "cpu.icachemiss.container"
 	MetricCPUL2CacheMissContainer  = "cpu.l2cachemiss.container"
 	MetricCPUL3CacheMissContainer  = "cpu.l3cachemiss.container"
+
+	// MetricPageWalkCyclesContainer is the rate of dtlb and itlb page-walk cycles, and
+	// MetricPageWalkRatioContainer is the ratio of page-walk cycles to total cycles
+	MetricPageWalkCyclesContainer        = "cpu.pagewalk.cycles.container"
+	MetricPageWalkRatioContainer         = "cpu.pagewalk.ratio.container"
+	MetricPageWalkCyclesCounterContainer = "cpu.pagewalk.cycles.counter.container"
 )
 
 // container per numa metrics
@@ -175,6 +361,9 @@ const (
 	MetricsMemTotalPerNumaContainer = "mem.total.numa.container"
 	MetricsMemFilePerNumaContainer  = "mem.file.numa.container"
 	MetricsMemAnonPerNumaContainer  = "mem.anon.numa.container"
+
+	MetricsOCRReadDRAMsPerNumaContainer     = "cpu.read.drams.numa.container"
+	MetricsMemBandwidthReadPerNumaContainer = "mem.bandwidth.read.numa.container"
 )
 
 // Cgroup cpu metrics
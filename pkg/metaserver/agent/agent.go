@@ -93,7 +93,10 @@ func NewMetaAgent(conf *config.Configuration, clientSet *client.GenericClientSet
 	}
 
 	if conf.EnableMetricsFetcher {
-		metaAgent.MetricsFetcher = malachite.NewMalachiteMetricsFetcher(emitter, metaAgent, conf)
+		metricsFetcher := malachite.NewMalachiteMetricsFetcher(emitter, metaAgent, conf).(*malachite.MalachiteMetricsFetcher)
+		metricsFetcher.SetMachineInfo(machineInfo)
+		metricsFetcher.SetNodeFetcher(metaAgent.NodeFetcher)
+		metaAgent.MetricsFetcher = metricsFetcher
 	} else {
 		metaAgent.MetricsFetcher = metric.NewFakeMetricsFetcher(emitter)
 	}
@@ -32,9 +32,12 @@ package metric
 
 import (
 	"context"
+	"fmt"
 	"sync"
+	"time"
 
 	v1 "k8s.io/api/core/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 
 	"github.com/kubewharf/katalyst-core/pkg/metrics"
 	"github.com/kubewharf/katalyst-core/pkg/util/machine"
@@ -45,6 +48,7 @@ import (
 func NewFakeMetricsFetcher(emitter metrics.MetricEmitter) MetricsFetcher {
 	return &FakeMetricsFetcher{
 		metricStore: metric.NewMetricStore(),
+		namedStores: make(map[string]*metric.MetricStore),
 		emitter:     emitter,
 		hasSynced:   true,
 	}
@@ -56,6 +60,9 @@ type FakeMetricsFetcher struct {
 	emitter          metrics.MetricEmitter
 	registeredMetric []func(store *metric.MetricStore)
 
+	namedStores           map[string]*metric.MetricStore
+	registeredStoreMetric map[string][]func(store *metric.MetricStore)
+
 	hasSynced bool
 }
 
@@ -65,6 +72,11 @@ func (f *FakeMetricsFetcher) Run(ctx context.Context) {
 	for _, fu := range f.registeredMetric {
 		fu(f.metricStore)
 	}
+	for storeName, fus := range f.registeredStoreMetric {
+		for _, fu := range fus {
+			fu(f.namedStores[storeName])
+		}
+	}
 }
 
 func (f *FakeMetricsFetcher) SetSynced(synced bool) {
@@ -87,10 +99,66 @@ func (f *FakeMetricsFetcher) RegisterExternalMetric(fu func(store *metric.Metric
 	f.registeredMetric = append(f.registeredMetric, fu)
 }
 
+func (f *FakeMetricsFetcher) RegisterExternalMetricToStore(storeName string, fu func(store *metric.MetricStore)) {
+	if storeName == "" || storeName == DefaultMetricStoreName {
+		f.RegisterExternalMetric(fu)
+		return
+	}
+
+	f.Lock()
+	defer f.Unlock()
+	if _, ok := f.namedStores[storeName]; !ok {
+		f.namedStores[storeName] = metric.NewMetricStore()
+	}
+	if f.registeredStoreMetric == nil {
+		f.registeredStoreMetric = make(map[string][]func(store *metric.MetricStore))
+	}
+	f.registeredStoreMetric[storeName] = append(f.registeredStoreMetric[storeName], fu)
+}
+
+func (f *FakeMetricsFetcher) IngestContainerMetrics(provider string, samples []ExternalContainerMetric) error {
+	var errs []error
+	now := time.Now()
+	for _, sample := range samples {
+		if err := sample.Validate(); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		t := sample.Time
+		if t.IsZero() {
+			t = now
+		}
+		f.metricStore.SetContainerMetric(sample.PodUID, sample.ContainerName, sample.MetricName, metric.MetricData{Value: sample.Value, Time: &t})
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+func (f *FakeMetricsFetcher) GetMetricStore(storeName string) (*metric.MetricStore, error) {
+	if storeName == "" || storeName == DefaultMetricStoreName {
+		return f.metricStore, nil
+	}
+
+	f.RLock()
+	defer f.RUnlock()
+	if store, ok := f.namedStores[storeName]; ok {
+		return store, nil
+	}
+	return nil, fmt.Errorf("metric store %v not found", storeName)
+}
+
+func (f *FakeMetricsFetcher) ResetContainerMetricBaseline(podUID, containerName, metricName string) {}
+
+func (f *FakeMetricsFetcher) Close() {}
+
 func (f *FakeMetricsFetcher) GetNodeMetric(metricName string) (metric.MetricData, error) {
 	return f.metricStore.GetNodeMetric(metricName)
 }
 
+func (f *FakeMetricsFetcher) GetNodeMetricSeries(metricName string, window time.Duration) []metric.MetricData {
+	return f.metricStore.GetNodeMetricSeries(metricName, window)
+}
+
 func (f *FakeMetricsFetcher) GetNumaMetric(numaID int, metricName string) (metric.MetricData, error) {
 	return f.metricStore.GetNumaMetric(numaID, metricName)
 }
@@ -103,10 +171,22 @@ func (f *FakeMetricsFetcher) GetCPUMetric(coreID int, metricName string) (metric
 	return f.metricStore.GetCPUMetric(coreID, metricName)
 }
 
+func (f *FakeMetricsFetcher) GetSocketMetric(socketID int, metricName string) (metric.MetricData, error) {
+	return f.metricStore.GetSocketMetric(socketID, metricName)
+}
+
 func (f *FakeMetricsFetcher) GetContainerMetric(podUID, containerName, metricName string) (metric.MetricData, error) {
 	return f.metricStore.GetContainerMetric(podUID, containerName, metricName)
 }
 
+func (f *FakeMetricsFetcher) GetPodContainerMetrics(podUID, metricName string, maxAge time.Duration) map[string]metric.MetricData {
+	return f.metricStore.GetPodContainerMetrics(podUID, metricName, maxAge)
+}
+
+func (f *FakeMetricsFetcher) GetMetricUnit(metricName string) (string, error) {
+	return f.metricStore.GetMetricUnit(metricName)
+}
+
 func (f *FakeMetricsFetcher) GetContainerNumaMetric(podUID, containerName, numaNode, metricName string) (metric.MetricData, error) {
 	return f.metricStore.GetContainerNumaMetric(podUID, containerName, numaNode, metricName)
 }
@@ -123,6 +203,10 @@ func (f *FakeMetricsFetcher) SetCPUMetric(cpu int, metricName string, data metri
 	f.metricStore.SetCPUMetric(cpu, metricName, data)
 }
 
+func (f *FakeMetricsFetcher) SetSocketMetric(socketID int, metricName string, data metric.MetricData) {
+	f.metricStore.SetSocketMetric(socketID, metricName, data)
+}
+
 func (f *FakeMetricsFetcher) SetDeviceMetric(deviceName string, metricName string, data metric.MetricData) {
 	f.metricStore.SetDeviceMetric(deviceName, metricName, data)
 }
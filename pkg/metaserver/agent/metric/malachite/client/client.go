@@ -51,6 +51,8 @@ type MalachiteClient struct {
 	relativePathFunc *func(podUID, containerId string) (string, error)
 
 	fetcher pod.PodFetcher
+
+	cgroupStatsParser CgroupStatsParser
 }
 
 func NewMalachiteClient(fetcher pod.PodFetcher) *MalachiteClient {
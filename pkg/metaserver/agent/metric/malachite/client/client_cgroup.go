@@ -17,7 +17,6 @@ limitations under the License.
 package client
 
 import (
-	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -31,54 +30,7 @@ func (c *MalachiteClient) GetCgroupStats(cgroupPath string) (*types.MalachiteCgr
 		return nil, err
 	}
 
-	rsp := &types.MalachiteCgroupResponse{}
-	if err := json.Unmarshal(cgroupStatsRaw, rsp); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal cgroup status raw data, err %s", err)
-	}
-
-	if rsp.Status != 0 {
-		return nil, fmt.Errorf("cgroup %s stats status is not ok, %d", cgroupPath, rsp.Status)
-	}
-
-	cgroupInfo := &types.MalachiteCgroupInfo{
-		MountPoint: rsp.Data.MountPoint,
-		UserPath:   rsp.Data.UserPath,
-		CgroupType: rsp.Data.CgroupType,
-	}
-
-	if cgroupInfo.CgroupType == "V1" {
-		subsysV1 := &types.SubSystemGroupsV1{}
-		if err := json.Unmarshal(rsp.Data.SubSystemGroups, subsysV1); err != nil {
-			return nil, fmt.Errorf("failed to Unmarshal cgroup v1 info, err %s", err)
-		}
-		cgV1 := &types.MalachiteCgroupV1Info{
-			Memory:    &subsysV1.Memory.V1.MemoryV1Data,
-			Blkio:     &subsysV1.Blkio.V1.BlkIOData,
-			Cpu:       &subsysV1.Cpuacct.V1.CPUData,
-			CpuSet:    &subsysV1.Cpuset.V1.CPUSetData,
-			PerfEvent: &subsysV1.PerfEvent.PerfEventData,
-			NetCls:    &subsysV1.NetCls.NetData,
-		}
-		cgroupInfo.V1 = cgV1
-	} else if cgroupInfo.CgroupType == "V2" {
-		subsysV2 := &types.SubSystemGroupsV2{}
-		if err := json.Unmarshal(rsp.Data.SubSystemGroups, subsysV2); err != nil {
-			return nil, fmt.Errorf("failed to Unmarshal cgroup v2 info, err %s", err)
-		}
-		cgV2 := &types.MalachiteCgroupV2Info{
-			Memory:    &subsysV2.Memory.V2.MemoryData,
-			Blkio:     &subsysV2.Blkio.V2.BlkIOData,
-			Cpu:       &subsysV2.Cpuacct.V2.CPUData,
-			CpuSet:    &subsysV2.Cpuset.V2.CPUSetData,
-			PerfEvent: &subsysV2.PerfEvent.PerfEventData,
-			NetCls:    &subsysV2.NetCls.NetData,
-		}
-		cgroupInfo.V2 = cgV2
-	} else {
-		return nil, fmt.Errorf("unknow cgroup type %s in cgroup info", cgroupInfo.CgroupType)
-	}
-
-	return cgroupInfo, nil
+	return c.getCgroupStatsParser().ParseCgroupStats(cgroupPath, cgroupStatsRaw)
 }
 
 func (c *MalachiteClient) getCgroupStats(cgroupPath string) ([]byte, error) {
@@ -0,0 +1,160 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	globalconfig "github.com/kubewharf/katalyst-core/pkg/config/agent/global"
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/metric/malachite/types"
+)
+
+// CgroupStatsParser parses the raw response of cgroup stats returned by malachite, and it can be
+// replaced to support response formats of other malachite versions or forks.
+type CgroupStatsParser interface {
+	ParseCgroupStats(cgroupPath string, raw []byte) (*types.MalachiteCgroupInfo, error)
+}
+
+// CgroupStatsParserFunc is an adapter to use ordinary functions as CgroupStatsParser
+type CgroupStatsParserFunc func(cgroupPath string, raw []byte) (*types.MalachiteCgroupInfo, error)
+
+func (f CgroupStatsParserFunc) ParseCgroupStats(cgroupPath string, raw []byte) (*types.MalachiteCgroupInfo, error) {
+	return f(cgroupPath, raw)
+}
+
+// DefaultCgroupStatsParser is the name of the parser for the response format of upstream malachite
+const DefaultCgroupStatsParser = globalconfig.MalachiteCgroupStatsParserDefault
+
+var (
+	cgroupStatsParserLock sync.RWMutex
+	// cgroupStatsParsers are parsers can be selected by name in configuration
+	cgroupStatsParsers = map[string]CgroupStatsParser{
+		DefaultCgroupStatsParser: CgroupStatsParserFunc(parseCgroupStats),
+	}
+)
+
+// RegisterCgroupStatsParser registers the parser with the given name, and the existing one with
+// the same name is replaced. The name is also made valid for the configuration to select it.
+func RegisterCgroupStatsParser(name string, parser CgroupStatsParser) {
+	cgroupStatsParserLock.Lock()
+	defer cgroupStatsParserLock.Unlock()
+	cgroupStatsParsers[name] = parser
+	globalconfig.RegisterMalachiteCgroupStatsParserName(name)
+}
+
+// GetCgroupStatsParser returns the registered parser with the given name
+func GetCgroupStatsParser(name string) (CgroupStatsParser, error) {
+	cgroupStatsParserLock.RLock()
+	defer cgroupStatsParserLock.RUnlock()
+
+	parser, ok := cgroupStatsParsers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown cgroup stats parser %q", name)
+	}
+	return parser, nil
+}
+
+// SetCgroupStatsParser sets the parser of cgroup stats, and the default one is used if it's nil
+func (c *MalachiteClient) SetCgroupStatsParser(parser CgroupStatsParser) {
+	c.Lock()
+	defer c.Unlock()
+	c.cgroupStatsParser = parser
+}
+
+func (c *MalachiteClient) getCgroupStatsParser() CgroupStatsParser {
+	c.RLock()
+	defer c.RUnlock()
+
+	if c.cgroupStatsParser == nil {
+		return CgroupStatsParserFunc(parseCgroupStats)
+	}
+	return c.cgroupStatsParser
+}
+
+// parseCgroupStats parses the response format of upstream malachite
+func parseCgroupStats(cgroupPath string, raw []byte) (*types.MalachiteCgroupInfo, error) {
+	rsp := &types.MalachiteCgroupResponse{}
+	if err := json.Unmarshal(raw, rsp); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal cgroup status raw data, err %s", err)
+	}
+
+	if rsp.Status != 0 {
+		return nil, fmt.Errorf("cgroup %s stats status is not ok, %d", cgroupPath, rsp.Status)
+	}
+
+	cgroupInfo := &types.MalachiteCgroupInfo{
+		MountPoint: rsp.Data.MountPoint,
+		UserPath:   rsp.Data.UserPath,
+		// cgroup type is matched case-insensitively, since it's reported in lowercase by some malachite versions
+		CgroupType: strings.ToUpper(strings.TrimSpace(rsp.Data.CgroupType)),
+	}
+
+	if cgroupInfo.CgroupType == "V1" {
+		subsysV1 := &types.SubSystemGroupsV1{}
+		if err := json.Unmarshal(rsp.Data.SubSystemGroups, subsysV1); err != nil {
+			return nil, fmt.Errorf("failed to Unmarshal cgroup v1 info, err %s", err)
+		}
+		cgV1 := &types.MalachiteCgroupV1Info{
+			Memory:    &subsysV1.Memory.V1.MemoryV1Data,
+			Blkio:     &subsysV1.Blkio.V1.BlkIOData,
+			Cpu:       &subsysV1.Cpuacct.V1.CPUData,
+			CpuSet:    &subsysV1.Cpuset.V1.CPUSetData,
+			PerfEvent: &subsysV1.PerfEvent.PerfEventData,
+			NetCls:    &subsysV1.NetCls.NetData,
+		}
+		if subsysV1.Pids != nil {
+			cgV1.Pids = &subsysV1.Pids.V1.PidsData
+		}
+		if subsysV1.Hugetlb != nil {
+			cgV1.Hugetlb = &subsysV1.Hugetlb.V1.HugetlbData
+		}
+		if subsysV1.Freezer != nil {
+			cgV1.Freezer = &subsysV1.Freezer.V1.FreezerData
+		}
+		cgroupInfo.V1 = cgV1
+	} else if cgroupInfo.CgroupType == "V2" {
+		subsysV2 := &types.SubSystemGroupsV2{}
+		if err := json.Unmarshal(rsp.Data.SubSystemGroups, subsysV2); err != nil {
+			return nil, fmt.Errorf("failed to Unmarshal cgroup v2 info, err %s", err)
+		}
+		cgV2 := &types.MalachiteCgroupV2Info{
+			Memory:    &subsysV2.Memory.V2.MemoryData,
+			Blkio:     &subsysV2.Blkio.V2.BlkIOData,
+			Cpu:       &subsysV2.Cpuacct.V2.CPUData,
+			CpuSet:    &subsysV2.Cpuset.V2.CPUSetData,
+			PerfEvent: &subsysV2.PerfEvent.PerfEventData,
+			NetCls:    &subsysV2.NetCls.NetData,
+		}
+		if subsysV2.Pids != nil {
+			cgV2.Pids = &subsysV2.Pids.V2.PidsData
+		}
+		if subsysV2.Hugetlb != nil {
+			cgV2.Hugetlb = &subsysV2.Hugetlb.V2.HugetlbData
+		}
+		if subsysV2.Freezer != nil {
+			cgV2.Freezer = &subsysV2.Freezer.V2.FreezerData
+		}
+		cgroupInfo.V2 = cgV2
+	} else {
+		return nil, fmt.Errorf("unknow cgroup type %s in cgroup info", cgroupInfo.CgroupType)
+	}
+
+	return cgroupInfo, nil
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/metric/malachite/types"
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/pod"
+)
+
+// fakeCgroupStatsParser parses responses in the format of "<cgroup type>:<rss>"
+type fakeCgroupStatsParser struct{}
+
+func (fakeCgroupStatsParser) ParseCgroupStats(cgroupPath string, raw []byte) (*types.MalachiteCgroupInfo, error) {
+	var (
+		cgroupType string
+		rss        uint64
+	)
+	if _, err := fmt.Sscanf(strings.Replace(string(raw), ":", " ", 1), "%s %d", &cgroupType, &rss); err != nil {
+		return nil, fmt.Errorf("invalid stats of cgroup %s: %v", cgroupPath, err)
+	}
+	if cgroupType != "V1" {
+		return nil, fmt.Errorf("unknow cgroup type %s in cgroup info", cgroupType)
+	}
+
+	return &types.MalachiteCgroupInfo{
+		UserPath:   cgroupPath,
+		CgroupType: cgroupType,
+		V1: &types.MalachiteCgroupV1Info{
+			Memory: &types.MemoryCgDataV1{TotalRss: rss},
+		},
+	}, nil
+}
+
+func TestGetCgroupStatsWithParser(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get(CgroupPathParamKey) {
+		case "v1-path":
+			_, _ = w.Write([]byte("V1:1024"))
+		default:
+			_, _ = w.Write([]byte("V2:1024"))
+		}
+	}))
+	defer server.Close()
+
+	RegisterCgroupStatsParser("fake", fakeCgroupStatsParser{})
+	parser, err := GetCgroupStatsParser("fake")
+	assert.NoError(t, err)
+	_, err = GetCgroupStatsParser("not-registered")
+	assert.Error(t, err)
+
+	malachiteClient := NewMalachiteClient(&pod.PodFetcherStub{})
+	malachiteClient.SetURL(map[string]string{
+		CgroupResource: server.URL,
+	})
+
+	// the response can't be parsed by the default parser
+	_, err = malachiteClient.GetCgroupStats("v1-path")
+	assert.Error(t, err)
+
+	malachiteClient.SetCgroupStatsParser(parser)
+	info, err := malachiteClient.GetCgroupStats("v1-path")
+	assert.NoError(t, err)
+	assert.Equal(t, &types.MalachiteCgroupInfo{
+		UserPath:   "v1-path",
+		CgroupType: "V1",
+		V1: &types.MalachiteCgroupV1Info{
+			Memory: &types.MemoryCgDataV1{TotalRss: 1024},
+		},
+	}, info)
+
+	_, err = malachiteClient.GetCgroupStats("v2-path")
+	assert.Error(t, err)
+}
@@ -65,6 +65,28 @@ func TestGetPodContainerStats(t *testing.T) {
 				SubSystemGroups: subSystemGroupsV2Data,
 			},
 		},
+		// cgroup types are matched case-insensitively, and surrounding spaces are trimmed
+		"podp-uid5/p5-c-uid1": {
+			Status: 0,
+			Data: types.CgroupDataInner{
+				CgroupType:      "v1",
+				SubSystemGroups: subSystemGroupsV1Data,
+			},
+		},
+		"podp-uid5/p5-c-uid2": {
+			Status: 0,
+			Data: types.CgroupDataInner{
+				CgroupType:      "V1 ",
+				SubSystemGroups: subSystemGroupsV1Data,
+			},
+		},
+		"podp-uid6/p6-c-uid1": {
+			Status: 0,
+			Data: types.CgroupDataInner{
+				CgroupType:      "V3",
+				SubSystemGroups: subSystemGroupsV2Data,
+			},
+		},
 	}
 
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -148,6 +170,38 @@ func TestGetPodContainerStats(t *testing.T) {
 				},
 			},
 		},
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "p-name5",
+				UID:  apitypes.UID("p-uid5"),
+			},
+			Status: v1.PodStatus{
+				ContainerStatuses: []v1.ContainerStatus{
+					{
+						Name:        "p5-c-name1",
+						ContainerID: "containerd://p5-c-uid1",
+					},
+					{
+						Name:        "p5-c-name2",
+						ContainerID: "containerd://p5-c-uid2",
+					},
+				},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "p-name6",
+				UID:  apitypes.UID("p-uid6"),
+			},
+			Status: v1.PodStatus{
+				ContainerStatuses: []v1.ContainerStatus{
+					{
+						Name:        "p6-c-name1",
+						ContainerID: "containerd://p6-c-uid1",
+					},
+				},
+			},
+		},
 	}
 	fetcher := &pod.PodFetcherStub{PodList: pods}
 
@@ -167,7 +221,7 @@ func TestGetPodContainerStats(t *testing.T) {
 
 	stats, err = malachiteClient.GetAllPodContainersStats(context.Background())
 	assert.NoError(t, err)
-	assert.Equal(t, 3, len(stats))
+	assert.Equal(t, 4, len(stats))
 
 	assert.NotNil(t, stats["p-uid1"]["p1-c-name1"].V1)
 	assert.Nil(t, stats["p-uid1"]["p1-c-name1"].V2)
@@ -180,4 +234,16 @@ func TestGetPodContainerStats(t *testing.T) {
 
 	assert.NotNil(t, stats["p-uid3"]["p3-c-name1"].V2)
 	assert.Nil(t, stats["p-uid3"]["p3-c-name1"].V1)
+
+	for _, containerName := range []string{"p5-c-name1", "p5-c-name2"} {
+		assert.NotNil(t, stats["p-uid5"][containerName].V1, containerName)
+		assert.Nil(t, stats["p-uid5"][containerName].V2, containerName)
+		assert.Equal(t, "V1", stats["p-uid5"][containerName].CgroupType, containerName)
+	}
+
+	// neither V1 nor V2 is parsed for the unrecognized cgroup type, so the container is skipped
+	assert.NotContains(t, stats, "p-uid6")
+	info, err := malachiteClient.GetPodContainerStats("p-uid6", "p6-c-uid1")
+	assert.Error(t, err)
+	assert.Nil(t, info)
 }
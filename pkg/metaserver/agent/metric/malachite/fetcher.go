@@ -20,20 +20,27 @@ import (
 	"context"
 	"crypto/rand"
 	"fmt"
+	"math"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"golang.org/x/time/rate"
 	v1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/klog/v2"
 
 	"github.com/kubewharf/katalyst-core/pkg/config"
+	globalconfig "github.com/kubewharf/katalyst-core/pkg/config/agent/global"
 	"github.com/kubewharf/katalyst-core/pkg/consts"
 	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/metric"
 	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/metric/malachite/client"
 	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/metric/malachite/types"
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/node"
 	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/pod"
 	"github.com/kubewharf/katalyst-core/pkg/metrics"
 	"github.com/kubewharf/katalyst-core/pkg/util/cgroup/common"
@@ -46,17 +53,137 @@ const (
 	metricsNamMalachiteUnHealthy              = "malachite_unhealthy"
 	metricsNameMalachiteGetSystemStatusFailed = "malachite_get_system_status_failed"
 	metricsNameMalachiteGetPodStatusFailed    = "malachite_get_pod_status_failed"
+	metricsNameMalachiteSampleWindowMismatch  = "malachite_sample_window_mismatch"
+	metricsNameMalachiteMemBandwidthWriteDiff = "malachite_mem_bandwidth_write_discrepancy"
+	metricsNameMalachiteUnknownSchemaVersion  = "malachite_unknown_schema_version"
+	metricsNameMalachiteSampleTickSkipped     = "malachite_sample_tick_skipped"
+	metricsNameMalachiteStoreRatioClamped     = "malachite_store_ratio_clamped"
+	metricsNameMalachiteContainerFailed       = "malachite_container_process_failed"
+	metricsNameMalachiteCgroupVersionSkipped  = "malachite_cgroup_version_skipped"
+	metricsNameMalachiteRateIntervalJitter    = "malachite_rate_interval_jitter"
+	metricsNameMalachiteRateClockJump         = "malachite_rate_clock_jump"
+	metricsNameMalachiteDerivedMetricOutcome  = "malachite_derived_metric_outcome"
+	metricsNameMalachiteNegativeRateClamped   = "malachite_negative_rate_clamped"
+	metricsNameMalachiteContainersProcessed   = "malachite_containers_processed"
+	metricsNameMalachiteProcessedTotal        = "malachite_containers_processed_total"
+	metricsNameMalachiteCounterStuck          = "malachite_counter_stuck"
+	metricsNameMalachiteExternalIngested      = "malachite_external_metrics_ingested"
 
 	pageShift = 12
+
+	// counterSampleWindowToleranceInSec is the max skew allowed between update times
+	// of counters that are combined into one metric
+	counterSampleWindowToleranceInSec = 1
+
+	// derivedMetricFreshness is the max age of metrics to be used in cross-metric derivations
+	derivedMetricFreshness = 30 * time.Second
+
+	// cgroupVersionSkipLogInterval is the min interval between logs of containers
+	// skipped for their cgroup versions, to avoid flooding logs every cycle
+	cgroupVersionSkipLogInterval = time.Minute
+
+	// rateClockJumpLogInterval is the min interval between logs of clock jumps
+	rateClockJumpLogInterval = time.Minute
+
+	// rateIntervalJitterWindow is the max number of the latest intervals between updates
+	// observed in rate calculation, which are used to measure the jitter of update times
+	rateIntervalJitterWindow = 1024
+
+	// notifiedKeySuffixNuma is used to distinguish numa-level data for container notifiers
+	notifiedKeySuffixNuma = "/numa"
 )
 
+// recognizedSchemaVersions are the schema versions of malachite response that can be parsed correctly,
+// and empty version is for those malachite not reporting its version.
+var recognizedSchemaVersions = sets.NewString("", "v1")
+
+// memBandwidthMetrics are metrics reported in the configured memory bandwidth unit
+var memBandwidthMetrics = []string{
+	consts.MetricMemBandwidthReadContainer,
+	consts.MetricMemBandwidthWriteContainer,
+	consts.MetricMemBandwidthLocalSocket,
+	consts.MetricMemBandwidthRemoteSocket,
+	consts.MetricMemBandwidthHeadroomNode,
+	consts.MetricMemBandwidthTenantNode,
+	consts.MetricMemBandwidthDecayedNode,
+	consts.MetricMemBandwidthWeightedCostContainer,
+}
+
+type containerMetricKey struct {
+	podUID        string
+	containerName string
+	metricName    string
+}
+
+type notifiedRecord struct {
+	value     float64
+	timestamp time.Time
+}
+
 // NewMalachiteMetricsFetcher returns the default implementation of MetricsFetcher.
 func NewMalachiteMetricsFetcher(emitter metrics.MetricEmitter, fetcher pod.PodFetcher, conf *config.Configuration) metric.MetricsFetcher {
-	return &MalachiteMetricsFetcher{
-		malachiteClient: client.NewMalachiteClient(fetcher),
-		metricStore:     utilmetric.NewMetricStore(),
-		emitter:         emitter,
-		conf:            conf,
+	metricConf := globalconfig.NewMetricConfiguration()
+	if conf != nil && conf.MetaServerConfiguration != nil && conf.MetricConfiguration != nil {
+		metricConf = conf.MetricConfiguration
+	}
+	return newMalachiteMetricsFetcher(emitter, fetcher, conf, metricConf)
+}
+
+// newMalachiteMetricsFetcher constructs the fetcher with the given metric configuration, and it's shared
+// by those fetchers derived from the running one (i.e. for replay), so that no state is left uninitialized.
+func newMalachiteMetricsFetcher(emitter metrics.MetricEmitter, fetcher pod.PodFetcher, conf *config.Configuration,
+	metricConf *globalconfig.MetricConfiguration) *MalachiteMetricsFetcher {
+	memBandwidthUnit := metricConf.MemBandwidthUnit
+	if memBandwidthUnit == "" {
+		memBandwidthUnit = utilmetric.DefaultMemBandwidthUnit
+	}
+	memBandwidthUnitScale, err := utilmetric.GetMemBandwidthUnitScale(memBandwidthUnit)
+	if err != nil {
+		klog.Errorf("[malachite] %v, fall back to %v", err, utilmetric.DefaultMemBandwidthUnit)
+		memBandwidthUnit = utilmetric.DefaultMemBandwidthUnit
+		memBandwidthUnitScale, _ = utilmetric.GetMemBandwidthUnitScale(memBandwidthUnit)
+	}
+
+	metricStore := utilmetric.NewMetricStore()
+	metricStore.SetMetricNamePrefix(metricConf.MetricNamePrefix)
+	for _, metricName := range memBandwidthMetrics {
+		metricStore.SetMetricUnit(metricName, memBandwidthUnit+"/s")
+	}
+
+	malachiteClient := client.NewMalachiteClient(fetcher)
+	m := &MalachiteMetricsFetcher{
+		malachiteClient:          malachiteClient,
+		getAllPodContainersStats: malachiteClient.GetAllPodContainersStats,
+		podFetcher:               fetcher,
+		metricStore:              metricStore,
+		memBandwidthUnitScale:    memBandwidthUnitScale,
+		memBandwidthConstants:    defaultMemBandwidthConstants,
+		emitter:                  newNodePoolEmitter(emitter),
+		conf:                     conf,
+		metricConf:               metricConf,
+		startTime:                time.Now(),
+		counterDeltaStrategies:   make(map[string]CounterDeltaStrategy),
+		containerStartTime:       make(map[string]map[string]time.Time),
+		lastNotified:             make(map[string]notifiedRecord),
+		baselineResets:           make(map[containerMetricKey]struct{}),
+		replaySamples:            make(map[string]map[string][]containerMemBandwidthCounters),
+		containerErrors:          make(map[string]map[string]error),
+		debugCaptures:            make(map[containerMetricKey][]ContainerDebugCapture),
+		containerMemPolicies:     make(map[string]map[string]ContainerMemPolicy),
+		containerIOLimitDevices:  make(map[string]map[string]sets.String),
+		podTombstones:            make(map[string]time.Time),
+		unknownCgroupTypes:       sets.NewString(),
+		sampleIntervalUpdated:    make(chan struct{}, 1),
+		memBandwidthBaselines:    make(map[string]map[string]*memBandwidthBaseline),
+		memBandwidthTrends:       make(map[string]map[string][]memBandwidthSample),
+		counterAdvances:          make(map[string]map[string]*counterAdvance),
+		memBandwidthExcludedPods: make(map[string]bool),
+		podWorkloads:             make(map[string]string),
+		workloadMetrics:          make(map[string]map[string]utilmetric.MetricData),
+		cgroupVersionSkipLog:     rate.NewLimiter(rate.Every(cgroupVersionSkipLogInterval), 1),
+		rateClockJumpLog:         rate.NewLimiter(rate.Every(rateClockJumpLogInterval), 1),
+		namedStores:              make(map[string]*utilmetric.MetricStore),
+		registeredStoreMetric:    make(map[string][]func(store *utilmetric.MetricStore)),
 		registeredNotifier: map[metric.MetricsScope]map[string]metric.NotifiedData{
 			metric.MetricsScopeNode:      make(map[string]metric.NotifiedData),
 			metric.MetricsScopeNuma:      make(map[string]metric.NotifiedData),
@@ -65,29 +192,246 @@ func NewMalachiteMetricsFetcher(emitter metrics.MetricEmitter, fetcher pod.PodFe
 			metric.MetricsScopeContainer: make(map[string]metric.NotifiedData),
 		},
 	}
+	m.applyMetricConf(metricConf, nil)
+	return m
 }
 
 type MalachiteMetricsFetcher struct {
 	metricStore     *utilmetric.MetricStore
 	malachiteClient *client.MalachiteClient
+	podFetcher      pod.PodFetcher
 	conf            *config.Configuration
+	metricConf      *globalconfig.MetricConfiguration
+
+	// sampleInterval is the interval between sampling cycles in nanoseconds, and it's accessed atomically
+	sampleInterval int64
+	// sampleIntervalUpdated wakes up the sampling loop when the configuration is updated
+	sampleIntervalUpdated chan struct{}
+
+	// getAllPodContainersStats reads the snapshot of all containers, and it's replaceable in tests
+	getAllPodContainersStats func(ctx context.Context) (map[string]map[string]*types.MalachiteCgroupInfo, error)
+
+	// memBandwidthUnitScale is the number of bytes in the unit of memory bandwidth metrics
+	memBandwidthUnitScale float64
+	memBandwidthConstants MemBandwidthConstants
+
+	// machineInfo is used for the derivations relying on machine topology, i.e. numa distances,
+	// and those derivations are skipped if it's not set
+	machineInfo *machine.KatalystMachineInfo
+
+	// startTime is when the fetcher is created, and rate metrics are withheld until warm-up period passes
+	startTime time.Time
+
+	// nodeFetcher is used to resolve the pool of this node, and nodePoolResolved is only accessed in sampling loop
+	nodeFetcher      node.NodeFetcher
+	nodePoolResolved bool
+
+	// rateSkippedContainers are containers whose current sample has been counted in MetricRateSkipCountContainer,
+	// and it's reset before each container is processed
+	rateSkippedContainers map[containerMetricKey]struct{}
+	// rateClockJumpSamples are containers (or the node with the empty key) whose current sample has been
+	// counted as dropped for clock jump, and it's reset before each sample is processed
+	rateClockJumpSamples map[containerMetricKey]struct{}
+
+	// unknownCgroupTypes are cgroup types not recognized and logged, and it's only accessed in sampling loop
+	unknownCgroupTypes sets.String
+
+	// energySocketIDs are sockets reporting energy in the last sample, and it's only accessed in sampling loop
+	energySocketIDs []int
+
+	// containerStartTime records the start time of running containers,
+	// map[podUID]map[containerName]startTime, and it's only accessed in sampling loop
+	containerStartTime map[string]map[string]time.Time
 
 	sync.RWMutex
 	registeredMetric   []func(store *utilmetric.MetricStore)
 	registeredNotifier map[metric.MetricsScope]map[string]metric.NotifiedData
 
+	// namedStores are isolated from the store of built-in metrics, and
+	// metrics in them are only set by the registered external functions
+	namedStores           map[string]*utilmetric.MetricStore
+	registeredStoreMetric map[string][]func(store *utilmetric.MetricStore)
+
+	// lastNotified records the data sent to each notifier last time, and it's
+	// only used when emit-on-change is enabled
+	notifiedLock sync.Mutex
+	lastNotified map[string]notifiedRecord
+
+	// baselineResets records the container rate metrics whose previous counters
+	// should not be used, and the next sample will only be used as baseline for them
+	baselineResetLock sync.Mutex
+	baselineResets    map[containerMetricKey]struct{}
+
+	// replaySamples retains raw memory bandwidth counters of the last cycles for each container,
+	// map[podUID]map[containerName]samples, which are used to re-derive bandwidth for what-if analysis
+	replayLock    sync.Mutex
+	replaySamples map[string]map[string][]containerMemBandwidthCounters
+
+	// memBandwidthBaselines records the total memory bandwidth of the last cycles for each container,
+	// map[podUID]map[containerName]baseline, and it's only accessed in sampling loop
+	memBandwidthBaselines map[string]map[string]*memBandwidthBaseline
+
+	// memBandwidthTrends records the total memory bandwidth samples in the trend window for each container,
+	// map[podUID]map[containerName]samples ordered by time, and it's only accessed in sampling loop
+	memBandwidthTrends map[string]map[string][]memBandwidthSample
+
+	// sharedCgroupShares records the share of memory bandwidth attributed to containers sharing the cgroup
+	// with others in current cycle, and it's only accessed in sampling loop
+	sharedCgroupShares map[containerMetricKey]float64
+
+	// previousCounters is the snapshot of raw counters of the last cycle, map[podUID]map[containerName]map[metricName]data,
+	// which is taken at the start of the sampling cycle and only accessed in sampling loop
+	previousCounters map[string]map[string]map[string]utilmetric.MetricData
+
+	// counterAdvances records the cumulative counters of the last sample for each container,
+	// map[podUID]map[containerName]counters, and it's only accessed in sampling loop
+	counterAdvances map[string]map[string]*counterAdvance
+
+	// counterDeltaStrategies records how counters of each derived metric are diffed, map[metricName]strategy,
+	// and those set by SetCounterDeltaStrategy are kept apart from those selected by configuration
+	counterDeltaLock                 sync.RWMutex
+	counterDeltaStrategies           map[string]CounterDeltaStrategy
+	configuredCounterDeltaStrategies map[string]CounterDeltaStrategy
+
+	// memBandwidthExcludedPods records pods matching memBandwidthExcludedPodSelector, whose containers are
+	// excluded from the tenant bandwidth of the node, and it's only accessed in sampling loop
+	memBandwidthExcludedPodSelector labels.Selector
+	memBandwidthExcludedPods        map[string]bool
+
+	// podWorkloads records the workload identity of each pod, which is refreshed with the pod list
+	// and only accessed in sampling loop, and workloadMetrics are metrics aggregated by workload,
+	// map[workload]map[metricName]data, which are replaced as a whole in each cycle
+	podWorkloads       map[string]string
+	workloadMetricLock sync.RWMutex
+	workloadMetrics    map[string]map[string]utilmetric.MetricData
+
+	// memBandwidthDecayed is the last decayed tenant bandwidth of the node, and it's only accessed in sampling loop
+	memBandwidthDecayed *utilmetric.MetricData
+
+	// containerErrors records the error of the last failed processing for each container,
+	// map[podUID]map[containerName]error, and it's removed once the container is processed successfully
+	containerErrorLock sync.RWMutex
+	containerErrors    map[string]map[string]error
+
+	// debugCaptures keeps the latest captures of containers in DebugCaptureContainers, and
+	// it's written in sampling loop and read by the http handler
+	debugCaptureLock sync.RWMutex
+	debugCaptures    map[containerMetricKey][]ContainerDebugCapture
+
+	// podTombstones records the time when each pod was found missing from malachite, and states of
+	// the pod are kept until PodMetricGCGracePeriod passes since then, keptPodUIDSet is the pods whose
+	// states were kept in the last cycle
+	podTombstoneLock sync.RWMutex
+	podTombstones    map[string]time.Time
+	keptPodUIDSet    map[string]bool
+
+	// containerMemPolicies records the numa memory policy of each container,
+	// map[podUID]map[containerName]policy, which is metadata rather than metrics
+	memPolicyLock        sync.RWMutex
+	containerMemPolicies map[string]map[string]ContainerMemPolicy
+
+	// containerIOLimitDevices records devices with io limits of each container reported in the last cycle,
+	// map[podUID]map[containerName]devices, and it's only accessed in sampling loop
+	containerIOLimitDevices map[string]map[string]sets.String
+
+	// cycleDerivedOutcomes collects outcomes of derived container metrics in the running sampling cycle,
+	// and derivedOutcomes is the report aggregated from them when the last cycle finished
+	derivedOutcomeLock   sync.Mutex
+	cycleDerivedOutcomes map[containerMetricKey]DerivedMetricOutcome
+	derivedOutcomes      DerivedMetricOutcomeReport
+
+	// derivationCycles counts the cycles in which containers have been processed since startup, to decide
+	// whether derived metrics with cycle intervals are due, and it's only accessed in sampling loop
+	derivationCycles uint64
+
+	// containersProcessed is the number of containers processed in the last cycle, and containersProcessedTotal
+	// is that since startup, both are accessed atomically
+	containersProcessed      int64
+	containersProcessedTotal int64
+
+	// cgroupVersionSkipped counts containers skipped for their cgroup versions since startup,
+	// and cgroupVersionSkipLog limits the rate to log them, both are only accessed in sampling loop
+	cgroupVersionSkipped int64
+	cgroupVersionSkipLog *rate.Limiter
+
+	// rateClockJumps counts samples dropped for clock jumps since startup,
+	// and rateClockJumpLog limits the rate to log them
+	rateClockJumps   int64
+	rateClockJumpLog *rate.Limiter
+
+	// rateIntervals records the latest intervals between updates observed in rate calculation
+	rateIntervals rateIntervalWindow
+
+	// sampling is set to 1 when a sampling cycle is running, and skippedTicks
+	// counts the ticks skipped since the previous cycle has not finished
+	sampling     int32
+	skippedTicks int64
+
+	// cycleLock is held by the running sampling cycle, and closed is set when the
+	// fetcher is closed, after which no sampling cycle will run any more
+	cycleLock sync.Mutex
+	closed    bool
+	cancel    context.CancelFunc
+	closeOnce sync.Once
+
 	startOnce sync.Once
-	emitter   metrics.MetricEmitter
+	emitter   *nodePoolEmitter
 
 	synced bool
 }
 
+// SetMachineInfo sets the machine info used for the derivations relying on machine topology,
+// and it should be called before Run.
+func (m *MalachiteMetricsFetcher) SetMachineInfo(machineInfo *machine.KatalystMachineInfo) {
+	m.machineInfo = machineInfo
+}
+
 func (m *MalachiteMetricsFetcher) Run(ctx context.Context) {
 	m.startOnce.Do(func() {
-		go wait.Until(func() { m.sample(ctx) }, time.Second*5, ctx.Done())
+		m.cycleLock.Lock()
+		defer m.cycleLock.Unlock()
+		if m.closed {
+			return
+		}
+
+		ctx, m.cancel = context.WithCancel(ctx)
+		m.loadSnapshot()
+		m.runLineExport(ctx)
+		m.runRemoteWrite(ctx)
+		go m.runSampleLoop(ctx)
 	})
 }
 
+// Close stops the sampling loop, flushes the latest metrics (including counter baselines) into the
+// snapshot file, and deregisters all notifiers. It waits for the in-flight sampling
+// cycle to finish rather than interrupting it, and it's safe to be called multiple times.
+func (m *MalachiteMetricsFetcher) Close() {
+	m.closeOnce.Do(func() {
+		m.cycleLock.Lock()
+		defer m.cycleLock.Unlock()
+
+		m.closed = true
+		if m.cancel != nil {
+			m.cancel()
+		}
+		m.writeSnapshot()
+		m.deregisterNotifiers()
+		m.metricStore.CloseChangeSubscriptions()
+		klog.Infof("[malachite] metrics fetcher is closed")
+	})
+}
+
+// deregisterNotifiers removes all registered notifiers, and their channels are left open
+// since they're owned by the callers, whose consumers don't expect them to be closed.
+func (m *MalachiteMetricsFetcher) deregisterNotifiers() {
+	m.Lock()
+	defer m.Unlock()
+
+	for scope := range m.registeredNotifier {
+		m.registeredNotifier[scope] = make(map[string]metric.NotifiedData)
+	}
+}
+
 func (m *MalachiteMetricsFetcher) RegisterNotifier(scope metric.MetricsScope, req metric.NotifiedRequest,
 	response chan metric.NotifiedResponse) string {
 	if _, ok := m.registeredNotifier[scope]; !ok {
@@ -114,6 +458,12 @@ func (m *MalachiteMetricsFetcher) DeRegisterNotifier(scope metric.MetricsScope,
 	defer m.Unlock()
 
 	delete(m.registeredNotifier[scope], key)
+
+	m.notifiedLock.Lock()
+	defer m.notifiedLock.Unlock()
+
+	delete(m.lastNotified, key)
+	delete(m.lastNotified, key+notifiedKeySuffixNuma)
 }
 
 func (m *MalachiteMetricsFetcher) RegisterExternalMetric(f func(store *utilmetric.MetricStore)) {
@@ -122,10 +472,47 @@ func (m *MalachiteMetricsFetcher) RegisterExternalMetric(f func(store *utilmetri
 	m.registeredMetric = append(m.registeredMetric, f)
 }
 
+func (m *MalachiteMetricsFetcher) RegisterExternalMetricToStore(storeName string, f func(store *utilmetric.MetricStore)) {
+	if storeName == "" || storeName == metric.DefaultMetricStoreName {
+		m.RegisterExternalMetric(f)
+		return
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	if _, ok := m.namedStores[storeName]; !ok {
+		m.namedStores[storeName] = utilmetric.NewMetricStore()
+	}
+	m.registeredStoreMetric[storeName] = append(m.registeredStoreMetric[storeName], f)
+}
+
+func (m *MalachiteMetricsFetcher) GetMetricStore(storeName string) (*utilmetric.MetricStore, error) {
+	if storeName == "" || storeName == metric.DefaultMetricStoreName {
+		return m.metricStore, nil
+	}
+
+	m.RLock()
+	defer m.RUnlock()
+	if store, ok := m.namedStores[storeName]; ok {
+		return store, nil
+	}
+	return nil, fmt.Errorf("metric store %v not found", storeName)
+}
+
+func (m *MalachiteMetricsFetcher) ResetContainerMetricBaseline(podUID, containerName, metricName string) {
+	m.baselineResetLock.Lock()
+	defer m.baselineResetLock.Unlock()
+	m.baselineResets[containerMetricKey{podUID: podUID, containerName: containerName, metricName: metricName}] = struct{}{}
+}
+
 func (m *MalachiteMetricsFetcher) GetNodeMetric(metricName string) (utilmetric.MetricData, error) {
 	return m.metricStore.GetNodeMetric(metricName)
 }
 
+func (m *MalachiteMetricsFetcher) GetNodeMetricSeries(metricName string, window time.Duration) []utilmetric.MetricData {
+	return m.metricStore.GetNodeMetricSeries(metricName, window)
+}
+
 func (m *MalachiteMetricsFetcher) GetNumaMetric(numaID int, metricName string) (utilmetric.MetricData, error) {
 	return m.metricStore.GetNumaMetric(numaID, metricName)
 }
@@ -138,10 +525,28 @@ func (m *MalachiteMetricsFetcher) GetCPUMetric(coreID int, metricName string) (u
 	return m.metricStore.GetCPUMetric(coreID, metricName)
 }
 
+func (m *MalachiteMetricsFetcher) GetSocketMetric(socketID int, metricName string) (utilmetric.MetricData, error) {
+	return m.metricStore.GetSocketMetric(socketID, metricName)
+}
+
 func (m *MalachiteMetricsFetcher) GetContainerMetric(podUID, containerName, metricName string) (utilmetric.MetricData, error) {
 	return m.metricStore.GetContainerMetric(podUID, containerName, metricName)
 }
 
+func (m *MalachiteMetricsFetcher) GetPodContainerMetrics(podUID, metricName string, maxAge time.Duration) map[string]utilmetric.MetricData {
+	return m.metricStore.GetPodContainerMetrics(podUID, metricName, maxAge)
+}
+
+func (m *MalachiteMetricsFetcher) GetMetricUnit(metricName string) (string, error) {
+	return m.metricStore.GetMetricUnit(metricName)
+}
+
+// RegisterValueTransform registers the transform applied to values of the metric before they are
+// stored, and it affects all consumers of the metric, including readers, notifiers and exporters.
+func (m *MalachiteMetricsFetcher) RegisterValueTransform(metricName string, transform utilmetric.ValueTransform) {
+	m.metricStore.RegisterValueTransform(metricName, transform)
+}
+
 func (m *MalachiteMetricsFetcher) GetContainerNumaMetric(podUID, containerName, numaNode, metricName string) (utilmetric.MetricData, error) {
 	return m.metricStore.GetContainerNumaMetric(podUID, containerName, numaNode, metricName)
 }
@@ -171,48 +576,116 @@ func (m *MalachiteMetricsFetcher) HasSynced() bool {
 	return m.synced
 }
 
-func (m *MalachiteMetricsFetcher) sample(ctx context.Context) {
+// sampleOnce runs a sampling cycle only if no other cycle is running, and the tick will be
+// skipped otherwise, so that interleaved cycles won't calculate deltas against values
+// written by each other.
+func (m *MalachiteMetricsFetcher) sampleOnce(ctx context.Context) *CycleResult {
+	if !atomic.CompareAndSwapInt32(&m.sampling, 0, 1) {
+		skipped := atomic.AddInt64(&m.skippedTicks, 1)
+		klog.Warningf("[malachite] previous sampling cycle is still running, skip the tick (%v skipped in total)", skipped)
+		_ = m.emitter.StoreInt64(metricsNameMalachiteSampleTickSkipped, 1, metrics.MetricTypeNameCount)
+		return &CycleResult{Skipped: true}
+	}
+	defer atomic.StoreInt32(&m.sampling, 0)
+
+	m.cycleLock.Lock()
+	defer m.cycleLock.Unlock()
+	if m.closed {
+		return &CycleResult{Skipped: true}
+	}
+
+	result := newCycleResult()
+	m.sample(ctx, result)
+	result.complete()
+	return result
+}
+
+func (m *MalachiteMetricsFetcher) sample(ctx context.Context, result *CycleResult) {
 	klog.V(4).Infof("[malachite] heartbeat")
 
-	if !m.checkMalachiteHealthy() {
+	if !m.checkMalachiteHealthy(result) {
 		return
 	}
+	m.resolveNodePool(ctx)
 
 	// Update system data
-	m.updateSystemStats()
+	m.updateSystemStats(result)
 	// Update pod data
-	m.updatePodsCgroupData(ctx)
+	m.updatePodsCgroupData(ctx, result)
+	result.ContainersProcessed = atomic.LoadInt64(&m.containersProcessed)
 	// Update top level cgroup of kubepods
-	m.updateCgroupData()
+	m.updateCgroupData(result)
+	m.processNodePoolMetrics()
+	m.emitRateIntervalJitter()
 
 	// after sampling, we should call the registered function to get external metric
-	m.RLock()
-	for _, f := range m.registeredMetric {
-		f(m.metricStore)
-	}
-	m.RUnlock()
+	m.updateExternalMetrics()
 
 	m.notifySystem()
 	m.notifyPods()
 
+	m.writeSnapshot()
+
 	m.synced = true
 }
 
+// updateExternalMetrics calls the registered functions to set external metrics into stores
+func (m *MalachiteMetricsFetcher) updateExternalMetrics() {
+	m.RLock()
+	defer m.RUnlock()
+
+	for _, f := range m.registeredMetric {
+		f(m.metricStore)
+	}
+	for storeName, fs := range m.registeredStoreMetric {
+		for _, f := range fs {
+			f(m.namedStores[storeName])
+		}
+	}
+}
+
 // checkMalachiteHealthy is to check whether malachite is healthy
-func (m *MalachiteMetricsFetcher) checkMalachiteHealthy() bool {
-	_, err := m.malachiteClient.GetSystemComputeStats()
+func (m *MalachiteMetricsFetcher) checkMalachiteHealthy(result *CycleResult) bool {
+	systemComputeData, err := m.malachiteClient.GetSystemComputeStats()
 	if err != nil {
 		klog.Errorf("[malachite] malachite is unhealthy: %v", err)
 		_ = m.emitter.StoreInt64(metricsNamMalachiteUnHealthy, 1, metrics.MetricTypeNameRaw)
+		result.recordSource(CycleSourceHealth, err)
+		return false
+	}
+
+	if !m.checkMalachiteSchemaVersion(systemComputeData.SchemaVersion) {
+		result.recordSource(CycleSourceHealth, fmt.Errorf("unrecognized schema version %q", systemComputeData.SchemaVersion))
+		return false
+	}
+	result.recordSource(CycleSourceHealth, nil)
+	return true
+}
+
+// checkMalachiteSchemaVersion is to check whether the schema version of malachite response is recognized,
+// since fields may be parsed as zero values silently if the schema changes. It returns false if metrics
+// should not be collected, so that the last values will be held.
+func (m *MalachiteMetricsFetcher) checkMalachiteSchemaVersion(version string) bool {
+	if recognizedSchemaVersions.Has(version) {
+		return true
+	}
+
+	_ = m.emitter.StoreInt64(metricsNameMalachiteUnknownSchemaVersion, 1, metrics.MetricTypeNameRaw,
+		metrics.MetricTag{Key: "version", Val: version})
+	if m.metricConf.UnknownSchemaVersionPolicy == globalconfig.UnknownSchemaVersionPolicyHold {
+		klog.Errorf("[malachite] unrecognized schema version %q, hold the last metrics", version)
 		return false
 	}
 
+	klog.Warningf("[malachite] unrecognized schema version %q, metrics may be incorrect", version)
 	return true
 }
 
 // Get raw system stats by malachite sdk and set to metricStore
-func (m *MalachiteMetricsFetcher) updateSystemStats() {
+func (m *MalachiteMetricsFetcher) updateSystemStats(result *CycleResult) {
+	delete(m.rateClockJumpSamples, containerMetricKey{})
 	systemComputeData, err := m.malachiteClient.GetSystemComputeStats()
+	result.recordSource(CycleSourceSystemCompute, err)
 	if err != nil {
 		klog.Errorf("[malachite] get system compute stats failed, err %v", err)
 		_ = m.emitter.StoreInt64(metricsNameMalachiteGetSystemStatusFailed, 1, metrics.MetricTypeNameCount,
@@ -223,6 +696,7 @@ func (m *MalachiteMetricsFetcher) updateSystemStats() {
 	}
 
 	systemMemoryData, err := m.malachiteClient.GetSystemMemoryStats()
+	result.recordSource(CycleSourceSystemMemory, err)
 	if err != nil {
 		klog.Errorf("[malachite] get system memory stats failed, err %v", err)
 		_ = m.emitter.StoreInt64(metricsNameMalachiteGetSystemStatusFailed, 1, metrics.MetricTypeNameCount,
@@ -230,9 +704,11 @@ func (m *MalachiteMetricsFetcher) updateSystemStats() {
 	} else {
 		m.processSystemMemoryData(systemMemoryData)
 		m.processSystemNumaData(systemMemoryData)
+		m.processSystemSocketMemBandwidth(systemMemoryData)
 	}
 
 	systemIOData, err := m.malachiteClient.GetSystemIOStats()
+	result.recordSource(CycleSourceSystemIO, err)
 	if err != nil {
 		klog.Errorf("[malachite] get system io stats failed, err %v", err)
 		_ = m.emitter.StoreInt64(metricsNameMalachiteGetSystemStatusFailed, 1, metrics.MetricTypeNameCount,
@@ -242,10 +718,11 @@ func (m *MalachiteMetricsFetcher) updateSystemStats() {
 	}
 }
 
-func (m *MalachiteMetricsFetcher) updateCgroupData() {
+func (m *MalachiteMetricsFetcher) updateCgroupData(result *CycleResult) {
 	cgroupPaths := []string{m.conf.ReclaimRelativeRootCgroupPath, common.CgroupFsRootPathBurstable, common.CgroupFsRootPathBestEffort}
 	for _, path := range cgroupPaths {
 		stats, err := m.malachiteClient.GetCgroupStats(path)
+		result.recordSource(CycleSourceCgroupPrefix+path, err)
 		if err != nil {
 			general.Errorf("GetCgroupStats %v err %v", path, err)
 			continue
@@ -259,26 +736,244 @@ func (m *MalachiteMetricsFetcher) updateCgroupData() {
 }
 
 // Get raw cgroup data by malachite sdk and set container metrics to metricStore, GC not existed pod metrics
-func (m *MalachiteMetricsFetcher) updatePodsCgroupData(ctx context.Context) {
-	podsContainersStats, err := m.malachiteClient.GetAllPodContainersStats(ctx)
+func (m *MalachiteMetricsFetcher) updatePodsCgroupData(ctx context.Context, result *CycleResult) {
+	podsContainersStats, err := m.fetchPodsContainersStats(ctx)
+	result.recordSource(CycleSourcePods, err)
 	if err != nil {
 		klog.Errorf("[malachite] GetAllPodsContainersStats failed, error %v", err)
 		_ = m.emitter.StoreInt64(metricsNameMalachiteGetPodStatusFailed, 1, metrics.MetricTypeNameCount)
 	}
 
+	pods, err := m.podFetcher.GetPodList(ctx, func(_ *v1.Pod) bool { return true })
+	result.recordSource(CycleSourcePodList, err)
+	if err != nil {
+		klog.Errorf("[malachite] get pod list failed, err %v", err)
+	} else {
+		m.updateContainerStartTime(pods)
+		m.updateMemBandwidthExcludedPods(pods)
+		m.updatePodWorkloads(pods)
+	}
+	m.processPodsContainersStats(podsContainersStats)
+
+	if m.metricConf.MemBandwidthConsistencyCheck {
+		m.checkMemBandwidthConsistency(podsContainersStats)
+	}
+}
+
+// processPodsContainersStats sets metrics of all containers, and then GC states of pods not existing any more
+func (m *MalachiteMetricsFetcher) processPodsContainersStats(podsContainersStats map[string]map[string]*types.MalachiteCgroupInfo) {
+	m.snapshotPreviousCounters(podsContainersStats)
+	m.processSharedCgroupMemBandwidth(podsContainersStats)
+	m.startDerivedOutcomeCycle()
 	podUIDSet := make(map[string]bool)
+	processed := int64(0)
 	for podUID, containerStats := range podsContainersStats {
 		podUIDSet[podUID] = true
 		for containerName, cgStats := range containerStats {
-			m.processContainerCPUData(podUID, containerName, cgStats)
-			m.processContainerMemoryData(podUID, containerName, cgStats)
-			m.processContainerBlkIOData(podUID, containerName, cgStats)
-			m.processContainerNetData(podUID, containerName, cgStats)
-			m.processContainerPerfData(podUID, containerName, cgStats)
-			m.processContainerPerNumaMemoryData(podUID, containerName, cgStats)
+			if cgStats != nil {
+				m.checkCgroupType(cgStats)
+				if cgroupVersion := cgroupVersionOf(cgStats); !m.isCgroupVersionAllowed(cgroupVersion) {
+					m.recordCgroupVersionSkipped(podUID, containerName, cgroupVersion)
+					continue
+				}
+			}
+			m.recordContainerError(podUID, containerName, m.processContainerStats(podUID, containerName, cgStats))
+			m.captureContainerDebug(podUID, containerName, cgStats)
+			processed++
 		}
 	}
+	m.recordContainersProcessed(processed)
+	m.finishDerivedOutcomeCycle()
+	m.releasePreviousCounters()
+	m.derivationCycles++
+	// samples of all containers have been counted, and states of those not existing are dropped as well
+	m.rateSkippedContainers = nil
+	m.rateClockJumpSamples = nil
+	m.processNodeTenantMemBandwidth(podsContainersStats)
+	m.processWorkloadMemBandwidth(podsContainersStats)
+	m.processContainerMemBandwidthShare(podsContainersStats)
+	m.processContainerEnergy(podsContainersStats)
+	podUIDSet = m.tombstoneMissingPods(podUIDSet, time.Now())
 	m.metricStore.GCPodsMetric(podUIDSet)
+	m.gcMemBandwidthReplaySamples(podUIDSet)
+	m.gcContainerErrors(podUIDSet)
+	m.gcDebugCaptures(podUIDSet)
+	m.gcMemBandwidthBaselines(podUIDSet)
+	m.gcMemBandwidthTrends(podUIDSet)
+	m.gcCounterAdvances(podUIDSet)
+	m.gcContainerMemPolicies(podUIDSet)
+	m.gcContainerIOLimitDevices(podUIDSet)
+}
+
+// checkCgroupType logs once for each cgroup type not recognized, since no metric of the
+// container can be processed for it.
+func (m *MalachiteMetricsFetcher) checkCgroupType(cgStats *types.MalachiteCgroupInfo) {
+	cgroupVersion := cgroupVersionOf(cgStats)
+	if cgroupVersion == "" || isCgroupV1(cgStats) || isCgroupV2(cgStats) || m.unknownCgroupTypes.Has(cgroupVersion) {
+		return
+	}
+	m.unknownCgroupTypes.Insert(cgroupVersion)
+	klog.Warningf("[malachite] unknown cgroup type %q, metrics of containers with it will be missing", cgStats.CgroupType)
+}
+
+// isCgroupVersionAllowed returns true if containers of the cgroup version should be processed
+func (m *MalachiteMetricsFetcher) isCgroupVersionAllowed(cgroupType string) bool {
+	if len(m.metricConf.CgroupVersionAllowList) == 0 {
+		return true
+	}
+
+	for _, version := range m.metricConf.CgroupVersionAllowList {
+		if version == cgroupType {
+			return true
+		}
+	}
+	return false
+}
+
+// recordContainersProcessed records the number of containers processed in the cycle, including those failed
+func (m *MalachiteMetricsFetcher) recordContainersProcessed(processed int64) {
+	atomic.StoreInt64(&m.containersProcessed, processed)
+	atomic.AddInt64(&m.containersProcessedTotal, processed)
+	_ = m.emitter.StoreInt64(metricsNameMalachiteContainersProcessed, processed, metrics.MetricTypeNameRaw)
+	_ = m.emitter.StoreInt64(metricsNameMalachiteProcessedTotal, processed, metrics.MetricTypeNameCount)
+}
+
+// GetContainersProcessed returns the number of containers processed in the last sampling cycle and the
+// cumulative total since startup, which can be combined with the cycle duration to estimate the cost of each.
+func (m *MalachiteMetricsFetcher) GetContainersProcessed() (lastCycle, total int64) {
+	return atomic.LoadInt64(&m.containersProcessed), atomic.LoadInt64(&m.containersProcessedTotal)
+}
+
+// recordCgroupVersionSkipped counts the container skipped for its cgroup version, and logs it with rate limited
+func (m *MalachiteMetricsFetcher) recordCgroupVersionSkipped(podUID, containerName, cgroupType string) {
+	m.cgroupVersionSkipped++
+	_ = m.emitter.StoreInt64(metricsNameMalachiteCgroupVersionSkipped, 1, metrics.MetricTypeNameCount,
+		metrics.MetricTag{Key: "version", Val: cgroupType})
+	if m.cgroupVersionSkipLog.Allow() {
+		klog.Warningf("[malachite] skip container %v/%v with cgroup version %q not in allow list %v (%v skipped in total)",
+			podUID, containerName, cgroupType, m.metricConf.CgroupVersionAllowList, m.cgroupVersionSkipped)
+	}
+}
+
+// ProcessContainerStats sets metrics of the container with the given cgroup stats on demand, i.e. for debugging,
+// rather than waiting for the next sampling cycle, and it goes through the same processing as the cycle does.
+func (m *MalachiteMetricsFetcher) ProcessContainerStats(podUID, containerName string, cgStats *types.MalachiteCgroupInfo) error {
+	m.cycleLock.Lock()
+	defer m.cycleLock.Unlock()
+	if m.closed {
+		return fmt.Errorf("metrics fetcher is closed")
+	}
+
+	if cgStats != nil && !m.isCgroupVersionAllowed(cgroupVersionOf(cgStats)) {
+		return fmt.Errorf("cgroup version %q is not in allow list %v", cgroupVersionOf(cgStats), m.metricConf.CgroupVersionAllowList)
+	}
+
+	err := m.processContainerStats(podUID, containerName, cgStats)
+	m.recordContainerError(podUID, containerName, err)
+	return err
+}
+
+// processContainerStats sets all metrics of the container, and the panic during processing is
+// recovered and returned as error, so that a malformed container won't abort the whole cycle.
+func (m *MalachiteMetricsFetcher) processContainerStats(podUID, containerName string, cgStats *types.MalachiteCgroupInfo) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic when processing container: %v", r)
+		}
+	}()
+
+	delete(m.rateSkippedContainers, containerMetricKey{podUID: podUID, containerName: containerName})
+	delete(m.rateClockJumpSamples, containerMetricKey{podUID: podUID, containerName: containerName})
+	if cgStats == nil {
+		return fmt.Errorf("cgroup stats is nil")
+	}
+
+	m.processContainerCPUData(podUID, containerName, cgStats)
+	m.processContainerMemoryData(podUID, containerName, cgStats)
+	m.processContainerBlkIOData(podUID, containerName, cgStats)
+	m.processContainerIOLimits(podUID, containerName, cgStats)
+	m.processContainerNetData(podUID, containerName, cgStats)
+	m.processContainerPerfData(podUID, containerName, cgStats)
+	m.processContainerPerNumaMemoryData(podUID, containerName, cgStats)
+	m.processContainerPidsData(podUID, containerName, cgStats)
+	m.processContainerSchedLatencyData(podUID, containerName, cgStats)
+	m.processContainerHugePageData(podUID, containerName, cgStats)
+	m.processContainerMemPolicy(podUID, containerName, cgStats)
+	m.processContainerFreezeState(podUID, containerName, cgStats)
+	m.processContainerCounterStaleness(podUID, containerName, cgStats)
+
+	// cross-metric derivations should be done after all raw metrics are updated
+	now := time.Now()
+	m.processContainerMemBandwidthIntensity(podUID, containerName, now)
+	m.processContainerMemBandwidthAnomaly(podUID, containerName, now)
+	m.processContainerMemBandwidthTrend(podUID, containerName, now)
+	m.processContainerMemBandwidthPressureClass(podUID, containerName, now)
+	return nil
+}
+
+// recordContainerError records the processing result of the container, and the
+// last error is cleared if the container is processed successfully.
+func (m *MalachiteMetricsFetcher) recordContainerError(podUID, containerName string, err error) {
+	m.containerErrorLock.Lock()
+	defer m.containerErrorLock.Unlock()
+
+	if err == nil {
+		if _, ok := m.containerErrors[podUID]; ok {
+			delete(m.containerErrors[podUID], containerName)
+			if len(m.containerErrors[podUID]) == 0 {
+				delete(m.containerErrors, podUID)
+			}
+		}
+		return
+	}
+
+	klog.Errorf("[malachite] process container %v/%v failed: %v", podUID, containerName, err)
+	_ = m.emitter.StoreInt64(metricsNameMalachiteContainerFailed, 1, metrics.MetricTypeNameCount,
+		metrics.MetricTag{Key: "pod", Val: podUID}, metrics.MetricTag{Key: "container", Val: containerName})
+	if _, ok := m.containerErrors[podUID]; !ok {
+		m.containerErrors[podUID] = make(map[string]error)
+	}
+	m.containerErrors[podUID][containerName] = err
+}
+
+// gcContainerErrors removes errors of pods that are not existed any more
+func (m *MalachiteMetricsFetcher) gcContainerErrors(podUIDSet map[string]bool) {
+	m.containerErrorLock.Lock()
+	defer m.containerErrorLock.Unlock()
+
+	for podUID := range m.containerErrors {
+		if !podUIDSet[podUID] {
+			delete(m.containerErrors, podUID)
+		}
+	}
+}
+
+// GetContainerLastError returns the error of the last failed processing of the container,
+// and nil is returned if the container was processed successfully in the last cycle.
+func (m *MalachiteMetricsFetcher) GetContainerLastError(podUID, containerName string) error {
+	m.containerErrorLock.RLock()
+	defer m.containerErrorLock.RUnlock()
+	return m.containerErrors[podUID][containerName]
+}
+
+// updateContainerStartTime refreshes the start time of all running containers,
+// containers that are not running any more will be removed
+func (m *MalachiteMetricsFetcher) updateContainerStartTime(pods []*v1.Pod) {
+	containerStartTime := make(map[string]map[string]time.Time)
+	for _, p := range pods {
+		podUID := string(p.UID)
+		for _, containerStatus := range p.Status.ContainerStatuses {
+			if containerStatus.State.Running == nil {
+				continue
+			}
+
+			if _, ok := containerStartTime[podUID]; !ok {
+				containerStartTime[podUID] = make(map[string]time.Time)
+			}
+			containerStartTime[podUID][containerStatus.Name] = containerStatus.State.Running.StartedAt.Time
+		}
+	}
+	m.containerStartTime = containerStartTime
 }
 
 // notifySystem notifies system-related data
@@ -287,56 +982,36 @@ func (m *MalachiteMetricsFetcher) notifySystem() {
 	m.RLock()
 	defer m.RUnlock()
 
-	for _, reg := range m.registeredNotifier[metric.MetricsScopeNode] {
+	for key, reg := range m.registeredNotifier[metric.MetricsScopeNode] {
 		v, err := m.metricStore.GetNodeMetric(reg.Req.MetricName)
 		if err != nil {
 			continue
-		} else if v.Time == nil {
-			v.Time = &now
-		}
-		reg.Response <- metric.NotifiedResponse{
-			Req:        reg.Req,
-			MetricData: v,
 		}
+		m.notify(key, reg, v, now)
 	}
 
-	for _, reg := range m.registeredNotifier[metric.MetricsScopeDevice] {
+	for key, reg := range m.registeredNotifier[metric.MetricsScopeDevice] {
 		v, err := m.metricStore.GetDeviceMetric(reg.Req.DeviceID, reg.Req.MetricName)
 		if err != nil {
 			continue
-		} else if v.Time == nil {
-			v.Time = &now
-		}
-		reg.Response <- metric.NotifiedResponse{
-			Req:        reg.Req,
-			MetricData: v,
 		}
+		m.notify(key, reg, v, now)
 	}
 
-	for _, reg := range m.registeredNotifier[metric.MetricsScopeNuma] {
+	for key, reg := range m.registeredNotifier[metric.MetricsScopeNuma] {
 		v, err := m.metricStore.GetNumaMetric(reg.Req.NumaID, reg.Req.MetricName)
 		if err != nil {
 			continue
-		} else if v.Time == nil {
-			v.Time = &now
-		}
-		reg.Response <- metric.NotifiedResponse{
-			Req:        reg.Req,
-			MetricData: v,
 		}
+		m.notify(key, reg, v, now)
 	}
 
-	for _, reg := range m.registeredNotifier[metric.MetricsScopeCPU] {
+	for key, reg := range m.registeredNotifier[metric.MetricsScopeCPU] {
 		v, err := m.metricStore.GetCPUMetric(reg.Req.CoreID, reg.Req.MetricName)
 		if err != nil {
 			continue
-		} else if v.Time == nil {
-			v.Time = &now
-		}
-		reg.Response <- metric.NotifiedResponse{
-			Req:        reg.Req,
-			MetricData: v,
 		}
+		m.notify(key, reg, v, now)
 	}
 }
 
@@ -346,17 +1021,12 @@ func (m *MalachiteMetricsFetcher) notifyPods() {
 	m.RLock()
 	defer m.RUnlock()
 
-	for _, reg := range m.registeredNotifier[metric.MetricsScopeContainer] {
+	for key, reg := range m.registeredNotifier[metric.MetricsScopeContainer] {
 		v, err := m.metricStore.GetContainerMetric(reg.Req.PodUID, reg.Req.ContainerName, reg.Req.MetricName)
 		if err != nil {
 			continue
-		} else if v.Time == nil {
-			v.Time = &now
-		}
-		reg.Response <- metric.NotifiedResponse{
-			Req:        reg.Req,
-			MetricData: v,
 		}
+		m.notify(key, reg, v, now)
 
 		if reg.Req.NumaID == 0 {
 			continue
@@ -365,16 +1035,48 @@ func (m *MalachiteMetricsFetcher) notifyPods() {
 		v, err = m.metricStore.GetContainerNumaMetric(reg.Req.PodUID, reg.Req.ContainerName, fmt.Sprintf("%v", reg.Req.NumaID), reg.Req.MetricName)
 		if err != nil {
 			continue
-		} else if v.Time == nil {
-			v.Time = &now
-		}
-		reg.Response <- metric.NotifiedResponse{
-			Req:        reg.Req,
-			MetricData: v,
 		}
+		m.notify(key+notifiedKeySuffixNuma, reg, v, now)
+	}
+}
+
+// notify sends metric data to the registered channel; if emit-on-change is enabled,
+// unchanged data will only be sent once in each keepalive interval.
+func (m *MalachiteMetricsFetcher) notify(key string, reg metric.NotifiedData, v utilmetric.MetricData, now time.Time) {
+	if v.Time == nil {
+		v.Time = &now
+	}
+
+	if !m.shouldNotify(key, v.Value, now) {
+		return
+	}
+
+	reg.Response <- metric.NotifiedResponse{
+		Req:        reg.Req,
+		MetricData: v,
 	}
 }
 
+// shouldNotify checks whether the value has changed (beyond the tolerance) since it
+// was sent last time or the keepalive interval has passed, and records it if true.
+func (m *MalachiteMetricsFetcher) shouldNotify(key string, value float64, now time.Time) bool {
+	if !m.metricConf.NotifierEmitOnChange {
+		return true
+	}
+
+	m.notifiedLock.Lock()
+	defer m.notifiedLock.Unlock()
+
+	if last, ok := m.lastNotified[key]; ok &&
+		math.Abs(value-last.value) <= m.metricConf.NotifierChangeTolerance &&
+		now.Sub(last.timestamp) < m.metricConf.NotifierKeepAliveInterval {
+		return false
+	}
+
+	m.lastNotified[key] = notifiedRecord{value: value, timestamp: now}
+	return true
+}
+
 func (m *MalachiteMetricsFetcher) processSystemComputeData(systemComputeData *types.SystemComputeData) {
 	// todo, currently we only get a unified data for the whole system compute data
 	updateTime := time.Unix(systemComputeData.UpdateTime, 0)
@@ -529,10 +1231,40 @@ func (m *MalachiteMetricsFetcher) processSystemCPUComputeData(systemComputeData
 	}
 	m.metricStore.SetNodeMetric(consts.MetricCPUUsageRatio,
 		utilmetric.MetricData{Value: systemComputeData.GlobalCPU.CPUUsage / 100.0, Time: &updateTime})
+
+	m.processSystemCPUStealData(systemComputeData)
+	m.processSystemSocketEnergy(systemComputeData)
+	m.processSystemCPUFrequency(systemComputeData)
+}
+
+// processSystemCPUFrequency stores the current frequency of each cpu reporting it, and the average of them
+// as the frequency of the node, and nothing is stored if none of cpus reports it.
+func (m *MalachiteMetricsFetcher) processSystemCPUFrequency(systemComputeData *types.SystemComputeData) {
+	updateTime := time.Unix(systemComputeData.UpdateTime, 0)
+
+	var sum float64
+	var count int
+	for _, cpu := range systemComputeData.CPU {
+		if cpu.FrequencyMHz == nil {
+			continue
+		}
+		cpuID, err := strconv.Atoi(strings.TrimPrefix(strings.ToLower(cpu.Name), "cpu"))
+		if err != nil {
+			continue
+		}
+		m.metricStore.SetCPUMetric(cpuID, consts.MetricCPUFrequencyCPU,
+			utilmetric.MetricData{Value: *cpu.FrequencyMHz, Time: &updateTime})
+		sum += *cpu.FrequencyMHz
+		count++
+	}
+	if count == 0 {
+		return
+	}
+	m.metricStore.SetNodeMetric(consts.MetricCPUFrequencyNode, utilmetric.MetricData{Value: sum / float64(count), Time: &updateTime})
 }
 
 func (m *MalachiteMetricsFetcher) processCgroupCPUData(cgroupPath string, cgStats *types.MalachiteCgroupInfo) {
-	if cgStats.CgroupType == "V1" {
+	if isCgroupV1(cgStats) {
 		cpu := cgStats.V1.Cpu
 		updateTime := time.Unix(cgStats.V1.Cpu.UpdateTime, 0)
 
@@ -558,7 +1290,7 @@ func (m *MalachiteMetricsFetcher) processCgroupCPUData(cgroupPath string, cgStat
 		m.metricStore.SetCgroupMetric(cgroupPath, consts.MetricLoad5MinCgroup, utilmetric.MetricData{Value: cpu.Load.Five, Time: &updateTime})
 		m.metricStore.SetCgroupMetric(cgroupPath, consts.MetricLoad15MinCgroup, utilmetric.MetricData{Value: cpu.Load.Fifteen, Time: &updateTime})
 
-	} else if cgStats.CgroupType == "V2" {
+	} else if isCgroupV2(cgStats) {
 		cpu := cgStats.V2.Cpu
 		updateTime := time.Unix(cgStats.V2.Cpu.UpdateTime, 0)
 
@@ -579,7 +1311,7 @@ func (m *MalachiteMetricsFetcher) processCgroupCPUData(cgroupPath string, cgStat
 }
 
 func (m *MalachiteMetricsFetcher) processCgroupMemoryData(cgroupPath string, cgStats *types.MalachiteCgroupInfo) {
-	if cgStats.CgroupType == "V1" {
+	if isCgroupV1(cgStats) {
 		mem := cgStats.V1.Memory
 		updateTime := time.Unix(cgStats.V1.Memory.UpdateTime, 0)
 
@@ -600,7 +1332,7 @@ func (m *MalachiteMetricsFetcher) processCgroupMemoryData(cgroupPath string, cgS
 
 		m.metricStore.SetCgroupMetric(cgroupPath, consts.MetricMemOomCgroup, utilmetric.MetricData{Time: &updateTime, Value: float64(mem.OomCnt)})
 		m.metricStore.SetCgroupMetric(cgroupPath, consts.MetricMemScaleFactorCgroup, utilmetric.MetricData{Time: &updateTime, Value: general.UIntPointerToFloat64(mem.WatermarkScaleFactor)})
-	} else if cgStats.CgroupType == "V2" {
+	} else if isCgroupV2(cgStats) {
 		mem := cgStats.V2.Memory
 		updateTime := time.Unix(cgStats.V2.Memory.UpdateTime, 0)
 		m.metricStore.SetCgroupMetric(cgroupPath, consts.MetricMemUsageCgroup, utilmetric.MetricData{Value: float64(mem.MemoryUsageInBytes), Time: &updateTime})
@@ -618,7 +1350,7 @@ func (m *MalachiteMetricsFetcher) processCgroupMemoryData(cgroupPath string, cgS
 
 func (m *MalachiteMetricsFetcher) processCgroupBlkIOData(cgroupPath string, cgStats *types.MalachiteCgroupInfo) {
 
-	if cgStats.CgroupType == "V1" {
+	if isCgroupV1(cgStats) {
 		updateTime := time.Unix(cgStats.V1.Blkio.UpdateTime, 0)
 
 		io := cgStats.V1.Blkio
@@ -626,7 +1358,7 @@ func (m *MalachiteMetricsFetcher) processCgroupBlkIOData(cgroupPath string, cgSt
 		m.metricStore.SetCgroupMetric(cgroupPath, consts.MetricBlkioWriteIopsCgroup, utilmetric.MetricData{Time: &updateTime, Value: float64(io.BpfFsData.FsWrite - io.OldBpfFsData.FsWrite)})
 		m.metricStore.SetCgroupMetric(cgroupPath, consts.MetricBlkioReadBpsCgroup, utilmetric.MetricData{Time: &updateTime, Value: float64(io.BpfFsData.FsReadBytes - io.OldBpfFsData.FsReadBytes)})
 		m.metricStore.SetCgroupMetric(cgroupPath, consts.MetricBlkioWriteBpsCgroup, utilmetric.MetricData{Time: &updateTime, Value: float64(io.BpfFsData.FsWriteBytes - io.OldBpfFsData.FsWriteBytes)})
-	} else if cgStats.CgroupType == "V2" {
+	} else if isCgroupV2(cgStats) {
 		io := cgStats.V2.Blkio
 		updateTime := time.Unix(cgStats.V2.Blkio.UpdateTime, 0)
 
@@ -641,10 +1373,10 @@ func (m *MalachiteMetricsFetcher) processCgroupNetData(cgroupPath string, cgStat
 	updateTime := time.Now()
 
 	var net *types.NetClsCgData
-	if cgStats.CgroupType == "V1" {
+	if isCgroupV1(cgStats) {
 		net = cgStats.V1.NetCls
 		updateTime = time.Unix(cgStats.V1.Blkio.UpdateTime, 0)
-	} else if cgStats.CgroupType == "V2" {
+	} else if isCgroupV2(cgStats) {
 		net = cgStats.V2.NetCls
 		updateTime = time.Unix(cgStats.V2.Blkio.UpdateTime, 0)
 	}
@@ -658,7 +1390,7 @@ func (m *MalachiteMetricsFetcher) processCgroupNetData(cgroupPath string, cgStat
 }
 
 func (m *MalachiteMetricsFetcher) processCgroupPerNumaMemoryData(cgroupPath string, cgStats *types.MalachiteCgroupInfo) {
-	if cgStats.CgroupType == "V1" {
+	if isCgroupV1(cgStats) {
 		numaStats := cgStats.V1.Memory.NumaStats
 		updateTime := time.Unix(cgStats.V1.Memory.UpdateTime, 0)
 
@@ -668,7 +1400,7 @@ func (m *MalachiteMetricsFetcher) processCgroupPerNumaMemoryData(cgroupPath stri
 			m.metricStore.SetCgroupNumaMetric(cgroupPath, numaID, consts.MetricsMemFilePerNumaCgroup, utilmetric.MetricData{Time: &updateTime, Value: float64(data.File << pageShift)})
 			m.metricStore.SetCgroupNumaMetric(cgroupPath, numaID, consts.MetricsMemAnonPerNumaCgroup, utilmetric.MetricData{Time: &updateTime, Value: float64(data.Anon << pageShift)})
 		}
-	} else if cgStats.CgroupType == "V2" {
+	} else if isCgroupV2(cgStats) {
 		numaStats := cgStats.V2.Memory.MemNumaStats
 		updateTime := time.Unix(cgStats.V2.Memory.UpdateTime, 0)
 
@@ -684,14 +1416,18 @@ func (m *MalachiteMetricsFetcher) processCgroupPerNumaMemoryData(cgroupPath stri
 
 func (m *MalachiteMetricsFetcher) processContainerCPUData(podUID, containerName string, cgStats *types.MalachiteCgroupInfo) {
 	var (
-		metricLastUpdateTime, _ = m.metricStore.GetContainerMetric(podUID, containerName, consts.MetricCPUUpdateTimeContainer)
-		cyclesOld, _            = m.GetContainerMetric(podUID, containerName, consts.MetricCPUCyclesContainer)
-		instructionsOld, _      = m.GetContainerMetric(podUID, containerName, consts.MetricCPUInstructionsContainer)
+		metricLastUpdateTime = m.getPreviousContainerCounter(podUID, containerName, consts.MetricCPUUpdateTimeContainer)
+		cyclesOld            = m.getPreviousContainerCounter(podUID, containerName, consts.MetricCPUCyclesContainer)
+		instructionsOld      = m.getPreviousContainerCounter(podUID, containerName, consts.MetricCPUInstructionsContainer)
 	)
 
-	m.processContainerMemBandwidth(podUID, containerName, cgStats, metricLastUpdateTime.Value)
+	memBandwidthBytes, memBandwidthBytesOK := m.processContainerMemBandwidth(podUID, containerName, cgStats, metricLastUpdateTime.Value)
+	m.processContainerPageWalk(podUID, containerName, cgStats)
+	m.processContainerCPUContention(podUID, containerName, cgStats, int64(metricLastUpdateTime.Value))
+	m.processContainerCPUThrottleToUsageRatio(podUID, containerName, cgStats)
+	m.processContainerCPUWeight(podUID, containerName, cgStats)
 
-	if cgStats.CgroupType == "V1" {
+	if isCgroupV1(cgStats) {
 		cpu := cgStats.V1.Cpu
 		updateTime := time.Unix(cgStats.V1.Cpu.UpdateTime, 0)
 
@@ -743,6 +1479,14 @@ func (m *MalachiteMetricsFetcher) processContainerCPUData(podUID, containerName
 			utilmetric.MetricData{Value: float64(cpu.StoreInstructions), Time: &updateTime})
 		m.metricStore.SetContainerMetric(podUID, containerName, consts.MetricCPUUpdateTimeContainer,
 			utilmetric.MetricData{Value: float64(cpu.UpdateTime), Time: &updateTime})
+		if cpu.MonotonicTime > 0 {
+			m.metricStore.SetContainerMetric(podUID, containerName, consts.MetricCPUMonotonicTimeContainer,
+				utilmetric.MetricData{Value: float64(cpu.MonotonicTime), Time: &updateTime})
+		}
+		if cpu.UpdateTimeNano > 0 {
+			m.metricStore.SetContainerMetric(podUID, containerName, consts.MetricCPUUpdateTimeNanoContainer,
+				utilmetric.MetricData{Value: float64(cpu.UpdateTimeNano), Time: &updateTime})
+		}
 		m.metricStore.SetContainerMetric(podUID, containerName, consts.MetricCPUCyclesContainer,
 			utilmetric.MetricData{Value: float64(cpu.Cycles), Time: &updateTime})
 		m.metricStore.SetContainerMetric(podUID, containerName, consts.MetricCPUInstructionsContainer,
@@ -750,13 +1494,16 @@ func (m *MalachiteMetricsFetcher) processContainerCPUData(podUID, containerName
 
 		if cyclesOld.Value > 0 && instructionsOld.Value > 0 {
 			instructionDiff := float64(cpu.Instructions) - instructionsOld.Value
+			if memBandwidthBytesOK {
+				m.processContainerBandwidthPerInstruction(podUID, containerName, instructionDiff, memBandwidthBytes, cpu.UpdateTime)
+			}
 			if instructionDiff > 0 {
 				cpi := (float64(cpu.Cycles) - cyclesOld.Value) / instructionDiff
 				m.metricStore.SetContainerMetric(podUID, containerName, consts.MetricCPUCPIContainer,
 					utilmetric.MetricData{Value: cpi, Time: &updateTime})
 			}
 		}
-	} else if cgStats.CgroupType == "V2" {
+	} else if isCgroupV2(cgStats) {
 		cpu := cgStats.V2.Cpu
 		updateTime := time.Unix(cgStats.V2.Cpu.UpdateTime, 0)
 
@@ -769,6 +1516,11 @@ func (m *MalachiteMetricsFetcher) processContainerCPUData(podUID, containerName
 		m.metricStore.SetContainerMetric(podUID, containerName, consts.MetricCPUUsageSysContainer,
 			utilmetric.MetricData{Value: cpu.CPUSysUsageRatio, Time: &updateTime})
 
+		m.metricStore.SetContainerMetric(podUID, containerName, consts.MetricCPUNrThrottledContainer,
+			utilmetric.MetricData{Value: float64(cpu.CPUStats.NrThrottled), Time: &updateTime})
+		m.metricStore.SetContainerMetric(podUID, containerName, consts.MetricCPUThrottledPeriodContainer,
+			utilmetric.MetricData{Value: float64(cpu.CPUStats.NrPeriods), Time: &updateTime})
+
 		m.metricStore.SetContainerMetric(podUID, containerName, consts.MetricCPUNrRunnableContainer,
 			utilmetric.MetricData{Value: float64(cpu.TaskNrRunning), Time: &updateTime})
 		m.metricStore.SetContainerMetric(podUID, containerName, consts.MetricCPUNrUninterruptibleContainer,
@@ -793,6 +1545,14 @@ func (m *MalachiteMetricsFetcher) processContainerCPUData(podUID, containerName
 			utilmetric.MetricData{Value: float64(cpu.StoreInstructions), Time: &updateTime})
 		m.metricStore.SetContainerMetric(podUID, containerName, consts.MetricCPUUpdateTimeContainer,
 			utilmetric.MetricData{Value: float64(cpu.UpdateTime), Time: &updateTime})
+		if cpu.MonotonicTime > 0 {
+			m.metricStore.SetContainerMetric(podUID, containerName, consts.MetricCPUMonotonicTimeContainer,
+				utilmetric.MetricData{Value: float64(cpu.MonotonicTime), Time: &updateTime})
+		}
+		if cpu.UpdateTimeNano > 0 {
+			m.metricStore.SetContainerMetric(podUID, containerName, consts.MetricCPUUpdateTimeNanoContainer,
+				utilmetric.MetricData{Value: float64(cpu.UpdateTimeNano), Time: &updateTime})
+		}
 		m.metricStore.SetContainerMetric(podUID, containerName, consts.MetricCPUCyclesContainer,
 			utilmetric.MetricData{Value: float64(cpu.Cycles), Time: &updateTime})
 		m.metricStore.SetContainerMetric(podUID, containerName, consts.MetricCPUInstructionsContainer,
@@ -800,6 +1560,9 @@ func (m *MalachiteMetricsFetcher) processContainerCPUData(podUID, containerName
 
 		if cyclesOld.Value > 0 && instructionsOld.Value > 0 {
 			instructionDiff := float64(cpu.Instructions) - instructionsOld.Value
+			if memBandwidthBytesOK {
+				m.processContainerBandwidthPerInstruction(podUID, containerName, instructionDiff, memBandwidthBytes, cpu.UpdateTime)
+			}
 			if instructionDiff > 0 {
 				cpi := (float64(cpu.Cycles) - cyclesOld.Value) / instructionDiff
 				m.metricStore.SetContainerMetric(podUID, containerName, consts.MetricCPUCPIContainer,
@@ -810,12 +1573,14 @@ func (m *MalachiteMetricsFetcher) processContainerCPUData(podUID, containerName
 }
 
 func (m *MalachiteMetricsFetcher) processContainerMemoryData(podUID, containerName string, cgStats *types.MalachiteCgroupInfo) {
-	if cgStats.CgroupType == "V1" {
+	m.processContainerPageFaults(podUID, containerName, cgStats)
+	m.processContainerOOMKills(podUID, containerName, cgStats)
+	m.processContainerSwap(podUID, containerName, cgStats)
+
+	if isCgroupV1(cgStats) {
 		mem := cgStats.V1.Memory
 		updateTime := time.Unix(cgStats.V1.Memory.UpdateTime, 0)
 
-		m.metricStore.SetContainerMetric(podUID, containerName, consts.MetricMemLimitContainer,
-			utilmetric.MetricData{Value: float64(mem.MemoryLimitInBytes), Time: &updateTime})
 		m.metricStore.SetContainerMetric(podUID, containerName, consts.MetricMemTCPLimitContainer,
 			utilmetric.MetricData{Value: float64(mem.KernTCPMemLimitInBytes), Time: &updateTime})
 		m.metricStore.SetContainerMetric(podUID, containerName, consts.MetricMemUsageContainer,
@@ -848,7 +1613,7 @@ func (m *MalachiteMetricsFetcher) processContainerMemoryData(podUID, containerNa
 			utilmetric.MetricData{Value: float64(mem.OomCnt), Time: &updateTime})
 		m.metricStore.SetContainerMetric(podUID, containerName, consts.MetricMemScaleFactorContainer,
 			utilmetric.MetricData{Value: general.UIntPointerToFloat64(mem.WatermarkScaleFactor), Time: &updateTime})
-	} else if cgStats.CgroupType == "V2" {
+	} else if isCgroupV2(cgStats) {
 		mem := cgStats.V2.Memory
 		updateTime := time.Unix(cgStats.V2.Memory.UpdateTime, 0)
 
@@ -871,69 +1636,107 @@ func (m *MalachiteMetricsFetcher) processContainerMemoryData(podUID, containerNa
 		m.metricStore.SetContainerMetric(podUID, containerName, consts.MetricMemScaleFactorContainer,
 			utilmetric.MetricData{Value: general.UInt64PointerToFloat64(mem.WatermarkScaleFactor), Time: &updateTime})
 	}
+
+	// the limit is not stored for unlimited cgroups, rather than the huge value reported for "max"
+	if limit, unlimited, updateTimeInSec, ok := getCgroupMemoryLimit(cgStats); ok && !unlimited {
+		updateTime := time.Unix(updateTimeInSec, 0)
+		m.metricStore.SetContainerMetric(podUID, containerName, consts.MetricMemLimitContainer,
+			utilmetric.MetricData{Value: float64(limit), Time: &updateTime})
+	}
+	m.processContainerMemUtilization(podUID, containerName, cgStats)
+
+	if workingSet, updateTimeInSec, ok := getCgroupMemoryWorkingSet(cgStats); ok {
+		updateTime := time.Unix(updateTimeInSec, 0)
+		m.metricStore.SetContainerMetric(podUID, containerName, consts.MetricMemWorkingSetContainer,
+			utilmetric.MetricData{Value: float64(workingSet), Time: &updateTime})
+	}
 }
 
 func (m *MalachiteMetricsFetcher) processContainerBlkIOData(podUID, containerName string, cgStats *types.MalachiteCgroupInfo) {
 	lastUpdateTime, _ := m.metricStore.GetContainerMetric(podUID, containerName, consts.MetricBlkioUpdateTimeContainer)
 
-	if cgStats.CgroupType == "V1" {
+	if isCgroupV1(cgStats) {
 		io := cgStats.V1.Blkio
 		updateTime := time.Unix(io.UpdateTime, 0)
 		updateTimestampInSec := updateTime.Unix()
 
 		m.setContainerRateMetric(podUID, containerName, consts.MetricBlkioReadIopsContainer,
-			func() float64 { return float64(uint64CounterDelta(io.OldBpfFsData.FsRead, io.BpfFsData.FsRead)) },
+			func() float64 {
+				return float64(m.counterDelta(consts.MetricBlkioReadIopsContainer, io.OldBpfFsData.FsRead, io.BpfFsData.FsRead))
+			},
 			int64(lastUpdateTime.Value), updateTimestampInSec)
 		m.setContainerRateMetric(podUID, containerName, consts.MetricBlkioWriteIopsContainer,
-			func() float64 { return float64(uint64CounterDelta(io.OldBpfFsData.FsWrite, io.BpfFsData.FsWrite)) },
+			func() float64 {
+				return float64(m.counterDelta(consts.MetricBlkioWriteIopsContainer, io.OldBpfFsData.FsWrite, io.BpfFsData.FsWrite))
+			},
 			int64(lastUpdateTime.Value), updateTimestampInSec)
 		m.setContainerRateMetric(podUID, containerName, consts.MetricBlkioReadBpsContainer,
 			func() float64 {
-				return float64(uint64CounterDelta(io.OldBpfFsData.FsReadBytes, io.BpfFsData.FsReadBytes))
+				return float64(m.counterDelta(consts.MetricBlkioReadBpsContainer, io.OldBpfFsData.FsReadBytes, io.BpfFsData.FsReadBytes))
 			},
 			int64(lastUpdateTime.Value), updateTimestampInSec)
 		m.setContainerRateMetric(podUID, containerName, consts.MetricBlkioWriteBpsContainer,
 			func() float64 {
-				return float64(uint64CounterDelta(io.OldBpfFsData.FsWriteBytes, io.BpfFsData.FsWriteBytes))
+				return float64(m.counterDelta(consts.MetricBlkioWriteBpsContainer, io.OldBpfFsData.FsWriteBytes, io.BpfFsData.FsWriteBytes))
 			},
 			int64(lastUpdateTime.Value), updateTimestampInSec)
 
 		m.metricStore.SetContainerMetric(podUID, containerName, consts.MetricBlkioUpdateTimeContainer,
 			utilmetric.MetricData{Value: float64(updateTimestampInSec), Time: &updateTime})
-	} else if cgStats.CgroupType == "V2" {
+	} else if isCgroupV2(cgStats) {
 		io := cgStats.V2.Blkio
 		updateTime := time.Unix(io.UpdateTime, 0)
 		updateTimestampInSec := updateTime.Unix()
 
 		m.setContainerRateMetric(podUID, containerName, consts.MetricBlkioReadIopsContainer,
-			func() float64 { return float64(uint64CounterDelta(io.OldBpfFsData.FsRead, io.BpfFsData.FsRead)) },
+			func() float64 {
+				return float64(m.counterDelta(consts.MetricBlkioReadIopsContainer, io.OldBpfFsData.FsRead, io.BpfFsData.FsRead))
+			},
 			int64(lastUpdateTime.Value), updateTimestampInSec)
 		m.setContainerRateMetric(podUID, containerName, consts.MetricBlkioWriteIopsContainer,
-			func() float64 { return float64(uint64CounterDelta(io.OldBpfFsData.FsWrite, io.BpfFsData.FsWrite)) },
+			func() float64 {
+				return float64(m.counterDelta(consts.MetricBlkioWriteIopsContainer, io.OldBpfFsData.FsWrite, io.BpfFsData.FsWrite))
+			},
 			int64(lastUpdateTime.Value), updateTimestampInSec)
 		m.setContainerRateMetric(podUID, containerName, consts.MetricBlkioReadBpsContainer,
 			func() float64 {
-				return float64(uint64CounterDelta(io.OldBpfFsData.FsReadBytes, io.BpfFsData.FsReadBytes))
+				return float64(m.counterDelta(consts.MetricBlkioReadBpsContainer, io.OldBpfFsData.FsReadBytes, io.BpfFsData.FsReadBytes))
 			},
 			int64(lastUpdateTime.Value), updateTimestampInSec)
 		m.setContainerRateMetric(podUID, containerName, consts.MetricBlkioWriteBpsContainer,
 			func() float64 {
-				return float64(uint64CounterDelta(io.OldBpfFsData.FsWriteBytes, io.BpfFsData.FsWriteBytes))
+				return float64(m.counterDelta(consts.MetricBlkioWriteBpsContainer, io.OldBpfFsData.FsWriteBytes, io.BpfFsData.FsWriteBytes))
 			},
 			int64(lastUpdateTime.Value), updateTimestampInSec)
 
 		m.metricStore.SetContainerMetric(podUID, containerName, consts.MetricBlkioUpdateTimeContainer,
 			utilmetric.MetricData{Value: float64(io.UpdateTime), Time: &updateTime})
+
+		// io pressure is skipped if it's not reported, rather than reported as zero
+		if io.IoPressure != nil {
+			m.metricStore.SetContainerMetric(podUID, containerName, consts.MetricIOPressureSomeContainer,
+				utilmetric.MetricData{Value: io.IoPressure.Some.Avg10, Time: &updateTime})
+			m.metricStore.SetContainerMetric(podUID, containerName, consts.MetricIOPressureSomeAvg60Container,
+				utilmetric.MetricData{Value: io.IoPressure.Some.Avg60, Time: &updateTime})
+			m.metricStore.SetContainerMetric(podUID, containerName, consts.MetricIOPressureSomeAvg300Container,
+				utilmetric.MetricData{Value: io.IoPressure.Some.Avg300, Time: &updateTime})
+			m.metricStore.SetContainerMetric(podUID, containerName, consts.MetricIOPressureFullContainer,
+				utilmetric.MetricData{Value: io.IoPressure.Full.Avg10, Time: &updateTime})
+			m.metricStore.SetContainerMetric(podUID, containerName, consts.MetricIOPressureFullAvg60Container,
+				utilmetric.MetricData{Value: io.IoPressure.Full.Avg60, Time: &updateTime})
+			m.metricStore.SetContainerMetric(podUID, containerName, consts.MetricIOPressureFullAvg300Container,
+				utilmetric.MetricData{Value: io.IoPressure.Full.Avg300, Time: &updateTime})
+		}
 	}
 }
 
 func (m *MalachiteMetricsFetcher) processContainerNetData(podUID, containerName string, cgStats *types.MalachiteCgroupInfo) {
 	var net *types.NetClsCgData
 	var updateTime time.Time
-	if cgStats.CgroupType == "V1" {
+	if isCgroupV1(cgStats) {
 		net = cgStats.V1.NetCls
 		updateTime = time.Unix(cgStats.V1.NetCls.UpdateTime, 0)
-	} else if cgStats.CgroupType == "V2" {
+	} else if isCgroupV2(cgStats) {
 		net = cgStats.V2.NetCls
 		updateTime = time.Unix(cgStats.V2.NetCls.UpdateTime, 0)
 	}
@@ -955,10 +1758,10 @@ func (m *MalachiteMetricsFetcher) processContainerNetData(podUID, containerName
 func (m *MalachiteMetricsFetcher) processContainerPerfData(podUID, containerName string, cgStats *types.MalachiteCgroupInfo) {
 	var perf *types.PerfEventData
 	var updateTime time.Time
-	if cgStats.CgroupType == "V1" {
+	if isCgroupV1(cgStats) {
 		perf = cgStats.V1.PerfEvent
 		updateTime = time.Unix(cgStats.V1.PerfEvent.UpdateTime, 0)
-	} else if cgStats.CgroupType == "V2" {
+	} else if isCgroupV2(cgStats) {
 		perf = cgStats.V2.PerfEvent
 		updateTime = time.Unix(cgStats.V2.PerfEvent.UpdateTime, 0)
 	}
@@ -976,8 +1779,96 @@ func (m *MalachiteMetricsFetcher) processContainerPerfData(podUID, containerName
 		utilmetric.MetricData{Value: perf.L3CacheMiss, Time: &updateTime})
 }
 
+func (m *MalachiteMetricsFetcher) processContainerPidsData(podUID, containerName string, cgStats *types.MalachiteCgroupInfo) {
+	if current, updateTimeInSec, ok := getCgroupPidsCurrent(cgStats); ok {
+		updateTime := time.Unix(updateTimeInSec, 0)
+		m.metricStore.SetContainerMetric(podUID, containerName, consts.MetricThreadCountContainer,
+			utilmetric.MetricData{Value: float64(current), Time: &updateTime})
+	}
+}
+
+// processContainerSchedLatencyData stores percentiles of the runqueue wait distribution of the container as gauges,
+// and they are skipped if the distribution is not reported or there is no wait in it.
+func (m *MalachiteMetricsFetcher) processContainerSchedLatencyData(podUID, containerName string, cgStats *types.MalachiteCgroupInfo) {
+	buckets, updateTimeInSec, ok := getCgroupSchedLatency(cgStats)
+	if !ok {
+		return
+	}
+
+	updateTime := time.Unix(updateTimeInSec, 0)
+	for metricName, percentile := range map[string]float64{
+		consts.MetricSchedLatencyP50Container: 0.5,
+		consts.MetricSchedLatencyP99Container: 0.99,
+	} {
+		if !m.isDerivationDue(metricName) {
+			continue
+		}
+		if latency, ok := schedLatencyPercentile(buckets, percentile); ok {
+			m.metricStore.SetContainerMetric(podUID, containerName, metricName,
+				utilmetric.MetricData{Value: latency, Time: &updateTime})
+		}
+	}
+}
+
+// schedLatencyPercentile returns the upper bound of the bucket where the percentile falls in, and the
+// largest bounded one is used instead of the unbounded bucket. Buckets are sorted by their bounds first,
+// since the order of them reported is not guaranteed.
+func schedLatencyPercentile(buckets []types.SchedLatencyBucket, percentile float64) (float64, bool) {
+	sorted := append([]types.SchedLatencyBucket(nil), buckets...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].UpperBoundNs == 0 || sorted[j].UpperBoundNs == 0 {
+			return sorted[j].UpperBoundNs == 0 && sorted[i].UpperBoundNs != 0
+		}
+		return sorted[i].UpperBoundNs < sorted[j].UpperBoundNs
+	})
+
+	var total uint64
+	for _, bucket := range sorted {
+		total += bucket.Count
+	}
+	if total == 0 {
+		return 0, false
+	}
+
+	var cumulative, bound uint64
+	rank := percentile * float64(total)
+	for _, bucket := range sorted {
+		if bucket.UpperBoundNs != 0 {
+			bound = bucket.UpperBoundNs
+		}
+		cumulative += bucket.Count
+		if float64(cumulative) >= rank {
+			break
+		}
+	}
+	if bound == 0 {
+		// all waits are in the unbounded bucket
+		return 0, false
+	}
+	return float64(bound), true
+}
+
+// processContainerHugePageData stores hugepage usage of each page size configured on the host,
+// and sizes not reported by malachite are skipped rather than set as zero.
+func (m *MalachiteMetricsFetcher) processContainerHugePageData(podUID, containerName string, cgStats *types.MalachiteCgroupInfo) {
+	usage, updateTimeInSec, ok := getCgroupHugePageUsage(cgStats)
+	if !ok {
+		return
+	}
+
+	updateTime := time.Unix(updateTimeInSec, 0)
+	for pageSize, bytes := range usage {
+		m.metricStore.SetContainerMetric(podUID, containerName, hugePageUsageMetricName(pageSize),
+			utilmetric.MetricData{Value: float64(bytes), Time: &updateTime})
+	}
+}
+
+func hugePageUsageMetricName(pageSize string) string {
+	return consts.MetricHugePageUsageContainer + "." + pageSize
+}
+
 func (m *MalachiteMetricsFetcher) processContainerPerNumaMemoryData(podUID, containerName string, cgStats *types.MalachiteCgroupInfo) {
-	if cgStats.CgroupType == "V1" {
+	if isCgroupV1(cgStats) {
 		numaStats := cgStats.V1.Memory.NumaStats
 		updateTime := time.Unix(cgStats.V1.Memory.UpdateTime, 0)
 
@@ -990,7 +1881,7 @@ func (m *MalachiteMetricsFetcher) processContainerPerNumaMemoryData(podUID, cont
 			m.metricStore.SetContainerNumaMetric(podUID, containerName, numaID, consts.MetricsMemAnonPerNumaContainer,
 				utilmetric.MetricData{Value: float64(data.Anon << pageShift), Time: &updateTime})
 		}
-	} else if cgStats.CgroupType == "V2" {
+	} else if isCgroupV2(cgStats) {
 		numaStats := cgStats.V2.Memory.MemNumaStats
 		updateTime := time.Unix(cgStats.V2.Memory.UpdateTime, 0)
 
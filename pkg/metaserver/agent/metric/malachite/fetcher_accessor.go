@@ -0,0 +1,409 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package malachite
+
+// the fields in cgroup data vary between V1 and V2, the accessors here
+// are used to unify the access to them, and tell the caller whether the
+// field is available for the given cgroup data
+import (
+	"math"
+	"strings"
+
+	"github.com/kubewharf/katalyst-core/pkg/consts"
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/metric/malachite/types"
+)
+
+// cgroupV1MemoryUnlimited is the value of memory.limit_in_bytes when no limit is set,
+// i.e. the max value of int64 which is aligned with page size.
+const cgroupV1MemoryUnlimited = uint64(math.MaxInt64) >> pageShift << pageShift
+
+// cgroupVersionOf returns the cgroup version of the cgroup data, and the type reported by source is matched
+// case-insensitively with spaces trimmed, so that minor format differences of source don't hide all metrics.
+// The trimmed type is returned as is if it's not recognized.
+func cgroupVersionOf(cgStats *types.MalachiteCgroupInfo) string {
+	cgroupType := strings.TrimSpace(cgStats.CgroupType)
+	switch {
+	case strings.EqualFold(cgroupType, "V1"):
+		return "V1"
+	case strings.EqualFold(cgroupType, "V2"):
+		return "V2"
+	}
+	return cgroupType
+}
+
+func isCgroupV1(cgStats *types.MalachiteCgroupInfo) bool {
+	return cgroupVersionOf(cgStats) == "V1"
+}
+
+func isCgroupV2(cgStats *types.MalachiteCgroupInfo) bool {
+	return cgroupVersionOf(cgStats) == "V2"
+}
+
+// getCgroupMemoryUsage returns the memory usage in bytes and the update time of the cgroup
+func getCgroupMemoryUsage(cgStats *types.MalachiteCgroupInfo) (usage uint64, updateTime int64, ok bool) {
+	if isCgroupV1(cgStats) && cgStats.V1 != nil && cgStats.V1.Memory != nil {
+		return cgStats.V1.Memory.MemoryUsageInBytes, cgStats.V1.Memory.UpdateTime, true
+	} else if isCgroupV2(cgStats) && cgStats.V2 != nil && cgStats.V2.Memory != nil {
+		return cgStats.V2.Memory.MemoryUsageInBytes, cgStats.V2.Memory.UpdateTime, true
+	}
+	return 0, 0, false
+}
+
+// getCgroupMemoryLimit returns the memory limit in bytes of the cgroup (memory.limit_in_bytes
+// for V1 and memory.max for V2), unlimited will be true if no limit is set for the cgroup.
+func getCgroupMemoryLimit(cgStats *types.MalachiteCgroupInfo) (limit uint64, unlimited bool, updateTime int64, ok bool) {
+	if isCgroupV1(cgStats) && cgStats.V1 != nil && cgStats.V1.Memory != nil {
+		limit, updateTime = cgStats.V1.Memory.MemoryLimitInBytes, cgStats.V1.Memory.UpdateTime
+	} else if isCgroupV2(cgStats) && cgStats.V2 != nil && cgStats.V2.Memory != nil {
+		limit, updateTime = cgStats.V2.Memory.Max, cgStats.V2.Memory.UpdateTime
+	} else {
+		return 0, false, 0, false
+	}
+	return limit, limit == 0 || limit >= cgroupV1MemoryUnlimited, updateTime, true
+}
+
+// getCgroupMBALimit returns the RDT-MBA throttle (in percentage of the full memory bandwidth)
+// configured for the cgroup, and ok will be false if RDT-MBA is not present on the host.
+func getCgroupMBALimit(cgStats *types.MalachiteCgroupInfo) (limit uint64, updateTime int64, ok bool) {
+	if isCgroupV1(cgStats) && cgStats.V1 != nil && cgStats.V1.Cpu != nil && cgStats.V1.Cpu.MBALimit != nil {
+		return *cgStats.V1.Cpu.MBALimit, cgStats.V1.Cpu.UpdateTime, true
+	} else if isCgroupV2(cgStats) && cgStats.V2 != nil && cgStats.V2.Cpu != nil && cgStats.V2.Cpu.MBALimit != nil {
+		return *cgStats.V2.Cpu.MBALimit, cgStats.V2.Cpu.UpdateTime, true
+	}
+	return 0, 0, false
+}
+
+// getCgroupMemoryWorkingSet returns the memory working set in bytes of the cgroup,
+// i.e. the memory usage excluding inactive file pages.
+func getCgroupMemoryWorkingSet(cgStats *types.MalachiteCgroupInfo) (workingSet uint64, updateTime int64, ok bool) {
+	var usage, inactiveFile uint64
+	if isCgroupV1(cgStats) && cgStats.V1 != nil && cgStats.V1.Memory != nil {
+		usage, inactiveFile, updateTime = cgStats.V1.Memory.MemoryUsageInBytes, cgStats.V1.Memory.TotalInactiveFile, cgStats.V1.Memory.UpdateTime
+	} else if isCgroupV2(cgStats) && cgStats.V2 != nil && cgStats.V2.Memory != nil {
+		usage, inactiveFile, updateTime = cgStats.V2.Memory.MemoryUsageInBytes, cgStats.V2.Memory.MemStats.InactiveFile, cgStats.V2.Memory.UpdateTime
+	} else {
+		return 0, 0, false
+	}
+
+	if usage < inactiveFile {
+		return 0, updateTime, true
+	}
+	return usage - inactiveFile, updateTime, true
+}
+
+// getCgroupCPUFullPath returns the full cgroup path reported by cpu subsystem of the cgroup
+func getCgroupCPUFullPath(cgStats *types.MalachiteCgroupInfo) (string, bool) {
+	if isCgroupV1(cgStats) && cgStats.V1 != nil && cgStats.V1.Cpu != nil {
+		return cgStats.V1.Cpu.FullPath, true
+	} else if isCgroupV2(cgStats) && cgStats.V2 != nil && cgStats.V2.Cpu != nil {
+		return cgStats.V2.Cpu.FullPath, true
+	}
+	return "", false
+}
+
+// getCgroupCPUUsage returns the cpu usage (in cores) of the cgroup
+func getCgroupCPUUsage(cgStats *types.MalachiteCgroupInfo) (float64, bool) {
+	if isCgroupV1(cgStats) && cgStats.V1 != nil && cgStats.V1.Cpu != nil {
+		return cgStats.V1.Cpu.CPUUsageRatio, true
+	} else if isCgroupV2(cgStats) && cgStats.V2 != nil && cgStats.V2.Cpu != nil {
+		return cgStats.V2.Cpu.CPUUsageRatio, true
+	}
+	return 0, false
+}
+
+// getCgroupCpusetMems returns the numa nodes bound by cpuset of the cgroup
+func getCgroupCpusetMems(cgStats *types.MalachiteCgroupInfo) ([]int, bool) {
+	if isCgroupV1(cgStats) && cgStats.V1 != nil && cgStats.V1.CpuSet != nil {
+		return cgStats.V1.CpuSet.Mems.Inner, true
+	} else if isCgroupV2(cgStats) && cgStats.V2 != nil && cgStats.V2.CpuSet != nil {
+		return cgStats.V2.CpuSet.Mems.Inner, true
+	}
+	return nil, false
+}
+
+// getCgroupCpusetCpus returns the cpus that the cgroup is allowed to run on
+func getCgroupCpusetCpus(cgStats *types.MalachiteCgroupInfo) ([]int, bool) {
+	if isCgroupV1(cgStats) && cgStats.V1 != nil && cgStats.V1.CpuSet != nil {
+		return cgStats.V1.CpuSet.Cpus.Inner, true
+	} else if isCgroupV2(cgStats) && cgStats.V2 != nil && cgStats.V2.CpuSet != nil {
+		return cgStats.V2.CpuSet.Cpus.Inner, true
+	}
+	return nil, false
+}
+
+// getCgroupNumaOCRReadDRAMs returns the per-numa DRAM read counters of the cgroup (keyed by numa name),
+// and ok will be false if those counters are not reported by malachite.
+func getCgroupNumaOCRReadDRAMs(cgStats *types.MalachiteCgroupInfo) (counters map[string]uint64, updateTime int64, ok bool) {
+	if isCgroupV1(cgStats) && cgStats.V1 != nil && cgStats.V1.Cpu != nil && len(cgStats.V1.Cpu.NumaOCRReadDRAMs) > 0 {
+		return cgStats.V1.Cpu.NumaOCRReadDRAMs, cgStats.V1.Cpu.UpdateTime, true
+	} else if isCgroupV2(cgStats) && cgStats.V2 != nil && cgStats.V2.Cpu != nil && len(cgStats.V2.Cpu.NumaOCRReadDRAMs) > 0 {
+		return cgStats.V2.Cpu.NumaOCRReadDRAMs, cgStats.V2.Cpu.UpdateTime, true
+	}
+	return nil, 0, false
+}
+
+// getCgroupPageWalkCycles returns the sum of dtlb and itlb page-walk cycles along with the total cycles
+// of the cgroup, and ok will be false if none of the page-walk counters is reported by malachite.
+func getCgroupPageWalkCycles(cgStats *types.MalachiteCgroupInfo) (pageWalkCycles, cycles uint64, updateTime int64, ok bool) {
+	var dtlb, itlb *uint64
+	if isCgroupV1(cgStats) && cgStats.V1 != nil && cgStats.V1.Cpu != nil {
+		dtlb, itlb, cycles, updateTime = cgStats.V1.Cpu.DTLBWalkCycles, cgStats.V1.Cpu.ITLBWalkCycles, cgStats.V1.Cpu.Cycles, cgStats.V1.Cpu.UpdateTime
+	} else if isCgroupV2(cgStats) && cgStats.V2 != nil && cgStats.V2.Cpu != nil {
+		dtlb, itlb, cycles, updateTime = cgStats.V2.Cpu.DTLBWalkCycles, cgStats.V2.Cpu.ITLBWalkCycles, cgStats.V2.Cpu.Cycles, cgStats.V2.Cpu.UpdateTime
+	}
+
+	if dtlb == nil && itlb == nil {
+		return 0, 0, 0, false
+	}
+	if dtlb != nil {
+		pageWalkCycles += *dtlb
+	}
+	if itlb != nil {
+		pageWalkCycles += *itlb
+	}
+	return pageWalkCycles, cycles, updateTime, true
+}
+
+// getCgroupSchedLatency returns the distribution of runqueue wait of the cgroup, and ok
+// will be false if it's not reported by malachite, i.e. schedstats are not enabled.
+func getCgroupSchedLatency(cgStats *types.MalachiteCgroupInfo) (buckets []types.SchedLatencyBucket, updateTime int64, ok bool) {
+	if isCgroupV1(cgStats) && cgStats.V1 != nil && cgStats.V1.Cpu != nil && len(cgStats.V1.Cpu.SchedLatency) > 0 {
+		return cgStats.V1.Cpu.SchedLatency, cgStats.V1.Cpu.UpdateTime, true
+	} else if isCgroupV2(cgStats) && cgStats.V2 != nil && cgStats.V2.Cpu != nil && len(cgStats.V2.Cpu.SchedLatency) > 0 {
+		return cgStats.V2.Cpu.SchedLatency, cgStats.V2.Cpu.UpdateTime, true
+	}
+	return nil, 0, false
+}
+
+// getCgroupCPUPressureSomeAvg10 returns the avg10 of cpu pressure "some" of the cgroup,
+// and ok will be false since PSI is only available for V2.
+func getCgroupCPUPressureSomeAvg10(cgStats *types.MalachiteCgroupInfo) (avg10 float64, updateTime int64, ok bool) {
+	if isCgroupV2(cgStats) && cgStats.V2 != nil && cgStats.V2.Cpu != nil {
+		return cgStats.V2.Cpu.CPUPressure.Some.Avg10, cgStats.V2.Cpu.UpdateTime, true
+	}
+	return 0, 0, false
+}
+
+// getCgroupCPUThrottleCounters returns the number of throttled periods and elapsed periods of the cgroup
+func getCgroupCPUThrottleCounters(cgStats *types.MalachiteCgroupInfo) (nrThrottled, nrPeriods uint64, updateTime int64, ok bool) {
+	if isCgroupV1(cgStats) && cgStats.V1 != nil && cgStats.V1.Cpu != nil {
+		return cgStats.V1.Cpu.CPUNrThrottled, cgStats.V1.Cpu.CPUNrPeriods, cgStats.V1.Cpu.UpdateTime, true
+	} else if isCgroupV2(cgStats) && cgStats.V2 != nil && cgStats.V2.Cpu != nil {
+		return cgStats.V2.Cpu.CPUStats.NrThrottled, cgStats.V2.Cpu.CPUStats.NrPeriods, cgStats.V2.Cpu.UpdateTime, true
+	}
+	return 0, 0, 0, false
+}
+
+// getCgroupCPUThrottledTime returns the accumulated throttled time in nanoseconds and the usage in cores
+// of the cgroup, and ok will be false for cgroup v2 since malachite doesn't report throttled time for it.
+func getCgroupCPUThrottledTime(cgStats *types.MalachiteCgroupInfo) (throttledTime uint64, usage float64, updateTime int64, ok bool) {
+	if isCgroupV1(cgStats) && cgStats.V1 != nil && cgStats.V1.Cpu != nil {
+		return cgStats.V1.Cpu.CPUThrottledTime, cgStats.V1.Cpu.CPUUsageRatio, cgStats.V1.Cpu.UpdateTime, true
+	}
+	return 0, 0, 0, false
+}
+
+// getCgroupCPUCounters returns the cumulative counters reported by cpu subsystem of the cgroup in a fixed
+// order, which should be compared only with those of the same cgroup version.
+func getCgroupCPUCounters(cgStats *types.MalachiteCgroupInfo) (counters []uint64, updateTime int64, ok bool) {
+	if isCgroupV1(cgStats) && cgStats.V1 != nil && cgStats.V1.Cpu != nil {
+		cpu := cgStats.V1.Cpu
+		return []uint64{cpu.NewCPUBasicInfo.CPUUsage, cpu.CPUNrPeriods, cpu.CPUThrottledTime,
+			cpu.OCRReadDRAMs, cpu.IMCWrites, cpu.Cycles, cpu.Instructions}, cpu.UpdateTime, true
+	} else if isCgroupV2(cgStats) && cgStats.V2 != nil && cgStats.V2.Cpu != nil {
+		cpu := cgStats.V2.Cpu
+		return []uint64{cpu.CPUStats.UsageUsec, cpu.CPUStats.NrPeriods,
+			cpu.OCRReadDRAMs, cpu.IMCWrites, cpu.Cycles, cpu.Instructions}, cpu.UpdateTime, true
+	}
+	return nil, 0, false
+}
+
+// the ranges of cpu.shares in cgroup v1 and cpu.weight in cgroup v2
+const (
+	cgroupCPUSharesMin = 2
+	cgroupCPUSharesMax = 262144
+	cgroupCPUWeightMin = 1
+	cgroupCPUWeightMax = 10000
+)
+
+// getCgroupCPUWeight returns cpu weight of the cgroup in the range of cgroup v2 cpu.weight, and cpu.shares
+// of cgroup v1 is converted linearly (the same as runc does), and ok will be false if it's not reported.
+func getCgroupCPUWeight(cgStats *types.MalachiteCgroupInfo) (weight uint64, updateTime int64, ok bool) {
+	if isCgroupV1(cgStats) && cgStats.V1 != nil && cgStats.V1.Cpu != nil && cgStats.V1.Cpu.CPUShares > 0 {
+		shares := cgStats.V1.Cpu.CPUShares
+		if shares < cgroupCPUSharesMin {
+			shares = cgroupCPUSharesMin
+		} else if shares > cgroupCPUSharesMax {
+			shares = cgroupCPUSharesMax
+		}
+		weight = cgroupCPUWeightMin + (shares-cgroupCPUSharesMin)*(cgroupCPUWeightMax-cgroupCPUWeightMin)/
+			(cgroupCPUSharesMax-cgroupCPUSharesMin)
+		return weight, cgStats.V1.Cpu.UpdateTime, true
+	} else if isCgroupV2(cgStats) && cgStats.V2 != nil && cgStats.V2.Cpu != nil && cgStats.V2.Cpu.Weight > 0 {
+		return uint64(cgStats.V2.Cpu.Weight), cgStats.V2.Cpu.UpdateTime, true
+	}
+	return 0, 0, false
+}
+
+// getCgroupPageFaults returns page fault counters of the cgroup, including those of descendant cgroups
+// (total_* fields in cgroup v1 memory.stat, while cgroup v2 memory.stat is always hierarchical).
+func getCgroupPageFaults(cgStats *types.MalachiteCgroupInfo) (pgfault, pgmajfault uint64, updateTime int64, ok bool) {
+	if isCgroupV1(cgStats) && cgStats.V1 != nil && cgStats.V1.Memory != nil {
+		return cgStats.V1.Memory.TotalPgfault, cgStats.V1.Memory.TotalPgmajfault, cgStats.V1.Memory.UpdateTime, true
+	} else if isCgroupV2(cgStats) && cgStats.V2 != nil && cgStats.V2.Memory != nil {
+		return cgStats.V2.Memory.MemStats.Pgfault, cgStats.V2.Memory.MemStats.Pgmajfault, cgStats.V2.Memory.UpdateTime, true
+	}
+	return 0, 0, 0, false
+}
+
+// getCgroupOOMKills returns the cumulative oom count of the cgroup, the same as MetricMemOomContainer,
+// and ok will be false if memory stats are not reported.
+func getCgroupOOMKills(cgStats *types.MalachiteCgroupInfo) (oomKills uint64, updateTime int64, ok bool) {
+	if isCgroupV1(cgStats) && cgStats.V1 != nil && cgStats.V1.Memory != nil {
+		return uint64(cgStats.V1.Memory.OomCnt), cgStats.V1.Memory.UpdateTime, true
+	} else if isCgroupV2(cgStats) && cgStats.V2 != nil && cgStats.V2.Memory != nil {
+		return cgStats.V2.Memory.OomCnt, cgStats.V2.Memory.UpdateTime, true
+	}
+	return 0, 0, false
+}
+
+// getCgroupSwapUsage returns the swap usage in bytes of the cgroup, and ok will be false if
+// swap accounting is disabled.
+func getCgroupSwapUsage(cgStats *types.MalachiteCgroupInfo) (usage uint64, updateTime int64, ok bool) {
+	if isCgroupV1(cgStats) && cgStats.V1 != nil && cgStats.V1.Memory != nil && cgStats.V1.Memory.TotalSwap != nil {
+		return *cgStats.V1.Memory.TotalSwap, cgStats.V1.Memory.UpdateTime, true
+	} else if isCgroupV2(cgStats) && cgStats.V2 != nil && cgStats.V2.Memory != nil && cgStats.V2.Memory.SwapCurrent != nil {
+		return *cgStats.V2.Memory.SwapCurrent, cgStats.V2.Memory.UpdateTime, true
+	}
+	return 0, 0, false
+}
+
+// getCgroupSwapCounters returns the cumulative numbers of pages swapped in and out of the cgroup, and
+// ok will be false if they are not available, i.e. they are only reported in memory.stat of cgroup v2.
+func getCgroupSwapCounters(cgStats *types.MalachiteCgroupInfo) (pswpin, pswpout uint64, updateTime int64, ok bool) {
+	if isCgroupV2(cgStats) && cgStats.V2 != nil && cgStats.V2.Memory != nil &&
+		cgStats.V2.Memory.MemStats.Pswpin != nil && cgStats.V2.Memory.MemStats.Pswpout != nil {
+		return *cgStats.V2.Memory.MemStats.Pswpin, *cgStats.V2.Memory.MemStats.Pswpout, cgStats.V2.Memory.UpdateTime, true
+	}
+	return 0, 0, 0, false
+}
+
+// getCgroupPidsCurrent returns the number of tasks (processes and threads) in the cgroup,
+// and ok will be false if pids controller is not present for the cgroup.
+func getCgroupPidsCurrent(cgStats *types.MalachiteCgroupInfo) (current uint64, updateTime int64, ok bool) {
+	if isCgroupV1(cgStats) && cgStats.V1 != nil && cgStats.V1.Pids != nil {
+		return cgStats.V1.Pids.PidsCurrent, cgStats.V1.Pids.UpdateTime, true
+	} else if isCgroupV2(cgStats) && cgStats.V2 != nil && cgStats.V2.Pids != nil {
+		return cgStats.V2.Pids.PidsCurrent, cgStats.V2.Pids.UpdateTime, true
+	}
+	return 0, 0, false
+}
+
+// getCgroupFrozen returns true if the cgroup is frozen, and FREEZING of cgroup v1 is regarded as frozen since
+// tasks are being stopped. ok will be false if the freeze state is not reported.
+func getCgroupFrozen(cgStats *types.MalachiteCgroupInfo) (frozen bool, updateTime int64, ok bool) {
+	if isCgroupV1(cgStats) && cgStats.V1 != nil && cgStats.V1.Freezer != nil {
+		return cgStats.V1.Freezer.State == "FROZEN" || cgStats.V1.Freezer.State == "FREEZING", cgStats.V1.Freezer.UpdateTime, true
+	} else if isCgroupV2(cgStats) && cgStats.V2 != nil && cgStats.V2.Freezer != nil {
+		return cgStats.V2.Freezer.Frozen != 0, cgStats.V2.Freezer.UpdateTime, true
+	}
+	return false, 0, false
+}
+
+// getCgroupIOLimits returns the parsed io throttle of the cgroup keyed by device and then by limit metric
+// name, and ok will be false if no throttle is reported, i.e. the blkio (io) controller is not present.
+func getCgroupIOLimits(cgStats *types.MalachiteCgroupInfo) (limits map[string]map[string]uint64, updateTime int64, ok bool) {
+	if isCgroupV1(cgStats) && cgStats.V1 != nil && cgStats.V1.Blkio != nil {
+		io := cgStats.V1.Blkio
+		if io.ThrottleReadBpsDevice == nil && io.ThrottleWriteBpsDevice == nil &&
+			io.ThrottleReadIopsDevice == nil && io.ThrottleWriteIopsDevice == nil {
+			return nil, 0, false
+		}
+		return parseBlkioThrottles(map[string][]string{
+			consts.MetricIOLimitReadBpsContainer:   io.ThrottleReadBpsDevice,
+			consts.MetricIOLimitWriteBpsContainer:  io.ThrottleWriteBpsDevice,
+			consts.MetricIOLimitReadIopsContainer:  io.ThrottleReadIopsDevice,
+			consts.MetricIOLimitWriteIopsContainer: io.ThrottleWriteIopsDevice,
+		}), io.UpdateTime, true
+	} else if isCgroupV2(cgStats) && cgStats.V2 != nil && cgStats.V2.Blkio != nil && cgStats.V2.Blkio.IoMaxRaw != nil {
+		return parseIOMax(cgStats.V2.Blkio.IoMaxRaw), cgStats.V2.Blkio.UpdateTime, true
+	}
+	return nil, 0, false
+}
+
+// getCgroupHugePageUsage returns the hugepage usage in bytes keyed by page size, and
+// ok will be false if hugetlb controller is not present for the cgroup.
+func getCgroupHugePageUsage(cgStats *types.MalachiteCgroupInfo) (usage map[string]uint64, updateTime int64, ok bool) {
+	if isCgroupV1(cgStats) && cgStats.V1 != nil && cgStats.V1.Hugetlb != nil {
+		return cgStats.V1.Hugetlb.Usage, cgStats.V1.Hugetlb.UpdateTime, true
+	} else if isCgroupV2(cgStats) && cgStats.V2 != nil && cgStats.V2.Hugetlb != nil {
+		return cgStats.V2.Hugetlb.Usage, cgStats.V2.Hugetlb.UpdateTime, true
+	}
+	return nil, 0, false
+}
+
+// getCgroupMemPolicy returns the numa memory policy of the cgroup, and ok
+// will be false if it's not reported by malachite.
+func getCgroupMemPolicy(cgStats *types.MalachiteCgroupInfo) (policy types.MemPolicy, updateTime int64, ok bool) {
+	if isCgroupV1(cgStats) && cgStats.V1 != nil && cgStats.V1.Memory != nil && cgStats.V1.Memory.MemPolicy != nil {
+		return *cgStats.V1.Memory.MemPolicy, cgStats.V1.Memory.UpdateTime, true
+	} else if isCgroupV2(cgStats) && cgStats.V2 != nil && cgStats.V2.Memory != nil && cgStats.V2.Memory.MemPolicy != nil {
+		return *cgStats.V2.Memory.MemPolicy, cgStats.V2.Memory.UpdateTime, true
+	}
+	return types.MemPolicy{}, 0, false
+}
+
+// getCgroupUpdateTimes returns the update times of all fields present in the cgroup data
+func getCgroupUpdateTimes(cgStats *types.MalachiteCgroupInfo) []int64 {
+	var updateTimes []int64
+	if isCgroupV1(cgStats) && cgStats.V1 != nil {
+		v1 := cgStats.V1
+		if v1.Memory != nil {
+			updateTimes = append(updateTimes, v1.Memory.UpdateTime)
+		}
+		if v1.Blkio != nil {
+			updateTimes = append(updateTimes, v1.Blkio.UpdateTime)
+		}
+		if v1.NetCls != nil {
+			updateTimes = append(updateTimes, v1.NetCls.UpdateTime)
+		}
+		if v1.PerfEvent != nil {
+			updateTimes = append(updateTimes, v1.PerfEvent.UpdateTime)
+		}
+		if v1.Cpu != nil {
+			updateTimes = append(updateTimes, v1.Cpu.UpdateTime)
+		}
+	} else if isCgroupV2(cgStats) && cgStats.V2 != nil {
+		v2 := cgStats.V2
+		if v2.Memory != nil {
+			updateTimes = append(updateTimes, v2.Memory.UpdateTime)
+		}
+		if v2.Blkio != nil {
+			updateTimes = append(updateTimes, v2.Blkio.UpdateTime)
+		}
+		if v2.NetCls != nil {
+			updateTimes = append(updateTimes, v2.NetCls.UpdateTime)
+		}
+		if v2.PerfEvent != nil {
+			updateTimes = append(updateTimes, v2.PerfEvent.UpdateTime)
+		}
+		if v2.Cpu != nil {
+			updateTimes = append(updateTimes, v2.Cpu.UpdateTime)
+		}
+	}
+	return updateTimes
+}
@@ -19,92 +19,1515 @@ package malachite
 // for those metrics need extra calculation logic,
 // we will put them in a separate file here
 import (
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/kubewharf/katalyst-core/pkg/config/agent/global"
 	"github.com/kubewharf/katalyst-core/pkg/consts"
 	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/metric/malachite/types"
+	"github.com/kubewharf/katalyst-core/pkg/metrics"
+	"github.com/kubewharf/katalyst-core/pkg/util/general"
+	"github.com/kubewharf/katalyst-core/pkg/util/machine"
 	"github.com/kubewharf/katalyst-core/pkg/util/metric"
 )
 
+// counterSample is a raw counter value along with the time it was sampled by malachite,
+// and the precise time is zero if it's not provided.
+type counterSample struct {
+	value      uint64
+	updateTime int64
+	preciseSampleTime
+}
+
+// preciseSampleTime is the time of a sample in a finer resolution than the update time in seconds,
+// and each field is zero if it's not provided by the source.
+type preciseSampleTime struct {
+	// updateTimeNano is the unix nanoseconds of the update time
+	updateTimeNano int64
+	// monotonicTime is the boot-relative nanoseconds when it's sampled
+	monotonicTime uint64
+}
+
+// containerMemBandwidthCounters contains all raw counters needed to calculate memory bandwidth,
+// each counter keeps its own update time since they may be sampled from different sources.
+type containerMemBandwidthCounters struct {
+	ocrReadDRAMs counterSample
+	imcWrites    counterSample
+	storeAllIns  counterSample
+	storeIns     counterSample
+
+	// sharedCgroupShare is the share of bandwidth attributed to the container if its cgroup is shared
+	// by other containers of the pod, and the whole bandwidth is attributed if sharedCgroup is false
+	sharedCgroup      bool
+	sharedCgroupShare float64
+}
+
+// attributedShare returns the share of bandwidth calculated from the counters attributed to the container
+func (c containerMemBandwidthCounters) attributedShare() float64 {
+	if !c.sharedCgroup {
+		return 1
+	}
+	return c.sharedCgroupShare
+}
+
+// getContainerMemBandwidthCounters returns the memory bandwidth counters from cgroup stats.
+func getContainerMemBandwidthCounters(cgStats *types.MalachiteCgroupInfo) containerMemBandwidthCounters {
+	if isCgroupV1(cgStats) {
+		cpu := cgStats.V1.Cpu
+		samplePreciseTime := preciseSampleTime{updateTimeNano: cpu.UpdateTimeNano, monotonicTime: cpu.MonotonicTime}
+		return containerMemBandwidthCounters{
+			ocrReadDRAMs: counterSample{value: cpu.OCRReadDRAMs, updateTime: cpu.UpdateTime, preciseSampleTime: samplePreciseTime},
+			imcWrites:    counterSample{value: cpu.IMCWrites, updateTime: cpu.UpdateTime, preciseSampleTime: samplePreciseTime},
+			storeAllIns:  counterSample{value: cpu.StoreAllInstructions, updateTime: cpu.UpdateTime, preciseSampleTime: samplePreciseTime},
+			storeIns:     counterSample{value: cpu.StoreInstructions, updateTime: cpu.UpdateTime, preciseSampleTime: samplePreciseTime},
+		}
+	} else if isCgroupV2(cgStats) {
+		cpu := cgStats.V2.Cpu
+		samplePreciseTime := preciseSampleTime{updateTimeNano: cpu.UpdateTimeNano, monotonicTime: cpu.MonotonicTime}
+		return containerMemBandwidthCounters{
+			ocrReadDRAMs: counterSample{value: cpu.OCRReadDRAMs, updateTime: cpu.UpdateTime, preciseSampleTime: samplePreciseTime},
+			imcWrites:    counterSample{value: cpu.IMCWrites, updateTime: cpu.UpdateTime, preciseSampleTime: samplePreciseTime},
+			storeAllIns:  counterSample{value: cpu.StoreAllInstructions, updateTime: cpu.UpdateTime, preciseSampleTime: samplePreciseTime},
+			storeIns:     counterSample{value: cpu.StoreInstructions, updateTime: cpu.UpdateTime, preciseSampleTime: samplePreciseTime},
+		}
+	}
+	return containerMemBandwidthCounters{}
+}
+
 // processContainerMemBandwidth handles memory bandwidth (read/write) rate in a period while,
-// and it will need the previously collected data to do this
-func (m *MalachiteMetricsFetcher) processContainerMemBandwidth(podUID, containerName string, cgStats *types.MalachiteCgroupInfo, lastUpdateTimeInSec float64) {
+// and it will need the previously collected data to do this; it returns the bytes moved in the period.
+func (m *MalachiteMetricsFetcher) processContainerMemBandwidth(podUID, containerName string, cgStats *types.MalachiteCgroupInfo, lastUpdateTimeInSec float64) (float64, bool) {
+	counters := getContainerMemBandwidthCounters(cgStats)
+	if share, ok := m.sharedCgroupShares[containerMetricKey{podUID: podUID, containerName: containerName}]; ok {
+		counters.sharedCgroup, counters.sharedCgroupShare = true, share
+	}
+	m.retainMemBandwidthReplaySample(podUID, containerName, counters)
+	bytes, bytesOK := m.calculateContainerMemBandwidth(podUID, containerName, counters, int64(lastUpdateTimeInSec))
+	m.processContainerPerNumaMemBandwidth(podUID, containerName, cgStats, counters.ocrReadDRAMs.updateTime)
+
+	// the bandwidth limit is a gauge, so it can be stored directly
+	if limit, updateTimeInSec, ok := getCgroupMBALimit(cgStats); ok {
+		updateTime := time.Unix(updateTimeInSec, 0)
+		m.metricStore.SetContainerMetric(podUID, containerName, consts.MetricMemBandwidthLimitContainer,
+			metric.MetricData{Value: float64(limit), Time: &updateTime})
+	}
+	return bytes, bytesOK
+}
+
+// calculateContainerMemBandwidth calculates the read/write bandwidth of the container, and it returns the
+// read and write bytes from counter deltas, which are only valid if both of them are calculated.
+func (m *MalachiteMetricsFetcher) calculateContainerMemBandwidth(podUID, containerName string, cur containerMemBandwidthCounters, lastUpdateTimeInSec int64) (float64, bool) {
 	var (
-		lastOCRReadDRAMsMetric, _ = m.metricStore.GetContainerMetric(podUID, containerName, consts.MetricOCRReadDRAMsContainer)
-		lastIMCWritesMetric, _    = m.metricStore.GetContainerMetric(podUID, containerName, consts.MetricIMCWriteContainer)
-		lastStoreAllInsMetric, _  = m.metricStore.GetContainerMetric(podUID, containerName, consts.MetricStoreAllInsContainer)
-		lastStoreInsMetric, _     = m.metricStore.GetContainerMetric(podUID, containerName, consts.MetricStoreInsContainer)
+		lastOCRReadDRAMsMetric = m.getPreviousContainerCounter(podUID, containerName, consts.MetricOCRReadDRAMsContainer)
+		lastIMCWritesMetric    = m.getPreviousContainerCounter(podUID, containerName, consts.MetricIMCWriteContainer)
+		lastStoreAllInsMetric  = m.getPreviousContainerCounter(podUID, containerName, consts.MetricStoreAllInsContainer)
+		lastStoreInsMetric     = m.getPreviousContainerCounter(podUID, containerName, consts.MetricStoreInsContainer)
+		lastMonotonicMetric    = m.getPreviousContainerCounter(podUID, containerName, consts.MetricCPUMonotonicTimeContainer)
+		lastUpdateTimeNano     = m.getPreviousContainerCounter(podUID, containerName, consts.MetricCPUUpdateTimeNanoContainer)
 
 		// those value are uint64 type from source
 		lastOCRReadDRAMs = uint64(lastOCRReadDRAMsMetric.Value)
 		lastIMCWrites    = uint64(lastIMCWritesMetric.Value)
 		lastStoreAllIns  = uint64(lastStoreAllInsMetric.Value)
 		lastStoreIns     = uint64(lastStoreInsMetric.Value)
-	)
+		last             = preciseSampleTime{updateTimeNano: int64(lastUpdateTimeNano.Value), monotonicTime: uint64(lastMonotonicMetric.Value)}
 
-	var (
-		curOCRReadDRAMs, curIMCWrites, curStoreAllIns, curStoreIns uint64
-		curUpdateTimeInSec                                         float64
+		readBytes, writeBytes     float64
+		readBytesOK, writeBytesOK bool
 	)
 
-	if cgStats.CgroupType == "V1" {
-		curOCRReadDRAMs = cgStats.V1.Cpu.OCRReadDRAMs
-		curIMCWrites = cgStats.V1.Cpu.IMCWrites
-		curStoreAllIns = cgStats.V1.Cpu.StoreAllInstructions
-		curStoreIns = cgStats.V1.Cpu.StoreInstructions
-		curUpdateTimeInSec = float64(cgStats.V1.Cpu.UpdateTime)
-	} else if cgStats.CgroupType == "V2" {
-		curOCRReadDRAMs = cgStats.V2.Cpu.OCRReadDRAMs
-		curIMCWrites = cgStats.V2.Cpu.IMCWrites
-		curStoreAllIns = cgStats.V2.Cpu.StoreAllInstructions
-		curStoreIns = cgStats.V2.Cpu.StoreInstructions
-		curUpdateTimeInSec = float64(cgStats.V2.Cpu.UpdateTime)
-	}
-
 	// read bandwidth
-	m.setContainerRateMetric(podUID, containerName, consts.MetricMemBandwidthReadContainer,
+	m.setContainerMonotonicRateMetric(podUID, containerName, consts.MetricMemBandwidthReadContainer,
 		func() float64 {
-			// read megabyte
-			return float64(uint64CounterDelta(lastOCRReadDRAMs, curOCRReadDRAMs)) * 64 / (1024 * 1024)
+			readBytes = float64(m.counterDelta(consts.MetricMemBandwidthReadContainer, lastOCRReadDRAMs, cur.ocrReadDRAMs.value)) *
+				float64(m.memBandwidthConstants.CacheLineSize) * cur.attributedShare()
+			readBytesOK = true
+			return m.toMemBandwidthUnit(readBytes)
 		},
-		int64(lastUpdateTimeInSec), int64(curUpdateTimeInSec))
+		lastUpdateTimeInSec, cur.ocrReadDRAMs.updateTime, last, cur.ocrReadDRAMs.preciseSampleTime)
+
+	// write bandwidth is combined by several counters, and it only makes sense
+	// if all of them are sampled in the same window
+	curUpdateTimeInSec, ok := m.getSharedSampleWindow(podUID, containerName, consts.MetricMemBandwidthWriteContainer,
+		cur.imcWrites, cur.storeAllIns, cur.storeIns)
+	if !ok {
+		return 0, false
+	}
 
-	// write bandwidth
-	m.setContainerRateMetric(podUID, containerName, consts.MetricMemBandwidthWriteContainer,
+	m.setContainerMonotonicRateMetric(podUID, containerName, consts.MetricMemBandwidthWriteContainer,
 		func() float64 {
-			storeAllInsInc := uint64CounterDelta(lastStoreAllIns, curStoreAllIns)
+			writeBytesOK = true
+			storeAllInsInc := m.counterDelta(consts.MetricMemBandwidthWriteContainer, lastStoreAllIns, cur.storeAllIns.value)
 			if storeAllInsInc == 0 {
 				return 0
 			}
 
-			storeInsInc := uint64CounterDelta(lastStoreIns, curStoreIns)
-			imcWritesInc := uint64CounterDelta(lastIMCWrites, curIMCWrites)
+			storeInsInc := m.counterDelta(consts.MetricMemBandwidthWriteContainer, lastStoreIns, cur.storeIns.value)
+			imcWritesInc := m.counterDelta(consts.MetricMemBandwidthWriteContainer, lastIMCWrites, cur.imcWrites.value)
+
+			// store instructions should be part of all store instructions, but counter glitches
+			// may break it, and the ratio is clamped to avoid inflated write bandwidth
+			storeRatio := float64(storeInsInc) / float64(storeAllInsInc)
+			if storeRatio > 1 {
+				general.Warningf("clamp store ratio for pod %v container %v: store ins %v exceeds all store ins %v",
+					podUID, containerName, storeInsInc, storeAllInsInc)
+				_ = m.emitter.StoreInt64(metricsNameMalachiteStoreRatioClamped, 1, metrics.MetricTypeNameCount)
+				m.recordDerivedOutcome(podUID, containerName, consts.MetricMemBandwidthWriteContainer, DerivedMetricOutcomeClamped)
+				storeRatio = 1
+			}
+
+			writeBytes = storeRatio * float64(imcWritesInc) * float64(m.memBandwidthConstants.CacheLineSize) * cur.attributedShare()
+			return m.toMemBandwidthUnit(writeBytes)
+		},
+		lastUpdateTimeInSec, curUpdateTimeInSec, last, cur.imcWrites.preciseSampleTime)
+	return readBytes + writeBytes, readBytesOK && writeBytesOK
+}
+
+// processContainerPerNumaMemBandwidth attributes the read bandwidth of the container calculated in current
+// cycle to numa nodes, either by the shares of per-numa access counters or evenly among numa nodes bound by cpuset.
+func (m *MalachiteMetricsFetcher) processContainerPerNumaMemBandwidth(podUID, containerName string, cgStats *types.MalachiteCgroupInfo, curUpdateTimeInSec int64) {
+	// access counters should always be updated to be used as the baseline in next cycle
+	accessShares, accessOK := m.getContainerNumaAccessShares(podUID, containerName, cgStats)
+
+	shares, ok := accessShares, accessOK
+	if m.metricConf.MemBandwidthNumaAttribution != global.MemBandwidthNumaAttributionAccessCounter || !ok {
+		shares, ok = getContainerNumaBindingShares(cgStats)
+	}
+	if !ok {
+		return
+	}
+
+	readBandwidth, err := m.metricStore.GetContainerMetric(podUID, containerName, consts.MetricMemBandwidthReadContainer)
+	if err != nil || readBandwidth.Time == nil || readBandwidth.Time.Unix() != curUpdateTimeInSec {
+		// read bandwidth is not calculated in current cycle
+		return
+	}
+
+	for numaID, share := range shares {
+		m.metricStore.SetContainerNumaMetric(podUID, containerName, numaID, consts.MetricsMemBandwidthReadPerNumaContainer,
+			metric.MetricData{Value: readBandwidth.Value * share, Time: readBandwidth.Time})
+	}
+
+	// the cost and the remote ratio are only meaningful with the actual accesses to each numa node
+	if accessOK {
+		m.processContainerMemBandwidthWeightedCost(podUID, containerName, cgStats, readBandwidth, accessShares)
+		m.processContainerMemRemoteReadRatio(podUID, containerName, cgStats, readBandwidth, accessShares)
+	}
+}
+
+// getContainerCPUNumaIDs returns the numa nodes of cpus bound by cpuset of the container,
+// and it returns false if the cpu topology is unknown or no cpu is bound.
+func (m *MalachiteMetricsFetcher) getContainerCPUNumaIDs(cgStats *types.MalachiteCgroupInfo) ([]int, bool) {
+	if m.machineInfo == nil || m.machineInfo.CPUTopology == nil {
+		return nil, false
+	}
+
+	cpus, ok := getCgroupCpusetCpus(cgStats)
+	if !ok || len(cpus) == 0 {
+		return nil, false
+	}
+	cpuNumaIDs := m.machineInfo.CPUDetails.KeepOnly(machine.NewCPUSet(cpus...)).NUMANodes().ToSliceInt()
+	return cpuNumaIDs, len(cpuNumaIDs) > 0
+}
+
+// processContainerMemRemoteReadRatio calculates the share of read bandwidth of the container from numa nodes other
+// than those of its cpus, and it's skipped if the read bandwidth is zero or the cpu topology is unknown. Write
+// bandwidth is not included, since only reads are attributed to numa nodes by access counters.
+func (m *MalachiteMetricsFetcher) processContainerMemRemoteReadRatio(podUID, containerName string,
+	cgStats *types.MalachiteCgroupInfo, readBandwidth metric.MetricData, accessShares map[string]float64,
+) {
+	if readBandwidth.Value <= 0 {
+		return
+	}
+	cpuNumaIDs, ok := m.getContainerCPUNumaIDs(cgStats)
+	if !ok {
+		return
+	}
+
+	local := sets.NewInt(cpuNumaIDs...)
+	remote := .0
+	for numa, share := range accessShares {
+		numaID, err := strconv.Atoi(numa)
+		if err != nil {
+			return
+		}
+		if !local.Has(numaID) {
+			remote += readBandwidth.Value * share
+		}
+	}
+
+	m.metricStore.SetContainerMetric(podUID, containerName, consts.MetricMemRemoteReadRatioContainer,
+		metric.MetricData{Value: remote / readBandwidth.Value, Time: readBandwidth.Time})
+}
+
+// processContainerMemBandwidthWeightedCost weights read bandwidth from each numa node by its distance to the numa
+// nodes of container cpus (averaged if there are multiple ones), relative to the local distance. It's skipped if
+// numa distances are unknown, or any numa node involved is missing in distances.
+func (m *MalachiteMetricsFetcher) processContainerMemBandwidthWeightedCost(podUID, containerName string,
+	cgStats *types.MalachiteCgroupInfo, readBandwidth metric.MetricData, accessShares map[string]float64,
+) {
+	if !m.isDerivationDue(consts.MetricMemBandwidthWeightedCostContainer) {
+		return
+	}
+	if m.machineInfo == nil || m.machineInfo.ExtraTopologyInfo == nil || len(m.machineInfo.NumaDistanceMap) == 0 {
+		return
+	}
+
+	cpuNumaIDs, ok := m.getContainerCPUNumaIDs(cgStats)
+	if !ok {
+		return
+	}
+
+	cost := .0
+	for _, cpuNumaID := range cpuNumaIDs {
+		distances, ok := m.machineInfo.NumaDistanceMap[cpuNumaID]
+		if !ok || distances[cpuNumaID] <= 0 {
+			return
+		}
+
+		for numa, share := range accessShares {
+			numaID, err := strconv.Atoi(numa)
+			if err != nil {
+				return
+			}
+			distance, ok := distances[numaID]
+			if !ok {
+				return
+			}
+			cost += readBandwidth.Value * share * float64(distance) / float64(distances[cpuNumaID])
+		}
+	}
+
+	m.metricStore.SetContainerMetric(podUID, containerName, consts.MetricMemBandwidthWeightedCostContainer,
+		metric.MetricData{Value: cost / float64(len(cpuNumaIDs)), Time: readBandwidth.Time})
+}
+
+// getContainerNumaAccessShares returns the shares of each numa node in DRAM reads of the container since
+// the last sample, and it returns false if per-numa access counters are not available.
+func (m *MalachiteMetricsFetcher) getContainerNumaAccessShares(podUID, containerName string, cgStats *types.MalachiteCgroupInfo) (map[string]float64, bool) {
+	counters, updateTimeInSec, ok := getCgroupNumaOCRReadDRAMs(cgStats)
+	if !ok {
+		return nil, false
+	}
+
+	var (
+		updateTime = time.Unix(updateTimeInSec, 0)
+		deltas     = make(map[string]uint64, len(counters))
+		total      uint64
+	)
+	for numa, value := range counters {
+		numaID := strings.TrimPrefix(numa, "N")
+		last, err := m.metricStore.GetContainerNumaMetric(podUID, containerName, numaID, consts.MetricsOCRReadDRAMsPerNumaContainer)
+		if err == nil && last.Time != nil && last.Time.Before(updateTime) {
+			deltas[numaID] = m.counterDelta(consts.MetricsMemBandwidthReadPerNumaContainer, uint64(last.Value), value)
+			total += deltas[numaID]
+		}
+		m.metricStore.SetContainerNumaMetric(podUID, containerName, numaID, consts.MetricsOCRReadDRAMsPerNumaContainer,
+			metric.MetricData{Value: float64(value), Time: &updateTime})
+	}
+
+	if total == 0 {
+		return nil, false
+	}
+
+	shares := make(map[string]float64, len(deltas))
+	for numaID, delta := range deltas {
+		shares[numaID] = float64(delta) / float64(total)
+	}
+	return shares, true
+}
+
+// getContainerNumaBindingShares splits the bandwidth evenly among numa nodes bound by cpuset of the container.
+func getContainerNumaBindingShares(cgStats *types.MalachiteCgroupInfo) (map[string]float64, bool) {
+	mems, ok := getCgroupCpusetMems(cgStats)
+	if !ok || len(mems) == 0 {
+		return nil, false
+	}
+
+	shares := make(map[string]float64, len(mems))
+	for _, numaID := range mems {
+		shares[strconv.Itoa(numaID)] = 1 / float64(len(mems))
+	}
+	return shares, true
+}
+
+// processContainerPageWalk calculates the rate of page-walk cycles and its ratio to total cycles,
+// which indicate the TLB pressure of the container, and it should be called before raw cycles are updated.
+func (m *MalachiteMetricsFetcher) processContainerPageWalk(podUID, containerName string, cgStats *types.MalachiteCgroupInfo) {
+	pageWalkCycles, cycles, curUpdateTimeInSec, ok := getCgroupPageWalkCycles(cgStats)
+	if !ok {
+		return
+	}
+
+	var (
+		lastPageWalkCyclesMetric, _ = m.metricStore.GetContainerMetric(podUID, containerName, consts.MetricPageWalkCyclesCounterContainer)
+		lastCyclesMetric, _         = m.metricStore.GetContainerMetric(podUID, containerName, consts.MetricCPUCyclesContainer)
+
+		lastPageWalkCycles = uint64(lastPageWalkCyclesMetric.Value)
+		lastCycles         = uint64(lastCyclesMetric.Value)
+		updateTime         = time.Unix(curUpdateTimeInSec, 0)
+	)
 
-			// write megabyte
-			return float64(storeInsInc) / float64(storeAllInsInc) / (1024 * 1024) * float64(imcWritesInc) * 64
+	// page-walk counters may be absent in previous samples, so the update time
+	// of the counter itself is used to avoid calculating against a missing baseline
+	var lastUpdateTimeInSec int64
+	if lastPageWalkCyclesMetric.Time != nil {
+		lastUpdateTimeInSec = lastPageWalkCyclesMetric.Time.Unix()
+	}
+
+	m.setContainerRateMetric(podUID, containerName, consts.MetricPageWalkCyclesContainer,
+		func() float64 {
+			return float64(m.counterDelta(consts.MetricPageWalkCyclesContainer, lastPageWalkCycles, pageWalkCycles))
 		},
-		int64(lastUpdateTimeInSec), int64(curUpdateTimeInSec))
+		lastUpdateTimeInSec, curUpdateTimeInSec)
+
+	if lastUpdateTimeInSec > 0 && lastUpdateTimeInSec < curUpdateTimeInSec {
+		if cyclesInc := m.counterDelta(consts.MetricPageWalkRatioContainer, lastCycles, cycles); cyclesInc > 0 {
+			m.metricStore.SetContainerMetric(podUID, containerName, consts.MetricPageWalkRatioContainer,
+				metric.MetricData{Value: float64(m.counterDelta(consts.MetricPageWalkRatioContainer, lastPageWalkCycles, pageWalkCycles)) / float64(cyclesInc), Time: &updateTime})
+		}
+	}
+
+	m.metricStore.SetContainerMetric(podUID, containerName, consts.MetricPageWalkCyclesCounterContainer,
+		metric.MetricData{Value: float64(pageWalkCycles), Time: &updateTime})
+}
+
+// processContainerPageFaults calculates the rates of page faults based on the raw counters of the
+// last sample, and it should be called before raw counters are updated.
+func (m *MalachiteMetricsFetcher) processContainerPageFaults(podUID, containerName string, cgStats *types.MalachiteCgroupInfo) {
+	pgfault, pgmajfault, updateTimeInSec, ok := getCgroupPageFaults(cgStats)
+	if !ok {
+		return
+	}
+
+	for _, counter := range []struct {
+		value       uint64
+		counterName string
+		rateName    string
+	}{
+		{value: pgfault, counterName: consts.MetricMemPgfaultContainer, rateName: consts.MetricPageFaultRateContainer},
+		{value: pgmajfault, counterName: consts.MetricMemPgmajfaultContainer, rateName: consts.MetricMajorPageFaultRateContainer},
+	} {
+		last, err := m.metricStore.GetContainerMetric(podUID, containerName, counter.counterName)
+		if err != nil || last.Time == nil {
+			continue
+		}
+
+		value := counter.value
+		m.setContainerRateMetric(podUID, containerName, counter.rateName,
+			func() float64 { return float64(m.counterDelta(counter.rateName, uint64(last.Value), value)) },
+			last.Time.Unix(), updateTimeInSec)
+	}
+}
+
+// processContainerOOMKills calculates the rate of oom kills of the container based on the cumulative count
+// (MetricMemOomContainer) of the last sample, so it must be called before the count is updated.
+func (m *MalachiteMetricsFetcher) processContainerOOMKills(podUID, containerName string, cgStats *types.MalachiteCgroupInfo) {
+	oomKills, updateTimeInSec, ok := getCgroupOOMKills(cgStats)
+	if !ok {
+		return
+	}
+
+	if last, err := m.metricStore.GetContainerMetric(podUID, containerName, consts.MetricMemOomContainer); err == nil && last.Time != nil {
+		m.setContainerRateMetric(podUID, containerName, consts.MetricOOMKillRateContainer,
+			func() float64 {
+				return float64(m.counterDelta(consts.MetricOOMKillRateContainer, uint64(last.Value), oomKills))
+			},
+			last.Time.Unix(), updateTimeInSec)
+	}
+}
+
+// processContainerSwap handles the swap usage of the container, and the rates of swap-in and swap-out are
+// calculated based on the counters of the last sample if they are available, so counters are updated after them.
+func (m *MalachiteMetricsFetcher) processContainerSwap(podUID, containerName string, cgStats *types.MalachiteCgroupInfo) {
+	usage, updateTimeInSec, ok := getCgroupSwapUsage(cgStats)
+	if !ok {
+		return
+	}
+
+	updateTime := time.Unix(updateTimeInSec, 0)
+	m.metricStore.SetContainerMetric(podUID, containerName, consts.MetricSwapUsageContainer,
+		metric.MetricData{Value: float64(usage), Time: &updateTime})
+
+	pswpin, pswpout, updateTimeInSec, ok := getCgroupSwapCounters(cgStats)
+	if !ok {
+		return
+	}
+
+	updateTime = time.Unix(updateTimeInSec, 0)
+	for _, counter := range []struct {
+		value       uint64
+		counterName string
+		rateName    string
+	}{
+		{value: pswpin, counterName: consts.MetricSwapInCountContainer, rateName: consts.MetricSwapInRateContainer},
+		{value: pswpout, counterName: consts.MetricSwapOutCountContainer, rateName: consts.MetricSwapOutRateContainer},
+	} {
+		if last, err := m.metricStore.GetContainerMetric(podUID, containerName, counter.counterName); err == nil && last.Time != nil {
+			value := counter.value
+			m.setContainerRateMetric(podUID, containerName, counter.rateName,
+				func() float64 { return float64(m.counterDelta(counter.rateName, uint64(last.Value), value)) },
+				last.Time.Unix(), updateTimeInSec)
+		}
+
+		m.metricStore.SetContainerMetric(podUID, containerName, counter.counterName,
+			metric.MetricData{Value: float64(counter.value), Time: &updateTime})
+	}
+}
+
+// processContainerCPUWeight handles the cpu weight of the container in the same scale for both cgroup versions
+func (m *MalachiteMetricsFetcher) processContainerCPUWeight(podUID, containerName string, cgStats *types.MalachiteCgroupInfo) {
+	weight, updateTimeInSec, ok := getCgroupCPUWeight(cgStats)
+	if !ok {
+		return
+	}
+
+	updateTime := time.Unix(updateTimeInSec, 0)
+	m.metricStore.SetContainerMetric(podUID, containerName, consts.MetricCPUWeightContainer,
+		metric.MetricData{Value: float64(weight), Time: &updateTime})
+}
+
+// processContainerCPUContention calculates the composite contention signal based on the latest cpu pressure
+// and throttling ratio in current cycle, and it should be called before raw throttle counters are updated.
+func (m *MalachiteMetricsFetcher) processContainerCPUContention(podUID, containerName string, cgStats *types.MalachiteCgroupInfo, lastUpdateTimeInSec int64) {
+	psiAvg10, _, ok := getCgroupCPUPressureSomeAvg10(cgStats)
+	if !ok {
+		return
+	}
+
+	nrThrottled, nrPeriods, curUpdateTimeInSec, ok := getCgroupCPUThrottleCounters(cgStats)
+	if !ok || lastUpdateTimeInSec == 0 || curUpdateTimeInSec <= lastUpdateTimeInSec {
+		return
+	}
+
+	var (
+		lastNrThrottledMetric, _ = m.metricStore.GetContainerMetric(podUID, containerName, consts.MetricCPUNrThrottledContainer)
+		lastNrPeriodsMetric, _   = m.metricStore.GetContainerMetric(podUID, containerName, consts.MetricCPUThrottledPeriodContainer)
+
+		nrThrottledInc = m.counterDelta(consts.MetricCPUContentionContainer, uint64(lastNrThrottledMetric.Value), nrThrottled)
+		nrPeriodsInc   = m.counterDelta(consts.MetricCPUContentionContainer, uint64(lastNrPeriodsMetric.Value), nrPeriods)
+		throttleRatio  float64
+	)
+	if nrPeriodsInc > 0 {
+		throttleRatio = float64(nrThrottledInc) / float64(nrPeriodsInc)
+	}
+
+	contention := 0.
+	if psiAvg10 > m.metricConf.CPUContentionPSIThreshold && throttleRatio > m.metricConf.CPUContentionThrottleRatioThreshold {
+		contention = 1
+	}
+
+	updateTime := time.Unix(curUpdateTimeInSec, 0)
+	m.metricStore.SetContainerMetric(podUID, containerName, consts.MetricCPUContentionContainer,
+		metric.MetricData{Value: contention, Time: &updateTime})
+}
+
+// processContainerCPUThrottleToUsageRatio calculates the ratio of throttled time to the sum of usage and
+// throttled time in current cycle, and it should be called before raw throttle counters are updated.
+func (m *MalachiteMetricsFetcher) processContainerCPUThrottleToUsageRatio(podUID, containerName string, cgStats *types.MalachiteCgroupInfo) {
+	throttledTime, usage, curUpdateTimeInSec, ok := getCgroupCPUThrottledTime(cgStats)
+	if !ok {
+		return
+	}
+
+	last, err := m.metricStore.GetContainerMetric(podUID, containerName, consts.MetricCPUThrottledTimeContainer)
+	if err != nil || last.Time == nil || curUpdateTimeInSec <= last.Time.Unix() {
+		return
+	}
+
+	// throttled time is in nanoseconds, so it's converted into cores to be comparable with usage
+	interval := float64(curUpdateTimeInSec - last.Time.Unix())
+	throttled := float64(m.counterDelta(consts.MetricCPUThrottleToUsageRatioContainer, uint64(last.Value), throttledTime)) / float64(time.Second) / interval
+	if usage+throttled <= 0 {
+		return
+	}
+
+	updateTime := time.Unix(curUpdateTimeInSec, 0)
+	m.metricStore.SetContainerMetric(podUID, containerName, consts.MetricCPUThrottleToUsageRatioContainer,
+		metric.MetricData{Value: throttled / (usage + throttled), Time: &updateTime})
+}
+
+// getSharedSampleWindow returns the update time shared by all counters of a combined metric,
+// and it returns false if those counters are sampled in different windows.
+func (m *MalachiteMetricsFetcher) getSharedSampleWindow(podUID, containerName, targetMetricName string, samples ...counterSample) (int64, bool) {
+	if len(samples) == 0 {
+		return 0, false
+	}
+
+	minUpdateTime, maxUpdateTime := samples[0].updateTime, samples[0].updateTime
+	for _, sample := range samples[1:] {
+		if sample.updateTime < minUpdateTime {
+			minUpdateTime = sample.updateTime
+		}
+		if sample.updateTime > maxUpdateTime {
+			maxUpdateTime = sample.updateTime
+		}
+	}
+
+	if maxUpdateTime-minUpdateTime > counterSampleWindowToleranceInSec {
+		general.Warningf("skip %v for pod %v container %v: counters are sampled in different windows [%v, %v]",
+			targetMetricName, podUID, containerName, minUpdateTime, maxUpdateTime)
+		_ = m.emitter.StoreInt64(metricsNameMalachiteSampleWindowMismatch, 1, metrics.MetricTypeNameCount,
+			metrics.MetricTag{Key: "metric", Val: targetMetricName})
+		return 0, false
+	}
+	return maxUpdateTime, true
+}
+
+// processContainerMemUtilization handles memory utilization (usage/limit) for container,
+// the utilization will be reported as 0 if no memory limit is set for the container.
+func (m *MalachiteMetricsFetcher) processContainerMemUtilization(podUID, containerName string, cgStats *types.MalachiteCgroupInfo) {
+	usage, updateTimeInSec, ok := getCgroupMemoryUsage(cgStats)
+	if !ok {
+		return
+	}
+
+	limit, unlimited, _, ok := getCgroupMemoryLimit(cgStats)
+	if !ok {
+		return
+	}
+
+	utilization := .0
+	if !unlimited {
+		utilization = float64(usage) / float64(limit)
+	}
+
+	updateTime := time.Unix(updateTimeInSec, 0)
+	m.metricStore.SetContainerMetric(podUID, containerName, consts.MetricMemUtilizationContainer,
+		metric.MetricData{Value: utilization, Time: &updateTime})
+}
+
+// processSystemCPUStealData handles cpu steal time rate in node level, and the result represents
+// the number of cores stolen by hypervisor; it will be skipped if steal time is not reported.
+func (m *MalachiteMetricsFetcher) processSystemCPUStealData(systemComputeData *types.SystemComputeData) {
+	if systemComputeData.GlobalCPU.CPUStealTime == nil {
+		return
+	}
+
+	var (
+		lastStealTimeMetric, _ = m.metricStore.GetNodeMetric(consts.MetricCPUStealTimeNode)
+		lastStealTime          = uint64(lastStealTimeMetric.Value)
+		lastUpdateTimeInSec    int64
+
+		curStealTime = *systemComputeData.GlobalCPU.CPUStealTime
+		updateTime   = time.Unix(systemComputeData.UpdateTime, 0)
+	)
+	if lastStealTimeMetric.Time != nil {
+		lastUpdateTimeInSec = lastStealTimeMetric.Time.Unix()
+	}
+
+	m.setNodeRateMetric(consts.MetricCPUStealNode,
+		func() float64 {
+			return float64(m.counterDelta(consts.MetricCPUStealNode, lastStealTime, curStealTime)) / float64(time.Second)
+		},
+		lastUpdateTimeInSec, systemComputeData.UpdateTime)
+
+	m.metricStore.SetNodeMetric(consts.MetricCPUStealTimeNode,
+		metric.MetricData{Value: float64(curStealTime), Time: &updateTime})
+}
+
+// processSystemSocketMemBandwidth handles local and remote memory bandwidth for each
+// socket, and sockets without the breakdown counters will be skipped.
+func (m *MalachiteMetricsFetcher) processSystemSocketMemBandwidth(systemMemoryData *types.SystemMemoryData) {
+	updateTime := time.Unix(systemMemoryData.UpdateTime, 0)
+
+	for _, socket := range systemMemoryData.Socket {
+		if socket.LocalDRAMReads == nil || socket.RemoteDRAMReads == nil {
+			continue
+		}
+
+		var (
+			lastLocalDRAMReadsMetric, _  = m.metricStore.GetSocketMetric(socket.ID, consts.MetricMemLocalDRAMReadsSocket)
+			lastRemoteDRAMReadsMetric, _ = m.metricStore.GetSocketMetric(socket.ID, consts.MetricMemRemoteDRAMReadsSocket)
+
+			lastLocalDRAMReads  = uint64(lastLocalDRAMReadsMetric.Value)
+			lastRemoteDRAMReads = uint64(lastRemoteDRAMReadsMetric.Value)
+			curLocalDRAMReads   = *socket.LocalDRAMReads
+			curRemoteDRAMReads  = *socket.RemoteDRAMReads
+			lastUpdateTimeInSec int64
+		)
+		if lastLocalDRAMReadsMetric.Time != nil {
+			lastUpdateTimeInSec = lastLocalDRAMReadsMetric.Time.Unix()
+		}
+
+		m.setSocketRateMetric(socket.ID, consts.MetricMemBandwidthLocalSocket,
+			func() float64 {
+				return m.toMemBandwidthUnit(float64(m.counterDelta(consts.MetricMemBandwidthLocalSocket, lastLocalDRAMReads, curLocalDRAMReads)) * float64(m.memBandwidthConstants.CacheLineSize))
+			},
+			lastUpdateTimeInSec, systemMemoryData.UpdateTime)
+		m.setSocketRateMetric(socket.ID, consts.MetricMemBandwidthRemoteSocket,
+			func() float64 {
+				return m.toMemBandwidthUnit(float64(m.counterDelta(consts.MetricMemBandwidthRemoteSocket, lastRemoteDRAMReads, curRemoteDRAMReads)) * float64(m.memBandwidthConstants.CacheLineSize))
+			},
+			lastUpdateTimeInSec, systemMemoryData.UpdateTime)
+
+		m.metricStore.SetSocketMetric(socket.ID, consts.MetricMemLocalDRAMReadsSocket,
+			metric.MetricData{Value: float64(curLocalDRAMReads), Time: &updateTime})
+		m.metricStore.SetSocketMetric(socket.ID, consts.MetricMemRemoteDRAMReadsSocket,
+			metric.MetricData{Value: float64(curRemoteDRAMReads), Time: &updateTime})
+	}
+
+	m.processSystemMemChannels(systemMemoryData)
+}
+
+// processSystemSocketEnergy calculates the power of each socket from the delta of RAPL energy counters,
+// and it's skipped for sockets (or hosts) not exposing RAPL.
+func (m *MalachiteMetricsFetcher) processSystemSocketEnergy(systemComputeData *types.SystemComputeData) {
+	updateTime := time.Unix(systemComputeData.UpdateTime, 0)
+
+	var socketIDs []int
+	for _, socket := range systemComputeData.Socket {
+		if socket.EnergyUJ == nil {
+			continue
+		}
+
+		var (
+			lastEnergyMetric, _ = m.metricStore.GetSocketMetric(socket.ID, consts.MetricEnergyCounterSocket)
+			lastEnergy          = uint64(lastEnergyMetric.Value)
+			curEnergy           = *socket.EnergyUJ
+			lastUpdateTimeInSec int64
+		)
+		if lastEnergyMetric.Time != nil {
+			lastUpdateTimeInSec = lastEnergyMetric.Time.Unix()
+		}
+
+		m.setSocketRateMetric(socket.ID, consts.MetricEnergyJoulesSocket,
+			func() float64 {
+				// microjoules to joules
+				return float64(m.counterDelta(consts.MetricEnergyJoulesSocket, lastEnergy, curEnergy)) / 1e6
+			},
+			lastUpdateTimeInSec, systemComputeData.UpdateTime)
+		m.metricStore.SetSocketMetric(socket.ID, consts.MetricEnergyCounterSocket,
+			metric.MetricData{Value: float64(curEnergy), Time: &updateTime})
+		socketIDs = append(socketIDs, socket.ID)
+	}
+	m.energySocketIDs = socketIDs
+}
+
+// processContainerEnergy estimates the power of each container by attributing the power of all sockets to
+// containers weighted by cpu usage, and it's skipped if the power of sockets or cpu usage is not fresh.
+func (m *MalachiteMetricsFetcher) processContainerEnergy(podsContainersStats map[string]map[string]*types.MalachiteCgroupInfo) {
+	now := time.Now()
+	fresh := func(data metric.MetricData, err error) bool {
+		return err == nil && data.Time != nil && now.Sub(*data.Time) <= derivedMetricFreshness
+	}
+
+	var power float64
+	for _, socketID := range m.energySocketIDs {
+		data, err := m.metricStore.GetSocketMetric(socketID, consts.MetricEnergyJoulesSocket)
+		if !fresh(data, err) {
+			return
+		}
+		power += data.Value
+	}
+	if len(m.energySocketIDs) == 0 {
+		return
+	}
+
+	var totalUsage float64
+	usages := make(map[string]map[string]metric.MetricData)
+	for podUID, containerStats := range podsContainersStats {
+		for containerName := range containerStats {
+			data, err := m.metricStore.GetContainerMetric(podUID, containerName, consts.MetricCPUUsageContainer)
+			if !fresh(data, err) {
+				continue
+			}
+			if _, ok := usages[podUID]; !ok {
+				usages[podUID] = make(map[string]metric.MetricData)
+			}
+			usages[podUID][containerName] = data
+			totalUsage += data.Value
+		}
+	}
+	if totalUsage <= 0 {
+		return
+	}
+
+	for podUID, containerUsages := range usages {
+		for containerName, usage := range containerUsages {
+			m.metricStore.SetContainerMetric(podUID, containerName, consts.MetricEnergyJoulesContainer,
+				metric.MetricData{Value: power * usage.Value / totalUsage, Time: usage.Time})
+		}
+	}
+}
+
+// processSystemMemChannels compares node bandwidth (the sum of socket bandwidth calculated in current cycle)
+// with the peak bandwidth of all memory channels. It's expressed both in the number of channels running at
+// peak bandwidth (assuming bandwidth is evenly distributed among all channels, and capped by the channel
+// count), and in the bandwidth headroom (clamped to zero). Both are skipped if node bandwidth is unknown.
+func (m *MalachiteMetricsFetcher) processSystemMemChannels(systemMemoryData *types.SystemMemoryData) {
+	channelCount, peakBandwidth := m.metricConf.MemChannelCount, m.metricConf.MemChannelPeakBandwidth
+	if channelCount <= 0 || peakBandwidth <= 0 {
+		return
+	}
+
+	var (
+		updateTime = time.Unix(systemMemoryData.UpdateTime, 0)
+		bandwidth  float64
+		found      bool
+	)
+	for _, socket := range systemMemoryData.Socket {
+		for _, metricName := range []string{consts.MetricMemBandwidthLocalSocket, consts.MetricMemBandwidthRemoteSocket} {
+			data, err := m.metricStore.GetSocketMetric(socket.ID, metricName)
+			if err != nil || data.Time == nil || !data.Time.Equal(updateTime) {
+				continue
+			}
+			bandwidth += data.Value
+			found = true
+		}
+	}
+	if !found {
+		return
+	}
+
+	peakBandwidth = m.scaleMemChannelPeakBandwidth(peakBandwidth, updateTime)
+	channels := bandwidth / peakBandwidth
+	if channels > float64(channelCount) {
+		channels = float64(channelCount)
+	}
+	m.metricStore.SetNodeMetric(consts.MetricMemChannelsUtilizedSystem, metric.MetricData{Value: channels, Time: &updateTime})
+
+	headroom := math.Max(0, float64(channelCount)*peakBandwidth-bandwidth)
+	m.metricStore.SetNodeMetric(consts.MetricMemBandwidthHeadroomNode, metric.MetricData{Value: headroom, Time: &updateTime})
+}
+
+// scaleMemChannelPeakBandwidth scales the peak bandwidth of channels by current frequency of the node against
+// MemChannelPeakBaseFrequency, and the static peak is returned if the frequency is not collected around updateTime.
+func (m *MalachiteMetricsFetcher) scaleMemChannelPeakBandwidth(peakBandwidth float64, updateTime time.Time) float64 {
+	baseFrequency := m.metricConf.MemChannelPeakBaseFrequency
+	if baseFrequency <= 0 {
+		return peakBandwidth
+	}
+
+	data, err := m.metricStore.GetNodeMetric(consts.MetricCPUFrequencyNode)
+	if err != nil || data.Time == nil || data.Value <= 0 {
+		return peakBandwidth
+	}
+	if skew := updateTime.Sub(*data.Time); skew > derivedMetricFreshness || skew < -derivedMetricFreshness {
+		return peakBandwidth
+	}
+	return peakBandwidth * data.Value / baseFrequency
+}
+
+// updateMemBandwidthExcludedPods refreshes pods whose containers are excluded from the tenant bandwidth
+func (m *MalachiteMetricsFetcher) updateMemBandwidthExcludedPods(pods []*v1.Pod) {
+	excludedPods := make(map[string]bool)
+	for _, p := range pods {
+		if m.memBandwidthExcludedPodSelector.Matches(labels.Set(p.Labels)) {
+			excludedPods[string(p.UID)] = true
+		}
+	}
+	m.memBandwidthExcludedPods = excludedPods
+}
+
+// isMemBandwidthExcluded returns true if the container is excluded from the tenant bandwidth
+// for its pod labels or its cgroup path.
+func (m *MalachiteMetricsFetcher) isMemBandwidthExcluded(podUID string, cgStats *types.MalachiteCgroupInfo) bool {
+	if m.memBandwidthExcludedPods[podUID] {
+		return true
+	}
+
+	if len(m.metricConf.MemBandwidthNodeExcludedCgroupPaths) == 0 || cgStats == nil {
+		return false
+	}
+	cgroupPath, ok := getCgroupCPUFullPath(cgStats)
+	if !ok {
+		return false
+	}
+	for _, prefix := range m.metricConf.MemBandwidthNodeExcludedCgroupPaths {
+		if prefix != "" && strings.HasPrefix(cgroupPath, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// processNodeTenantMemBandwidth sums up the read and write bandwidth of containers in current cycle as the
+// tenant bandwidth of the node, except for the excluded ones and idle ones below MemBandwidthNodeIdleFloor, and
+// it's skipped if no container has fresh bandwidth.
+func (m *MalachiteMetricsFetcher) processNodeTenantMemBandwidth(podsContainersStats map[string]map[string]*types.MalachiteCgroupInfo) {
+	var (
+		now        = time.Now()
+		bandwidth  float64
+		updateTime *time.Time
+	)
+	for podUID, containerStats := range podsContainersStats {
+		for containerName, cgStats := range containerStats {
+			if m.isMemBandwidthExcluded(podUID, cgStats) {
+				continue
+			}
+
+			var (
+				containerBandwidth  float64
+				containerUpdateTime *time.Time
+			)
+			for _, metricName := range []string{consts.MetricMemBandwidthReadContainer, consts.MetricMemBandwidthWriteContainer} {
+				data, err := m.metricStore.GetContainerMetric(podUID, containerName, metricName)
+				if err != nil || data.Time == nil || now.Sub(*data.Time) > derivedMetricFreshness {
+					continue
+				}
+				containerBandwidth += data.Value
+				containerUpdateTime = general.MaxTimePtr(containerUpdateTime, data.Time)
+			}
+			if containerUpdateTime == nil {
+				continue
+			}
+
+			// the update time of idle containers still counts, so that the total is updated even if all are idle
+			updateTime = general.MaxTimePtr(updateTime, containerUpdateTime)
+			if containerBandwidth < m.metricConf.MemBandwidthNodeIdleFloor {
+				continue
+			}
+			bandwidth += containerBandwidth
+		}
+	}
+	if updateTime == nil {
+		return
+	}
+
+	m.metricStore.SetNodeMetric(consts.MetricMemBandwidthTenantNode, metric.MetricData{Value: bandwidth, Time: updateTime})
+	m.processNodeDecayedMemBandwidth(bandwidth, *updateTime)
+}
+
+// processNodeDecayedMemBandwidth updates the decayed tenant bandwidth of the node, which jumps to the current
+// bandwidth if it's higher, and decays towards it with MemBandwidthNodeDecayFactor as the weight of the last
+// estimate otherwise. The estimate is only updated once for each update of the tenant bandwidth.
+func (m *MalachiteMetricsFetcher) processNodeDecayedMemBandwidth(bandwidth float64, updateTime time.Time) {
+	factor := m.metricConf.MemBandwidthNodeDecayFactor
+	if factor <= 0 || factor >= 1 {
+		m.memBandwidthDecayed = nil
+		return
+	}
+
+	decayed := bandwidth
+	if last := m.memBandwidthDecayed; last != nil {
+		if !updateTime.After(*last.Time) {
+			return
+		}
+		decayed = math.Max(bandwidth, factor*last.Value+(1-factor)*bandwidth)
+	}
+	m.memBandwidthDecayed = &metric.MetricData{Value: decayed, Time: &updateTime}
+	m.metricStore.SetNodeMetric(consts.MetricMemBandwidthDecayedNode, metric.MetricData{Value: decayed, Time: &updateTime})
+}
+
+// processContainerMemBandwidthShare calculates the share of each container in the total bandwidth of all
+// containers, so it must be called after bandwidth of all containers are updated in the cycle, and it's
+// skipped if the total is zero. Containers without fresh bandwidth are not counted in the total.
+func (m *MalachiteMetricsFetcher) processContainerMemBandwidthShare(podsContainersStats map[string]map[string]*types.MalachiteCgroupInfo) {
+	type containerBandwidth struct {
+		podUID, containerName string
+		bandwidth             float64
+		updateTime            *time.Time
+	}
+
+	var (
+		now        = time.Now()
+		total      float64
+		bandwidths []containerBandwidth
+	)
+	for podUID, containerStats := range podsContainersStats {
+		for containerName := range containerStats {
+			cur := containerBandwidth{podUID: podUID, containerName: containerName}
+			for _, metricName := range []string{consts.MetricMemBandwidthReadContainer, consts.MetricMemBandwidthWriteContainer} {
+				data, err := m.metricStore.GetContainerMetric(podUID, containerName, metricName)
+				if err != nil || data.Time == nil || now.Sub(*data.Time) > derivedMetricFreshness {
+					continue
+				}
+				cur.bandwidth += data.Value
+				cur.updateTime = general.MaxTimePtr(cur.updateTime, data.Time)
+			}
+
+			if cur.updateTime != nil {
+				total += cur.bandwidth
+				bandwidths = append(bandwidths, cur)
+			}
+		}
+	}
+	if total <= 0 {
+		return
+	}
+
+	for _, cur := range bandwidths {
+		m.metricStore.SetContainerMetric(cur.podUID, cur.containerName, consts.MetricMemBandwidthShareContainer,
+			metric.MetricData{Value: cur.bandwidth / total, Time: cur.updateTime})
+	}
+}
+
+// processContainerMemBandwidthIntensity handles the memory bandwidth per byte of working set, which
+// could be used to tell streaming workloads from cache-resident ones. It's calculated based on the
+// latest bandwidth and working set, and skipped if any of them is not fresh or working set is zero.
+func (m *MalachiteMetricsFetcher) processContainerMemBandwidthIntensity(podUID, containerName string, now time.Time) {
+	var (
+		readBandwidth, readErr   = m.metricStore.GetContainerMetric(podUID, containerName, consts.MetricMemBandwidthReadContainer)
+		writeBandwidth, writeErr = m.metricStore.GetContainerMetric(podUID, containerName, consts.MetricMemBandwidthWriteContainer)
+		workingSet, wsErr        = m.metricStore.GetContainerMetric(podUID, containerName, consts.MetricMemWorkingSetContainer)
+	)
+	if readErr != nil || writeErr != nil || wsErr != nil || workingSet.Value <= 0 {
+		return
+	}
+
+	for _, data := range []metric.MetricData{readBandwidth, writeBandwidth, workingSet} {
+		if data.Time == nil || now.Sub(*data.Time) > derivedMetricFreshness {
+			return
+		}
+	}
+
+	bandwidthInBytes := (readBandwidth.Value + writeBandwidth.Value) * m.memBandwidthUnitScale
+	m.metricStore.SetContainerMetric(podUID, containerName, consts.MetricMemBandwidthIntensityContainer,
+		metric.MetricData{Value: bandwidthInBytes / workingSet.Value, Time: general.MaxTimePtr(readBandwidth.Time, writeBandwidth.Time)})
+}
+
+// processContainerBandwidthPerInstruction handles the memory traffic in bytes per instruction retired, and high
+// values indicate streaming or memory-bound code. It's calculated with the bytes from counter deltas of the same
+// sample, and skipped if the instruction delta is zero or the bandwidth is not updated by the sample.
+func (m *MalachiteMetricsFetcher) processContainerBandwidthPerInstruction(podUID, containerName string, instructionDiff, bytes float64,
+	curUpdateTime int64) {
+	if instructionDiff <= 0 {
+		return
+	}
+
+	var (
+		readBandwidth, readErr   = m.metricStore.GetContainerMetric(podUID, containerName, consts.MetricMemBandwidthReadContainer)
+		writeBandwidth, writeErr = m.metricStore.GetContainerMetric(podUID, containerName, consts.MetricMemBandwidthWriteContainer)
+	)
+	if readErr != nil || writeErr != nil {
+		return
+	}
+	for _, data := range []metric.MetricData{readBandwidth, writeBandwidth} {
+		if data.Time == nil || data.Time.Unix() != curUpdateTime {
+			return
+		}
+	}
+
+	updateTime := time.Unix(curUpdateTime, 0)
+	m.metricStore.SetContainerMetric(podUID, containerName, consts.MetricBandwidthPerInstructionContainer,
+		metric.MetricData{Value: bytes / instructionDiff, Time: &updateTime})
+}
+
+// processContainerMemBandwidthPressureClass calculates the bandwidth utilization of the container against the
+// peak bandwidth of all memory channels (scaled by the frequency of the node), and classifies it by the configured bands. It's skipped if bands or
+// the peak bandwidth are not configured, or if the latest bandwidth is not fresh.
+func (m *MalachiteMetricsFetcher) processContainerMemBandwidthPressureClass(podUID, containerName string, now time.Time) {
+	bands := m.metricConf.MemBandwidthPressureClassBands
+	peakBandwidth := float64(m.metricConf.MemChannelCount) * m.metricConf.MemChannelPeakBandwidth
+	if len(bands) == 0 || peakBandwidth <= 0 {
+		return
+	}
+
+	var (
+		readBandwidth, readErr   = m.metricStore.GetContainerMetric(podUID, containerName, consts.MetricMemBandwidthReadContainer)
+		writeBandwidth, writeErr = m.metricStore.GetContainerMetric(podUID, containerName, consts.MetricMemBandwidthWriteContainer)
+	)
+	if readErr != nil || writeErr != nil {
+		return
+	}
+
+	for _, data := range []metric.MetricData{readBandwidth, writeBandwidth} {
+		if data.Time == nil || now.Sub(*data.Time) > derivedMetricFreshness {
+			return
+		}
+	}
+
+	updateTime := general.MaxTimePtr(readBandwidth.Time, writeBandwidth.Time)
+	// the peak is reduced with the frequency of the node, the same as that of node saturation
+	peakBandwidth = m.scaleMemChannelPeakBandwidth(peakBandwidth, *updateTime)
+	utilization := (readBandwidth.Value + writeBandwidth.Value) / peakBandwidth
+	m.metricStore.SetContainerMetric(podUID, containerName, consts.MetricMemBandwidthUtilizationContainer,
+		metric.MetricData{Value: utilization, Time: updateTime})
+
+	// bands are validated to be ascending, so the class is the number of bands not greater than utilization
+	class := sort.Search(len(bands), func(i int) bool { return bands[i] > utilization })
+	m.metricStore.SetContainerMetric(podUID, containerName, consts.MetricMemBandwidthPressureClassContainer,
+		metric.MetricData{Value: float64(class), Time: updateTime})
+}
+
+// memBandwidthBaseline is the total memory bandwidth of the container in the last cycles
+type memBandwidthBaseline struct {
+	samples []float64
+	// lastTime is the time of the last bandwidth sample, to avoid
+	// recording the same sample more than once if it's not updated
+	lastTime time.Time
+}
+
+// processContainerMemBandwidthAnomaly calculates the ratio of current total memory bandwidth to the median
+// of the container's bandwidth in the last cycles, and it's skipped until enough samples are collected as
+// baseline, or if the baseline is zero. Current sample is added into the baseline after calculation.
+func (m *MalachiteMetricsFetcher) processContainerMemBandwidthAnomaly(podUID, containerName string, now time.Time) {
+	maxCycles := m.metricConf.MemBandwidthAnomalyBaselineCycles
+	if maxCycles <= 0 || !m.isDerivationDue(consts.MetricMemBandwidthAnomalyContainer) {
+		return
+	}
+
+	var (
+		readBandwidth, readErr   = m.metricStore.GetContainerMetric(podUID, containerName, consts.MetricMemBandwidthReadContainer)
+		writeBandwidth, writeErr = m.metricStore.GetContainerMetric(podUID, containerName, consts.MetricMemBandwidthWriteContainer)
+	)
+	if readErr != nil || writeErr != nil {
+		return
+	}
+	for _, data := range []metric.MetricData{readBandwidth, writeBandwidth} {
+		if data.Time == nil || now.Sub(*data.Time) > derivedMetricFreshness {
+			return
+		}
+	}
+
+	if _, ok := m.memBandwidthBaselines[podUID]; !ok {
+		m.memBandwidthBaselines[podUID] = make(map[string]*memBandwidthBaseline)
+	}
+	baseline, ok := m.memBandwidthBaselines[podUID][containerName]
+	if !ok {
+		baseline = &memBandwidthBaseline{}
+		m.memBandwidthBaselines[podUID][containerName] = baseline
+	}
+
+	sampleTime := general.MaxTimePtr(readBandwidth.Time, writeBandwidth.Time)
+	if !sampleTime.After(baseline.lastTime) {
+		return
+	}
+	baseline.lastTime = *sampleTime
+
+	bandwidth := readBandwidth.Value + writeBandwidth.Value
+	if len(baseline.samples) >= maxCycles {
+		if median := medianOf(baseline.samples); median > 0 {
+			m.metricStore.SetContainerMetric(podUID, containerName, consts.MetricMemBandwidthAnomalyContainer,
+				metric.MetricData{Value: bandwidth / median, Time: sampleTime})
+		}
+	}
+
+	baseline.samples = append(baseline.samples, bandwidth)
+	if len(baseline.samples) > maxCycles {
+		baseline.samples = baseline.samples[len(baseline.samples)-maxCycles:]
+	}
+}
+
+// gcMemBandwidthBaselines removes bandwidth baselines of pods not existing any more
+func (m *MalachiteMetricsFetcher) gcMemBandwidthBaselines(livingPodUIDSet map[string]bool) {
+	for podUID := range m.memBandwidthBaselines {
+		if !livingPodUIDSet[podUID] {
+			delete(m.memBandwidthBaselines, podUID)
+		}
+	}
+}
+
+// counterStuckWarningThresholdInSec is the staleness of counters beyond which they are warned as stuck
+const counterStuckWarningThresholdInSec = 300
+
+// counterAdvance is the cumulative counters of the container in the last sample
+type counterAdvance struct {
+	counters []uint64
+	// lastAdvanceTime is the update time of the sample in which any counter advanced last time
+	lastAdvanceTime int64
+	// warned is set if the counters have been warned as stuck since they advanced last time
+	warned bool
+}
+
+// processContainerFreezeState sets whether the cgroup of the container is frozen
+func (m *MalachiteMetricsFetcher) processContainerFreezeState(podUID, containerName string, cgStats *types.MalachiteCgroupInfo) {
+	frozen, updateTimeInSec, ok := getCgroupFrozen(cgStats)
+	if !ok {
+		return
+	}
+
+	value := 0.
+	if frozen {
+		value = 1
+	}
+	updateTime := time.Unix(updateTimeInSec, 0)
+	m.metricStore.SetContainerMetric(podUID, containerName, consts.MetricCgroupFrozenContainer,
+		metric.MetricData{Value: value, Time: &updateTime})
+}
+
+// processContainerCounterStaleness calculates the seconds since any cumulative counter of the container
+// advanced, based on the update time of samples rather than wall clock, so that it only grows when the
+// container is still updated but its counters stay flat. The first sample is regarded as an advance.
+// Counters are warned once as stuck if the staleness exceeds the threshold, unless the cgroup is frozen.
+func (m *MalachiteMetricsFetcher) processContainerCounterStaleness(podUID, containerName string, cgStats *types.MalachiteCgroupInfo) {
+	counters, updateTimeInSec, ok := getCgroupCPUCounters(cgStats)
+	if !ok {
+		return
+	}
+
+	if _, ok := m.counterAdvances[podUID]; !ok {
+		m.counterAdvances[podUID] = make(map[string]*counterAdvance)
+	}
+	last, ok := m.counterAdvances[podUID][containerName]
+	if !ok || !reflect.DeepEqual(last.counters, counters) {
+		last = &counterAdvance{counters: counters, lastAdvanceTime: updateTimeInSec}
+		m.counterAdvances[podUID][containerName] = last
+	}
+
+	staleness := updateTimeInSec - last.lastAdvanceTime
+	if staleness < 0 {
+		staleness = 0
+	}
+
+	// flat counters are expected for frozen cgroups
+	if frozen, _, _ := getCgroupFrozen(cgStats); !frozen && !last.warned && staleness >= counterStuckWarningThresholdInSec {
+		last.warned = true
+		general.Warningf("counters of container %v/%v have not advanced for %vs, they may be stuck",
+			podUID, containerName, staleness)
+		_ = m.emitter.StoreInt64(metricsNameMalachiteCounterStuck, 1, metrics.MetricTypeNameCount)
+	}
+
+	updateTime := time.Unix(updateTimeInSec, 0)
+	m.metricStore.SetContainerMetric(podUID, containerName, consts.MetricCounterStalenessContainer,
+		metric.MetricData{Value: float64(staleness), Time: &updateTime})
+}
+
+// gcCounterAdvances removes counters of pods that are not existed any more
+func (m *MalachiteMetricsFetcher) gcCounterAdvances(livingPodUIDSet map[string]bool) {
+	for podUID := range m.counterAdvances {
+		if !livingPodUIDSet[podUID] {
+			delete(m.counterAdvances, podUID)
+		}
+	}
+}
+
+// medianOf returns the median of values without changing their order
+func medianOf(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// checkMemBandwidthConsistency compares the sum of estimated write bandwidth of all containers
+// with the write bandwidth measured by IMC, and exports the ratio between them as discrepancy.
+// Large persistent discrepancy means the store-ratio based estimation doesn't fit the workloads.
+func (m *MalachiteMetricsFetcher) checkMemBandwidthConsistency(podsContainersStats map[string]map[string]*types.MalachiteCgroupInfo) (float64, bool) {
+	containerWriteBandwidth := .0
+	for podUID, containerStats := range podsContainersStats {
+		for containerName := range containerStats {
+			data, err := m.metricStore.GetContainerMetric(podUID, containerName, consts.MetricMemBandwidthWriteContainer)
+			if err != nil {
+				continue
+			}
+			containerWriteBandwidth += data.Value
+		}
+	}
+
+	// numa-level bandwidth is reported in GB/s by malachite
+	imcWriteBandwidth := m.toMemBandwidthUnit(m.metricStore.AggregateNumaMetric(consts.MetricMemBandwidthWriteNuma,
+		metric.AggregatorSum).Value * (1 << 30))
+	if imcWriteBandwidth <= 0 {
+		return 0, false
+	}
+
+	discrepancy := containerWriteBandwidth / imcWriteBandwidth
+	general.InfofV(4, "container write bandwidth %v, imc write bandwidth %v, discrepancy %v",
+		containerWriteBandwidth, imcWriteBandwidth, discrepancy)
+	_ = m.emitter.StoreFloat64(metricsNameMalachiteMemBandwidthWriteDiff, discrepancy, metrics.MetricTypeNameRaw)
+	return discrepancy, true
+}
+
+// toMemBandwidthUnit converts bytes into the configured memory bandwidth unit.
+func (m *MalachiteMetricsFetcher) toMemBandwidthUnit(bytes float64) float64 {
+	return bytes / m.memBandwidthUnitScale
+}
+
+// setNodeRateMetric is used to set rate metric in node level.
+func (m *MalachiteMetricsFetcher) setNodeRateMetric(targetMetricName string, deltaValueFunc func() float64, lastUpdateTime, curUpdateTime int64) {
+	data, ok := m.calculateRateMetric(deltaValueFunc, lastUpdateTime, curUpdateTime)
+	if !ok || m.isRateWarmingUp() {
+		return
+	}
+	m.metricStore.SetNodeMetric(targetMetricName, data)
+}
+
+// setSocketRateMetric is used to set rate metric in socket level.
+func (m *MalachiteMetricsFetcher) setSocketRateMetric(socketID int, targetMetricName string, deltaValueFunc func() float64, lastUpdateTime, curUpdateTime int64) {
+	data, ok := m.calculateRateMetric(deltaValueFunc, lastUpdateTime, curUpdateTime)
+	if !ok || m.isRateWarmingUp() {
+		return
+	}
+	m.metricStore.SetSocketMetric(socketID, targetMetricName, data)
 }
 
 // setContainerRateMetric is used to set rate metric in container level.
 // This method will check if the metric is really updated, and decide weather to update metric in metricStore.
 // The method could help avoid lots of meaningless "zero" value.
 func (m *MalachiteMetricsFetcher) setContainerRateMetric(podUID, containerName, targetMetricName string, deltaValueFunc func() float64, lastUpdateTime, curUpdateTime int64) {
+	m.setContainerMonotonicRateMetric(podUID, containerName, targetMetricName, deltaValueFunc, lastUpdateTime, curUpdateTime,
+		preciseSampleTime{}, preciseSampleTime{})
+}
+
+// countContainerRateSkip increases the count of samples of the container skipped in rate calculations,
+// and the sample is only counted once even if it's skipped by several rate metrics.
+func (m *MalachiteMetricsFetcher) countContainerRateSkip(podUID, containerName string, curUpdateTime int64) {
+	key := containerMetricKey{podUID: podUID, containerName: containerName}
+	if _, ok := m.rateSkippedContainers[key]; ok {
+		return
+	} else if m.rateSkippedContainers == nil {
+		m.rateSkippedContainers = make(map[containerMetricKey]struct{})
+	}
+	m.rateSkippedContainers[key] = struct{}{}
+
+	updateTime := time.Unix(curUpdateTime, 0)
+	m.metricStore.IncrementContainerMetric(podUID, containerName, consts.MetricRateSkipCountContainer,
+		metric.MetricData{Value: 1, Time: &updateTime})
+}
+
+// setContainerMonotonicRateMetric is the same as setContainerRateMetric, except that the interval is
+// measured by the precise times of samples if they are provided, see calculateMonotonicRateMetric.
+func (m *MalachiteMetricsFetcher) setContainerMonotonicRateMetric(podUID, containerName, targetMetricName string, deltaValueFunc func() float64,
+	lastUpdateTime, curUpdateTime int64, last, cur preciseSampleTime) {
+	if m.isContainerBaselineSample(podUID, containerName, lastUpdateTime, curUpdateTime) {
+		// the previous data belongs to the last instance of this container,
+		// so current sample should only be used as the baseline for counters
+		m.recordDerivedOutcome(podUID, containerName, targetMetricName, DerivedMetricOutcomeDropped)
+		return
+	}
+
+	// the previous counters are dropped on demand, so current sample is only used as baseline,
+	// and the reset should be kept until there comes a new sample
+	if curUpdateTime > lastUpdateTime && m.consumeContainerBaselineReset(podUID, containerName, targetMetricName) {
+		m.recordDerivedOutcome(podUID, containerName, targetMetricName, DerivedMetricOutcomeDropped)
+		return
+	}
+
+	if lastUpdateTime != 0 && curUpdateTime <= lastUpdateTime {
+		m.countContainerRateSkip(podUID, containerName, curUpdateTime)
+	}
+
+	data, ok := m.calculateMonotonicRateMetric(containerMetricKey{podUID: podUID, containerName: containerName},
+		deltaValueFunc, lastUpdateTime, curUpdateTime, last, cur)
+	if !ok || m.isRateWarmingUp() {
+		switch {
+		case lastUpdateTime == 0:
+			m.recordDerivedOutcome(podUID, containerName, targetMetricName, DerivedMetricOutcomeMissingCounter)
+		case curUpdateTime == lastUpdateTime:
+			m.recordDerivedOutcome(podUID, containerName, targetMetricName, DerivedMetricOutcomeZeroDelta)
+		default:
+			m.recordDerivedOutcome(podUID, containerName, targetMetricName, DerivedMetricOutcomeDropped)
+		}
+		return
+	}
+
+	// deltas of counters are never negative, so a negative rate means a bug in the derivation,
+	// and it's clamped to zero rather than published
+	if data.Value < 0 {
+		general.Warningf("clamp negative rate %v of %v for pod %v container %v", data.Value, targetMetricName, podUID, containerName)
+		_ = m.emitter.StoreInt64(metricsNameMalachiteNegativeRateClamped, 1, metrics.MetricTypeNameCount,
+			metrics.MetricTag{Key: "metric", Val: targetMetricName})
+		m.recordDerivedOutcome(podUID, containerName, targetMetricName, DerivedMetricOutcomeClamped)
+		data.Value = 0
+	}
+	m.recordDerivedOutcome(podUID, containerName, targetMetricName, DerivedMetricOutcomeSucceeded)
+	m.metricStore.SetContainerMetric(podUID, containerName, targetMetricName, data)
+}
+
+// isRateWarmingUp returns true if the fetcher is still in warm-up period, and rates calculated
+// should not be published, but the raw counters are still updated as baselines.
+func (m *MalachiteMetricsFetcher) isRateWarmingUp() bool {
+	return m.metricConf.RateWarmUpPeriod > 0 && time.Since(m.startTime) < m.metricConf.RateWarmUpPeriod
+}
+
+// calculateRateMetric calculates the rate of delta value in the period between two updates,
+// and it returns false if the period is not valid to calculate a meaningful rate.
+func (m *MalachiteMetricsFetcher) calculateRateMetric(deltaValueFunc func() float64, lastUpdateTime, curUpdateTime int64) (metric.MetricData, bool) {
+	return m.calculateMonotonicRateMetric(containerMetricKey{}, deltaValueFunc, lastUpdateTime, curUpdateTime, preciseSampleTime{}, preciseSampleTime{})
+}
+
+// calculateMonotonicRateMetric calculates the rate with the interval between monotonic times (in nanoseconds)
+// of the updates if both of them are provided and RateMonotonicInterval is enabled, so that the rate won't be
+// affected by steps of wall-clock. Otherwise, the wall-clock interval is measured in nanoseconds if both of
+// the updates provide them, and in seconds at last. Intervals in nanoseconds are precise, so they are used
+// without smoothing, and they make rates of short windows accurate since no sub-second part is truncated.
+// The key identifies the container of the sample, and it's empty for samples of the node.
+func (m *MalachiteMetricsFetcher) calculateMonotonicRateMetric(key containerMetricKey, deltaValueFunc func() float64, lastUpdateTime, curUpdateTime int64,
+	last, cur preciseSampleTime) (metric.MetricData, bool) {
+	if m.metricConf.RateMonotonicInterval && lastUpdateTime != 0 && last.monotonicTime > 0 && cur.monotonicTime > 0 {
+		if cur.monotonicTime <= last.monotonicTime {
+			// the metric is not updated, or the monotonic clock of source is restarted (i.e. after reboot)
+			return metric.MetricData{}, false
+		}
+
+		interval := float64(cur.monotonicTime-last.monotonicTime) / float64(time.Second)
+		updateTime := time.Unix(curUpdateTime, 0)
+		m.rateIntervals.add(interval)
+		return metric.MetricData{Value: deltaValueFunc() / interval, Time: &updateTime}, true
+	}
+
 	timeDeltaInSec := curUpdateTime - lastUpdateTime
+	if direction, jumped := m.getRateClockJump(timeDeltaInSec); lastUpdateTime != 0 && jumped {
+		// the sample is dropped, and since raw counters are still updated, the next
+		// sample will be calculated against current one, i.e. the baseline restarts
+		m.countRateClockJump(key, direction, timeDeltaInSec)
+		return metric.MetricData{}, false
+	}
+
 	if lastUpdateTime == 0 || timeDeltaInSec <= 0 {
 		// Return directly when the following situations happen:
 		// 1. lastUpdateTime == 0, which means no previous data.
 		// 2. timeDeltaInSec == 0, which means the metric is not updated,
 		//	this is originated from the sampling lag between katalyst-core and malachite(data source)
 		// 3. timeDeltaInSec < 0, this is illegal and unlikely to happen.
-		return
+		return metric.MetricData{}, false
+	}
+
+	// nanoseconds are only trusted if they agree with the update times in seconds, since they may
+	// be restored from a snapshot written by a source not providing them
+	if last.updateTimeNano/int64(time.Second) == lastUpdateTime && cur.updateTimeNano/int64(time.Second) == curUpdateTime &&
+		last.updateTimeNano > 0 && cur.updateTimeNano > last.updateTimeNano {
+		interval := float64(cur.updateTimeNano-last.updateTimeNano) / float64(time.Second)
+		updateTime := time.Unix(0, cur.updateTimeNano)
+		m.rateIntervals.add(interval)
+		return metric.MetricData{Value: deltaValueFunc() / interval, Time: &updateTime}, true
 	}
 
 	// TODO this will duplicate "updateTime" a lot.
 	// But to my knowledge, the cost could be acceptable.
 	updateTime := time.Unix(curUpdateTime, 0)
-	m.metricStore.SetContainerMetric(podUID, containerName, targetMetricName,
-		metric.MetricData{Value: deltaValueFunc() / float64(timeDeltaInSec), Time: &updateTime})
+	m.rateIntervals.add(float64(timeDeltaInSec))
+	return metric.MetricData{Value: deltaValueFunc() / m.getEffectiveRateInterval(timeDeltaInSec), Time: &updateTime}, true
+}
+
+// getRateClockJump returns the direction of clock jump if the interval between updates is implausible compared
+// with the sampling interval, which is likely caused by clock steps (i.e. by NTP) of the node.
+func (m *MalachiteMetricsFetcher) getRateClockJump(timeDeltaInSec int64) (string, bool) {
+	factor, nominal := m.metricConf.RateClockJumpFactor, m.getSampleInterval().Seconds()
+	if factor <= 1 || nominal <= 0 {
+		return "", false
+	}
+
+	switch interval := float64(timeDeltaInSec); {
+	case interval > nominal*factor:
+		return "forward", true
+	case interval < 0, interval > 0 && interval < nominal/factor:
+		return "backward", true
+	default:
+		return "", false
+	}
+}
+
+// countRateClockJump counts the sample dropped for clock jump, and the sample is only counted once even if
+// it's dropped by several rate metrics. Samples of the node are keyed by the empty key.
+func (m *MalachiteMetricsFetcher) countRateClockJump(key containerMetricKey, direction string, timeDeltaInSec int64) {
+	if _, ok := m.rateClockJumpSamples[key]; ok {
+		return
+	} else if m.rateClockJumpSamples == nil {
+		m.rateClockJumpSamples = make(map[containerMetricKey]struct{})
+	}
+	m.rateClockJumpSamples[key] = struct{}{}
+
+	jumps := atomic.AddInt64(&m.rateClockJumps, 1)
+	_ = m.emitter.StoreInt64(metricsNameMalachiteRateClockJump, 1, metrics.MetricTypeNameCount,
+		metrics.MetricTag{Key: "direction", Val: direction})
+	if m.rateClockJumpLog.Allow() {
+		general.Warningf("clock jumped %v with update interval %vs against sampling interval %v, "+
+			"drop the sample (%v dropped in total)", direction, timeDeltaInSec, m.getSampleInterval(), jumps)
+	}
+}
+
+// rateIntervalWindow is a ring of the latest intervals (in seconds) between updates used to calculate rates
+type rateIntervalWindow struct {
+	sync.Mutex
+	intervals []float64
+	next      int
+}
+
+func (w *rateIntervalWindow) add(interval float64) {
+	w.Lock()
+	defer w.Unlock()
+
+	if len(w.intervals) < rateIntervalJitterWindow {
+		w.intervals = append(w.intervals, interval)
+		return
+	}
+	w.intervals[w.next] = interval
+	w.next = (w.next + 1) % rateIntervalJitterWindow
+}
+
+// jitter returns the coefficient of variation (standard deviation to mean) of intervals in
+// the window, which is zero if updates are perfectly regular, and it returns false if there
+// are not enough intervals.
+func (w *rateIntervalWindow) jitter() (float64, bool) {
+	w.Lock()
+	defer w.Unlock()
+
+	if len(w.intervals) < 2 {
+		return 0, false
+	}
+
+	var sum, squareSum float64
+	for _, interval := range w.intervals {
+		sum += interval
+	}
+	mean := sum / float64(len(w.intervals))
+	for _, interval := range w.intervals {
+		squareSum += (interval - mean) * (interval - mean)
+	}
+	return math.Sqrt(squareSum/float64(len(w.intervals))) / mean, true
+}
+
+// emitRateIntervalJitter emits the jitter of update times observed in rate calculation, which helps
+// to decide the collection interval and smoothing parameters, i.e. RateSmoothedInterval.
+func (m *MalachiteMetricsFetcher) emitRateIntervalJitter() {
+	if jitter, ok := m.rateIntervals.jitter(); ok {
+		_ = m.emitter.StoreFloat64(metricsNameMalachiteRateIntervalJitter, jitter, metrics.MetricTypeNameRaw)
+	}
+}
+
+// getEffectiveRateInterval returns the interval (in seconds) used as the divisor of rates. If the smoothed
+// interval is configured, the jitter of update times is absorbed by rounding the raw delta to multiples of
+// that interval, and skipped cycles are still reflected since the raw delta spans multiple intervals.
+func (m *MalachiteMetricsFetcher) getEffectiveRateInterval(timeDeltaInSec int64) float64 {
+	interval := m.metricConf.RateSmoothedInterval.Seconds()
+	if interval <= 0 {
+		return float64(timeDeltaInSec)
+	}
+	return math.Max(math.Round(float64(timeDeltaInSec)/interval), 1) * interval
+}
+
+// consumeContainerBaselineReset returns true if baseline of the container rate metric
+// has been reset since the last sample, and the reset will be cleared after that.
+func (m *MalachiteMetricsFetcher) consumeContainerBaselineReset(podUID, containerName, metricName string) bool {
+	m.baselineResetLock.Lock()
+	defer m.baselineResetLock.Unlock()
+
+	key := containerMetricKey{podUID: podUID, containerName: containerName, metricName: metricName}
+	if _, ok := m.baselineResets[key]; !ok {
+		return false
+	}
+	delete(m.baselineResets, key)
+	return true
+}
+
+// isContainerBaselineSample returns true if the sample is the first one collected for a newly started
+// container within the startup grace period, in which case the previous data (if exists) is left by the
+// last container instance and the delta between them is meaningless.
+func (m *MalachiteMetricsFetcher) isContainerBaselineSample(podUID, containerName string, lastUpdateTime, curUpdateTime int64) bool {
+	gracePeriod := m.metricConf.ContainerStartupBaselineGracePeriod
+	if gracePeriod <= 0 {
+		return false
+	}
+
+	startTime, ok := m.containerStartTime[podUID][containerName]
+	if !ok {
+		return false
+	}
+
+	if time.Unix(curUpdateTime, 0).Sub(startTime) > gracePeriod {
+		return false
+	}
+	return lastUpdateTime < startTime.Unix()
 }
 
 // uint64CounterDelta calculate the delta between two uint64 counters
@@ -0,0 +1,1783 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package malachite
+
+import (
+	"math"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/kubewharf/katalyst-core/pkg/config"
+	globalconfig "github.com/kubewharf/katalyst-core/pkg/config/agent/global"
+	"github.com/kubewharf/katalyst-core/pkg/consts"
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/metric/malachite/types"
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/pod"
+	"github.com/kubewharf/katalyst-core/pkg/metrics"
+	"github.com/kubewharf/katalyst-core/pkg/util/machine"
+	utilmetric "github.com/kubewharf/katalyst-core/pkg/util/metric"
+)
+
+func newTestCgroupInfoV2(updateTime int64, ocrReadDRAMs uint64) *types.MalachiteCgroupInfo {
+	return &types.MalachiteCgroupInfo{
+		CgroupType: "V2",
+		V2: &types.MalachiteCgroupV2Info{
+			Memory:    &types.MemoryCgDataV2{},
+			Blkio:     &types.BlkIOCgDataV2{},
+			NetCls:    &types.NetClsCgData{},
+			PerfEvent: &types.PerfEventData{},
+			CpuSet:    &types.CPUSetCgDataV2{},
+			Cpu: &types.CPUCgDataV2{
+				OCRReadDRAMs: ocrReadDRAMs,
+				UpdateTime:   updateTime,
+			},
+		},
+	}
+}
+
+func TestMalachiteMetricsFetcher_containerStartupBaseline(t *testing.T) {
+	t.Parallel()
+
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+	f.metricConf.ContainerStartupBaselineGracePeriod = 30 * time.Second
+
+	startTime := time.Unix(10000, 0)
+	f.containerStartTime = map[string]map[string]time.Time{
+		"pod1": {"container1": startTime},
+	}
+
+	// the last sample is collected from the previous container instance
+	f.processContainerCPUData("pod1", "container1", newTestCgroupInfoV2(startTime.Unix()-60, 1<<20))
+
+	// the first sample arrives just after start, it should only be used as baseline
+	f.processContainerCPUData("pod1", "container1", newTestCgroupInfoV2(startTime.Unix()+2, 1<<30))
+	_, err := f.GetContainerMetric("pod1", "container1", consts.MetricMemBandwidthReadContainer)
+	assert.Error(t, err)
+
+	// the following sample should calculate rates based on the baseline
+	f.processContainerCPUData("pod1", "container1", newTestCgroupInfoV2(startTime.Unix()+7, 1<<30+5*(1<<20)))
+	data, err := f.GetContainerMetric("pod1", "container1", consts.MetricMemBandwidthReadContainer)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(64), data.Value)
+}
+
+func TestMalachiteMetricsFetcher_processContainerMemUtilization(t *testing.T) {
+	t.Parallel()
+
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+
+	tests := []struct {
+		name            string
+		cgStats         *types.MalachiteCgroupInfo
+		wantLimit       float64
+		wantUtilization float64
+	}{
+		{
+			name: "v1 limited",
+			cgStats: &types.MalachiteCgroupInfo{
+				CgroupType: "V1",
+				V1: &types.MalachiteCgroupV1Info{
+					Memory: &types.MemoryCgDataV1{MemoryLimitInBytes: 4 << 30, MemoryUsageInBytes: 1 << 30},
+				},
+			},
+			wantLimit:       4 << 30,
+			wantUtilization: 0.25,
+		},
+		{
+			name: "v1 unlimited",
+			cgStats: &types.MalachiteCgroupInfo{
+				CgroupType: "V1",
+				V1: &types.MalachiteCgroupV1Info{
+					Memory: &types.MemoryCgDataV1{MemoryLimitInBytes: 9223372036854771712, MemoryUsageInBytes: 1 << 30},
+				},
+			},
+			wantUtilization: 0,
+		},
+		{
+			name: "v2 limited",
+			cgStats: &types.MalachiteCgroupInfo{
+				CgroupType: "V2",
+				V2: &types.MalachiteCgroupV2Info{
+					Memory: &types.MemoryCgDataV2{Max: 2 << 30, MemoryUsageInBytes: 1 << 30},
+				},
+			},
+			wantLimit:       2 << 30,
+			wantUtilization: 0.5,
+		},
+		{
+			name: "v2 unlimited",
+			cgStats: &types.MalachiteCgroupInfo{
+				CgroupType: "V2",
+				V2: &types.MalachiteCgroupV2Info{
+					Memory: &types.MemoryCgDataV2{Max: math.MaxUint64, MemoryUsageInBytes: 1 << 30},
+				},
+			},
+			wantUtilization: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		f.processContainerMemoryData("pod1", tt.name, tt.cgStats)
+
+		// no limit is stored for unlimited cgroups
+		limit, err := f.GetContainerMetric("pod1", tt.name, consts.MetricMemLimitContainer)
+		if tt.wantLimit == 0 {
+			assert.Error(t, err, tt.name)
+		} else {
+			assert.NoError(t, err, tt.name)
+			assert.Equal(t, tt.wantLimit, limit.Value, tt.name)
+		}
+
+		utilization, err := f.GetContainerMetric("pod1", tt.name, consts.MetricMemUtilizationContainer)
+		assert.NoError(t, err, tt.name)
+		assert.Equal(t, tt.wantUtilization, utilization.Value, tt.name)
+	}
+}
+
+func TestMalachiteMetricsFetcher_processSystemCPUStealData(t *testing.T) {
+	t.Parallel()
+
+	// steal time is absent on bare metal
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+	f.processSystemCPUComputeData(&types.SystemComputeData{UpdateTime: 100})
+	f.processSystemCPUComputeData(&types.SystemComputeData{UpdateTime: 105})
+	_, err := f.GetNodeMetric(consts.MetricCPUStealNode)
+	assert.Error(t, err)
+	_, err = f.GetNodeMetric(consts.MetricCPUStealTimeNode)
+	assert.Error(t, err)
+
+	// steal time is reported on virtualized hosts
+	stealTime1, stealTime2 := uint64(10*time.Second), uint64(12*time.Second)
+	f.processSystemCPUComputeData(&types.SystemComputeData{UpdateTime: 110, GlobalCPU: types.CPU{CPUStealTime: &stealTime1}})
+	_, err = f.GetNodeMetric(consts.MetricCPUStealNode)
+	assert.Error(t, err)
+
+	f.processSystemCPUComputeData(&types.SystemComputeData{UpdateTime: 115, GlobalCPU: types.CPU{CPUStealTime: &stealTime2}})
+	data, err := f.GetNodeMetric(consts.MetricCPUStealNode)
+	assert.NoError(t, err)
+	assert.InDelta(t, 0.4, data.Value, 1e-9)
+}
+
+func TestMalachiteMetricsFetcher_processSystemSocketMemBandwidth(t *testing.T) {
+	t.Parallel()
+
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+
+	newSocket := func(id int, local, remote uint64) types.Socket {
+		return types.Socket{ID: id, LocalDRAMReads: &local, RemoteDRAMReads: &remote}
+	}
+
+	f.processSystemSocketMemBandwidth(&types.SystemMemoryData{
+		UpdateTime: 100,
+		Socket:     []types.Socket{newSocket(0, 0, 0), {ID: 1}},
+	})
+	_, err := f.GetSocketMetric(0, consts.MetricMemBandwidthLocalSocket)
+	assert.Error(t, err)
+
+	// 1MB equals to 16384 cache lines
+	f.processSystemSocketMemBandwidth(&types.SystemMemoryData{
+		UpdateTime: 110,
+		Socket:     []types.Socket{newSocket(0, 16384*100, 16384*20), {ID: 1}},
+	})
+
+	local, err := f.GetSocketMetric(0, consts.MetricMemBandwidthLocalSocket)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(10), local.Value)
+	remote, err := f.GetSocketMetric(0, consts.MetricMemBandwidthRemoteSocket)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(2), remote.Value)
+
+	// sockets without breakdown counters are skipped
+	_, err = f.GetSocketMetric(1, consts.MetricMemBandwidthLocalSocket)
+	assert.Error(t, err)
+	_, err = f.GetSocketMetric(1, consts.MetricMemLocalDRAMReadsSocket)
+	assert.Error(t, err)
+}
+
+func TestMalachiteMetricsFetcher_processSystemSocketEnergy(t *testing.T) {
+	t.Parallel()
+
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+
+	newSocket := func(id int, energy uint64) types.ComputeSocket {
+		return types.ComputeSocket{ID: id, EnergyUJ: &energy}
+	}
+
+	now := time.Now().Unix()
+	f.processSystemSocketEnergy(&types.SystemComputeData{
+		UpdateTime: now - 10,
+		Socket:     []types.ComputeSocket{newSocket(0, 1000), {ID: 1}},
+	})
+	_, err := f.GetSocketMetric(0, consts.MetricEnergyJoulesSocket)
+	assert.Error(t, err)
+
+	// 500 joules consumed in 10 seconds
+	f.processSystemSocketEnergy(&types.SystemComputeData{
+		UpdateTime: now,
+		Socket:     []types.ComputeSocket{newSocket(0, 1000+500*1e6), {ID: 1}},
+	})
+	power, err := f.GetSocketMetric(0, consts.MetricEnergyJoulesSocket)
+	assert.NoError(t, err)
+	assert.InDelta(t, 50, power.Value, 1e-9)
+
+	// sockets without RAPL are skipped
+	_, err = f.GetSocketMetric(1, consts.MetricEnergyJoulesSocket)
+	assert.Error(t, err)
+	_, err = f.GetSocketMetric(1, consts.MetricEnergyCounterSocket)
+	assert.Error(t, err)
+
+	// power of sockets is attributed to containers by cpu usage
+	updateTime := time.Now()
+	f.metricStore.SetContainerMetric("pod-1", "c1", consts.MetricCPUUsageContainer, utilmetric.MetricData{Value: 3, Time: &updateTime})
+	f.metricStore.SetContainerMetric("pod-1", "c2", consts.MetricCPUUsageContainer, utilmetric.MetricData{Value: 1, Time: &updateTime})
+	podsContainersStats := map[string]map[string]*types.MalachiteCgroupInfo{
+		"pod-1": {"c1": nil, "c2": nil, "c3": nil},
+	}
+	f.processContainerEnergy(podsContainersStats)
+
+	c1, err := f.GetContainerMetric("pod-1", "c1", consts.MetricEnergyJoulesContainer)
+	assert.NoError(t, err)
+	assert.InDelta(t, 37.5, c1.Value, 1e-9)
+	c2, err := f.GetContainerMetric("pod-1", "c2", consts.MetricEnergyJoulesContainer)
+	assert.NoError(t, err)
+	assert.InDelta(t, 12.5, c2.Value, 1e-9)
+	_, err = f.GetContainerMetric("pod-1", "c3", consts.MetricEnergyJoulesContainer)
+	assert.Error(t, err)
+
+	// hosts without RAPL don't have estimation for containers
+	f2 := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+	f2.processSystemSocketEnergy(&types.SystemComputeData{UpdateTime: now})
+	f2.metricStore.SetContainerMetric("pod-1", "c1", consts.MetricCPUUsageContainer, utilmetric.MetricData{Value: 3, Time: &updateTime})
+	f2.processContainerEnergy(podsContainersStats)
+	_, err = f2.GetContainerMetric("pod-1", "c1", consts.MetricEnergyJoulesContainer)
+	assert.Error(t, err)
+}
+
+func TestMalachiteMetricsFetcher_processSystemMemChannels(t *testing.T) {
+	t.Parallel()
+
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+	// 8 channels with 10MiB/s peak for each
+	f.metricConf.MemChannelCount = 8
+	f.metricConf.MemChannelPeakBandwidth = 10
+
+	newSocket := func(id int, local, remote uint64) types.Socket {
+		return types.Socket{ID: id, LocalDRAMReads: &local, RemoteDRAMReads: &remote}
+	}
+
+	f.processSystemSocketMemBandwidth(&types.SystemMemoryData{
+		UpdateTime: 100,
+		Socket:     []types.Socket{newSocket(0, 0, 0), newSocket(1, 0, 0)},
+	})
+	_, err := f.GetNodeMetric(consts.MetricMemChannelsUtilizedSystem)
+	assert.Error(t, err)
+	// full peak won't be reported as headroom if node bandwidth is unknown
+	_, err = f.GetNodeMetric(consts.MetricMemBandwidthHeadroomNode)
+	assert.Error(t, err)
+
+	// 25MiB/s in total for the node
+	f.processSystemSocketMemBandwidth(&types.SystemMemoryData{
+		UpdateTime: 110,
+		Socket:     []types.Socket{newSocket(0, 16384*100, 16384*20), newSocket(1, 16384*100, 16384*30)},
+	})
+	data, err := f.GetNodeMetric(consts.MetricMemChannelsUtilizedSystem)
+	assert.NoError(t, err)
+	assert.Equal(t, 2.5, data.Value)
+	data, err = f.GetNodeMetric(consts.MetricMemBandwidthHeadroomNode)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(55), data.Value)
+
+	// capped by the channel count, and headroom is clamped to zero
+	f.processSystemSocketMemBandwidth(&types.SystemMemoryData{
+		UpdateTime: 120,
+		Socket:     []types.Socket{newSocket(0, 16384*1100, 16384*20), newSocket(1, 16384*100, 16384*30)},
+	})
+	data, err = f.GetNodeMetric(consts.MetricMemChannelsUtilizedSystem)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(8), data.Value)
+	data, err = f.GetNodeMetric(consts.MetricMemBandwidthHeadroomNode)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(0), data.Value)
+}
+
+func TestMalachiteMetricsFetcher_scaleMemChannelPeakBandwidth(t *testing.T) {
+	t.Parallel()
+
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+	f.metricConf.MemChannelCount = 8
+	f.metricConf.MemChannelPeakBandwidth = 10
+	f.metricConf.MemChannelPeakBaseFrequency = 2000
+
+	newSocket := func(id int, local, remote uint64) types.Socket {
+		return types.Socket{ID: id, LocalDRAMReads: &local, RemoteDRAMReads: &remote}
+	}
+	newCPU := func(name string, frequency float64) types.CPU {
+		return types.CPU{Name: name, FrequencyMHz: &frequency}
+	}
+	f.processSystemSocketMemBandwidth(&types.SystemMemoryData{
+		UpdateTime: 100,
+		Socket:     []types.Socket{newSocket(0, 0, 0), newSocket(1, 0, 0)},
+	})
+
+	// the frequency is unknown, so the static peak is used for 20MiB/s in total
+	f.processSystemSocketMemBandwidth(&types.SystemMemoryData{
+		UpdateTime: 110,
+		Socket:     []types.Socket{newSocket(0, 16384*100, 0), newSocket(1, 16384*100, 0)},
+	})
+	data, err := f.GetNodeMetric(consts.MetricMemChannelsUtilizedSystem)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(2), data.Value)
+
+	// the same bandwidth saturates more channels at the reduced frequency
+	f.processSystemCPUFrequency(&types.SystemComputeData{
+		UpdateTime: 120,
+		CPU:        []types.CPU{newCPU("cpu0", 800), newCPU("cpu1", 1200), {Name: "cpu2"}},
+	})
+	data, err = f.GetNodeMetric(consts.MetricCPUFrequencyNode)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(1000), data.Value)
+	data, err = f.GetCPUMetric(1, consts.MetricCPUFrequencyCPU)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(1200), data.Value)
+
+	f.processSystemSocketMemBandwidth(&types.SystemMemoryData{
+		UpdateTime: 120,
+		Socket:     []types.Socket{newSocket(0, 16384*200, 0), newSocket(1, 16384*200, 0)},
+	})
+	data, err = f.GetNodeMetric(consts.MetricMemChannelsUtilizedSystem)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(4), data.Value)
+	data, err = f.GetNodeMetric(consts.MetricMemBandwidthHeadroomNode)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(20), data.Value)
+
+	// the utilization of container is against the reduced peak as well, i.e. 20MiB/s of 40MiB/s
+	f.metricConf.MemBandwidthPressureClassBands = []float64{0.3, 0.6}
+	updateTime := time.Unix(120, 0)
+	f.metricStore.SetContainerMetric("pod1", "c1", consts.MetricMemBandwidthReadContainer,
+		utilmetric.MetricData{Value: 15, Time: &updateTime})
+	f.metricStore.SetContainerMetric("pod1", "c1", consts.MetricMemBandwidthWriteContainer,
+		utilmetric.MetricData{Value: 5, Time: &updateTime})
+	f.processContainerMemBandwidthPressureClass("pod1", "c1", updateTime)
+	data, err = f.GetContainerMetric("pod1", "c1", consts.MetricMemBandwidthUtilizationContainer)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.5, data.Value)
+	data, err = f.GetContainerMetric("pod1", "c1", consts.MetricMemBandwidthPressureClassContainer)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(1), data.Value)
+}
+
+func TestMalachiteMetricsFetcher_calculateContainerMemBandwidthSampleWindow(t *testing.T) {
+	t.Parallel()
+
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+
+	// counters for the write bandwidth are sampled seconds apart
+	f.calculateContainerMemBandwidth("pod1", "mismatched", containerMemBandwidthCounters{
+		ocrReadDRAMs: counterSample{value: 16384 * 10, updateTime: 110},
+		imcWrites:    counterSample{value: 16384 * 10, updateTime: 110},
+		storeAllIns:  counterSample{value: 100, updateTime: 105},
+		storeIns:     counterSample{value: 100, updateTime: 110},
+	}, 100)
+
+	read, err := f.GetContainerMetric("pod1", "mismatched", consts.MetricMemBandwidthReadContainer)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(1), read.Value)
+	_, err = f.GetContainerMetric("pod1", "mismatched", consts.MetricMemBandwidthWriteContainer)
+	assert.Error(t, err)
+
+	// counters for the write bandwidth share the same window
+	f.calculateContainerMemBandwidth("pod1", "matched", containerMemBandwidthCounters{
+		ocrReadDRAMs: counterSample{value: 16384 * 10, updateTime: 110},
+		imcWrites:    counterSample{value: 16384 * 10, updateTime: 110},
+		storeAllIns:  counterSample{value: 100, updateTime: 110},
+		storeIns:     counterSample{value: 100, updateTime: 110},
+	}, 100)
+
+	write, err := f.GetContainerMetric("pod1", "matched", consts.MetricMemBandwidthWriteContainer)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(1), write.Value)
+}
+
+// TestMalachiteMetricsFetcher_writeBandwidthFormula pins the write bandwidth as the contract of the formula:
+//
+//	write bytes = (storeInsInc / storeAllInsInc) * imcWritesInc * 64 (bytes per cache line)
+//	write MiB/s = write bytes / (1024 * 1024) / interval in seconds
+//
+// i.e. the ratio of store instructions attributes IMC writes (counted in cache lines) to the container,
+// and the unit conversion is applied on bytes, after the cache line size is multiplied.
+func TestMalachiteMetricsFetcher_writeBandwidthFormula(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name                                   string
+		storeAllInsInc, storeInsInc, imcWrites uint64
+		want                                   float64
+	}{
+		{
+			// 163840 lines * 64 = 10MiB, and 10MiB / 10s = 1MiB/s
+			name:           "all stores attributed",
+			storeAllInsInc: 100, storeInsInc: 100, imcWrites: 16384 * 10,
+			want: 1,
+		},
+		{
+			// 0.5 * 10MiB / 10s
+			name:           "half stores attributed",
+			storeAllInsInc: 100, storeInsInc: 50, imcWrites: 16384 * 10,
+			want: 0.5,
+		},
+		{
+			// 2^40 lines * 64 = 2^46 bytes = 2^26 MiB, and 0.999999 * 2^26 / 10 = 6710879.6891136 MiB/s
+			name:           "large imc writes with ratio near 1",
+			storeAllInsInc: 1000000, storeInsInc: 999999, imcWrites: 1 << 40,
+			want: 6710879.6891136,
+		},
+		{
+			// the ratio is clamped to 1, i.e. 2^26 / 10 MiB/s
+			name:           "store ins exceeds all store ins",
+			storeAllInsInc: 100, storeInsInc: 101, imcWrites: 1 << 40,
+			want: 6710886.4,
+		},
+		{
+			name:           "no store instructions",
+			storeAllInsInc: 0, storeInsInc: 0, imcWrites: 1 << 40,
+			want: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+		last := containerMemBandwidthCounters{
+			imcWrites:   counterSample{value: 1000, updateTime: 100},
+			storeAllIns: counterSample{value: 1000, updateTime: 100},
+			storeIns:    counterSample{value: 1000, updateTime: 100},
+		}
+		f.setContainerMemBandwidthCounters("pod1", "c1", last)
+
+		f.calculateContainerMemBandwidth("pod1", "c1", containerMemBandwidthCounters{
+			imcWrites:   counterSample{value: 1000 + tt.imcWrites, updateTime: 110},
+			storeAllIns: counterSample{value: 1000 + tt.storeAllInsInc, updateTime: 110},
+			storeIns:    counterSample{value: 1000 + tt.storeInsInc, updateTime: 110},
+		}, 100)
+
+		data, err := f.GetContainerMetric("pod1", "c1", consts.MetricMemBandwidthWriteContainer)
+		assert.NoError(t, err, tt.name)
+		assert.InDelta(t, tt.want, data.Value, 1e-6, tt.name)
+	}
+}
+
+func TestMalachiteMetricsFetcher_memBandwidthUnit(t *testing.T) {
+	t.Parallel()
+
+	// 10GiB is read in 10 seconds
+	counters := containerMemBandwidthCounters{
+		ocrReadDRAMs: counterSample{value: 10 << 30 / 64, updateTime: 110},
+	}
+
+	tests := []struct {
+		unit     string
+		wantUnit string
+		want     float64
+	}{
+		{unit: "", wantUnit: "MiB/s", want: 1 << 10},
+		{unit: utilmetric.MemBandwidthUnitBytes, wantUnit: "bytes/s", want: 1 << 30},
+		{unit: utilmetric.MemBandwidthUnitKiB, wantUnit: "KiB/s", want: 1 << 20},
+		{unit: utilmetric.MemBandwidthUnitMiB, wantUnit: "MiB/s", want: 1 << 10},
+		{unit: utilmetric.MemBandwidthUnitGiB, wantUnit: "GiB/s", want: 1},
+		{unit: "unknown", wantUnit: "MiB/s", want: 1 << 10},
+	}
+
+	for _, tt := range tests {
+		conf := config.NewConfiguration()
+		conf.MemBandwidthUnit = tt.unit
+		f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, conf).(*MalachiteMetricsFetcher)
+
+		f.calculateContainerMemBandwidth("pod1", "c1", counters, 100)
+		data, err := f.GetContainerMetric("pod1", "c1", consts.MetricMemBandwidthReadContainer)
+		assert.NoError(t, err, tt.unit)
+		assert.Equal(t, tt.want, data.Value, tt.unit)
+
+		unit, err := f.GetMetricUnit(consts.MetricMemBandwidthReadContainer)
+		assert.NoError(t, err, tt.unit)
+		assert.Equal(t, tt.wantUnit, unit, tt.unit)
+	}
+}
+
+func TestMalachiteMetricsFetcher_checkMemBandwidthConsistency(t *testing.T) {
+	t.Parallel()
+
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+	now := time.Now()
+	stats := map[string]map[string]*types.MalachiteCgroupInfo{
+		"pod1": {"c1": nil, "c2": nil},
+		"pod2": {"c1": nil},
+	}
+
+	// no imc bandwidth is reported
+	_, ok := f.checkMemBandwidthConsistency(stats)
+	assert.False(t, ok)
+
+	// 3GiB/s is measured by imc, and 1.5GiB/s is estimated for all containers, while
+	// metrics for containers not in current cycle are ignored
+	f.metricStore.SetNumaMetric(0, consts.MetricMemBandwidthWriteNuma, utilmetric.MetricData{Value: 1, Time: &now})
+	f.metricStore.SetNumaMetric(1, consts.MetricMemBandwidthWriteNuma, utilmetric.MetricData{Value: 2, Time: &now})
+	f.metricStore.SetContainerMetric("pod1", "c1", consts.MetricMemBandwidthWriteContainer, utilmetric.MetricData{Value: 512, Time: &now})
+	f.metricStore.SetContainerMetric("pod1", "c2", consts.MetricMemBandwidthWriteContainer, utilmetric.MetricData{Value: 256, Time: &now})
+	f.metricStore.SetContainerMetric("pod2", "c1", consts.MetricMemBandwidthWriteContainer, utilmetric.MetricData{Value: 768, Time: &now})
+	f.metricStore.SetContainerMetric("pod3", "c1", consts.MetricMemBandwidthWriteContainer, utilmetric.MetricData{Value: 1024, Time: &now})
+
+	discrepancy, ok := f.checkMemBandwidthConsistency(stats)
+	assert.True(t, ok)
+	assert.Equal(t, 0.5, discrepancy)
+}
+
+func TestMalachiteMetricsFetcher_processContainerMBALimit(t *testing.T) {
+	t.Parallel()
+
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+
+	// RDT-MBA is not present
+	f.processContainerMemBandwidth("pod1", "c1", newTestCgroupInfoV2(100, 0), 0)
+	_, err := f.GetContainerMetric("pod1", "c1", consts.MetricMemBandwidthLimitContainer)
+	assert.Error(t, err)
+
+	// RDT-MBA throttle is configured
+	limit := uint64(60)
+	cgStats := newTestCgroupInfoV2(100, 0)
+	cgStats.V2.Cpu.MBALimit = &limit
+	f.processContainerMemBandwidth("pod1", "c2", cgStats, 0)
+	data, err := f.GetContainerMetric("pod1", "c2", consts.MetricMemBandwidthLimitContainer)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(60), data.Value)
+	assert.Equal(t, int64(100), data.Time.Unix())
+}
+
+func TestMalachiteMetricsFetcher_ResetContainerMetricBaseline(t *testing.T) {
+	t.Parallel()
+
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+	cycle := func(updateTime int64, ocrReadDRAMs uint64) {
+		f.processContainerCPUData("pod1", "c1", newTestCgroupInfoV2(updateTime, ocrReadDRAMs))
+	}
+
+	cycle(100, 0)
+	cycle(110, 16384*10)
+	data, err := f.GetContainerMetric("pod1", "c1", consts.MetricMemBandwidthReadContainer)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(1), data.Value)
+
+	f.ResetContainerMetricBaseline("pod1", "c1", consts.MetricMemBandwidthReadContainer)
+
+	// the reset is kept if malachite has not updated yet
+	cycle(110, 16384*10)
+	// the transition happens, and the sample is only used as baseline
+	cycle(120, 16384*1010)
+	data, err = f.GetContainerMetric("pod1", "c1", consts.MetricMemBandwidthReadContainer)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(1), data.Value)
+	assert.Equal(t, int64(110), data.Time.Unix())
+
+	cycle(130, 16384*1030)
+	data, err = f.GetContainerMetric("pod1", "c1", consts.MetricMemBandwidthReadContainer)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(2), data.Value)
+}
+
+func TestMalachiteMetricsFetcher_processContainerMemBandwidthIntensity(t *testing.T) {
+	t.Parallel()
+
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+	now := time.Now()
+	stale := now.Add(-time.Minute)
+
+	set := func(containerName string, read, write, workingSet float64, workingSetTime *time.Time) {
+		f.metricStore.SetContainerMetric("pod1", containerName, consts.MetricMemBandwidthReadContainer, utilmetric.MetricData{Value: read, Time: &now})
+		f.metricStore.SetContainerMetric("pod1", containerName, consts.MetricMemBandwidthWriteContainer, utilmetric.MetricData{Value: write, Time: &now})
+		f.metricStore.SetContainerMetric("pod1", containerName, consts.MetricMemWorkingSetContainer, utilmetric.MetricData{Value: workingSet, Time: workingSetTime})
+		f.processContainerMemBandwidthIntensity("pod1", containerName, now)
+	}
+
+	// 3MiB/s bandwidth with 1GiB working set
+	set("c1", 2, 1, 1<<30, &now)
+	data, err := f.GetContainerMetric("pod1", "c1", consts.MetricMemBandwidthIntensityContainer)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(3)/1024, data.Value)
+
+	// working set is zero
+	set("c2", 2, 1, 0, &now)
+	_, err = f.GetContainerMetric("pod1", "c2", consts.MetricMemBandwidthIntensityContainer)
+	assert.Error(t, err)
+
+	// working set is not fresh
+	set("c3", 2, 1, 1<<30, &stale)
+	_, err = f.GetContainerMetric("pod1", "c3", consts.MetricMemBandwidthIntensityContainer)
+	assert.Error(t, err)
+}
+
+func TestMalachiteMetricsFetcher_processContainerBandwidthPerInstruction(t *testing.T) {
+	t.Parallel()
+
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+
+	newStats := func(updateTime int64, ocrReadDRAMs, instructions uint64) *types.MalachiteCgroupInfo {
+		cgStats := newTestCgroupInfoV2(updateTime, ocrReadDRAMs)
+		cgStats.V2.Cpu.Cycles = instructions * 2
+		cgStats.V2.Cpu.Instructions = instructions
+		return cgStats
+	}
+
+	// memory-bound: 10MiB read with 1M instructions retired in 10 seconds
+	f.processContainerCPUData("pod1", "memory-bound", newStats(100, 1, 1))
+	f.processContainerCPUData("pod1", "memory-bound", newStats(110, 1+16384*10, 1+1<<20))
+	// compute-bound: 1MiB read with 1G instructions retired in 10 seconds
+	f.processContainerCPUData("pod1", "compute-bound", newStats(100, 1, 1))
+	f.processContainerCPUData("pod1", "compute-bound", newStats(110, 1+16384, 1+1<<30))
+
+	memoryBound, err := f.GetContainerMetric("pod1", "memory-bound", consts.MetricBandwidthPerInstructionContainer)
+	assert.NoError(t, err)
+	assert.InDelta(t, 10, memoryBound.Value, 1e-9)
+	computeBound, err := f.GetContainerMetric("pod1", "compute-bound", consts.MetricBandwidthPerInstructionContainer)
+	assert.NoError(t, err)
+	assert.InDelta(t, float64(1)/1024, computeBound.Value, 1e-9)
+
+	// skipped if no instruction is retired, and the last value is kept
+	f.processContainerCPUData("pod1", "memory-bound", newStats(120, 1+16384*20, 1+1<<20))
+	data, err := f.GetContainerMetric("pod1", "memory-bound", consts.MetricBandwidthPerInstructionContainer)
+	assert.NoError(t, err)
+	assert.True(t, data.Time.Equal(time.Unix(110, 0)))
+
+	// the bytes come from counter deltas even if the rate divisor is smoothed to 10 seconds rather than 12
+	f.metricConf.RateSmoothedInterval = 5 * time.Second
+	f.processContainerCPUData("pod1", "smoothed", newStats(100, 1, 1))
+	f.processContainerCPUData("pod1", "smoothed", newStats(112, 1+16384*10, 1+1<<20))
+	smoothed, err := f.GetContainerMetric("pod1", "smoothed", consts.MetricBandwidthPerInstructionContainer)
+	assert.NoError(t, err)
+	assert.InDelta(t, 10, smoothed.Value, 1e-9)
+}
+
+func TestMalachiteMetricsFetcher_countContainerRateSkip(t *testing.T) {
+	t.Parallel()
+
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+
+	// the counters of c1 are updated every cycle, while those of c2 are only updated every 3 cycles
+	for i := int64(0); i < 9; i++ {
+		assert.NoError(t, f.processContainerStats("pod1", "c1", newTestCgroupInfoV2(100+i*5, uint64(1+i*16384))))
+		c2UpdateTime := 100 + i/3*15
+		assert.NoError(t, f.processContainerStats("pod1", "c2", newTestCgroupInfoV2(c2UpdateTime, uint64(1+c2UpdateTime*16384))))
+	}
+
+	_, err := f.GetContainerMetric("pod1", "c1", consts.MetricRateSkipCountContainer)
+	assert.Error(t, err)
+	// each skipped sample is counted once, though it's skipped by several rate metrics
+	data, err := f.GetContainerMetric("pod1", "c2", consts.MetricRateSkipCountContainer)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(6), data.Value)
+}
+
+func TestMalachiteMetricsFetcher_processContainerMemWorkingSet(t *testing.T) {
+	t.Parallel()
+
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+	cgStats := newTestCgroupInfoV2(100, 0)
+	cgStats.V2.Memory.MemoryUsageInBytes = 100 << 20
+	cgStats.V2.Memory.MemStats.InactiveFile = 30 << 20
+
+	f.processContainerMemoryData("pod1", "c1", cgStats)
+	data, err := f.GetContainerMetric("pod1", "c1", consts.MetricMemWorkingSetContainer)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(70<<20), data.Value)
+}
+
+func TestMalachiteMetricsFetcher_negativeRateClamp(t *testing.T) {
+	t.Parallel()
+
+	emitter := newCountingEmitter()
+	f := NewMalachiteMetricsFetcher(emitter, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+
+	f.startDerivedOutcomeCycle()
+	f.setContainerRateMetric("pod1", "c1", consts.MetricMemBandwidthReadContainer, func() float64 { return -10 }, 100, 105)
+	f.setContainerRateMetric("pod1", "c2", consts.MetricMemBandwidthReadContainer, func() float64 { return 10 }, 100, 105)
+	f.finishDerivedOutcomeCycle()
+
+	data, err := f.GetContainerMetric("pod1", "c1", consts.MetricMemBandwidthReadContainer)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(0), data.Value)
+	data, err = f.GetContainerMetric("pod1", "c2", consts.MetricMemBandwidthReadContainer)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(2), data.Value)
+
+	assert.Equal(t, int64(1), emitter.count(metricsNameMalachiteNegativeRateClamped))
+	assert.Equal(t, map[DerivedMetricOutcome]int{DerivedMetricOutcomeClamped: 1, DerivedMetricOutcomeSucceeded: 1},
+		f.GetDerivedMetricOutcomes()[consts.MetricMemBandwidthReadContainer])
+}
+
+func TestMalachiteMetricsFetcher_storeRatioClamp(t *testing.T) {
+	t.Parallel()
+
+	emitter := newCountingEmitter()
+	f := NewMalachiteMetricsFetcher(emitter, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+
+	// store ins increases more than all store ins by a glitch
+	f.calculateContainerMemBandwidth("pod1", "c1", containerMemBandwidthCounters{
+		imcWrites:   counterSample{value: 16384 * 10, updateTime: 110},
+		storeAllIns: counterSample{value: 100, updateTime: 110},
+		storeIns:    counterSample{value: 300, updateTime: 110},
+	}, 100)
+
+	data, err := f.GetContainerMetric("pod1", "c1", consts.MetricMemBandwidthWriteContainer)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(1), data.Value)
+	assert.Equal(t, int64(1), emitter.count(metricsNameMalachiteStoreRatioClamped))
+
+	// the ratio is in range
+	f.calculateContainerMemBandwidth("pod1", "c2", containerMemBandwidthCounters{
+		imcWrites:   counterSample{value: 16384 * 10, updateTime: 110},
+		storeAllIns: counterSample{value: 100, updateTime: 110},
+		storeIns:    counterSample{value: 50, updateTime: 110},
+	}, 100)
+
+	data, err = f.GetContainerMetric("pod1", "c2", consts.MetricMemBandwidthWriteContainer)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.5, data.Value)
+	assert.Equal(t, int64(1), emitter.count(metricsNameMalachiteStoreRatioClamped))
+}
+
+func TestMalachiteMetricsFetcher_processContainerPerNumaMemBandwidth(t *testing.T) {
+	t.Parallel()
+
+	newCgStats := func(updateTime int64, ocrReadDRAMs uint64, numaOCRReadDRAMs map[string]uint64) *types.MalachiteCgroupInfo {
+		cgStats := newTestCgroupInfoV2(updateTime, ocrReadDRAMs)
+		cgStats.V2.CpuSet.Mems.Inner = []int{0, 1}
+		cgStats.V2.Cpu.NumaOCRReadDRAMs = numaOCRReadDRAMs
+		return cgStats
+	}
+
+	tests := []struct {
+		name        string
+		attribution string
+		first       map[string]uint64
+		second      map[string]uint64
+		want        map[string]float64
+	}{
+		{
+			name:        "cpu binding",
+			attribution: globalconfig.MemBandwidthNumaAttributionCPUBinding,
+			first:       map[string]uint64{"N0": 100, "N1": 100},
+			second:      map[string]uint64{"N0": 400, "N1": 200},
+			want:        map[string]float64{"0": 0.5, "1": 0.5},
+		},
+		{
+			name:        "access counter",
+			attribution: globalconfig.MemBandwidthNumaAttributionAccessCounter,
+			first:       map[string]uint64{"N0": 100, "N1": 100},
+			second:      map[string]uint64{"N0": 400, "N1": 200},
+			want:        map[string]float64{"0": 0.75, "1": 0.25},
+		},
+		{
+			name:        "access counter falls back to cpu binding",
+			attribution: globalconfig.MemBandwidthNumaAttributionAccessCounter,
+			want:        map[string]float64{"0": 0.5, "1": 0.5},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+			f.metricConf.MemBandwidthNumaAttribution = tt.attribution
+
+			// read bandwidth is 1MiB/s in total
+			f.processContainerCPUData("pod1", "c1", newCgStats(100, 0, tt.first))
+			f.processContainerCPUData("pod1", "c1", newCgStats(110, 16384*10, tt.second))
+
+			for numaID, want := range tt.want {
+				data, err := f.metricStore.GetContainerNumaMetric("pod1", "c1", numaID, consts.MetricsMemBandwidthReadPerNumaContainer)
+				assert.NoError(t, err)
+				assert.Equal(t, want, data.Value)
+			}
+		})
+	}
+}
+
+func TestMalachiteMetricsFetcher_processContainerMemBandwidthWeightedCost(t *testing.T) {
+	t.Parallel()
+
+	machineInfo := &machine.KatalystMachineInfo{
+		CPUTopology: &machine.CPUTopology{
+			CPUDetails: machine.CPUDetails{
+				0: {NUMANodeID: 0},
+				1: {NUMANodeID: 0},
+				2: {NUMANodeID: 1},
+				3: {NUMANodeID: 1},
+			},
+		},
+		ExtraTopologyInfo: &machine.ExtraTopologyInfo{
+			NumaDistanceMap: map[int]map[int]int{
+				0: {0: 10, 1: 20},
+				1: {0: 20, 1: 10},
+			},
+		},
+	}
+	newCgStats := func(updateTime int64, ocrReadDRAMs uint64, cpus []int, numaOCRReadDRAMs map[string]uint64) *types.MalachiteCgroupInfo {
+		cgStats := newTestCgroupInfoV2(updateTime, ocrReadDRAMs)
+		cgStats.V2.CpuSet.Mems.Inner = []int{0, 1}
+		cgStats.V2.CpuSet.Cpus.Inner = cpus
+		cgStats.V2.Cpu.NumaOCRReadDRAMs = numaOCRReadDRAMs
+		return cgStats
+	}
+
+	tests := []struct {
+		name        string
+		machineInfo *machine.KatalystMachineInfo
+		cpus        []int
+		first       map[string]uint64
+		second      map[string]uint64
+		want        float64
+		wantErr     bool
+	}{
+		{
+			name:        "cpus on numa 0",
+			machineInfo: machineInfo,
+			cpus:        []int{0, 1},
+			first:       map[string]uint64{"N0": 100, "N1": 100},
+			second:      map[string]uint64{"N0": 400, "N1": 200},
+			want:        1.25,
+		},
+		{
+			name:        "cpus on both numa nodes",
+			machineInfo: machineInfo,
+			cpus:        []int{1, 2},
+			first:       map[string]uint64{"N0": 100, "N1": 100},
+			second:      map[string]uint64{"N0": 400, "N1": 200},
+			want:        1.5,
+		},
+		{
+			name:    "distances are unknown",
+			cpus:    []int{0, 1},
+			first:   map[string]uint64{"N0": 100, "N1": 100},
+			second:  map[string]uint64{"N0": 400, "N1": 200},
+			wantErr: true,
+		},
+		{
+			name:        "per-numa accesses are not reported",
+			machineInfo: machineInfo,
+			cpus:        []int{0, 1},
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+			f.SetMachineInfo(tt.machineInfo)
+
+			// read bandwidth is 1MiB/s in total
+			f.processContainerCPUData("pod1", "c1", newCgStats(100, 0, tt.cpus, tt.first))
+			f.processContainerCPUData("pod1", "c1", newCgStats(110, 16384*10, tt.cpus, tt.second))
+
+			data, err := f.GetContainerMetric("pod1", "c1", consts.MetricMemBandwidthWeightedCostContainer)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.InDelta(t, tt.want, data.Value, 1e-9)
+		})
+	}
+}
+
+func TestMalachiteMetricsFetcher_processContainerMemRemoteReadRatio(t *testing.T) {
+	t.Parallel()
+
+	machineInfo := &machine.KatalystMachineInfo{
+		CPUTopology: &machine.CPUTopology{
+			CPUDetails: machine.CPUDetails{
+				0: {NUMANodeID: 0},
+				1: {NUMANodeID: 1},
+				2: {NUMANodeID: 2},
+			},
+		},
+	}
+	newCgStats := func(updateTime int64, ocrReadDRAMs uint64, cpus []int, numaOCRReadDRAMs map[string]uint64) *types.MalachiteCgroupInfo {
+		cgStats := newTestCgroupInfoV2(updateTime, ocrReadDRAMs)
+		cgStats.V2.CpuSet.Mems.Inner = []int{0, 1, 2}
+		cgStats.V2.CpuSet.Cpus.Inner = cpus
+		cgStats.V2.Cpu.NumaOCRReadDRAMs = numaOCRReadDRAMs
+		return cgStats
+	}
+
+	tests := []struct {
+		name         string
+		machineInfo  *machine.KatalystMachineInfo
+		cpus         []int
+		ocrReadDRAMs uint64
+		want         float64
+		wantErr      bool
+	}{
+		{name: "cpus on numa 0", machineInfo: machineInfo, cpus: []int{0}, ocrReadDRAMs: 16384 * 10, want: 0.75},
+		{name: "cpus on numa 0 and 1", machineInfo: machineInfo, cpus: []int{0, 1}, ocrReadDRAMs: 16384 * 10, want: 0.25},
+		{name: "cpus on numa 0, 1 and 2", machineInfo: machineInfo, cpus: []int{0, 1, 2}, ocrReadDRAMs: 16384 * 10, want: 0},
+		{name: "cpu topology is unknown", cpus: []int{0}, ocrReadDRAMs: 16384 * 10, wantErr: true},
+		{name: "no bandwidth", machineInfo: machineInfo, cpus: []int{0}, wantErr: true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+			f.SetMachineInfo(tt.machineInfo)
+
+			// a quarter of reads are from numa 0, a half from numa 1 and the rest from numa 2
+			f.processContainerCPUData("pod1", "c1", newCgStats(100, 0, tt.cpus, map[string]uint64{"N0": 0, "N1": 0, "N2": 0}))
+			f.processContainerCPUData("pod1", "c1", newCgStats(110, tt.ocrReadDRAMs, tt.cpus, map[string]uint64{"N0": 100, "N1": 200, "N2": 100}))
+
+			data, err := f.GetContainerMetric("pod1", "c1", consts.MetricMemRemoteReadRatioContainer)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.InDelta(t, tt.want, data.Value, 1e-9)
+		})
+	}
+}
+
+func TestMalachiteMetricsFetcher_processContainerPageWalk(t *testing.T) {
+	t.Parallel()
+
+	newCgStats := func(updateTime int64, cycles uint64, dtlb, itlb *uint64) *types.MalachiteCgroupInfo {
+		cgStats := newTestCgroupInfoV2(updateTime, 0)
+		cgStats.V2.Cpu.Cycles = cycles
+		cgStats.V2.Cpu.DTLBWalkCycles = dtlb
+		cgStats.V2.Cpu.ITLBWalkCycles = itlb
+		return cgStats
+	}
+	uint64Ptr := func(v uint64) *uint64 { return &v }
+
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+
+	// counters present
+	f.processContainerCPUData("pod1", "c1", newCgStats(100, 1000, uint64Ptr(100), uint64Ptr(0)))
+	f.processContainerCPUData("pod1", "c1", newCgStats(110, 2000, uint64Ptr(150), uint64Ptr(50)))
+
+	data, err := f.GetContainerMetric("pod1", "c1", consts.MetricPageWalkCyclesContainer)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(10), data.Value)
+	data, err = f.GetContainerMetric("pod1", "c1", consts.MetricPageWalkRatioContainer)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.1, data.Value)
+
+	// cycles not increased
+	f.processContainerCPUData("pod1", "c1", newCgStats(120, 2000, uint64Ptr(250), uint64Ptr(50)))
+	data, err = f.GetContainerMetric("pod1", "c1", consts.MetricPageWalkRatioContainer)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.1, data.Value)
+
+	// counters absent
+	f.processContainerCPUData("pod1", "c2", newCgStats(100, 1000, nil, nil))
+	f.processContainerCPUData("pod1", "c2", newCgStats(110, 2000, nil, nil))
+
+	_, err = f.GetContainerMetric("pod1", "c2", consts.MetricPageWalkCyclesContainer)
+	assert.Error(t, err)
+	_, err = f.GetContainerMetric("pod1", "c2", consts.MetricPageWalkRatioContainer)
+	assert.Error(t, err)
+}
+
+func TestMalachiteMetricsFetcher_processContainerCPUContention(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		psiAvg10    float64
+		nrThrottled uint64
+		want        float64
+	}{
+		{name: "psi high and throttle high", psiAvg10: 20, nrThrottled: 50, want: 1},
+		{name: "psi high and throttle low", psiAvg10: 20, nrThrottled: 5, want: 0},
+		{name: "psi low and throttle high", psiAvg10: 5, nrThrottled: 50, want: 0},
+		{name: "psi low and throttle low", psiAvg10: 5, nrThrottled: 5, want: 0},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+			f.metricConf.CPUContentionPSIThreshold = 10
+			f.metricConf.CPUContentionThrottleRatioThreshold = 0.1
+
+			f.processContainerCPUData("pod1", "c1", newTestCgroupInfoV2(100, 0))
+
+			cgStats := newTestCgroupInfoV2(110, 0)
+			cgStats.V2.Cpu.CPUPressure.Some.Avg10 = tt.psiAvg10
+			cgStats.V2.Cpu.CPUStats.NrThrottled = tt.nrThrottled
+			cgStats.V2.Cpu.CPUStats.NrPeriods = 100
+			f.processContainerCPUData("pod1", "c1", cgStats)
+
+			data, err := f.GetContainerMetric("pod1", "c1", consts.MetricCPUContentionContainer)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, data.Value)
+		})
+	}
+}
+
+func TestMalachiteMetricsFetcher_calculateRateMetricSmoothedInterval(t *testing.T) {
+	t.Parallel()
+
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+
+	// a steady workload with 100 per 5s, while update times jitter around the nominal interval
+	updateTimes := []int64{100, 104, 110, 114, 120}
+	rates := func() []float64 {
+		var res []float64
+		for i := 1; i < len(updateTimes); i++ {
+			data, ok := f.calculateRateMetric(func() float64 { return 100 }, updateTimes[i-1], updateTimes[i])
+			assert.True(t, ok)
+			res = append(res, data.Value)
+		}
+		return res
+	}
+	assert.Equal(t, []float64{25, 100. / 6, 25, 100. / 6}, rates())
+
+	f.metricConf.RateSmoothedInterval = 5 * time.Second
+	assert.Equal(t, []float64{20, 20, 20, 20}, rates())
+
+	// skipped cycles are not hidden
+	data, ok := f.calculateRateMetric(func() float64 { return 200 }, 100, 109)
+	assert.True(t, ok)
+	assert.Equal(t, float64(20), data.Value)
+}
+
+func TestMalachiteMetricsFetcher_processContainerMemBandwidthAnomaly(t *testing.T) {
+	t.Parallel()
+
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+	f.metricConf.MemBandwidthAnomalyBaselineCycles = 4
+
+	now := time.Now()
+	setBandwidth := func(i int, read, write float64) time.Time {
+		sampleTime := now.Add(time.Duration(i-10) * time.Second)
+		f.metricStore.SetContainerMetric("pod1", "container1", consts.MetricMemBandwidthReadContainer,
+			utilmetric.MetricData{Value: read, Time: &sampleTime})
+		f.metricStore.SetContainerMetric("pod1", "container1", consts.MetricMemBandwidthWriteContainer,
+			utilmetric.MetricData{Value: write, Time: &sampleTime})
+		return sampleTime
+	}
+
+	// no score until the baseline is full
+	for i, read := range []float64{90, 110, 100, 100} {
+		setBandwidth(i, read, 0)
+		f.processContainerMemBandwidthAnomaly("pod1", "container1", now)
+		_, err := f.GetContainerMetric("pod1", "container1", consts.MetricMemBandwidthAnomalyContainer)
+		assert.Error(t, err)
+	}
+
+	// unchanged sample won't be recorded into the baseline twice
+	f.processContainerMemBandwidthAnomaly("pod1", "container1", now)
+	assert.Len(t, f.memBandwidthBaselines["pod1"]["container1"].samples, 4)
+
+	setBandwidth(4, 200, 50)
+	f.processContainerMemBandwidthAnomaly("pod1", "container1", now)
+	data, err := f.GetContainerMetric("pod1", "container1", consts.MetricMemBandwidthAnomalyContainer)
+	assert.NoError(t, err)
+	assert.Equal(t, 2.5, data.Value)
+
+	f.gcMemBandwidthBaselines(map[string]bool{})
+	assert.Empty(t, f.memBandwidthBaselines)
+}
+
+func TestMalachiteMetricsFetcher_processContainerCPUWeight(t *testing.T) {
+	t.Parallel()
+
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+
+	newV1 := func(shares uint64) *types.MalachiteCgroupInfo {
+		return &types.MalachiteCgroupInfo{
+			CgroupType: "V1",
+			V1:         &types.MalachiteCgroupV1Info{Cpu: &types.CPUCgDataV1{CPUShares: shares, UpdateTime: 100}},
+		}
+	}
+	newV2 := func(weight int) *types.MalachiteCgroupInfo {
+		return &types.MalachiteCgroupInfo{
+			CgroupType: "V2",
+			V2:         &types.MalachiteCgroupV2Info{Cpu: &types.CPUCgDataV2{Weight: weight, UpdateTime: 100}},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		cgStats *types.MalachiteCgroupInfo
+		want    float64
+	}{
+		{name: "v1 default", cgStats: newV1(1024), want: 39},
+		{name: "v2 default", cgStats: newV2(39), want: 39},
+		{name: "v1 min", cgStats: newV1(2), want: 1},
+		{name: "v2 min", cgStats: newV2(1), want: 1},
+		{name: "v1 max", cgStats: newV1(262144), want: 10000},
+		{name: "v2 max", cgStats: newV2(10000), want: 10000},
+	}
+	for _, tt := range tests {
+		f.processContainerCPUWeight("pod1", tt.name, tt.cgStats)
+		data, err := f.GetContainerMetric("pod1", tt.name, consts.MetricCPUWeightContainer)
+		assert.NoError(t, err, tt.name)
+		assert.Equal(t, tt.want, data.Value, tt.name)
+	}
+
+	// weight is not reported
+	f.processContainerCPUWeight("pod1", "absent", newV2(0))
+	_, err := f.GetContainerMetric("pod1", "absent", consts.MetricCPUWeightContainer)
+	assert.Error(t, err)
+}
+
+func TestMalachiteMetricsFetcher_rateIntervalJitter(t *testing.T) {
+	t.Parallel()
+
+	feed := func(f *MalachiteMetricsFetcher, updateTimes []int64) {
+		for i := 1; i < len(updateTimes); i++ {
+			f.calculateRateMetric(func() float64 { return 1 }, updateTimes[i-1], updateTimes[i])
+		}
+	}
+
+	regular := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+	_, ok := regular.rateIntervals.jitter()
+	assert.False(t, ok)
+	feed(regular, []int64{100, 105, 110, 115, 120})
+	regularJitter, ok := regular.rateIntervals.jitter()
+	assert.True(t, ok)
+	assert.Equal(t, float64(0), regularJitter)
+
+	irregular := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+	feed(irregular, []int64{100, 103, 110, 114, 120})
+	irregularJitter, ok := irregular.rateIntervals.jitter()
+	assert.True(t, ok)
+	assert.InDelta(t, 0.3162, irregularJitter, 1e-4)
+
+	// only the latest intervals are kept in the window
+	for i := 0; i < rateIntervalJitterWindow; i++ {
+		irregular.rateIntervals.add(5)
+	}
+	irregularJitter, _ = irregular.rateIntervals.jitter()
+	assert.Equal(t, float64(0), irregularJitter)
+}
+
+func TestMalachiteMetricsFetcher_rateWarmUp(t *testing.T) {
+	t.Parallel()
+
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+	f.metricConf.RateWarmUpPeriod = time.Hour
+
+	// rates are withheld during warm-up, while gauges and raw counters are published
+	f.processContainerCPUData("pod1", "container1", newTestCgroupInfoV2(100, 1<<20))
+	f.processContainerCPUData("pod1", "container1", newTestCgroupInfoV2(105, 1<<20+16384))
+	_, err := f.GetContainerMetric("pod1", "container1", consts.MetricMemBandwidthReadContainer)
+	assert.Error(t, err)
+	_, err = f.GetContainerMetric("pod1", "container1", consts.MetricCPUUsageContainer)
+	assert.NoError(t, err)
+	data, err := f.GetContainerMetric("pod1", "container1", consts.MetricOCRReadDRAMsContainer)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(1<<20+16384), data.Value)
+
+	// rates are published based on the baselines established during warm-up
+	f.startTime = f.startTime.Add(-2 * time.Hour)
+	f.processContainerCPUData("pod1", "container1", newTestCgroupInfoV2(110, 1<<20+2*16384))
+	data, err = f.GetContainerMetric("pod1", "container1", consts.MetricMemBandwidthReadContainer)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.2, data.Value)
+}
+
+func TestMalachiteMetricsFetcher_processContainerOOMKills(t *testing.T) {
+	t.Parallel()
+
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+
+	newV1 := func(updateTime int64, oomCnt int) *types.MalachiteCgroupInfo {
+		return &types.MalachiteCgroupInfo{
+			CgroupType: "V1",
+			V1:         &types.MalachiteCgroupV1Info{Memory: &types.MemoryCgDataV1{OomCnt: oomCnt, UpdateTime: updateTime}},
+		}
+	}
+	newV2 := func(updateTime int64, oomCnt uint64) *types.MalachiteCgroupInfo {
+		return &types.MalachiteCgroupInfo{
+			CgroupType: "V2",
+			V2:         &types.MalachiteCgroupV2Info{Memory: &types.MemoryCgDataV2{OomCnt: oomCnt, UpdateTime: updateTime}},
+		}
+	}
+
+	f.processContainerMemoryData("pod1", "v1", newV1(100, 1))
+	f.processContainerMemoryData("pod1", "v2", newV2(100, 0))
+	data, err := f.GetContainerMetric("pod1", "v1", consts.MetricMemOomContainer)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(1), data.Value)
+	_, err = f.GetContainerMetric("pod1", "v1", consts.MetricOOMKillRateContainer)
+	assert.Error(t, err)
+
+	// the rate is calculated against the count of the last sample
+	f.processContainerMemoryData("pod1", "v1", newV1(110, 3))
+	f.processContainerMemoryData("pod1", "v2", newV2(105, 5))
+	for _, tt := range []struct {
+		containerName string
+		metricName    string
+		want          float64
+	}{
+		{containerName: "v1", metricName: consts.MetricMemOomContainer, want: 3},
+		{containerName: "v1", metricName: consts.MetricOOMKillRateContainer, want: 0.2},
+		{containerName: "v2", metricName: consts.MetricMemOomContainer, want: 5},
+		{containerName: "v2", metricName: consts.MetricOOMKillRateContainer, want: 1},
+	} {
+		data, err := f.GetContainerMetric("pod1", tt.containerName, tt.metricName)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.want, data.Value, tt.containerName+"/"+tt.metricName)
+	}
+}
+
+func TestMalachiteMetricsFetcher_processContainerSwap(t *testing.T) {
+	t.Parallel()
+
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+
+	value := func(v uint64) *uint64 { return &v }
+	newV1 := func(updateTime int64, swap *uint64) *types.MalachiteCgroupInfo {
+		return &types.MalachiteCgroupInfo{
+			CgroupType: "V1",
+			V1:         &types.MalachiteCgroupV1Info{Memory: &types.MemoryCgDataV1{TotalSwap: swap, UpdateTime: updateTime}},
+		}
+	}
+	newV2 := func(updateTime int64, swap, pswpin, pswpout *uint64) *types.MalachiteCgroupInfo {
+		return &types.MalachiteCgroupInfo{
+			CgroupType: "V2",
+			V2: &types.MalachiteCgroupV2Info{Memory: &types.MemoryCgDataV2{
+				SwapCurrent: swap,
+				MemStats:    types.MemStats{Pswpin: pswpin, Pswpout: pswpout},
+				UpdateTime:  updateTime,
+			}},
+		}
+	}
+
+	f.processContainerSwap("pod1", "v1", newV1(100, value(1024)))
+	f.processContainerSwap("pod1", "v2", newV2(100, value(2048), value(10), value(20)))
+	_, err := f.GetContainerMetric("pod1", "v2", consts.MetricSwapInRateContainer)
+	assert.Error(t, err)
+
+	f.processContainerSwap("pod1", "v1", newV1(110, value(4096)))
+	f.processContainerSwap("pod1", "v2", newV2(110, value(8192), value(30), value(70)))
+	for _, tt := range []struct {
+		containerName string
+		metricName    string
+		want          float64
+	}{
+		{containerName: "v1", metricName: consts.MetricSwapUsageContainer, want: 4096},
+		{containerName: "v2", metricName: consts.MetricSwapUsageContainer, want: 8192},
+		{containerName: "v2", metricName: consts.MetricSwapInRateContainer, want: 2},
+		{containerName: "v2", metricName: consts.MetricSwapOutRateContainer, want: 5},
+	} {
+		data, err := f.GetContainerMetric("pod1", tt.containerName, tt.metricName)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.want, data.Value, tt.containerName+"/"+tt.metricName)
+	}
+
+	// swap-in and swap-out counters are not available in cgroup v1
+	_, err = f.GetContainerMetric("pod1", "v1", consts.MetricSwapInRateContainer)
+	assert.Error(t, err)
+
+	// swap accounting is disabled
+	f.processContainerSwap("pod1", "disabled-v1", newV1(100, nil))
+	f.processContainerSwap("pod1", "disabled-v2", newV2(100, nil, value(10), value(20)))
+	for _, containerName := range []string{"disabled-v1", "disabled-v2"} {
+		_, err = f.GetContainerMetric("pod1", containerName, consts.MetricSwapUsageContainer)
+		assert.Error(t, err)
+		_, err = f.GetContainerMetric("pod1", containerName, consts.MetricSwapInCountContainer)
+		assert.Error(t, err)
+	}
+}
+
+func TestMalachiteMetricsFetcher_processContainerPageFaults(t *testing.T) {
+	t.Parallel()
+
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+
+	newV1 := func(updateTime int64, pgfault, pgmajfault uint64) *types.MalachiteCgroupInfo {
+		return &types.MalachiteCgroupInfo{
+			CgroupType: "V1",
+			V1: &types.MalachiteCgroupV1Info{Memory: &types.MemoryCgDataV1{
+				TotalPgfault: pgfault, TotalPgmajfault: pgmajfault, UpdateTime: updateTime,
+			}},
+		}
+	}
+	newV2 := func(updateTime int64, pgfault, pgmajfault uint64) *types.MalachiteCgroupInfo {
+		return &types.MalachiteCgroupInfo{
+			CgroupType: "V2",
+			V2: &types.MalachiteCgroupV2Info{Memory: &types.MemoryCgDataV2{
+				MemStats: types.MemStats{Pgfault: pgfault, Pgmajfault: pgmajfault}, UpdateTime: updateTime,
+			}},
+		}
+	}
+
+	f.processContainerMemoryData("pod1", "v1", newV1(100, 1000, 10))
+	f.processContainerMemoryData("pod1", "v2", newV2(100, 1000, 10))
+	_, err := f.GetContainerMetric("pod1", "v1", consts.MetricPageFaultRateContainer)
+	assert.Error(t, err)
+
+	f.processContainerMemoryData("pod1", "v1", newV1(110, 2000, 60))
+	f.processContainerMemoryData("pod1", "v2", newV2(105, 1500, 20))
+	for _, tt := range []struct {
+		containerName string
+		metricName    string
+		want          float64
+	}{
+		{containerName: "v1", metricName: consts.MetricPageFaultRateContainer, want: 100},
+		{containerName: "v1", metricName: consts.MetricMajorPageFaultRateContainer, want: 5},
+		{containerName: "v2", metricName: consts.MetricPageFaultRateContainer, want: 100},
+		{containerName: "v2", metricName: consts.MetricMajorPageFaultRateContainer, want: 2},
+	} {
+		data, err := f.GetContainerMetric("pod1", tt.containerName, tt.metricName)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.want, data.Value, tt.containerName+"/"+tt.metricName)
+	}
+
+	// memory stats are absent
+	f.processContainerPageFaults("pod1", "absent", &types.MalachiteCgroupInfo{CgroupType: "V2", V2: &types.MalachiteCgroupV2Info{}})
+	_, err = f.GetContainerMetric("pod1", "absent", consts.MetricPageFaultRateContainer)
+	assert.Error(t, err)
+}
+
+func TestMalachiteMetricsFetcher_processContainerCPUThrottleToUsageRatio(t *testing.T) {
+	t.Parallel()
+
+	newV1 := func(updateTime int64, throttledTime uint64, usage float64) *types.MalachiteCgroupInfo {
+		return &types.MalachiteCgroupInfo{
+			CgroupType: "V1",
+			V1: &types.MalachiteCgroupV1Info{Cpu: &types.CPUCgDataV1{
+				CPUThrottledTime: throttledTime, CPUUsageRatio: usage, UpdateTime: updateTime,
+			}},
+		}
+	}
+
+	tests := []struct {
+		name          string
+		throttledTime uint64
+		usage         float64
+		want          float64
+		wantErr       bool
+	}{
+		{name: "no throttle", throttledTime: 0, usage: 2, want: 0},
+		{name: "throttle equals usage", throttledTime: 20 * uint64(time.Second), usage: 2, want: 0.5},
+		{name: "throttle dominates", throttledTime: 30 * uint64(time.Second), usage: 1, want: 0.75},
+		{name: "throttle without usage", throttledTime: 10 * uint64(time.Second), usage: 0, want: 1},
+		{name: "zero denominator", throttledTime: 0, usage: 0, wantErr: true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+			lastTime := time.Unix(100, 0)
+			f.metricStore.SetContainerMetric("pod1", "c1", consts.MetricCPUThrottledTimeContainer,
+				utilmetric.MetricData{Value: float64(time.Second), Time: &lastTime})
+
+			f.processContainerCPUThrottleToUsageRatio("pod1", "c1", newV1(110, uint64(time.Second)+tt.throttledTime, tt.usage))
+
+			data, err := f.GetContainerMetric("pod1", "c1", consts.MetricCPUThrottleToUsageRatioContainer)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.InDelta(t, tt.want, data.Value, 1e-9)
+		})
+	}
+}
+
+func TestMalachiteMetricsFetcher_processContainerCounterStaleness(t *testing.T) {
+	t.Parallel()
+
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+
+	for _, tt := range []struct {
+		updateTime   int64
+		ocrReadDRAMs uint64
+		want         float64
+	}{
+		{updateTime: 100, ocrReadDRAMs: 10, want: 0},
+		{updateTime: 110, ocrReadDRAMs: 20, want: 0},
+		// update time advances but counters stay flat
+		{updateTime: 120, ocrReadDRAMs: 20, want: 10},
+		{updateTime: 130, ocrReadDRAMs: 20, want: 20},
+		{updateTime: 140, ocrReadDRAMs: 30, want: 0},
+	} {
+		f.processContainerCounterStaleness("pod1", "c1", newTestCgroupInfoV2(tt.updateTime, tt.ocrReadDRAMs))
+		data, err := f.GetContainerMetric("pod1", "c1", consts.MetricCounterStalenessContainer)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.want, data.Value)
+	}
+
+	f.gcCounterAdvances(map[string]bool{})
+	assert.Empty(t, f.counterAdvances)
+}
+
+func TestMalachiteMetricsFetcher_processContainerCounterStuckWarning(t *testing.T) {
+	t.Parallel()
+
+	for _, tt := range []struct {
+		name   string
+		frozen uint64
+		want   int64
+	}{
+		{name: "thawed container is warned once", frozen: 0, want: 1},
+		{name: "frozen container is not warned", frozen: 1, want: 0},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			emitter := newCountingEmitter()
+			f := NewMalachiteMetricsFetcher(emitter, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+			for _, updateTime := range []int64{100, 100 + counterStuckWarningThresholdInSec, 200 + counterStuckWarningThresholdInSec} {
+				cgStats := newTestCgroupInfoV2(updateTime, 10)
+				cgStats.V2.Freezer = &types.FreezerCgDataV2{Frozen: tt.frozen, UpdateTime: updateTime}
+
+				f.processContainerFreezeState("pod1", "c1", cgStats)
+				f.processContainerCounterStaleness("pod1", "c1", cgStats)
+			}
+
+			data, err := f.GetContainerMetric("pod1", "c1", consts.MetricCgroupFrozenContainer)
+			assert.NoError(t, err)
+			assert.Equal(t, float64(tt.frozen), data.Value)
+			assert.Equal(t, tt.want, emitter.count(metricsNameMalachiteCounterStuck))
+		})
+	}
+}
+
+func TestMalachiteMetricsFetcher_processNodeTenantMemBandwidth(t *testing.T) {
+	t.Parallel()
+
+	conf := config.NewConfiguration()
+	conf.MemBandwidthNodeExcludedCgroupPaths = []string{"/kubepods/besteffort/pod-agent"}
+	conf.MemBandwidthNodeExcludedPodSelector = "app=infra"
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, conf).(*MalachiteMetricsFetcher)
+
+	f.updateMemBandwidthExcludedPods([]*v1.Pod{
+		{ObjectMeta: metav1.ObjectMeta{UID: "pod-infra", Labels: map[string]string{"app": "infra"}}},
+		{ObjectMeta: metav1.ObjectMeta{UID: "pod-tenant", Labels: map[string]string{"app": "tenant"}}},
+	})
+
+	now := time.Now()
+	podsContainersStats := make(map[string]map[string]*types.MalachiteCgroupInfo)
+	for _, podUID := range []string{"pod-infra", "pod-tenant", "pod-agent"} {
+		cgStats := newTestCgroupInfoV2(now.Unix(), 0)
+		cgStats.V2.Cpu.FullPath = "/kubepods/besteffort/" + podUID + "/c1"
+		podsContainersStats[podUID] = map[string]*types.MalachiteCgroupInfo{"c1": cgStats}
+
+		f.metricStore.SetContainerMetric(podUID, "c1", consts.MetricMemBandwidthReadContainer,
+			utilmetric.MetricData{Value: 10, Time: &now})
+		f.metricStore.SetContainerMetric(podUID, "c1", consts.MetricMemBandwidthWriteContainer,
+			utilmetric.MetricData{Value: 5, Time: &now})
+	}
+
+	f.processNodeTenantMemBandwidth(podsContainersStats)
+	data, err := f.GetNodeMetric(consts.MetricMemBandwidthTenantNode)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(15), data.Value)
+
+	// nothing is excluded by default
+	f = NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+	for podUID := range podsContainersStats {
+		f.metricStore.SetContainerMetric(podUID, "c1", consts.MetricMemBandwidthReadContainer,
+			utilmetric.MetricData{Value: 10, Time: &now})
+	}
+	f.processNodeTenantMemBandwidth(podsContainersStats)
+	data, err = f.GetNodeMetric(consts.MetricMemBandwidthTenantNode)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(30), data.Value)
+
+	// containers below the idle floor are excluded, while their update time still counts
+	f.metricConf.MemBandwidthNodeIdleFloor = 8
+	later := now.Add(time.Second)
+	for podUID, read := range map[string]float64{"pod-infra": 0.01, "pod-tenant": 20, "pod-agent": 7.99} {
+		f.metricStore.SetContainerMetric(podUID, "c1", consts.MetricMemBandwidthReadContainer,
+			utilmetric.MetricData{Value: read, Time: &later})
+	}
+	f.processNodeTenantMemBandwidth(podsContainersStats)
+	data, err = f.GetNodeMetric(consts.MetricMemBandwidthTenantNode)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(20), data.Value)
+	assert.True(t, later.Equal(*data.Time))
+
+	f.processNodeTenantMemBandwidth(map[string]map[string]*types.MalachiteCgroupInfo{
+		"pod-infra": podsContainersStats["pod-infra"],
+	})
+	data, err = f.GetNodeMetric(consts.MetricMemBandwidthTenantNode)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(0), data.Value)
+
+	// stale bandwidth of containers is not counted
+	f.metricConf.MemBandwidthNodeIdleFloor = 0
+	stale := now.Add(-2 * derivedMetricFreshness)
+	f.metricStore.SetContainerMetric("pod-agent", "c1", consts.MetricMemBandwidthReadContainer,
+		utilmetric.MetricData{Value: 100, Time: &stale})
+	f.processNodeTenantMemBandwidth(map[string]map[string]*types.MalachiteCgroupInfo{
+		"pod-tenant": podsContainersStats["pod-tenant"],
+		"pod-agent":  podsContainersStats["pod-agent"],
+	})
+	data, err = f.GetNodeMetric(consts.MetricMemBandwidthTenantNode)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(20), data.Value)
+}
+
+func TestMalachiteMetricsFetcher_processNodeDecayedMemBandwidth(t *testing.T) {
+	t.Parallel()
+
+	conf := config.NewConfiguration()
+	conf.MemBandwidthNodeDecayFactor = 0.5
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, conf).(*MalachiteMetricsFetcher)
+
+	// samples are kept within derivedMetricFreshness
+	base := time.Now().Add(-25 * time.Second)
+	var got []float64
+	for i, bandwidth := range []float64{10, 10, 90, 10, 10, 10} {
+		updateTime := base.Add(time.Duration(i) * 5 * time.Second)
+		f.metricStore.SetContainerMetric("pod1", "c1", consts.MetricMemBandwidthReadContainer,
+			utilmetric.MetricData{Value: bandwidth, Time: &updateTime})
+		f.processNodeTenantMemBandwidth(map[string]map[string]*types.MalachiteCgroupInfo{"pod1": {"c1": nil}})
+		// the estimate is not decayed again if the bandwidth is not updated
+		f.processNodeTenantMemBandwidth(map[string]map[string]*types.MalachiteCgroupInfo{"pod1": {"c1": nil}})
+
+		data, err := f.GetNodeMetric(consts.MetricMemBandwidthDecayedNode)
+		assert.NoError(t, err)
+		got = append(got, data.Value)
+	}
+	// it rises to the spike at once, and falls by half of the distance to the current bandwidth in each cycle
+	assert.Equal(t, []float64{10, 10, 90, 50, 30, 20}, got)
+
+	// it's disabled by default
+	f = NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+	f.metricStore.SetContainerMetric("pod1", "c1", consts.MetricMemBandwidthReadContainer,
+		utilmetric.MetricData{Value: 10, Time: &base})
+	f.processNodeTenantMemBandwidth(map[string]map[string]*types.MalachiteCgroupInfo{"pod1": {"c1": nil}})
+	_, err := f.GetNodeMetric(consts.MetricMemBandwidthDecayedNode)
+	assert.Error(t, err)
+}
+
+func TestMalachiteMetricsFetcher_processContainerMemBandwidthShare(t *testing.T) {
+	t.Parallel()
+
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+
+	now := time.Now()
+	stale := now.Add(-time.Hour)
+	podsContainersStats := map[string]map[string]*types.MalachiteCgroupInfo{
+		"pod1": {"c1": nil, "c2": nil},
+		"pod2": {"c1": nil, "stale": nil, "absent": nil},
+	}
+	for _, c := range []struct {
+		podUID, containerName string
+		read, write           float64
+		updateTime            *time.Time
+	}{
+		{podUID: "pod1", containerName: "c1", read: 40, write: 10, updateTime: &now},
+		{podUID: "pod1", containerName: "c2", read: 20, write: 10, updateTime: &now},
+		{podUID: "pod2", containerName: "c1", read: 15, write: 5, updateTime: &now},
+		{podUID: "pod2", containerName: "stale", read: 100, write: 100, updateTime: &stale},
+	} {
+		f.metricStore.SetContainerMetric(c.podUID, c.containerName, consts.MetricMemBandwidthReadContainer,
+			utilmetric.MetricData{Value: c.read, Time: c.updateTime})
+		f.metricStore.SetContainerMetric(c.podUID, c.containerName, consts.MetricMemBandwidthWriteContainer,
+			utilmetric.MetricData{Value: c.write, Time: c.updateTime})
+	}
+
+	// the node total is 100, and stale containers are not counted
+	f.processContainerMemBandwidthShare(podsContainersStats)
+	for podUID, shares := range map[string]map[string]float64{
+		"pod1": {"c1": 0.5, "c2": 0.3},
+		"pod2": {"c1": 0.2},
+	} {
+		for containerName, share := range shares {
+			data, err := f.GetContainerMetric(podUID, containerName, consts.MetricMemBandwidthShareContainer)
+			assert.NoError(t, err)
+			assert.InDelta(t, share, data.Value, 1e-9)
+		}
+	}
+	for _, containerName := range []string{"stale", "absent"} {
+		_, err := f.GetContainerMetric("pod2", containerName, consts.MetricMemBandwidthShareContainer)
+		assert.Error(t, err)
+	}
+
+	// skipped if the node total is zero
+	f = NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+	f.metricStore.SetContainerMetric("pod1", "c1", consts.MetricMemBandwidthReadContainer, utilmetric.MetricData{Value: 0, Time: &now})
+	f.processContainerMemBandwidthShare(podsContainersStats)
+	_, err := f.GetContainerMetric("pod1", "c1", consts.MetricMemBandwidthShareContainer)
+	assert.Error(t, err)
+}
+
+func TestMalachiteMetricsFetcher_rateClockJump(t *testing.T) {
+	t.Parallel()
+
+	emitter := newCountingEmitter()
+	conf := config.NewConfiguration()
+	conf.SampleInterval = 10 * time.Second
+	conf.RateClockJumpFactor = 3
+	f := NewMalachiteMetricsFetcher(emitter, &pod.PodFetcherStub{}, conf).(*MalachiteMetricsFetcher)
+
+	delta := func() float64 { return 100 }
+	for _, tt := range []struct {
+		name           string
+		lastUpdateTime int64
+		curUpdateTime  int64
+		wantOK         bool
+	}{
+		{name: "regular interval", lastUpdateTime: 100, curUpdateTime: 110, wantOK: true},
+		{name: "forward step", lastUpdateTime: 110, curUpdateTime: 3710},
+		{name: "backward step", lastUpdateTime: 3710, curUpdateTime: 120},
+		{name: "partial backward step", lastUpdateTime: 120, curUpdateTime: 122},
+		{name: "baseline restarted", lastUpdateTime: 122, curUpdateTime: 131, wantOK: true},
+	} {
+		// each sample of the node is processed in its own cycle
+		f.rateClockJumpSamples = nil
+		_, ok := f.calculateRateMetric(delta, tt.lastUpdateTime, tt.curUpdateTime)
+		assert.Equal(t, tt.wantOK, ok, tt.name)
+	}
+	assert.Equal(t, int64(3), emitter.count(metricsNameMalachiteRateClockJump))
+
+	// a jumped sample of the container is counted once, though it's dropped by several rate metrics
+	for _, updateTime := range []int64{100, 110, 3710} {
+		assert.NoError(t, f.processContainerStats("pod1", "c1", newTestCgroupInfoV2(updateTime, uint64(updateTime)*16384)))
+	}
+	assert.Equal(t, int64(4), emitter.count(metricsNameMalachiteRateClockJump))
+	assert.Equal(t, int64(4), atomic.LoadInt64(&f.rateClockJumps))
+
+	// detection is disabled without the factor
+	f = NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+	_, ok := f.calculateRateMetric(delta, 110, 3710)
+	assert.True(t, ok)
+}
+
+func TestMalachiteMetricsFetcher_rateMonotonicInterval(t *testing.T) {
+	t.Parallel()
+
+	newCgStats := func(updateTime int64, monotonicTime uint64, ocrReadDRAMs uint64) *types.MalachiteCgroupInfo {
+		cgStats := newTestCgroupInfoV2(updateTime, ocrReadDRAMs)
+		cgStats.V2.Cpu.MonotonicTime = monotonicTime
+		return cgStats
+	}
+
+	conf := config.NewConfiguration()
+	conf.RateMonotonicInterval = true
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, conf).(*MalachiteMetricsFetcher)
+
+	f.processContainerCPUData("pod1", "container1", newCgStats(100, 100*uint64(time.Second), 1<<20))
+	// wall-clock steps backward, while monotonic clock is steady
+	f.processContainerCPUData("pod1", "container1", newCgStats(50, 105*uint64(time.Second), 1<<20+5*(1<<20)))
+	data, err := f.GetContainerMetric("pod1", "container1", consts.MetricMemBandwidthReadContainer)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(64), data.Value)
+
+	// wall-clock steps forward
+	f.processContainerCPUData("pod1", "container1", newCgStats(3650, 110*uint64(time.Second), 1<<20+10*(1<<20)))
+	data, err = f.GetContainerMetric("pod1", "container1", consts.MetricMemBandwidthReadContainer)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(64), data.Value)
+	assert.Equal(t, time.Unix(3650, 0), *data.Time)
+
+	// wall-clock is used when monotonic time is not provided
+	f.processContainerCPUData("pod1", "container2", newCgStats(100, 0, 1<<20))
+	f.processContainerCPUData("pod1", "container2", newCgStats(110, 0, 1<<20+5*(1<<20)))
+	data, err = f.GetContainerMetric("pod1", "container2", consts.MetricMemBandwidthReadContainer)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(32), data.Value)
+}
+
+func TestMalachiteMetricsFetcher_rateSubSecondUpdateTime(t *testing.T) {
+	t.Parallel()
+
+	newCgStats := func(updateTimeNano int64, withNano bool, ocrReadDRAMs uint64) *types.MalachiteCgroupInfo {
+		cgStats := newTestCgroupInfoV2(updateTimeNano/int64(time.Second), ocrReadDRAMs)
+		if withNano {
+			cgStats.V2.Cpu.UpdateTimeNano = updateTimeNano
+		}
+		return cgStats
+	}
+
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+	// samples are 1.25s apart, while it's 2s measured by the update times in seconds
+	first, second := int64(100750*time.Millisecond), int64(102*time.Second)
+	for containerName, withNano := range map[string]bool{"nano-true": true, "nano-false": false} {
+		f.processContainerCPUData("pod1", containerName, newCgStats(first, withNano, 1<<20))
+		f.processContainerCPUData("pod1", containerName, newCgStats(second, withNano, 1<<20+1310720))
+	}
+
+	data, err := f.GetContainerMetric("pod1", "nano-true", consts.MetricMemBandwidthReadContainer)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(64), data.Value)
+	assert.Equal(t, time.Unix(0, second), *data.Time)
+
+	data, err = f.GetContainerMetric("pod1", "nano-false", consts.MetricMemBandwidthReadContainer)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(40), data.Value)
+
+	// nanoseconds not agreeing with the update times in seconds are not trusted
+	data, ok := f.calculateMonotonicRateMetric(containerMetricKey{}, func() float64 { return 100 }, 100, 102,
+		preciseSampleTime{updateTimeNano: first}, preciseSampleTime{updateTimeNano: int64(110 * time.Second)})
+	assert.True(t, ok)
+	assert.Equal(t, float64(50), data.Value)
+	assert.Equal(t, time.Unix(102, 0), *data.Time)
+}
+
+func TestMalachiteMetricsFetcher_processContainerMemBandwidthPressureClass(t *testing.T) {
+	t.Parallel()
+
+	conf := config.NewConfiguration()
+	conf.MemChannelCount = 4
+	conf.MemChannelPeakBandwidth = 25
+	conf.MemBandwidthPressureClassBands = []float64{0.3, 0.6, 0.9}
+
+	tests := []struct {
+		bandwidth float64
+		want      float64
+	}{
+		{bandwidth: 0, want: 0},
+		{bandwidth: 29.9, want: 0},
+		{bandwidth: 30, want: 1},
+		{bandwidth: 59.9, want: 1},
+		{bandwidth: 60, want: 2},
+		{bandwidth: 89.9, want: 2},
+		{bandwidth: 90, want: 3},
+		{bandwidth: 150, want: 3},
+	}
+	for _, tt := range tests {
+		f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, conf).(*MalachiteMetricsFetcher)
+		now := time.Now()
+		f.metricStore.SetContainerMetric("pod1", "c1", consts.MetricMemBandwidthReadContainer,
+			utilmetric.MetricData{Value: tt.bandwidth / 2, Time: &now})
+		f.metricStore.SetContainerMetric("pod1", "c1", consts.MetricMemBandwidthWriteContainer,
+			utilmetric.MetricData{Value: tt.bandwidth / 2, Time: &now})
+
+		f.processContainerMemBandwidthPressureClass("pod1", "c1", now)
+		data, err := f.GetContainerMetric("pod1", "c1", consts.MetricMemBandwidthPressureClassContainer)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.want, data.Value, tt.bandwidth)
+	}
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package malachite
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/metric/malachite/types"
+)
+
+const defaultDebugCaptureSize = 10
+
+// ContainerDebugCapture is the raw cgroup info of a container parsed in a sampling cycle together with
+// all metrics of the container right after they are processed, which helps to correlate derived metrics
+// with the exact source response.
+type ContainerDebugCapture struct {
+	PodUID        string                     `json:"podUID"`
+	ContainerName string                     `json:"containerName"`
+	Timestamp     time.Time                  `json:"timestamp"`
+	Raw           *types.MalachiteCgroupInfo `json:"raw"`
+	Metrics       []ContainerMetricEntry     `json:"metrics"`
+}
+
+// isDebugCaptureTarget returns true if the container is configured to be captured,
+// and it must be called with cycleLock held.
+func (m *MalachiteMetricsFetcher) isDebugCaptureTarget(podUID, containerName string) bool {
+	for _, target := range m.metricConf.DebugCaptureContainers {
+		if target == podUID+"/"+containerName {
+			return true
+		}
+	}
+	return false
+}
+
+// captureContainerDebug records the raw cgroup info and the resulting metrics of the container if it's
+// a capture target, and only the latest DebugCaptureSize captures are kept for each container.
+func (m *MalachiteMetricsFetcher) captureContainerDebug(podUID, containerName string, cgStats *types.MalachiteCgroupInfo) {
+	if !m.isDebugCaptureTarget(podUID, containerName) {
+		return
+	}
+
+	capture := ContainerDebugCapture{
+		PodUID:        podUID,
+		ContainerName: containerName,
+		Timestamp:     time.Now(),
+		// the raw info is parsed from a new response in each cycle, so it's not modified after that
+		Raw:     cgStats,
+		Metrics: make([]ContainerMetricEntry, 0),
+	}
+	for name, data := range m.metricStore.GetAllContainerMetrics(podUID, containerName) {
+		capture.Metrics = append(capture.Metrics, ContainerMetricEntry{
+			PodUID:        podUID,
+			ContainerName: containerName,
+			MetricName:    name,
+			Value:         data.Value,
+			Timestamp:     data.Time,
+		})
+	}
+	sort.Slice(capture.Metrics, func(i, j int) bool { return capture.Metrics[i].MetricName < capture.Metrics[j].MetricName })
+
+	size := m.metricConf.DebugCaptureSize
+	if size <= 0 {
+		size = defaultDebugCaptureSize
+	}
+
+	m.debugCaptureLock.Lock()
+	defer m.debugCaptureLock.Unlock()
+
+	key := containerMetricKey{podUID: podUID, containerName: containerName}
+	captures := append(m.debugCaptures[key], capture)
+	if len(captures) > size {
+		captures = append([]ContainerDebugCapture(nil), captures[len(captures)-size:]...)
+	}
+	m.debugCaptures[key] = captures
+}
+
+// gcDebugCaptures removes captures of pods that are not existed any more, and those of
+// containers not configured to be captured any more.
+func (m *MalachiteMetricsFetcher) gcDebugCaptures(podUIDSet map[string]bool) {
+	m.debugCaptureLock.Lock()
+	defer m.debugCaptureLock.Unlock()
+
+	for key := range m.debugCaptures {
+		if !podUIDSet[key.podUID] || !m.isDebugCaptureTarget(key.podUID, key.containerName) {
+			delete(m.debugCaptures, key)
+		}
+	}
+}
+
+// getDebugCaptures returns captures of the container from the oldest to the latest
+func (m *MalachiteMetricsFetcher) getDebugCaptures(podUID, containerName string) []ContainerDebugCapture {
+	m.debugCaptureLock.RLock()
+	defer m.debugCaptureLock.RUnlock()
+
+	captures := m.debugCaptures[containerMetricKey{podUID: podUID, containerName: containerName}]
+	return append(make([]ContainerDebugCapture, 0, len(captures)), captures...)
+}
+
+func (m *MalachiteMetricsFetcher) handleDebugCapture(w http.ResponseWriter, r *http.Request) {
+	if r == nil || r.Method != http.MethodGet || r.URL == nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = fmt.Fprintf(w, "Request must be GET with Query URL")
+		return
+	}
+
+	query := r.URL.Query()
+	podUID := strings.TrimSpace(query.Get(ContainerMetricsParamPod))
+	containerName := strings.TrimSpace(query.Get(ContainerMetricsParamContainer))
+	if podUID == "" || containerName == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = fmt.Fprintf(w, "both %v and %v are required", ContainerMetricsParamPod, ContainerMetricsParamContainer)
+		return
+	}
+
+	bytes, err := json.Marshal(m.getDebugCaptures(podUID, containerName))
+	if err != nil {
+		klog.Errorf("[malachite] marshal debug captures err: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = fmt.Fprintf(w, "Marshal debug captures error: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(bytes)
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package malachite
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kubewharf/katalyst-core/pkg/consts"
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/metric/malachite/types"
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/pod"
+	"github.com/kubewharf/katalyst-core/pkg/metrics"
+)
+
+func TestMalachiteMetricsFetcher_captureContainerDebug(t *testing.T) {
+	t.Parallel()
+
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+	f.metricConf.DebugCaptureContainers = []string{"pod1/c1"}
+	f.metricConf.DebugCaptureSize = 2
+	mux := http.NewServeMux()
+	f.Serve(mux)
+
+	for i := int64(0); i < 3; i++ {
+		f.processPodsContainersStats(map[string]map[string]*types.MalachiteCgroupInfo{
+			"pod1": {
+				"c1": newTestCgroupInfoV2(10000+5*i, 1<<30+uint64(i)*5*(1<<20)),
+				"c2": newTestCgroupInfoV2(10000+5*i, 1<<30),
+			},
+		})
+	}
+
+	query := func(rawQuery string) (int, []ContainerDebugCapture) {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, ServingDebugCapturePath+"?"+rawQuery, nil))
+		if rec.Code != http.StatusOK {
+			return rec.Code, nil
+		}
+
+		var captures []ContainerDebugCapture
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &captures))
+		return rec.Code, captures
+	}
+
+	// only the latest captures are kept, and both raw fields and derived metrics are included
+	code, captures := query("pod=pod1&container=c1")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, captures, 2)
+	latest := captures[1]
+	assert.Equal(t, "V2", latest.Raw.CgroupType)
+	assert.Equal(t, uint64(1<<30+10*(1<<20)), latest.Raw.V2.Cpu.OCRReadDRAMs)
+	assert.Equal(t, int64(10010), latest.Raw.V2.Cpu.UpdateTime)
+	derived := make(map[string]float64)
+	for _, entry := range latest.Metrics {
+		derived[entry.MetricName] = entry.Value
+	}
+	assert.Equal(t, float64(64), derived[consts.MetricMemBandwidthReadContainer])
+	assert.Equal(t, int64(10005), captures[0].Raw.V2.Cpu.UpdateTime)
+
+	// containers not targeted are not captured
+	code, captures = query("pod=pod1&container=c2")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Empty(t, captures)
+
+	code, _ = query("pod=pod1")
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	// captures are dropped once the container is not targeted any more
+	f.metricConf.DebugCaptureContainers = nil
+	f.processPodsContainersStats(map[string]map[string]*types.MalachiteCgroupInfo{
+		"pod1": {"c1": newTestCgroupInfoV2(10015, 1<<30+15*(1<<20))},
+	})
+	_, captures = query("pod=pod1&container=c1")
+	assert.Empty(t, captures)
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package malachite
+
+import (
+	"time"
+
+	utilmetric "github.com/kubewharf/katalyst-core/pkg/util/metric"
+)
+
+// ContainerIdentity identifies a container by the uid of its pod and its name
+type ContainerIdentity struct {
+	PodUID        string
+	ContainerName string
+}
+
+// ContainerMetricComparison is the values of a metric in two containers, and the value is nil if the
+// metric is absent or stale in the container. Delta is the value of B minus that of A, and it's nil
+// unless the metric is present in both containers.
+type ContainerMetricComparison struct {
+	MetricName string
+	A          *utilmetric.MetricData
+	B          *utilmetric.MetricData
+	Delta      *float64
+}
+
+// CompareContainerMetrics returns the given metrics of two containers side by side in the order of
+// metricNames, and metrics updated before maxAge ago are regarded as absent if maxAge is positive.
+// It's mainly used to debug why one replica behaves differently from another.
+func (m *MalachiteMetricsFetcher) CompareContainerMetrics(a, b ContainerIdentity, metricNames []string,
+	maxAge time.Duration) []ContainerMetricComparison {
+	metricsA := m.metricStore.GetContainerMetrics(a.PodUID, a.ContainerName, metricNames, maxAge)
+	metricsB := m.metricStore.GetContainerMetrics(b.PodUID, b.ContainerName, metricNames, maxAge)
+
+	res := make([]ContainerMetricComparison, 0, len(metricNames))
+	for _, metricName := range metricNames {
+		comparison := ContainerMetricComparison{MetricName: metricName}
+		if data, ok := metricsA[metricName]; ok {
+			comparison.A = &data
+		}
+		if data, ok := metricsB[metricName]; ok {
+			comparison.B = &data
+		}
+		if comparison.A != nil && comparison.B != nil {
+			delta := comparison.B.Value - comparison.A.Value
+			comparison.Delta = &delta
+		}
+		res = append(res, comparison)
+	}
+	return res
+}
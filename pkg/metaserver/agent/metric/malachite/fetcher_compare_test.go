@@ -0,0 +1,69 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package malachite
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kubewharf/katalyst-core/pkg/consts"
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/pod"
+	"github.com/kubewharf/katalyst-core/pkg/metrics"
+	utilmetric "github.com/kubewharf/katalyst-core/pkg/util/metric"
+)
+
+func TestMalachiteMetricsFetcher_CompareContainerMetrics(t *testing.T) {
+	t.Parallel()
+
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+
+	now := time.Now()
+	stale := now.Add(-time.Hour)
+	f.metricStore.SetContainerMetric("pod1", "c1", consts.MetricCPUUsageContainer, utilmetric.MetricData{Value: 2, Time: &now})
+	f.metricStore.SetContainerMetric("pod1", "c1", consts.MetricMemWorkingSetContainer, utilmetric.MetricData{Value: 1024, Time: &now})
+	f.metricStore.SetContainerMetric("pod2", "c1", consts.MetricCPUUsageContainer, utilmetric.MetricData{Value: 3.5, Time: &now})
+	f.metricStore.SetContainerMetric("pod2", "c1", consts.MetricMemWorkingSetContainer, utilmetric.MetricData{Value: 512, Time: &stale})
+
+	a := ContainerIdentity{PodUID: "pod1", ContainerName: "c1"}
+	b := ContainerIdentity{PodUID: "pod2", ContainerName: "c1"}
+	metricNames := []string{consts.MetricCPUUsageContainer, consts.MetricMemWorkingSetContainer, consts.MetricMemUsageContainer}
+
+	res := f.CompareContainerMetrics(a, b, metricNames, time.Minute)
+	assert.Len(t, res, 3)
+
+	assert.Equal(t, consts.MetricCPUUsageContainer, res[0].MetricName)
+	assert.Equal(t, float64(2), res[0].A.Value)
+	assert.Equal(t, 3.5, res[0].B.Value)
+	assert.Equal(t, 1.5, *res[0].Delta)
+
+	// stale metric in one container has no delta
+	assert.Equal(t, consts.MetricMemWorkingSetContainer, res[1].MetricName)
+	assert.Equal(t, float64(1024), res[1].A.Value)
+	assert.Nil(t, res[1].B)
+	assert.Nil(t, res[1].Delta)
+
+	assert.Equal(t, consts.MetricMemUsageContainer, res[2].MetricName)
+	assert.Nil(t, res[2].A)
+	assert.Nil(t, res[2].B)
+	assert.Nil(t, res[2].Delta)
+
+	// stale metrics are compared if max age is not limited
+	res = f.CompareContainerMetrics(a, b, metricNames, 0)
+	assert.Equal(t, float64(-512), *res[1].Delta)
+}
@@ -0,0 +1,181 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package malachite
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/klog/v2"
+
+	globalconfig "github.com/kubewharf/katalyst-core/pkg/config/agent/global"
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/metric/malachite/client"
+	utilmetric "github.com/kubewharf/katalyst-core/pkg/util/metric"
+)
+
+// UpdateConfig swaps the active metric configuration at runtime without restart, and it waits for the
+// in-flight sampling cycle to finish, so the new configuration takes effect since the next cycle. Settings
+// only consumed at startup are kept as they are, i.e. the unit of memory bandwidth, the prefix of metric
+// names, the snapshot file, the export socket and the remote write. The configuration is validated as
+// the one parsed from flags, and it's rejected as a whole if invalid.
+func (m *MalachiteMetricsFetcher) UpdateConfig(metricConf *globalconfig.MetricConfiguration) error {
+	if metricConf == nil {
+		return fmt.Errorf("metric configuration is nil")
+	}
+
+	m.cycleLock.Lock()
+	defer m.cycleLock.Unlock()
+	if m.closed {
+		return fmt.Errorf("metrics fetcher is closed")
+	}
+
+	prev := m.metricConf
+	next := *metricConf
+	next.MemBandwidthUnit = prev.MemBandwidthUnit
+	next.MetricNamePrefix = prev.MetricNamePrefix
+	next.MetricSnapshotFile = prev.MetricSnapshotFile
+	next.MetricSnapshotPreload = prev.MetricSnapshotPreload
+	next.MetricExportSocketPath = prev.MetricExportSocketPath
+	next.MetricRemoteWriteURL = prev.MetricRemoteWriteURL
+	next.MetricRemoteWriteInterval = prev.MetricRemoteWriteInterval
+	next.MetricRemoteWriteQueueSize = prev.MetricRemoteWriteQueueSize
+	if err := next.Validate(); err != nil {
+		return err
+	}
+
+	m.applyMetricConf(&next, prev)
+	klog.Infof("[malachite] metric configuration is updated")
+
+	// wake up the sampling loop waiting with the previous interval
+	select {
+	case m.sampleIntervalUpdated <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// getMetricConf returns the active metric configuration, and it's used by those out of sampling loop.
+func (m *MalachiteMetricsFetcher) getMetricConf() *globalconfig.MetricConfiguration {
+	m.cycleLock.Lock()
+	defer m.cycleLock.Unlock()
+	return m.metricConf
+}
+
+// applyMetricConf makes the configuration active, including settings of the metric store and those
+// parsed from the configuration, and prev is the configuration active before (nil at startup).
+// It must be called with cycleLock held unless the fetcher is being constructed.
+func (m *MalachiteMetricsFetcher) applyMetricConf(metricConf, prev *globalconfig.MetricConfiguration) {
+	if rounder, err := utilmetric.NewValueRounder(metricConf.StoreRoundingMode, metricConf.StoreRoundingDigits); err != nil {
+		klog.Errorf("[malachite] %v, metric values will not be rounded", err)
+		m.metricStore.SetValueRounder(nil)
+	} else {
+		m.metricStore.SetValueRounder(rounder)
+	}
+
+	m.metricStore.SetNodeMetricRetention(metricConf.NodeMetricRetention)
+	if prev != nil {
+		for metricName := range prev.NodeMetricRetentionOverrides {
+			if _, ok := metricConf.NodeMetricRetentionOverrides[metricName]; !ok {
+				m.metricStore.SetNodeMetricRetentionOf(metricName, utilmetric.MetricRetention{})
+			}
+		}
+	}
+	for metricName, value := range metricConf.NodeMetricRetentionOverrides {
+		if retention, err := utilmetric.ParseMetricRetention(value); err != nil {
+			klog.Errorf("[malachite] %v, default retention is used for %v", err, metricName)
+			m.metricStore.SetNodeMetricRetentionOf(metricName, utilmetric.MetricRetention{})
+		} else {
+			m.metricStore.SetNodeMetricRetentionOf(metricName, retention)
+		}
+	}
+	m.metricStore.SetMaxMetricKeys(metricConf.MetricStoreMaxKeys)
+	m.metricStore.SetMinWriteIntervals(metricConf.MetricMinWriteIntervals)
+	m.metricStore.SetDisabledMetrics(metricConf.DisabledMetrics)
+
+	m.memBandwidthExcludedPodSelector = labels.Nothing()
+	if metricConf.MemBandwidthNodeExcludedPodSelector != "" {
+		if selector, err := labels.Parse(metricConf.MemBandwidthNodeExcludedPodSelector); err != nil {
+			klog.Errorf("[malachite] invalid pod selector for tenant memory bandwidth: %v, no pod will be excluded", err)
+		} else {
+			m.memBandwidthExcludedPodSelector = selector
+		}
+	}
+
+	counterDeltaStrategies := make(map[string]CounterDeltaStrategy, len(metricConf.CounterDeltaStrategies))
+	for metricName, name := range metricConf.CounterDeltaStrategies {
+		strategy, err := GetCounterDeltaStrategy(name)
+		if err != nil {
+			klog.Errorf("[malachite] %v, default strategy will be used for %v", err, metricName)
+			continue
+		}
+		counterDeltaStrategies[metricName] = strategy
+	}
+	m.setConfiguredCounterDeltaStrategies(counterDeltaStrategies)
+
+	if m.malachiteClient != nil {
+		parserName := metricConf.MalachiteCgroupStatsParser
+		if parserName == "" {
+			parserName = client.DefaultCgroupStatsParser
+		}
+		if parser, err := client.GetCgroupStatsParser(parserName); err != nil {
+			klog.Errorf("[malachite] %v, default parser will be used for cgroup stats", err)
+			m.malachiteClient.SetCgroupStatsParser(nil)
+		} else {
+			m.malachiteClient.SetCgroupStatsParser(parser)
+		}
+	}
+
+	sampleInterval := metricConf.SampleInterval
+	if sampleInterval <= 0 {
+		sampleInterval = globalconfig.DefaultMetricSampleInterval
+	}
+	atomic.StoreInt64(&m.sampleInterval, int64(sampleInterval))
+
+	m.metricConf = metricConf
+}
+
+// getSampleInterval returns the interval between sampling cycles
+func (m *MalachiteMetricsFetcher) getSampleInterval() time.Duration {
+	return time.Duration(atomic.LoadInt64(&m.sampleInterval))
+}
+
+// runSampleLoop runs sampling cycles until the context is done, and the interval is read before waiting
+// for each cycle. If the interval is updated during the wait, the wait restarts with the new interval, so
+// that a long interval configured before never delays the update.
+func (m *MalachiteMetricsFetcher) runSampleLoop(ctx context.Context) {
+	for {
+		m.sampleOnce(ctx)
+
+		timer := time.NewTimer(m.getSampleInterval())
+	wait:
+		for {
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-m.sampleIntervalUpdated:
+				timer.Stop()
+				timer = time.NewTimer(m.getSampleInterval())
+			case <-timer.C:
+				break wait
+			}
+		}
+	}
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package malachite
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kubewharf/katalyst-core/pkg/config"
+	globalconfig "github.com/kubewharf/katalyst-core/pkg/config/agent/global"
+	"github.com/kubewharf/katalyst-core/pkg/consts"
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/metric/malachite/client"
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/metric/malachite/types"
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/pod"
+	"github.com/kubewharf/katalyst-core/pkg/metrics"
+	utilmetric "github.com/kubewharf/katalyst-core/pkg/util/metric"
+)
+
+func TestMalachiteMetricsFetcher_UpdateConfig(t *testing.T) {
+	t.Parallel()
+
+	emitter := newCountingEmitter()
+	conf := config.NewConfiguration()
+	conf.SampleInterval = time.Hour
+	f := NewMalachiteMetricsFetcher(emitter, &pod.PodFetcherStub{}, conf).(*MalachiteMetricsFetcher)
+	// malachite is unhealthy without urls, which is counted for each cycle
+	f.malachiteClient.SetURL(map[string]string{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	f.Run(ctx)
+	assert.Eventually(t, func() bool { return emitter.count(metricsNamMalachiteUnHealthy) == 1 }, time.Second, 10*time.Millisecond)
+
+	now := time.Now()
+	f.metricStore.SetContainerMetric("pod1", "c1", consts.MetricCPUCPIContainer, utilmetric.MetricData{Value: 1, Time: &now})
+
+	assert.Error(t, f.UpdateConfig(nil))
+	assert.Error(t, f.UpdateConfig(&globalconfig.MetricConfiguration{SampleInterval: -time.Second}))
+	for _, invalid := range []func(c *globalconfig.MetricConfiguration){
+		func(c *globalconfig.MetricConfiguration) { c.MemBandwidthPressureClassBands = []float64{0.8, 0.5} },
+		func(c *globalconfig.MetricConfiguration) { c.MemBandwidthHistogramBuckets = []float64{10, 10} },
+		func(c *globalconfig.MetricConfiguration) { c.MemBandwidthNodeDecayFactor = 1 },
+		func(c *globalconfig.MetricConfiguration) { c.RateClockJumpFactor = 0.5 },
+		func(c *globalconfig.MetricConfiguration) { c.MemBandwidthSharedCgroupPolicy = "unknown" },
+		func(c *globalconfig.MetricConfiguration) {
+			c.NodeMetricRetentionOverrides = map[string]string{"m": "x"}
+		},
+		func(c *globalconfig.MetricConfiguration) { c.StoreRoundingMode = "unknown" },
+		func(c *globalconfig.MetricConfiguration) {
+			c.CounterDeltaStrategies = map[string]string{consts.MetricPageFaultRateContainer: "unknown"}
+		},
+		func(c *globalconfig.MetricConfiguration) { c.MalachiteCgroupStatsParser = "unknown" },
+	} {
+		invalidConf := *f.getMetricConf()
+		invalid(&invalidConf)
+		assert.Error(t, f.UpdateConfig(&invalidConf))
+	}
+
+	// the loop waiting for an hour is woken up with the new interval
+	newConf := *f.getMetricConf()
+	newConf.SampleInterval = 10 * time.Millisecond
+	newConf.DisabledMetrics = []string{consts.MetricCPUCPIContainer}
+	newConf.MetricNamePrefix = "ignored_"
+	assert.NoError(t, f.UpdateConfig(&newConf))
+	assert.Eventually(t, func() bool { return emitter.count(metricsNamMalachiteUnHealthy) >= 3 }, time.Second, 10*time.Millisecond)
+
+	// disabled metrics are removed and not stored any more
+	_, err := f.GetContainerMetric("pod1", "c1", consts.MetricCPUCPIContainer)
+	assert.Error(t, err)
+	f.metricStore.SetContainerMetric("pod1", "c1", consts.MetricCPUCPIContainer, utilmetric.MetricData{Value: 1, Time: &now})
+	_, err = f.GetContainerMetric("pod1", "c1", consts.MetricCPUCPIContainer)
+	assert.Error(t, err)
+
+	// the introspection endpoint reflects the new configuration, except those only consumed at startup
+	mux := http.NewServeMux()
+	f.Serve(mux)
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, ServingMetricConfigPath, nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	served := &globalconfig.MetricConfiguration{}
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), served))
+	assert.Equal(t, 10*time.Millisecond, served.SampleInterval)
+	assert.Equal(t, []string{consts.MetricCPUCPIContainer}, served.DisabledMetrics)
+	assert.Equal(t, "", served.MetricNamePrefix)
+
+	f.Close()
+	assert.Error(t, f.UpdateConfig(&newConf))
+}
+
+func TestMalachiteMetricsFetcher_UpdateConfigCounterDeltaStrategies(t *testing.T) {
+	t.Parallel()
+
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+	doubled := CounterDeltaFunc(func(previous, current uint64) uint64 { return 2 * (current - previous) })
+	f.SetCounterDeltaStrategy(consts.MetricPageFaultRateContainer, doubled)
+
+	newConf := *f.getMetricConf()
+	newConf.CounterDeltaStrategies = map[string]string{
+		consts.MetricPageFaultRateContainer:      CounterDeltaStrategyResetAsZero,
+		consts.MetricMajorPageFaultRateContainer: CounterDeltaStrategyResetAsZero,
+	}
+	assert.NoError(t, f.UpdateConfig(&newConf))
+
+	// strategies set programmatically are kept and take precedence over the configured ones
+	assert.Equal(t, uint64(40), f.counterDelta(consts.MetricPageFaultRateContainer, 10, 30))
+	assert.Equal(t, uint64(10), f.counterDelta(consts.MetricMajorPageFaultRateContainer, 30, 10))
+
+	newConf.CounterDeltaStrategies = nil
+	assert.NoError(t, f.UpdateConfig(&newConf))
+	assert.Equal(t, uint64(40), f.counterDelta(consts.MetricPageFaultRateContainer, 10, 30))
+	assert.Equal(t, uint64(0), f.counterDelta(consts.MetricMajorPageFaultRateContainer, 30, 10))
+
+	// parsers registered are valid to be selected
+	newConf.MalachiteCgroupStatsParser = "test-config-parser"
+	assert.Error(t, f.UpdateConfig(&newConf))
+	client.RegisterCgroupStatsParser("test-config-parser", client.CgroupStatsParserFunc(
+		func(_ string, _ []byte) (*types.MalachiteCgroupInfo, error) { return &types.MalachiteCgroupInfo{}, nil }))
+	assert.NoError(t, f.UpdateConfig(&newConf))
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package malachite
+
+import (
+	"fmt"
+	"math"
+
+	globalconfig "github.com/kubewharf/katalyst-core/pkg/config/agent/global"
+)
+
+// CounterDeltaStrategy calculates the delta between two samples of a cumulative counter, and
+// it decides how to handle the case that the current value is less than the previous one.
+type CounterDeltaStrategy interface {
+	Delta(previous, current uint64) uint64
+}
+
+// CounterDeltaFunc is an adapter to use ordinary functions as CounterDeltaStrategy
+type CounterDeltaFunc func(previous, current uint64) uint64
+
+func (f CounterDeltaFunc) Delta(previous, current uint64) uint64 {
+	return f(previous, current)
+}
+
+// names of the built-in counter delta strategies
+const (
+	CounterDeltaStrategySaturating  = globalconfig.CounterDeltaStrategySaturating
+	CounterDeltaStrategyResetAsZero = globalconfig.CounterDeltaStrategyResetAsZero
+	CounterDeltaStrategyWrap48      = globalconfig.CounterDeltaStrategyWrap48
+	CounterDeltaStrategyWrap64      = globalconfig.CounterDeltaStrategyWrap64
+)
+
+// builtinCounterDeltaStrategies are strategies can be selected by name in configuration
+var builtinCounterDeltaStrategies = map[string]CounterDeltaStrategy{
+	// the delta is zero if the counter goes backwards, since the upper bound of the counter is unknown
+	CounterDeltaStrategySaturating: CounterDeltaFunc(uint64CounterDelta),
+	// the counter is regarded as reset and restarted from zero if it goes backwards
+	CounterDeltaStrategyResetAsZero: CounterDeltaFunc(resetAsZeroCounterDelta),
+	// the counter is regarded as wrapped around at its width if it goes backwards
+	CounterDeltaStrategyWrap48: NewWrapCounterDelta(48),
+	CounterDeltaStrategyWrap64: NewWrapCounterDelta(64),
+}
+
+// GetCounterDeltaStrategy returns the built-in strategy with the given name
+func GetCounterDeltaStrategy(name string) (CounterDeltaStrategy, error) {
+	strategy, ok := builtinCounterDeltaStrategies[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown counter delta strategy %q", name)
+	}
+	return strategy, nil
+}
+
+func resetAsZeroCounterDelta(previous, current uint64) uint64 {
+	if current >= previous {
+		return current - previous
+	}
+	return current
+}
+
+// NewWrapCounterDelta returns the strategy for counters wrapping around at the given bits, and the
+// delta is zero if the previous value is out of the range, which means it's not such a counter.
+func NewWrapCounterDelta(bits uint) CounterDeltaStrategy {
+	maxValue := uint64(math.MaxUint64)
+	if bits < 64 {
+		maxValue = 1<<bits - 1
+	}
+
+	return CounterDeltaFunc(func(previous, current uint64) uint64 {
+		if current >= previous {
+			return current - previous
+		}
+		if previous > maxValue {
+			return 0
+		}
+		return maxValue - previous + current + 1
+	})
+}
+
+// SetCounterDeltaStrategy sets the strategy to calculate deltas of the counters which the given
+// metric is derived from, and the saturating strategy is used for metrics without any strategy.
+// Strategies set by it take precedence over those in configuration, and they're kept across
+// updates of the configuration.
+func (m *MalachiteMetricsFetcher) SetCounterDeltaStrategy(metricName string, strategy CounterDeltaStrategy) {
+	m.counterDeltaLock.Lock()
+	defer m.counterDeltaLock.Unlock()
+	m.counterDeltaStrategies[metricName] = strategy
+}
+
+// setConfiguredCounterDeltaStrategies replaces strategies selected by configuration
+func (m *MalachiteMetricsFetcher) setConfiguredCounterDeltaStrategies(strategies map[string]CounterDeltaStrategy) {
+	m.counterDeltaLock.Lock()
+	defer m.counterDeltaLock.Unlock()
+	m.configuredCounterDeltaStrategies = strategies
+}
+
+// counterDelta calculates the delta of the counter with the strategy of the derived metric
+func (m *MalachiteMetricsFetcher) counterDelta(metricName string, previous, current uint64) uint64 {
+	m.counterDeltaLock.RLock()
+	strategy, ok := m.counterDeltaStrategies[metricName]
+	if !ok {
+		strategy, ok = m.configuredCounterDeltaStrategies[metricName]
+	}
+	m.counterDeltaLock.RUnlock()
+
+	if !ok {
+		return uint64CounterDelta(previous, current)
+	}
+	return strategy.Delta(previous, current)
+}
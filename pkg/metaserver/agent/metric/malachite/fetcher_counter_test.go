@@ -0,0 +1,87 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package malachite
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kubewharf/katalyst-core/pkg/consts"
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/metric/malachite/types"
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/pod"
+	"github.com/kubewharf/katalyst-core/pkg/metrics"
+)
+
+func TestGetCounterDeltaStrategy(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		strategy string
+		previous uint64
+		current  uint64
+		want     uint64
+	}{
+		{strategy: CounterDeltaStrategySaturating, previous: 10, current: 30, want: 20},
+		{strategy: CounterDeltaStrategySaturating, previous: 30, current: 10, want: 0},
+		{strategy: CounterDeltaStrategyResetAsZero, previous: 10, current: 30, want: 20},
+		{strategy: CounterDeltaStrategyResetAsZero, previous: 30, current: 10, want: 10},
+		{strategy: CounterDeltaStrategyWrap48, previous: 10, current: 30, want: 20},
+		{strategy: CounterDeltaStrategyWrap48, previous: 1<<48 - 10, current: 10, want: 20},
+		{strategy: CounterDeltaStrategyWrap48, previous: 1 << 50, current: 10, want: 0},
+		{strategy: CounterDeltaStrategyWrap64, previous: 10, current: 30, want: 20},
+		{strategy: CounterDeltaStrategyWrap64, previous: math.MaxUint64 - 9, current: 10, want: 20},
+	}
+	for _, tt := range tests {
+		strategy, err := GetCounterDeltaStrategy(tt.strategy)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.want, strategy.Delta(tt.previous, tt.current), tt.strategy)
+	}
+
+	_, err := GetCounterDeltaStrategy("unknown")
+	assert.Error(t, err)
+}
+
+func TestMalachiteMetricsFetcher_SetCounterDeltaStrategy(t *testing.T) {
+	t.Parallel()
+
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+	// custom strategy doubles the delta, and it only applies to the metric declaring it
+	f.SetCounterDeltaStrategy(consts.MetricPageFaultRateContainer, CounterDeltaFunc(func(previous, current uint64) uint64 {
+		return 2 * (current - previous)
+	}))
+	assert.Equal(t, uint64(40), f.counterDelta(consts.MetricPageFaultRateContainer, 10, 30))
+	assert.Equal(t, uint64(20), f.counterDelta(consts.MetricMajorPageFaultRateContainer, 10, 30))
+
+	newV2 := func(updateTime int64, pgfault uint64) *types.MalachiteCgroupInfo {
+		return &types.MalachiteCgroupInfo{
+			CgroupType: "V2",
+			V2: &types.MalachiteCgroupV2Info{Memory: &types.MemoryCgDataV2{
+				MemStats: types.MemStats{Pgfault: pgfault}, UpdateTime: updateTime,
+			}},
+		}
+	}
+	f.processContainerMemoryData("pod1", "c1", newV2(100, 1000))
+	f.processContainerMemoryData("pod1", "c1", newV2(110, 2000))
+
+	data, err := f.GetContainerMetric("pod1", "c1", consts.MetricPageFaultRateContainer)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(200), data.Value)
+	assert.True(t, data.Time.Equal(time.Unix(110, 0)))
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package malachite
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// those are names of sources read in a sampling cycle
+const (
+	CycleSourceHealth        = "health"
+	CycleSourceSystemCompute = "system-compute"
+	CycleSourceSystemMemory  = "system-memory"
+	CycleSourceSystemIO      = "system-io"
+	CycleSourcePods          = "pods"
+	CycleSourcePodList       = "pod-list"
+
+	// CycleSourceCgroupPrefix is followed by the path of top level cgroups in their source names
+	CycleSourceCgroupPrefix = "cgroup:"
+)
+
+// CycleResult is the outcome of a sampling cycle, so that a supervising component can decide whether
+// to alert or retry. Sources not read in the cycle (e.g. all of them after malachite is found unhealthy)
+// are neither succeeded nor failed.
+type CycleResult struct {
+	// Skipped is set if the cycle is not run, since the previous cycle is still running or the fetcher is closed
+	Skipped bool
+
+	// SucceededSources are sorted names of sources read successfully
+	SucceededSources []string
+	// FailedSources maps names of failed sources to their errors
+	FailedSources map[string]error
+
+	// ContainersProcessed is the number of containers processed in the cycle, including those failed
+	ContainersProcessed int64
+
+	// Err aggregates errors of all failed sources in order of their names, and it's nil if no source failed
+	Err error
+}
+
+func newCycleResult() *CycleResult {
+	return &CycleResult{FailedSources: make(map[string]error)}
+}
+
+// recordSource records the outcome of reading the source
+func (r *CycleResult) recordSource(source string, err error) {
+	if err != nil {
+		r.FailedSources[source] = err
+		return
+	}
+	r.SucceededSources = append(r.SucceededSources, source)
+}
+
+// complete sorts the succeeded sources and aggregates errors of failed ones
+func (r *CycleResult) complete() {
+	sort.Strings(r.SucceededSources)
+
+	failed := make([]string, 0, len(r.FailedSources))
+	for source := range r.FailedSources {
+		failed = append(failed, source)
+	}
+	sort.Strings(failed)
+
+	errs := make([]error, 0, len(failed))
+	for _, source := range failed {
+		errs = append(errs, fmt.Errorf("source %v: %w", source, r.FailedSources[source]))
+	}
+	r.Err = utilerrors.NewAggregate(errs)
+}
+
+// SampleOnce runs a sampling cycle out of the sampling loop, and returns its outcome. The same as those
+// triggered by the loop, it's skipped if another cycle is running.
+func (m *MalachiteMetricsFetcher) SampleOnce(ctx context.Context) *CycleResult {
+	return m.sampleOnce(ctx)
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package malachite
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kubewharf/katalyst-core/pkg/config"
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/metric/malachite/client"
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/metric/malachite/types"
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/pod"
+	"github.com/kubewharf/katalyst-core/pkg/metrics"
+	"github.com/kubewharf/katalyst-core/pkg/util/cgroup/common"
+)
+
+func TestMalachiteMetricsFetcher_SampleOnce(t *testing.T) {
+	t.Parallel()
+
+	responses := map[string]interface{}{
+		"/compute": &types.MalachiteSystemComputeResponse{},
+		"/io":      &types.MalachiteSystemDiskIoResponse{},
+		"/cgroup": &types.MalachiteCgroupResponse{
+			Data: types.CgroupDataInner{CgroupType: "V2", SubSystemGroups: json.RawMessage("{}")},
+		},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rsp, ok := responses[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		data, _ := json.Marshal(rsp)
+		_, _ = w.Write(data)
+	}))
+	defer server.Close()
+
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, config.NewConfiguration()).(*MalachiteMetricsFetcher)
+	f.malachiteClient.SetURL(map[string]string{
+		client.SystemComputeResource: server.URL + "/compute",
+		client.SystemMemoryResource:  server.URL + "/memory",
+		client.SystemIOResource:      server.URL + "/io",
+		client.CgroupResource:        server.URL + "/cgroup",
+	})
+	f.getAllPodContainersStats = func(_ context.Context) (map[string]map[string]*types.MalachiteCgroupInfo, error) {
+		return map[string]map[string]*types.MalachiteCgroupInfo{
+			"pod1": {"c1": newTestCgroupInfoV2(100, 10), "c2": newTestCgroupInfoV2(100, 10)},
+		}, nil
+	}
+
+	result := f.SampleOnce(context.Background())
+	assert.False(t, result.Skipped)
+	assert.Equal(t, int64(2), result.ContainersProcessed)
+	assert.Equal(t, []string{
+		CycleSourceCgroupPrefix + f.conf.ReclaimRelativeRootCgroupPath,
+		CycleSourceCgroupPrefix + common.CgroupFsRootPathBestEffort,
+		CycleSourceCgroupPrefix + common.CgroupFsRootPathBurstable,
+		CycleSourceHealth,
+		CycleSourcePodList,
+		CycleSourcePods,
+		CycleSourceSystemCompute,
+		CycleSourceSystemIO,
+	}, result.SucceededSources)
+	assert.Len(t, result.FailedSources, 1)
+	assert.Error(t, result.FailedSources[CycleSourceSystemMemory])
+	assert.Error(t, result.Err)
+	assert.Contains(t, result.Err.Error(), "source "+CycleSourceSystemMemory)
+
+	// the cycle is skipped if another one is running
+	f.sampling = 1
+	assert.True(t, f.SampleOnce(context.Background()).Skipped)
+}
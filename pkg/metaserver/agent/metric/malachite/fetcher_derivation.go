@@ -0,0 +1,28 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package malachite
+
+// isDerivationDue returns true if the derived metric should be calculated in the running cycle, according
+// to its cycle interval in DerivedMetricCycleIntervals. Derivations with intervals are done in the first
+// cycle and every N cycles after it, and their last values are kept in the store in between.
+func (m *MalachiteMetricsFetcher) isDerivationDue(metricName string) bool {
+	interval := m.metricConf.DerivedMetricCycleIntervals[metricName]
+	if interval <= 1 {
+		return true
+	}
+	return m.derivationCycles%uint64(interval) == 0
+}
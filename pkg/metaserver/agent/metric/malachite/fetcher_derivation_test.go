@@ -0,0 +1,58 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package malachite
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kubewharf/katalyst-core/pkg/consts"
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/metric/malachite/types"
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/pod"
+	"github.com/kubewharf/katalyst-core/pkg/metrics"
+)
+
+func TestMalachiteMetricsFetcher_isDerivationDue(t *testing.T) {
+	t.Parallel()
+
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+	f.metricConf.DerivedMetricCycleIntervals = map[string]int{
+		consts.MetricSchedLatencyP99Container: 3,
+	}
+
+	newStats := func(cycle int) map[string]map[string]*types.MalachiteCgroupInfo {
+		cgStats := newTestCgroupInfoV2(int64(100+cycle), 0)
+		// all samples fall in the bucket whose bound is changed in each cycle
+		cgStats.V2.Cpu.SchedLatency = []types.SchedLatencyBucket{{UpperBoundNs: uint64(1000 * (cycle + 1)), Count: 10}}
+		return map[string]map[string]*types.MalachiteCgroupInfo{"pod1": {"container1": cgStats}}
+	}
+
+	for cycle, wantP99 := range []float64{1000, 1000, 1000, 4000, 4000, 4000, 7000} {
+		f.processPodsContainersStats(newStats(cycle))
+		assert.NoError(t, f.GetContainerLastError("pod1", "container1"))
+
+		// metrics without interval are calculated in each cycle
+		data, err := f.GetContainerMetric("pod1", "container1", consts.MetricSchedLatencyP50Container)
+		assert.NoError(t, err)
+		assert.Equal(t, float64(1000*(cycle+1)), data.Value, "cycle %v", cycle)
+
+		data, err = f.GetContainerMetric("pod1", "container1", consts.MetricSchedLatencyP99Container)
+		assert.NoError(t, err)
+		assert.Equal(t, wantP99, data.Value, "cycle %v", cycle)
+	}
+}
@@ -0,0 +1,161 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package malachite
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	globalconfig "github.com/kubewharf/katalyst-core/pkg/config/agent/global"
+	"github.com/kubewharf/katalyst-core/pkg/consts"
+	utilmetric "github.com/kubewharf/katalyst-core/pkg/util/metric"
+)
+
+// runLineExport serves the unix socket to export all metrics in line protocol until ctx is done,
+// and each connection receives a consistent snapshot of metric store before it's closed.
+func (m *MalachiteMetricsFetcher) runLineExport(ctx context.Context) {
+	socketPath := m.metricConf.MetricExportSocketPath
+	if socketPath == "" {
+		return
+	}
+
+	// the socket file may be left by the last process
+	if err := os.Remove(socketPath); err != nil && !os.IsNotExist(err) {
+		klog.Errorf("[malachite] remove stale metric export socket %v failed: %v", socketPath, err)
+		return
+	}
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		klog.Errorf("[malachite] listen metric export socket %v failed: %v", socketPath, err)
+		return
+	}
+
+	go func() {
+		<-ctx.Done()
+		_ = listener.Close()
+	}()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if ctx.Err() == nil {
+					klog.Errorf("[malachite] accept on metric export socket %v failed: %v", socketPath, err)
+				}
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+				snapshot := m.metricStore.Snapshot()
+				addMemBandwidthHistogram(snapshot, m.getMetricConf(), time.Now())
+				if err := writeMetricLines(conn, snapshot, m.GetNodePool()); err != nil {
+					klog.Warningf("[malachite] export metrics to socket %v failed: %v", socketPath, err)
+				}
+			}()
+		}
+	}()
+	klog.Infof("[malachite] metrics are exported on socket %v", socketPath)
+}
+
+// writeMetricLines writes each metric in the snapshot as a "key value timestamp" line sorted by keys,
+// where timestamp is the unix seconds of the collecting time, and it's 0 if the time is unknown. The
+// pool of node is appended to each line as "node_pool=<pool>" if it's resolved.
+func writeMetricLines(w io.Writer, snapshot *utilmetric.MetricStoreSnapshot, pool string) error {
+	var suffix string
+	if pool != "" {
+		suffix = fmt.Sprintf(" %s=%s", metricTagKeyNodePool, pool)
+	}
+
+	var lines []string
+	snapshot.ForEach(func(key utilmetric.MetricKey, data utilmetric.MetricData) {
+		var timestamp int64
+		if data.Time != nil {
+			timestamp = data.Time.Unix()
+		}
+		lines = append(lines, fmt.Sprintf("%s %s %d%s", key.String(), strconv.FormatFloat(data.Value, 'g', -1, 64), timestamp, suffix))
+	})
+	sort.Strings(lines)
+
+	bw := bufio.NewWriter(w)
+	for _, line := range lines {
+		if _, err := bw.WriteString(line + "\n"); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// addMemBandwidthHistogram adds the cumulative buckets, sum and count of total (read and write) memory bandwidth of
+// containers with fresh bandwidth into node metrics of the snapshot in the Prometheus histogram style, i.e.
+// <name>_bucket{le="<bound>"}, and nothing is added if no buckets are configured.
+func addMemBandwidthHistogram(snapshot *utilmetric.MetricStoreSnapshot, conf *globalconfig.MetricConfiguration, now time.Time) {
+	bounds := conf.MemBandwidthHistogramBuckets
+	if len(bounds) == 0 {
+		return
+	}
+
+	prefix := conf.MetricNamePrefix
+	counts := make([]int, len(bounds))
+	var sum float64
+	var total int
+	for _, containers := range snapshot.PodContainerMetrics {
+		for _, metrics := range containers {
+			var bandwidth float64
+			fresh := false
+			for _, name := range []string{consts.MetricMemBandwidthReadContainer, consts.MetricMemBandwidthWriteContainer} {
+				data, ok := metrics[prefix+name]
+				if !ok || data.Time == nil || now.Sub(*data.Time) > derivedMetricFreshness {
+					continue
+				}
+				bandwidth += data.Value
+				fresh = true
+			}
+			if !fresh {
+				continue
+			}
+
+			for i, bound := range bounds {
+				if bandwidth <= bound {
+					counts[i]++
+				}
+			}
+			sum += bandwidth
+			total++
+		}
+	}
+
+	if snapshot.NodeMetrics == nil {
+		snapshot.NodeMetrics = make(map[string]utilmetric.MetricData)
+	}
+	name := prefix + consts.MetricMemBandwidthHistogramNode
+	for i, bound := range bounds {
+		snapshot.NodeMetrics[fmt.Sprintf("%s_bucket{le=%q}", name, strconv.FormatFloat(bound, 'g', -1, 64))] =
+			utilmetric.MetricData{Value: float64(counts[i]), Time: &now}
+	}
+	snapshot.NodeMetrics[name+`_bucket{le="+Inf"}`] = utilmetric.MetricData{Value: float64(total), Time: &now}
+	snapshot.NodeMetrics[name+"_sum"] = utilmetric.MetricData{Value: sum, Time: &now}
+	snapshot.NodeMetrics[name+"_count"] = utilmetric.MetricData{Value: float64(total), Time: &now}
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package malachite
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kubewharf/katalyst-core/pkg/config"
+	"github.com/kubewharf/katalyst-core/pkg/consts"
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/pod"
+	"github.com/kubewharf/katalyst-core/pkg/metrics"
+	utilmetric "github.com/kubewharf/katalyst-core/pkg/util/metric"
+)
+
+func TestMalachiteMetricsFetcher_runLineExport(t *testing.T) {
+	t.Parallel()
+
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+	f.metricConf.MetricExportSocketPath = filepath.Join(t.TempDir(), "metric.sock")
+
+	updateTime := time.Unix(100, 0)
+	f.metricStore.SetNodeMetric(consts.MetricMemAvailableSystem, utilmetric.MetricData{Value: 0.5, Time: &updateTime})
+	f.metricStore.SetNumaMetric(1, consts.MetricMemBandwidthNuma, utilmetric.MetricData{Value: 10, Time: &updateTime})
+	f.metricStore.SetContainerMetric("pod1", "c1", consts.MetricMemBandwidthReadContainer, utilmetric.MetricData{Value: 2.25})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	f.runLineExport(ctx)
+
+	conn, err := net.Dial("unix", f.metricConf.MetricExportSocketPath)
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	got := make(map[string][2]string)
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		assert.Len(t, fields, 3)
+		_, err := strconv.ParseFloat(fields[1], 64)
+		assert.NoError(t, err)
+		got[fields[0]] = [2]string{fields[1], fields[2]}
+	}
+	assert.NoError(t, scanner.Err())
+	assert.Equal(t, map[string][2]string{
+		"node/" + consts.MetricMemAvailableSystem:                     {"0.5", "100"},
+		"numa/1/" + consts.MetricMemBandwidthNuma:                     {"10", "100"},
+		"container/pod1/c1/" + consts.MetricMemBandwidthReadContainer: {"2.25", "0"},
+	}, got)
+}
+
+func TestAddMemBandwidthHistogram(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	stale := now.Add(-2 * derivedMetricFreshness)
+	store := utilmetric.NewMetricStore()
+	for i, bandwidth := range []float64{50, 100, 500, 2000} {
+		pod := "pod" + strconv.Itoa(i)
+		store.SetContainerMetric(pod, "c", consts.MetricMemBandwidthReadContainer, utilmetric.MetricData{Value: bandwidth / 2, Time: &now})
+		store.SetContainerMetric(pod, "c", consts.MetricMemBandwidthWriteContainer, utilmetric.MetricData{Value: bandwidth / 2, Time: &now})
+	}
+	// stale containers are not counted
+	store.SetContainerMetric("pod-stale", "c", consts.MetricMemBandwidthReadContainer, utilmetric.MetricData{Value: 10, Time: &stale})
+
+	conf := config.NewConfiguration()
+	snapshot := store.Snapshot()
+	addMemBandwidthHistogram(snapshot, conf.MetricConfiguration, now)
+	assert.Empty(t, snapshot.NodeMetrics)
+
+	conf.MemBandwidthHistogramBuckets = []float64{100, 1000}
+	addMemBandwidthHistogram(snapshot, conf.MetricConfiguration, now)
+
+	name := consts.MetricMemBandwidthHistogramNode
+	got := make(map[string]float64)
+	for key, data := range snapshot.NodeMetrics {
+		got[key] = data.Value
+	}
+	assert.Equal(t, map[string]float64{
+		name + `_bucket{le="100"}`:  2,
+		name + `_bucket{le="1000"}`: 3,
+		name + `_bucket{le="+Inf"}`: 4,
+		name + "_sum":               2650,
+		name + "_count":             4,
+	}, got)
+
+	var buf bytes.Buffer
+	assert.NoError(t, writeMetricLines(&buf, snapshot, ""))
+	assert.Contains(t, buf.String(), "node/"+name+`_bucket{le="1000"} 3 `+strconv.FormatInt(now.Unix(), 10)+"\n")
+
+	buf.Reset()
+	assert.NoError(t, writeMetricLines(&buf, snapshot, "pool-a"))
+	assert.Contains(t, buf.String(), "node/"+name+`_bucket{le="1000"} 3 `+strconv.FormatInt(now.Unix(), 10)+" node_pool=pool-a\n")
+}
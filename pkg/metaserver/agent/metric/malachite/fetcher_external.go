@@ -0,0 +1,65 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package malachite
+
+import (
+	"fmt"
+	"time"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/metric"
+	"github.com/kubewharf/katalyst-core/pkg/metrics"
+	utilmetric "github.com/kubewharf/katalyst-core/pkg/util/metric"
+)
+
+// IngestContainerMetrics sets per-container metrics pushed by the external provider into the store of
+// built-in metrics. Unlike RegisterExternalMetric, it's called by the provider at its own pace rather
+// than in sampling cycles, and ingested metrics are GC'd with the pod as built-in ones. Samples are merged
+// with the provider as their source, so a sample older than the stored one is ignored.
+func (m *MalachiteMetricsFetcher) IngestContainerMetrics(provider string, samples []metric.ExternalContainerMetric) error {
+	if provider == "" {
+		return fmt.Errorf("provider of external metrics must be set")
+	}
+
+	var errs []error
+	ingested := int64(0)
+	now := time.Now()
+	samplesStore := utilmetric.NewMetricStore()
+	for _, sample := range samples {
+		if err := sample.Validate(); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		t := sample.Time
+		if t.IsZero() {
+			t = now
+		}
+		samplesStore.SetContainerMetric(sample.PodUID, sample.ContainerName, sample.MetricName,
+			utilmetric.MetricData{Value: sample.Value, Time: &t})
+		ingested++
+	}
+	m.metricStore.MergeMetrics(provider, samplesStore)
+
+	_ = m.emitter.StoreInt64(metricsNameMalachiteExternalIngested, ingested, metrics.MetricTypeNameCount,
+		metrics.MetricTag{Key: "provider", Val: provider})
+	if len(errs) > 0 {
+		return fmt.Errorf("ingest metrics from %v: %w", provider, utilerrors.NewAggregate(errs))
+	}
+	return nil
+}
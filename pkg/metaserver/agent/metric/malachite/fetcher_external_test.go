@@ -0,0 +1,68 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package malachite
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/metric"
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/pod"
+	utilmetric "github.com/kubewharf/katalyst-core/pkg/util/metric"
+)
+
+func TestMalachiteMetricsFetcher_IngestContainerMetrics(t *testing.T) {
+	t.Parallel()
+
+	emitter := newCountingEmitter()
+	f := NewMalachiteMetricsFetcher(emitter, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+
+	sampled := time.Now().Add(-time.Second).Truncate(time.Second)
+	err := f.IngestContainerMetrics("dcgm", []metric.ExternalContainerMetric{
+		{PodUID: "pod1", ContainerName: "c1", MetricName: "gpu.utilization.container", Value: 0.8, Time: sampled},
+		{PodUID: "pod1", ContainerName: "c2", MetricName: "gpu.utilization.container", Value: 0.3},
+		{PodUID: "pod1", MetricName: "gpu.utilization.container", Value: 1},
+	})
+	assert.Error(t, err)
+	assert.Equal(t, int64(2), emitter.count(metricsNameMalachiteExternalIngested))
+
+	data, err := f.GetContainerMetric("pod1", "c1", "gpu.utilization.container")
+	assert.NoError(t, err)
+	assert.Equal(t, 0.8, data.Value)
+	assert.Equal(t, sampled, *data.Time)
+
+	podMetrics := f.GetPodContainerMetrics("pod1", "gpu.utilization.container", 0)
+	assert.Len(t, podMetrics, 2)
+	assert.Equal(t, 0.3, podMetrics["c2"].Value)
+	assert.NotNil(t, podMetrics["c2"].Time)
+
+	// ingested metrics are tagged with the provider, and older samples don't overwrite newer ones
+	key := utilmetric.MetricKey{Scope: utilmetric.MetricChangeScopeContainer, PodUID: "pod1", ContainerName: "c1",
+		MetricName: "gpu.utilization.container"}
+	assert.Equal(t, "dcgm", f.metricStore.GetMetricSource(key))
+	assert.NoError(t, f.IngestContainerMetrics("other", []metric.ExternalContainerMetric{
+		{PodUID: "pod1", ContainerName: "c1", MetricName: "gpu.utilization.container", Value: 0.1, Time: sampled.Add(-time.Second)},
+	}))
+	data, err = f.GetContainerMetric("pod1", "c1", "gpu.utilization.container")
+	assert.NoError(t, err)
+	assert.Equal(t, 0.8, data.Value)
+	assert.Equal(t, "dcgm", f.metricStore.GetMetricSource(key))
+
+	assert.Error(t, f.IngestContainerMetrics("", nil))
+}
@@ -0,0 +1,170 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package malachite
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+)
+
+const (
+	ServingContainerMetricsPath = "/metrics/container"
+	ServingMetricConfigPath     = "/metrics/config"
+	// ServingDebugCapturePath requires both ContainerMetricsParamPod and ContainerMetricsParamContainer
+	ServingDebugCapturePath = "/metrics/debug/capture"
+)
+
+// those are query parameters of ServingContainerMetricsPath, and all of them are optional
+const (
+	ContainerMetricsParamPod       = "pod"
+	ContainerMetricsParamContainer = "container"
+	// ContainerMetricsParamName can be repeated to query several metrics
+	ContainerMetricsParamName = "name"
+	// ContainerMetricsParamMaxAge skips metrics updated before it (i.e. 30s) ago
+	ContainerMetricsParamMaxAge = "maxAge"
+)
+
+// ContainerMetricEntry is a container metric returned by ServingContainerMetricsPath
+type ContainerMetricEntry struct {
+	PodUID        string     `json:"podUID"`
+	ContainerName string     `json:"containerName"`
+	MetricName    string     `json:"metricName"`
+	Value         float64    `json:"value"`
+	Timestamp     *time.Time `json:"timestamp,omitempty"`
+}
+
+// Serve adds the handlers to query container metrics, the active metric configuration and debug captures in json for
+// debugging, which are aimed at humans rather than scrapers, and the filters not given in query match all.
+// katalyst-agent adds them to its generic endpoint.
+func (m *MalachiteMetricsFetcher) Serve(mux *http.ServeMux) {
+	mux.HandleFunc(ServingContainerMetricsPath, m.handleContainerMetrics)
+	mux.HandleFunc(ServingMetricConfigPath, m.handleMetricConfig)
+	mux.HandleFunc(ServingDebugCapturePath, m.handleDebugCapture)
+}
+
+func (m *MalachiteMetricsFetcher) handleMetricConfig(w http.ResponseWriter, r *http.Request) {
+	if r == nil || r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = fmt.Fprintf(w, "Request must be GET")
+		return
+	}
+
+	bytes, err := json.Marshal(m.getMetricConf())
+	if err != nil {
+		klog.Errorf("[malachite] marshal metric configuration err: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = fmt.Fprintf(w, "Marshal metric configuration error: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(bytes)
+}
+
+func (m *MalachiteMetricsFetcher) handleContainerMetrics(w http.ResponseWriter, r *http.Request) {
+	if r == nil || r.Method != http.MethodGet || r.URL == nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = fmt.Fprintf(w, "Request must be GET with Query URL")
+		return
+	}
+
+	query := r.URL.Query()
+	podUID := strings.TrimSpace(query.Get(ContainerMetricsParamPod))
+	containerName := strings.TrimSpace(query.Get(ContainerMetricsParamContainer))
+	metricNames := sets.NewString()
+	for _, name := range query[ContainerMetricsParamName] {
+		if name = strings.TrimSpace(name); name != "" {
+			metricNames.Insert(name)
+		}
+	}
+
+	var maxAge time.Duration
+	if s := strings.TrimSpace(query.Get(ContainerMetricsParamMaxAge)); s != "" {
+		var err error
+		if maxAge, err = time.ParseDuration(s); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = fmt.Fprintf(w, "invalid %v %q: %v", ContainerMetricsParamMaxAge, s, err)
+			return
+		}
+	}
+
+	bytes, err := json.Marshal(m.queryContainerMetrics(podUID, containerName, metricNames, maxAge))
+	if err != nil {
+		klog.Errorf("[malachite] marshal container metrics err: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = fmt.Fprintf(w, "Marshal container metrics error: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(bytes)
+}
+
+// queryContainerMetrics returns container metrics matching the filters (empty matches all) ordered by
+// pod, container and metric name, and they are read by GetContainerMetrics with the same freshness check.
+func (m *MalachiteMetricsFetcher) queryContainerMetrics(podUID, containerName string, metricNames sets.String, maxAge time.Duration) []ContainerMetricEntry {
+	prefix := m.getMetricConf().MetricNamePrefix
+	entries := make([]ContainerMetricEntry, 0)
+	for pod, containers := range m.metricStore.Snapshot().PodContainerMetrics {
+		if podUID != "" && pod != podUID {
+			continue
+		}
+
+		for container, metrics := range containers {
+			if containerName != "" && container != containerName {
+				continue
+			}
+
+			names := metricNames.List()
+			if len(names) == 0 {
+				for name := range metrics {
+					// metrics are read without the prefix as other readers do
+					names = append(names, strings.TrimPrefix(name, prefix))
+				}
+			}
+
+			for name, data := range m.metricStore.GetContainerMetrics(pod, container, names, maxAge) {
+				entries = append(entries, ContainerMetricEntry{
+					PodUID:        pod,
+					ContainerName: container,
+					MetricName:    name,
+					Value:         data.Value,
+					Timestamp:     data.Time,
+				})
+			}
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].PodUID != entries[j].PodUID {
+			return entries[i].PodUID < entries[j].PodUID
+		} else if entries[i].ContainerName != entries[j].ContainerName {
+			return entries[i].ContainerName < entries[j].ContainerName
+		}
+		return entries[i].MetricName < entries[j].MetricName
+	})
+	return entries
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package malachite
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/pod"
+	"github.com/kubewharf/katalyst-core/pkg/metrics"
+	utilmetric "github.com/kubewharf/katalyst-core/pkg/util/metric"
+)
+
+func TestMalachiteMetricsFetcher_handleContainerMetrics(t *testing.T) {
+	t.Parallel()
+
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+	mux := http.NewServeMux()
+	f.Serve(mux)
+
+	now := time.Now()
+	stale := now.Add(-time.Hour)
+	f.metricStore.SetContainerMetric("pod1", "c1", "cpu.usage.container", utilmetric.MetricData{Value: 1, Time: &now})
+	f.metricStore.SetContainerMetric("pod1", "c1", "mem.usage.container", utilmetric.MetricData{Value: 2, Time: &stale})
+	f.metricStore.SetContainerMetric("pod1", "c2", "cpu.usage.container", utilmetric.MetricData{Value: 3, Time: &now})
+	f.metricStore.SetContainerMetric("pod2", "c1", "cpu.usage.container", utilmetric.MetricData{Value: 4, Time: &now})
+
+	query := func(rawQuery string) (int, []float64) {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, ServingContainerMetricsPath+"?"+rawQuery, nil))
+		if rec.Code != http.StatusOK {
+			return rec.Code, nil
+		}
+
+		var entries []ContainerMetricEntry
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &entries))
+		values := make([]float64, 0, len(entries))
+		for _, entry := range entries {
+			values = append(values, entry.Value)
+		}
+		return rec.Code, values
+	}
+
+	for _, tt := range []struct {
+		name     string
+		query    string
+		wantCode int
+		want     []float64
+	}{
+		{name: "all", query: "", wantCode: http.StatusOK, want: []float64{1, 2, 3, 4}},
+		{name: "pod", query: "pod=pod1", wantCode: http.StatusOK, want: []float64{1, 2, 3}},
+		{name: "pod and container", query: "pod=pod1&container=c1", wantCode: http.StatusOK, want: []float64{1, 2}},
+		{name: "container across pods", query: "container=c1&name=cpu.usage.container", wantCode: http.StatusOK, want: []float64{1, 4}},
+		{name: "several names", query: "pod=pod1&container=c1&name=cpu.usage.container&name=mem.usage.container", wantCode: http.StatusOK, want: []float64{1, 2}},
+		{name: "fresh only", query: "pod=pod1&maxAge=1m", wantCode: http.StatusOK, want: []float64{1, 3}},
+		{name: "no match", query: "pod=pod3", wantCode: http.StatusOK, want: []float64{}},
+		{name: "invalid max age", query: "maxAge=abc", wantCode: http.StatusBadRequest},
+	} {
+		code, values := query(tt.query)
+		assert.Equal(t, tt.wantCode, code, tt.name)
+		if tt.wantCode == http.StatusOK {
+			assert.Equal(t, tt.want, values, tt.name)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, ServingContainerMetricsPath, nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
@@ -0,0 +1,162 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package malachite
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/kubewharf/katalyst-core/pkg/consts"
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/metric/malachite/types"
+	"github.com/kubewharf/katalyst-core/pkg/util/general"
+	utilmetric "github.com/kubewharf/katalyst-core/pkg/util/metric"
+)
+
+// ioMaxUnlimited is the value of io.max keys without limit
+const ioMaxUnlimited = "max"
+
+// ioMaxKeyMetrics maps keys of io.max to the limit metrics
+var ioMaxKeyMetrics = map[string]string{
+	"rbps":  consts.MetricIOLimitReadBpsContainer,
+	"wbps":  consts.MetricIOLimitWriteBpsContainer,
+	"riops": consts.MetricIOLimitReadIopsContainer,
+	"wiops": consts.MetricIOLimitWriteIopsContainer,
+}
+
+// processContainerIOLimits sets the io throttle of the container per device as gauges, and limits of devices
+// set in the last cycle but not reported any more are set to 0 (no limit), since their throttles are removed.
+func (m *MalachiteMetricsFetcher) processContainerIOLimits(podUID, containerName string, cgStats *types.MalachiteCgroupInfo) {
+	limits, updateTimeInSec, ok := getCgroupIOLimits(cgStats)
+	if !ok {
+		return
+	}
+
+	updateTime := time.Unix(updateTimeInSec, 0)
+	devices := sets.NewString()
+	for device, deviceLimits := range limits {
+		for metricName, limit := range deviceLimits {
+			m.metricStore.SetContainerMetric(podUID, containerName, ioLimitMetricName(metricName, device),
+				utilmetric.MetricData{Value: float64(limit), Time: &updateTime})
+		}
+		devices.Insert(device)
+	}
+
+	for _, device := range m.containerIOLimitDevices[podUID][containerName].Difference(devices).UnsortedList() {
+		for _, metricName := range ioMaxKeyMetrics {
+			m.metricStore.SetContainerMetric(podUID, containerName, ioLimitMetricName(metricName, device),
+				utilmetric.MetricData{Value: 0, Time: &updateTime})
+		}
+	}
+
+	if _, ok := m.containerIOLimitDevices[podUID]; !ok {
+		m.containerIOLimitDevices[podUID] = make(map[string]sets.String)
+	}
+	m.containerIOLimitDevices[podUID][containerName] = devices
+}
+
+// gcContainerIOLimitDevices removes devices with io limits of pods that are not existed any more
+func (m *MalachiteMetricsFetcher) gcContainerIOLimitDevices(podUIDSet map[string]bool) {
+	for podUID := range m.containerIOLimitDevices {
+		if !podUIDSet[podUID] {
+			delete(m.containerIOLimitDevices, podUID)
+		}
+	}
+}
+
+func ioLimitMetricName(metricName, device string) string {
+	return metricName + "." + device
+}
+
+// parseIOMax parses lines of io.max, and malformed lines are skipped
+func parseIOMax(lines []string) map[string]map[string]uint64 {
+	limits := make(map[string]map[string]uint64)
+	for _, line := range lines {
+		device, deviceLimits, err := parseIOMaxLine(line)
+		if err != nil {
+			general.InfofV(4, "skip io.max line %q: %v", line, err)
+			continue
+		}
+		limits[device] = deviceLimits
+	}
+	return limits
+}
+
+// parseIOMaxLine parses a line of io.max, e.g. "8:16 rbps=2097152 wbps=max riops=max wiops=120", and all
+// limit metrics are returned for the device, with 0 for those set to max or not present in the line.
+func parseIOMaxLine(line string) (string, map[string]uint64, error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return "", nil, fmt.Errorf("empty line")
+	}
+
+	limits := make(map[string]uint64, len(ioMaxKeyMetrics))
+	for _, metricName := range ioMaxKeyMetrics {
+		limits[metricName] = 0
+	}
+	for _, field := range fields[1:] {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			return "", nil, fmt.Errorf("invalid field %q", field)
+		}
+
+		metricName, ok := ioMaxKeyMetrics[kv[0]]
+		if !ok || kv[1] == ioMaxUnlimited {
+			continue
+		}
+		limit, err := strconv.ParseUint(kv[1], 10, 64)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid value of %v: %v", kv[0], err)
+		}
+		limits[metricName] = limit
+	}
+	return fields[0], limits, nil
+}
+
+// parseBlkioThrottles parses lines of blkio.throttle.* files keyed by limit metrics, e.g. "8:16 1048576"
+// of blkio.throttle.read_bps_device, and malformed lines are skipped. Only devices with limits are listed
+// in those files, so limits absent for the device are returned as 0.
+func parseBlkioThrottles(throttles map[string][]string) map[string]map[string]uint64 {
+	limits := make(map[string]map[string]uint64)
+	for metricName, lines := range throttles {
+		for _, line := range lines {
+			fields := strings.Fields(line)
+			if len(fields) != 2 {
+				general.InfofV(4, "skip blkio throttle line %q of %v", line, metricName)
+				continue
+			}
+			limit, err := strconv.ParseUint(fields[1], 10, 64)
+			if err != nil {
+				general.InfofV(4, "skip blkio throttle line %q of %v: %v", line, metricName, err)
+				continue
+			}
+
+			device := fields[0]
+			if _, ok := limits[device]; !ok {
+				limits[device] = make(map[string]uint64, len(throttles))
+				for name := range throttles {
+					limits[device][name] = 0
+				}
+			}
+			limits[device][metricName] = limit
+		}
+	}
+	return limits
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package malachite
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kubewharf/katalyst-core/pkg/consts"
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/metric/malachite/types"
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/pod"
+	"github.com/kubewharf/katalyst-core/pkg/metrics"
+)
+
+func Test_parseIOMaxLine(t *testing.T) {
+	t.Parallel()
+
+	device, limits, err := parseIOMaxLine("8:16 rbps=2097152 wbps=max riops=max wiops=120")
+	assert.NoError(t, err)
+	assert.Equal(t, "8:16", device)
+	assert.Equal(t, map[string]uint64{
+		consts.MetricIOLimitReadBpsContainer:   2097152,
+		consts.MetricIOLimitWriteBpsContainer:  0,
+		consts.MetricIOLimitReadIopsContainer:  0,
+		consts.MetricIOLimitWriteIopsContainer: 120,
+	}, limits)
+
+	device, limits, err = parseIOMaxLine("253:0 rbps=max wbps=max riops=max wiops=max")
+	assert.NoError(t, err)
+	assert.Equal(t, "253:0", device)
+	for _, limit := range limits {
+		assert.Equal(t, uint64(0), limit)
+	}
+
+	_, _, err = parseIOMaxLine("8:16 rbps=fast")
+	assert.Error(t, err)
+}
+
+func TestMalachiteMetricsFetcher_processContainerIOLimits(t *testing.T) {
+	t.Parallel()
+
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+
+	cgStatsV2 := newTestCgroupInfoV2(100, 0)
+	cgStatsV2.V2.Blkio.IoMaxRaw = []string{"8:16 rbps=2097152 wbps=max riops=max wiops=120", "broken"}
+	f.processContainerIOLimits("pod1", "c1", cgStatsV2)
+
+	data, err := f.GetContainerMetric("pod1", "c1", ioLimitMetricName(consts.MetricIOLimitReadBpsContainer, "8:16"))
+	assert.NoError(t, err)
+	assert.Equal(t, float64(2097152), data.Value)
+	data, err = f.GetContainerMetric("pod1", "c1", ioLimitMetricName(consts.MetricIOLimitWriteBpsContainer, "8:16"))
+	assert.NoError(t, err)
+	assert.Equal(t, float64(0), data.Value)
+
+	// limits of devices whose throttles are removed are reset to no limit
+	cgStatsV2 = newTestCgroupInfoV2(100, 0)
+	cgStatsV2.V2.Blkio.IoMaxRaw = []string{"8:32 rbps=1024"}
+	f.processContainerIOLimits("pod1", "c1", cgStatsV2)
+	data, err = f.GetContainerMetric("pod1", "c1", ioLimitMetricName(consts.MetricIOLimitReadBpsContainer, "8:16"))
+	assert.NoError(t, err)
+	assert.Equal(t, float64(0), data.Value)
+	data, err = f.GetContainerMetric("pod1", "c1", ioLimitMetricName(consts.MetricIOLimitReadBpsContainer, "8:32"))
+	assert.NoError(t, err)
+	assert.Equal(t, float64(1024), data.Value)
+
+	cgStatsV1 := &types.MalachiteCgroupInfo{
+		CgroupType: "V1",
+		V1: &types.MalachiteCgroupV1Info{Blkio: &types.BlkIOCgDataV1{
+			ThrottleReadIopsDevice: []string{"8:0 500"},
+			UpdateTime:             100,
+		}},
+	}
+	f.processContainerIOLimits("pod1", "c2", cgStatsV1)
+	data, err = f.GetContainerMetric("pod1", "c2", ioLimitMetricName(consts.MetricIOLimitReadIopsContainer, "8:0"))
+	assert.NoError(t, err)
+	assert.Equal(t, float64(500), data.Value)
+	data, err = f.GetContainerMetric("pod1", "c2", ioLimitMetricName(consts.MetricIOLimitWriteBpsContainer, "8:0"))
+	assert.NoError(t, err)
+	assert.Equal(t, float64(0), data.Value)
+
+	// skipped if no throttle is reported
+	f.processContainerIOLimits("pod1", "c3", newTestCgroupInfoV2(100, 0))
+	_, err = f.GetContainerMetric("pod1", "c3", ioLimitMetricName(consts.MetricIOLimitReadBpsContainer, "8:16"))
+	assert.Error(t, err)
+}
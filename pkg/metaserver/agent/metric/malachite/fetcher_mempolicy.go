@@ -0,0 +1,97 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package malachite
+
+import (
+	"time"
+
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/metric/malachite/types"
+	"github.com/kubewharf/katalyst-core/pkg/util/general"
+	"github.com/kubewharf/katalyst-core/pkg/util/machine"
+)
+
+// ContainerMemPolicy is the numa memory policy of the container, which is kept as metadata
+// rather than metrics, to help interpret how memory bandwidth is split among numa nodes.
+type ContainerMemPolicy struct {
+	// Mode is the policy mode reported by malachite, i.e. bind, interleave or preferred
+	Mode string
+	// Nodes are the numa nodes in the node mask of the policy
+	Nodes      machine.CPUSet
+	UpdateTime time.Time
+}
+
+// processContainerMemPolicy records the memory policy of the container, and the previous one is removed
+// if it's not reported any more or fails to be parsed, so that a stale policy won't be mistaken as current.
+func (m *MalachiteMetricsFetcher) processContainerMemPolicy(podUID, containerName string, cgStats *types.MalachiteCgroupInfo) {
+	m.memPolicyLock.Lock()
+	defer m.memPolicyLock.Unlock()
+
+	policy, updateTimeInSec, ok := getCgroupMemPolicy(cgStats)
+	if !ok {
+		m.deleteContainerMemPolicy(podUID, containerName)
+		return
+	}
+
+	nodes, err := machine.Parse(policy.Nodes)
+	if err != nil {
+		general.Warningf("invalid node mask %q of memory policy for pod %v container %v: %v",
+			policy.Nodes, podUID, containerName, err)
+		m.deleteContainerMemPolicy(podUID, containerName)
+		return
+	}
+
+	if _, ok := m.containerMemPolicies[podUID]; !ok {
+		m.containerMemPolicies[podUID] = make(map[string]ContainerMemPolicy)
+	}
+	m.containerMemPolicies[podUID][containerName] = ContainerMemPolicy{
+		Mode:       policy.Mode,
+		Nodes:      nodes,
+		UpdateTime: time.Unix(updateTimeInSec, 0),
+	}
+}
+
+// deleteContainerMemPolicy removes the policy of the container, it must be called with lock held.
+func (m *MalachiteMetricsFetcher) deleteContainerMemPolicy(podUID, containerName string) {
+	if _, ok := m.containerMemPolicies[podUID]; ok {
+		delete(m.containerMemPolicies[podUID], containerName)
+		if len(m.containerMemPolicies[podUID]) == 0 {
+			delete(m.containerMemPolicies, podUID)
+		}
+	}
+}
+
+// gcContainerMemPolicies removes memory policies of pods that are not existed any more
+func (m *MalachiteMetricsFetcher) gcContainerMemPolicies(podUIDSet map[string]bool) {
+	m.memPolicyLock.Lock()
+	defer m.memPolicyLock.Unlock()
+
+	for podUID := range m.containerMemPolicies {
+		if !podUIDSet[podUID] {
+			delete(m.containerMemPolicies, podUID)
+		}
+	}
+}
+
+// GetContainerMemPolicy returns the numa memory policy of the container,
+// and false is returned if it's not reported by malachite.
+func (m *MalachiteMetricsFetcher) GetContainerMemPolicy(podUID, containerName string) (ContainerMemPolicy, bool) {
+	m.memPolicyLock.RLock()
+	defer m.memPolicyLock.RUnlock()
+
+	policy, ok := m.containerMemPolicies[podUID][containerName]
+	return policy, ok
+}
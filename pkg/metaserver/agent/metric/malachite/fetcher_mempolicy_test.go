@@ -0,0 +1,64 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package malachite
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/metric/malachite/types"
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/pod"
+	"github.com/kubewharf/katalyst-core/pkg/metrics"
+	"github.com/kubewharf/katalyst-core/pkg/util/machine"
+)
+
+func TestMalachiteMetricsFetcher_GetContainerMemPolicy(t *testing.T) {
+	t.Parallel()
+
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+
+	cgStats := newTestCgroupInfoV2(100, 0)
+	cgStats.V2.Memory.MemPolicy = &types.MemPolicy{Mode: "bind", Nodes: "0-1,3"}
+	cgStats.V2.Memory.UpdateTime = 100
+	f.processContainerMemPolicy("pod1", "c1", cgStats)
+
+	policy, ok := f.GetContainerMemPolicy("pod1", "c1")
+	assert.True(t, ok)
+	assert.Equal(t, "bind", policy.Mode)
+	assert.True(t, machine.NewCPUSet(0, 1, 3).Equals(policy.Nodes))
+	assert.Equal(t, time.Unix(100, 0), policy.UpdateTime)
+
+	// invalid node mask is skipped
+	cgStats.V2.Memory.MemPolicy = &types.MemPolicy{Mode: "bind", Nodes: "x"}
+	f.processContainerMemPolicy("pod1", "c2", cgStats)
+	_, ok = f.GetContainerMemPolicy("pod1", "c2")
+	assert.False(t, ok)
+
+	// the previous policy is dropped rather than kept as current if the new one is invalid
+	f.processContainerMemPolicy("pod1", "c1", cgStats)
+	_, ok = f.GetContainerMemPolicy("pod1", "c1")
+	assert.False(t, ok)
+	cgStats.V2.Memory.MemPolicy = &types.MemPolicy{Mode: "bind", Nodes: "0-1,3"}
+	f.processContainerMemPolicy("pod1", "c1", cgStats)
+
+	// the policy is removed once it's not reported
+	f.processContainerMemPolicy("pod1", "c1", newTestCgroupInfoV2(105, 0))
+	_, ok = f.GetContainerMemPolicy("pod1", "c1")
+	assert.False(t, ok)
+}
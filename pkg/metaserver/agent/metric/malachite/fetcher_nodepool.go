@@ -0,0 +1,131 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package malachite
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"k8s.io/klog/v2"
+
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/node"
+	"github.com/kubewharf/katalyst-core/pkg/metrics"
+)
+
+const metricTagKeyNodePool = "node_pool"
+
+// nodePoolEmitter tags all metrics emitted with the pool of this node once it's resolved,
+// and the pool is kept in atomic value since metrics may be emitted outside sampling loop.
+type nodePoolEmitter struct {
+	metrics.MetricEmitter
+	pool *atomic.Value
+}
+
+func newNodePoolEmitter(emitter metrics.MetricEmitter) *nodePoolEmitter {
+	e := &nodePoolEmitter{MetricEmitter: emitter, pool: &atomic.Value{}}
+	e.pool.Store("")
+	return e
+}
+
+func (e *nodePoolEmitter) StoreInt64(key string, val int64, emitType metrics.MetricTypeName, tags ...metrics.MetricTag) error {
+	return e.MetricEmitter.StoreInt64(key, val, emitType, e.withPoolTag(tags)...)
+}
+
+func (e *nodePoolEmitter) StoreFloat64(key string, val float64, emitType metrics.MetricTypeName, tags ...metrics.MetricTag) error {
+	return e.MetricEmitter.StoreFloat64(key, val, emitType, e.withPoolTag(tags)...)
+}
+
+// WithTags returns the emitter with common tags, which shares the pool with this one to be tagged
+// with the pool resolved later.
+func (e *nodePoolEmitter) WithTags(unit string, commonTags ...metrics.MetricTag) metrics.MetricEmitter {
+	return &nodePoolEmitter{MetricEmitter: e.MetricEmitter.WithTags(unit, commonTags...), pool: e.pool}
+}
+
+func (e *nodePoolEmitter) setPool(pool string) {
+	e.pool.Store(pool)
+}
+
+func (e *nodePoolEmitter) getPool() string {
+	return e.pool.Load().(string)
+}
+
+func (e *nodePoolEmitter) withPoolTag(tags []metrics.MetricTag) []metrics.MetricTag {
+	pool := e.getPool()
+	if pool == "" {
+		return tags
+	}
+	return append(append(make([]metrics.MetricTag, 0, len(tags)+1), tags...), metrics.MetricTag{Key: metricTagKeyNodePool, Val: pool})
+}
+
+// nodePoolMetricName returns the name of node-pool-tagged copy of the node metric
+func nodePoolMetricName(metricName, pool string) string {
+	return fmt.Sprintf("%s.pool.%s", metricName, pool)
+}
+
+// SetNodeFetcher sets the fetcher of node metadata to read the pool of this node from label
+// NodePoolLabelKey, and it should be called before Run.
+func (m *MalachiteMetricsFetcher) SetNodeFetcher(nodeFetcher node.NodeFetcher) {
+	m.nodeFetcher = nodeFetcher
+}
+
+// GetNodePool returns the pool of this node, and it's empty if the pool is not resolved.
+func (m *MalachiteMetricsFetcher) GetNodePool() string {
+	return m.emitter.getPool()
+}
+
+// resolveNodePool reads the pool of this node from node metadata if it's not configured, and
+// it's retried in following cycles until the node is fetched, even if the label is absent.
+func (m *MalachiteMetricsFetcher) resolveNodePool(ctx context.Context) {
+	if m.nodePoolResolved {
+		return
+	}
+
+	if m.metricConf.NodePool != "" {
+		m.emitter.setPool(m.metricConf.NodePool)
+		m.nodePoolResolved = true
+		return
+	}
+	if m.metricConf.NodePoolLabelKey == "" || m.nodeFetcher == nil {
+		m.nodePoolResolved = true
+		return
+	}
+
+	n, err := m.nodeFetcher.GetNode(ctx)
+	if err != nil {
+		klog.Errorf("[malachite] failed to get node to resolve pool: %v", err)
+		return
+	}
+	m.emitter.setPool(n.Labels[m.metricConf.NodePoolLabelKey])
+	m.nodePoolResolved = true
+}
+
+// processNodePoolMetrics stores node-pool-tagged copies of node metrics in NodePoolStoreMetrics
+func (m *MalachiteMetricsFetcher) processNodePoolMetrics() {
+	pool := m.GetNodePool()
+	if pool == "" {
+		return
+	}
+
+	for _, metricName := range m.metricConf.NodePoolStoreMetrics {
+		data, err := m.metricStore.GetNodeMetric(metricName)
+		if err != nil {
+			continue
+		}
+		m.metricStore.SetNodeMetric(nodePoolMetricName(metricName, pool), data)
+	}
+}
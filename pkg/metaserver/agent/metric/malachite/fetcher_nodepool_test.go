@@ -0,0 +1,144 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package malachite
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/kubewharf/katalyst-core/pkg/config"
+	"github.com/kubewharf/katalyst-core/pkg/consts"
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/pod"
+	"github.com/kubewharf/katalyst-core/pkg/metrics"
+	utilmetric "github.com/kubewharf/katalyst-core/pkg/util/metric"
+)
+
+// taggingEmitter records tags of the last emission of metrics by their names
+type taggingEmitter struct {
+	metrics.DummyMetrics
+
+	sync.Mutex
+	tags map[string][]metrics.MetricTag
+}
+
+func (e *taggingEmitter) StoreInt64(key string, _ int64, _ metrics.MetricTypeName, tags ...metrics.MetricTag) error {
+	e.Lock()
+	defer e.Unlock()
+	e.tags[key] = tags
+	return nil
+}
+
+func (e *taggingEmitter) WithTags(unit string, commonTags ...metrics.MetricTag) metrics.MetricEmitter {
+	return (&metrics.MetricTagWrapper{MetricEmitter: e}).WithTags(unit, commonTags...)
+}
+
+type nodeFetcherStub struct {
+	node *v1.Node
+	err  error
+}
+
+func (n *nodeFetcherStub) Run(_ context.Context) {}
+
+func (n *nodeFetcherStub) GetNode(_ context.Context) (*v1.Node, error) {
+	return n.node, n.err
+}
+
+func TestMalachiteMetricsFetcher_nodePool(t *testing.T) {
+	t.Parallel()
+
+	tagOf := func(tags []metrics.MetricTag, key string) (string, bool) {
+		for _, tag := range tags {
+			if tag.Key == key {
+				return tag.Val, true
+			}
+		}
+		return "", false
+	}
+
+	t.Run("from config", func(t *testing.T) {
+		t.Parallel()
+
+		e := &taggingEmitter{tags: make(map[string][]metrics.MetricTag)}
+		conf := config.NewConfiguration()
+		conf.NodePool = "pool-a"
+		conf.NodePoolStoreMetrics = []string{consts.MetricMemBandwidthTenantNode}
+		f := NewMalachiteMetricsFetcher(e, &pod.PodFetcherStub{}, conf).(*MalachiteMetricsFetcher)
+
+		f.resolveNodePool(context.Background())
+		assert.Equal(t, "pool-a", f.GetNodePool())
+
+		f.recordCgroupVersionSkipped("pod1", "c1", "V1")
+		pool, ok := tagOf(e.tags[metricsNameMalachiteCgroupVersionSkipped], metricTagKeyNodePool)
+		assert.True(t, ok)
+		assert.Equal(t, "pool-a", pool)
+		version, _ := tagOf(e.tags[metricsNameMalachiteCgroupVersionSkipped], "version")
+		assert.Equal(t, "V1", version)
+
+		now := time.Now()
+		f.metricStore.SetNodeMetric(consts.MetricMemBandwidthTenantNode, utilmetric.MetricData{Value: 10, Time: &now})
+		f.processNodePoolMetrics()
+		data, err := f.GetNodeMetric(consts.MetricMemBandwidthTenantNode + ".pool.pool-a")
+		assert.NoError(t, err)
+		assert.Equal(t, float64(10), data.Value)
+	})
+
+	t.Run("from node label", func(t *testing.T) {
+		t.Parallel()
+
+		e := &taggingEmitter{tags: make(map[string][]metrics.MetricTag)}
+		conf := config.NewConfiguration()
+		conf.NodePoolLabelKey = "pool"
+		f := NewMalachiteMetricsFetcher(e, &pod.PodFetcherStub{}, conf).(*MalachiteMetricsFetcher)
+		nodeFetcher := &nodeFetcherStub{err: fmt.Errorf("not ready")}
+		f.SetNodeFetcher(nodeFetcher)
+
+		// metrics are not tagged before the pool is resolved
+		derived := f.emitter.WithTags("malachite")
+		f.resolveNodePool(context.Background())
+		f.recordCgroupVersionSkipped("pod1", "c1", "V1")
+		_, ok := tagOf(e.tags[metricsNameMalachiteCgroupVersionSkipped], metricTagKeyNodePool)
+		assert.False(t, ok)
+
+		nodeFetcher.node = &v1.Node{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"pool": "pool-b"}}}
+		nodeFetcher.err = nil
+		f.resolveNodePool(context.Background())
+		f.recordCgroupVersionSkipped("pod1", "c1", "V1")
+		pool, ok := tagOf(e.tags[metricsNameMalachiteCgroupVersionSkipped], metricTagKeyNodePool)
+		assert.True(t, ok)
+		assert.Equal(t, "pool-b", pool)
+
+		// emitters derived with common tags are tagged with the pool resolved later as well
+		_ = derived.StoreInt64("derived", 1, metrics.MetricTypeNameRaw)
+		pool, ok = tagOf(e.tags["derived"], metricTagKeyNodePool)
+		assert.True(t, ok)
+		assert.Equal(t, "pool-b", pool)
+
+		// copies are not stored unless configured
+		now := time.Now()
+		f.metricStore.SetNodeMetric(consts.MetricMemBandwidthTenantNode, utilmetric.MetricData{Value: 10, Time: &now})
+		f.processNodePoolMetrics()
+		_, err := f.GetNodeMetric(consts.MetricMemBandwidthTenantNode + ".pool.pool-b")
+		assert.Error(t, err)
+	})
+}
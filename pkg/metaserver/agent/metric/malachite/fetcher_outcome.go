@@ -0,0 +1,103 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package malachite
+
+import (
+	"github.com/kubewharf/katalyst-core/pkg/metrics"
+)
+
+// DerivedMetricOutcome tells how the derivation of a container metric ended in a sampling cycle
+type DerivedMetricOutcome string
+
+const (
+	DerivedMetricOutcomeSucceeded = DerivedMetricOutcome("succeeded")
+	// DerivedMetricOutcomeZeroDelta means counters are not updated since the previous sample
+	DerivedMetricOutcomeZeroDelta = DerivedMetricOutcome("zero_delta")
+	// DerivedMetricOutcomeMissingCounter means there are no previous counters to diff against
+	DerivedMetricOutcomeMissingCounter = DerivedMetricOutcome("missing_counter")
+	// DerivedMetricOutcomeClamped means the metric is set, but with some of its inputs clamped
+	DerivedMetricOutcomeClamped = DerivedMetricOutcome("clamped")
+	// DerivedMetricOutcomeDropped means the sample is dropped for other reasons,
+	// i.e. container restarts, warm-up period or clock jumps
+	DerivedMetricOutcomeDropped = DerivedMetricOutcome("dropped")
+)
+
+// DerivedMetricOutcomeReport counts containers by outcome for each derived metric, map[metricName]map[outcome]count
+type DerivedMetricOutcomeReport map[string]map[DerivedMetricOutcome]int
+
+// startDerivedOutcomeCycle starts to collect outcomes of a new sampling cycle, and outcomes
+// of on-demand processing out of sampling cycles are not collected.
+func (m *MalachiteMetricsFetcher) startDerivedOutcomeCycle() {
+	m.derivedOutcomeLock.Lock()
+	defer m.derivedOutcomeLock.Unlock()
+	m.cycleDerivedOutcomes = make(map[containerMetricKey]DerivedMetricOutcome)
+}
+
+// recordDerivedOutcome records the outcome of the derived metric for the container, and only the
+// first outcome is kept in a cycle, since the following ones are recorded by the general rate path
+// after the specific ones (i.e. clamps) are recorded inside the derivation.
+func (m *MalachiteMetricsFetcher) recordDerivedOutcome(podUID, containerName, metricName string, outcome DerivedMetricOutcome) {
+	m.derivedOutcomeLock.Lock()
+	defer m.derivedOutcomeLock.Unlock()
+
+	if m.cycleDerivedOutcomes == nil {
+		return
+	}
+
+	key := containerMetricKey{podUID: podUID, containerName: containerName, metricName: metricName}
+	if _, ok := m.cycleDerivedOutcomes[key]; !ok {
+		m.cycleDerivedOutcomes[key] = outcome
+	}
+}
+
+// finishDerivedOutcomeCycle aggregates outcomes collected in the cycle into the report, and emits them
+func (m *MalachiteMetricsFetcher) finishDerivedOutcomeCycle() {
+	m.derivedOutcomeLock.Lock()
+	defer m.derivedOutcomeLock.Unlock()
+
+	report := make(DerivedMetricOutcomeReport)
+	for key, outcome := range m.cycleDerivedOutcomes {
+		if _, ok := report[key.metricName]; !ok {
+			report[key.metricName] = make(map[DerivedMetricOutcome]int)
+		}
+		report[key.metricName][outcome]++
+	}
+	m.cycleDerivedOutcomes = nil
+	m.derivedOutcomes = report
+
+	for metricName, outcomes := range report {
+		for outcome, count := range outcomes {
+			_ = m.emitter.StoreInt64(metricsNameMalachiteDerivedMetricOutcome, int64(count), metrics.MetricTypeNameRaw,
+				metrics.MetricTag{Key: "metric", Val: metricName}, metrics.MetricTag{Key: "outcome", Val: string(outcome)})
+		}
+	}
+}
+
+// GetDerivedMetricOutcomes returns the outcomes of derived container metrics in the last sampling cycle
+func (m *MalachiteMetricsFetcher) GetDerivedMetricOutcomes() DerivedMetricOutcomeReport {
+	m.derivedOutcomeLock.Lock()
+	defer m.derivedOutcomeLock.Unlock()
+
+	report := make(DerivedMetricOutcomeReport, len(m.derivedOutcomes))
+	for metricName, outcomes := range m.derivedOutcomes {
+		report[metricName] = make(map[DerivedMetricOutcome]int, len(outcomes))
+		for outcome, count := range outcomes {
+			report[metricName][outcome] = count
+		}
+	}
+	return report
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package malachite
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kubewharf/katalyst-core/pkg/consts"
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/metric/malachite/types"
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/pod"
+	"github.com/kubewharf/katalyst-core/pkg/metrics"
+)
+
+func TestMalachiteMetricsFetcher_GetDerivedMetricOutcomes(t *testing.T) {
+	t.Parallel()
+
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+	assert.Empty(t, f.GetDerivedMetricOutcomes())
+
+	withStores := func(cgStats *types.MalachiteCgroupInfo, storeAllIns, storeIns, imcWrites uint64) *types.MalachiteCgroupInfo {
+		cgStats.V2.Cpu.StoreAllInstructions = storeAllIns
+		cgStats.V2.Cpu.StoreInstructions = storeIns
+		cgStats.V2.Cpu.IMCWrites = imcWrites
+		return cgStats
+	}
+
+	f.processPodsContainersStats(map[string]map[string]*types.MalachiteCgroupInfo{
+		"pod1": {
+			"advanced": withStores(newTestCgroupInfoV2(100, 1<<20), 100, 50, 100),
+			"stale":    withStores(newTestCgroupInfoV2(100, 1<<20), 100, 50, 100),
+			"clamped":  withStores(newTestCgroupInfoV2(100, 1<<20), 100, 50, 100),
+		},
+	})
+	report := f.GetDerivedMetricOutcomes()
+	assert.Equal(t, 3, report[consts.MetricMemBandwidthReadContainer][DerivedMetricOutcomeMissingCounter])
+	assert.Equal(t, 3, report[consts.MetricMemBandwidthWriteContainer][DerivedMetricOutcomeMissingCounter])
+
+	f.processPodsContainersStats(map[string]map[string]*types.MalachiteCgroupInfo{
+		"pod1": {
+			"advanced": withStores(newTestCgroupInfoV2(105, 2<<20), 200, 100, 200),
+			"stale":    withStores(newTestCgroupInfoV2(100, 1<<20), 100, 50, 100),
+			// store instructions grow faster than all store instructions
+			"clamped": withStores(newTestCgroupInfoV2(105, 2<<20), 200, 250, 200),
+			"new":     withStores(newTestCgroupInfoV2(105, 1<<20), 100, 50, 100),
+		},
+	})
+	report = f.GetDerivedMetricOutcomes()
+	assert.Equal(t, map[DerivedMetricOutcome]int{
+		DerivedMetricOutcomeSucceeded:      2,
+		DerivedMetricOutcomeZeroDelta:      1,
+		DerivedMetricOutcomeMissingCounter: 1,
+	}, report[consts.MetricMemBandwidthReadContainer])
+	assert.Equal(t, map[DerivedMetricOutcome]int{
+		DerivedMetricOutcomeSucceeded:      1,
+		DerivedMetricOutcomeZeroDelta:      1,
+		DerivedMetricOutcomeMissingCounter: 1,
+		DerivedMetricOutcomeClamped:        1,
+	}, report[consts.MetricMemBandwidthWriteContainer])
+
+	// outcomes of on-demand processing are not collected into the report
+	assert.NoError(t, f.ProcessContainerStats("pod1", "advanced", newTestCgroupInfoV2(110, 3<<20)))
+	assert.Equal(t, report, f.GetDerivedMetricOutcomes())
+}
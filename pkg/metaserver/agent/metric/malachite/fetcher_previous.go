@@ -0,0 +1,68 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package malachite
+
+import (
+	"github.com/kubewharf/katalyst-core/pkg/consts"
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/metric/malachite/types"
+	utilmetric "github.com/kubewharf/katalyst-core/pkg/util/metric"
+)
+
+// previousCounterNames are the raw counters of the last cycle that memory bandwidth and cpu
+// derivations are diffed against, and they are snapshotted before any of them is overwritten
+var previousCounterNames = []string{
+	consts.MetricCPUUpdateTimeContainer,
+	consts.MetricCPUMonotonicTimeContainer,
+	consts.MetricCPUUpdateTimeNanoContainer,
+	consts.MetricCPUCyclesContainer,
+	consts.MetricCPUInstructionsContainer,
+	consts.MetricOCRReadDRAMsContainer,
+	consts.MetricIMCWriteContainer,
+	consts.MetricStoreAllInsContainer,
+	consts.MetricStoreInsContainer,
+}
+
+// snapshotPreviousCounters freezes the previous counters of all containers in the cycle before
+// any of them is processed, so that deltas are always calculated against the last cycle rather than
+// values written earlier in the same cycle, regardless of the order in which metrics are written.
+func (m *MalachiteMetricsFetcher) snapshotPreviousCounters(podsContainersStats map[string]map[string]*types.MalachiteCgroupInfo) {
+	snapshot := make(map[string]map[string]map[string]utilmetric.MetricData, len(podsContainersStats))
+	for podUID, containerStats := range podsContainersStats {
+		snapshot[podUID] = make(map[string]map[string]utilmetric.MetricData, len(containerStats))
+		for containerName := range containerStats {
+			snapshot[podUID][containerName] = m.metricStore.GetContainerMetrics(podUID, containerName, previousCounterNames, 0)
+		}
+	}
+	m.previousCounters = snapshot
+}
+
+// releasePreviousCounters drops the snapshot when the cycle finishes, after which
+// previous counters are read from the store directly, i.e. for on-demand processing
+func (m *MalachiteMetricsFetcher) releasePreviousCounters() {
+	m.previousCounters = nil
+}
+
+// getPreviousContainerCounter returns the counter of the container in the last cycle, and zero
+// value is returned if it doesn't exist, the same as the counter is never sampled before.
+func (m *MalachiteMetricsFetcher) getPreviousContainerCounter(podUID, containerName, metricName string) utilmetric.MetricData {
+	if counters, ok := m.previousCounters[podUID][containerName]; ok {
+		return counters[metricName]
+	}
+
+	data, _ := m.metricStore.GetContainerMetric(podUID, containerName, metricName)
+	return data
+}
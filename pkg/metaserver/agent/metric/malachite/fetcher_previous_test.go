@@ -0,0 +1,67 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package malachite
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kubewharf/katalyst-core/pkg/consts"
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/metric/malachite/types"
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/pod"
+	"github.com/kubewharf/katalyst-core/pkg/metrics"
+	utilmetric "github.com/kubewharf/katalyst-core/pkg/util/metric"
+)
+
+func TestMalachiteMetricsFetcher_snapshotPreviousCounters(t *testing.T) {
+	t.Parallel()
+
+	lastCycle := map[string]map[string]*types.MalachiteCgroupInfo{
+		"pod1": {"container1": newTestCgroupInfoV2(100, 1<<20)},
+	}
+	curCycle := map[string]map[string]*types.MalachiteCgroupInfo{
+		"pod1": {"container1": newTestCgroupInfoV2(105, 1<<20+5*(1<<20))},
+	}
+
+	ordered := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+	ordered.processPodsContainersStats(lastCycle)
+	ordered.processPodsContainersStats(curCycle)
+	expected, err := ordered.GetContainerMetric("pod1", "container1", consts.MetricMemBandwidthReadContainer)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(64), expected.Value)
+
+	// raw counters of current cycle are written before the derivation
+	reordered := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+	reordered.processPodsContainersStats(lastCycle)
+	reordered.snapshotPreviousCounters(curCycle)
+	updateTime := time.Unix(105, 0)
+	reordered.metricStore.SetContainerMetric("pod1", "container1", consts.MetricCPUUpdateTimeContainer,
+		utilmetric.MetricData{Value: 105, Time: &updateTime})
+	reordered.metricStore.SetContainerMetric("pod1", "container1", consts.MetricOCRReadDRAMsContainer,
+		utilmetric.MetricData{Value: 1<<20 + 5*(1<<20), Time: &updateTime})
+	assert.NoError(t, reordered.processContainerStats("pod1", "container1", curCycle["pod1"]["container1"]))
+	reordered.releasePreviousCounters()
+
+	actual, err := reordered.GetContainerMetric("pod1", "container1", consts.MetricMemBandwidthReadContainer)
+	assert.NoError(t, err)
+	assert.Equal(t, expected.Value, actual.Value)
+
+	// previous counters are read from the store out of the cycle
+	assert.Equal(t, float64(105), reordered.getPreviousContainerCounter("pod1", "container1", consts.MetricCPUUpdateTimeContainer).Value)
+}
@@ -0,0 +1,341 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package malachite
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+	"k8s.io/klog/v2"
+
+	"github.com/kubewharf/katalyst-core/pkg/metrics"
+	utilmetric "github.com/kubewharf/katalyst-core/pkg/util/metric"
+)
+
+const (
+	metricsNameMalachiteRemoteWriteDropped = "malachite_remote_write_dropped"
+	metricsNameMalachiteRemoteWriteFailed  = "malachite_remote_write_failed"
+
+	// remoteWriteTimeout is the timeout for each batch to be sent to the endpoint
+	remoteWriteTimeout = 10 * time.Second
+)
+
+// RemoteWritePayload is a batch of metrics in the same shape as WriteRequest of the Prometheus remote write
+// protocol (version 0.1.0), and it's sent as the snappy-compressed protobuf encoded by Marshal.
+type RemoteWritePayload struct {
+	Timeseries []RemoteWriteTimeseries
+}
+
+// RemoteWriteTimeseries is a series identified by its labels sorted by names, and the metric name
+// is given as the "__name__" label.
+type RemoteWriteTimeseries struct {
+	Labels  []RemoteWriteLabel
+	Samples []RemoteWriteSample
+}
+
+type RemoteWriteLabel struct {
+	Name  string
+	Value string
+}
+
+// RemoteWriteSample is the value of a series with the collecting time in unix milliseconds.
+type RemoteWriteSample struct {
+	Value     float64
+	Timestamp int64
+}
+
+// field numbers of the messages in prometheus/prompb, which are encoded directly since the
+// generated definitions are not vendored here.
+const (
+	remoteWriteFieldWriteRequestTimeseries = 1
+
+	remoteWriteFieldTimeseriesLabels  = 1
+	remoteWriteFieldTimeseriesSamples = 2
+
+	remoteWriteFieldLabelName  = 1
+	remoteWriteFieldLabelValue = 2
+
+	remoteWriteFieldSampleValue     = 1
+	remoteWriteFieldSampleTimestamp = 2
+)
+
+// Marshal encodes the payload as the protobuf of prompb.WriteRequest
+func (p *RemoteWritePayload) Marshal() []byte {
+	var b []byte
+	for _, series := range p.Timeseries {
+		var sb []byte
+		for _, label := range series.Labels {
+			var lb []byte
+			lb = protowire.AppendTag(lb, remoteWriteFieldLabelName, protowire.BytesType)
+			lb = protowire.AppendString(lb, label.Name)
+			lb = protowire.AppendTag(lb, remoteWriteFieldLabelValue, protowire.BytesType)
+			lb = protowire.AppendString(lb, label.Value)
+
+			sb = protowire.AppendTag(sb, remoteWriteFieldTimeseriesLabels, protowire.BytesType)
+			sb = protowire.AppendBytes(sb, lb)
+		}
+		for _, sample := range series.Samples {
+			var smb []byte
+			smb = protowire.AppendTag(smb, remoteWriteFieldSampleValue, protowire.Fixed64Type)
+			smb = protowire.AppendFixed64(smb, math.Float64bits(sample.Value))
+			smb = protowire.AppendTag(smb, remoteWriteFieldSampleTimestamp, protowire.VarintType)
+			smb = protowire.AppendVarint(smb, uint64(sample.Timestamp))
+
+			sb = protowire.AppendTag(sb, remoteWriteFieldTimeseriesSamples, protowire.BytesType)
+			sb = protowire.AppendBytes(sb, smb)
+		}
+
+		b = protowire.AppendTag(b, remoteWriteFieldWriteRequestTimeseries, protowire.BytesType)
+		b = protowire.AppendBytes(b, sb)
+	}
+	return b
+}
+
+// encodeRemoteWriteBatch encodes the payload as the body of a remote write request
+func encodeRemoteWriteBatch(payload *RemoteWritePayload) []byte {
+	return snappy.Encode(nil, payload.Marshal())
+}
+
+// remoteWriteQueue is a bounded queue of encoded batches, the oldest batch is dropped to make room
+// for a new one when it's full, so that the latest metrics are always sent first to a slow endpoint.
+type remoteWriteQueue struct {
+	mutex   sync.Mutex
+	size    int
+	batches [][]byte
+	// notify is signaled when a batch is pushed
+	notify chan struct{}
+}
+
+func newRemoteWriteQueue(size int) *remoteWriteQueue {
+	if size <= 0 {
+		size = 1
+	}
+	return &remoteWriteQueue{size: size, notify: make(chan struct{}, 1)}
+}
+
+// push appends the batch into the queue, and returns true if the oldest batch is dropped.
+func (q *remoteWriteQueue) push(batch []byte) bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	dropped := false
+	if len(q.batches) >= q.size {
+		q.batches = q.batches[1:]
+		dropped = true
+	}
+	q.batches = append(q.batches, batch)
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+	return dropped
+}
+
+// pop removes and returns the oldest batch, and it returns false if the queue is empty.
+func (q *remoteWriteQueue) pop() ([]byte, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if len(q.batches) == 0 {
+		return nil, false
+	}
+	batch := q.batches[0]
+	q.batches = q.batches[1:]
+	return batch, true
+}
+
+// runRemoteWrite builds a batch from the consistent snapshot of metric store every interval, and sends
+// batches to the configured endpoint in another goroutine until ctx is done, so that a slow endpoint
+// never blocks building batches.
+func (m *MalachiteMetricsFetcher) runRemoteWrite(ctx context.Context) {
+	url, interval := m.metricConf.MetricRemoteWriteURL, m.metricConf.MetricRemoteWriteInterval
+	if url == "" || interval <= 0 {
+		return
+	}
+
+	queue := newRemoteWriteQueue(m.metricConf.MetricRemoteWriteQueueSize)
+	nodeName := m.nodeName()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			now := time.Now()
+			snapshot := m.metricStore.Snapshot()
+			addMemBandwidthHistogram(snapshot, m.getMetricConf(), now)
+			batch := encodeRemoteWriteBatch(buildRemoteWritePayload(snapshot, nodeName, m.GetNodePool()))
+			if queue.push(batch) {
+				_ = m.emitter.StoreInt64(metricsNameMalachiteRemoteWriteDropped, 1, metrics.MetricTypeNameCount)
+			}
+		}
+	}()
+	go func() {
+		client := &http.Client{Timeout: remoteWriteTimeout}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-queue.notify:
+			}
+
+			for batch, ok := queue.pop(); ok && ctx.Err() == nil; batch, ok = queue.pop() {
+				if err := sendRemoteWrite(ctx, client, url, batch); err != nil {
+					klog.Warningf("[malachite] remote write to %v failed: %v", url, err)
+					_ = m.emitter.StoreInt64(metricsNameMalachiteRemoteWriteFailed, 1, metrics.MetricTypeNameCount)
+				}
+			}
+		}
+	}()
+	klog.Infof("[malachite] metrics are written to %v every %v", url, interval)
+}
+
+func sendRemoteWrite(ctx context.Context, client *http.Client, url string, batch []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(batch))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %v", resp.Status)
+	}
+	return nil
+}
+
+// nodeName returns the name of the node the agent runs on, and it's empty if not configured.
+func (m *MalachiteMetricsFetcher) nodeName() string {
+	if m.conf == nil || m.conf.AgentConfiguration == nil || m.conf.GenericAgentConfiguration == nil ||
+		m.conf.BaseConfiguration == nil {
+		return ""
+	}
+	return m.conf.NodeName
+}
+
+// buildRemoteWritePayload converts each metric in the snapshot into a series labeled with its scope and
+// identifiers (and the node and its pool if they are not empty), and metrics without collecting time are
+// skipped. Series are sorted by labels to keep the payload stable.
+func buildRemoteWritePayload(snapshot *utilmetric.MetricStoreSnapshot, nodeName, pool string) *RemoteWritePayload {
+	payload := &RemoteWritePayload{}
+	snapshot.ForEach(func(key utilmetric.MetricKey, data utilmetric.MetricData) {
+		if data.Time == nil {
+			return
+		}
+
+		name, labels := parseExportMetricName(key.MetricName)
+		labels["__name__"] = sanitizeRemoteWriteName(name)
+		labels["scope"] = key.Scope
+		if nodeName != "" {
+			labels["node"] = nodeName
+		}
+		if pool != "" {
+			labels[metricTagKeyNodePool] = pool
+		}
+		switch key.Scope {
+		case utilmetric.MetricChangeScopeNuma:
+			labels["numa"] = strconv.Itoa(key.NumaID)
+		case utilmetric.MetricChangeScopeDevice:
+			labels["device"] = key.DeviceName
+		case utilmetric.MetricChangeScopeCPU:
+			labels["cpu"] = strconv.Itoa(key.CPUID)
+		case utilmetric.MetricChangeScopeSocket:
+			labels["socket"] = strconv.Itoa(key.SocketID)
+		case utilmetric.MetricChangeScopeContainer:
+			labels["pod_uid"], labels["container"] = key.PodUID, key.ContainerName
+		case utilmetric.MetricChangeScopeContainerNuma:
+			labels["pod_uid"], labels["container"], labels["numa_node"] = key.PodUID, key.ContainerName, key.NumaNode
+		case utilmetric.MetricChangeScopeCgroup:
+			labels["cgroup_path"] = key.CgroupPath
+		case utilmetric.MetricChangeScopeCgroupNuma:
+			labels["cgroup_path"], labels["numa_node"] = key.CgroupPath, key.NumaNode
+		}
+
+		series := RemoteWriteTimeseries{
+			Samples: []RemoteWriteSample{{Value: data.Value, Timestamp: data.Time.UnixNano() / int64(time.Millisecond)}},
+		}
+		for labelName, labelValue := range labels {
+			series.Labels = append(series.Labels, RemoteWriteLabel{Name: labelName, Value: labelValue})
+		}
+		sort.Slice(series.Labels, func(i, j int) bool { return series.Labels[i].Name < series.Labels[j].Name })
+		payload.Timeseries = append(payload.Timeseries, series)
+	})
+
+	sort.Slice(payload.Timeseries, func(i, j int) bool {
+		return remoteWriteSeriesID(payload.Timeseries[i]) < remoteWriteSeriesID(payload.Timeseries[j])
+	})
+	return payload
+}
+
+// parseExportMetricName splits labels off the metric name added on export, i.e. `<name>_bucket{le="10"}`.
+func parseExportMetricName(metricName string) (string, map[string]string) {
+	labels := make(map[string]string)
+	i := strings.Index(metricName, "{")
+	if i < 0 || !strings.HasSuffix(metricName, "}") {
+		return metricName, labels
+	}
+
+	for _, pair := range strings.Split(metricName[i+1:len(metricName)-1], ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		if value, err := strconv.Unquote(kv[1]); err == nil {
+			labels[kv[0]] = value
+		}
+	}
+	return metricName[:i], labels
+}
+
+// sanitizeRemoteWriteName replaces characters not allowed in metric names of Prometheus, i.e. the dots, with "_"
+func sanitizeRemoteWriteName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || r == ':' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+func remoteWriteSeriesID(series RemoteWriteTimeseries) string {
+	var sb strings.Builder
+	for _, label := range series.Labels {
+		sb.WriteString(label.Name + "=" + label.Value + ",")
+	}
+	return sb.String()
+}
@@ -0,0 +1,256 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package malachite
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/kubewharf/katalyst-core/pkg/config"
+	"github.com/kubewharf/katalyst-core/pkg/consts"
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/pod"
+	"github.com/kubewharf/katalyst-core/pkg/metrics"
+	utilmetric "github.com/kubewharf/katalyst-core/pkg/util/metric"
+)
+
+func TestBuildRemoteWritePayload(t *testing.T) {
+	t.Parallel()
+
+	now := time.UnixMilli(1700000000123)
+	store := utilmetric.NewMetricStore()
+	store.SetNodeMetric(consts.MetricMemBandwidthTenantNode, utilmetric.MetricData{Value: 100, Time: &now})
+	store.SetContainerMetric("pod1", "c1", consts.MetricMemBandwidthReadContainer, utilmetric.MetricData{Value: 10, Time: &now})
+	store.SetNumaMetric(1, consts.MetricMemBandwidthNuma, utilmetric.MetricData{Value: 20, Time: &now})
+	// metrics without collecting time are skipped
+	store.SetNodeMetric(consts.MetricMemBandwidthHeadroomNode, utilmetric.MetricData{Value: 1})
+
+	snapshot := store.Snapshot()
+	snapshot.NodeMetrics[consts.MetricMemBandwidthHistogramNode+`_bucket{le="100"}`] = utilmetric.MetricData{Value: 3, Time: &now}
+
+	payload := buildRemoteWritePayload(snapshot, "node1", "")
+	assert.Equal(t, []RemoteWriteTimeseries{
+		{
+			Labels: []RemoteWriteLabel{
+				{Name: "__name__", Value: "mem_bandwidth_histogram_node_bucket"},
+				{Name: "le", Value: "100"},
+				{Name: "node", Value: "node1"},
+				{Name: "scope", Value: "node"},
+			},
+			Samples: []RemoteWriteSample{{Value: 3, Timestamp: 1700000000123}},
+		},
+		{
+			Labels: []RemoteWriteLabel{
+				{Name: "__name__", Value: "mem_bandwidth_numa"},
+				{Name: "node", Value: "node1"},
+				{Name: "numa", Value: "1"},
+				{Name: "scope", Value: "numa"},
+			},
+			Samples: []RemoteWriteSample{{Value: 20, Timestamp: 1700000000123}},
+		},
+		{
+			Labels: []RemoteWriteLabel{
+				{Name: "__name__", Value: "mem_bandwidth_read_container"},
+				{Name: "container", Value: "c1"},
+				{Name: "node", Value: "node1"},
+				{Name: "pod_uid", Value: "pod1"},
+				{Name: "scope", Value: "container"},
+			},
+			Samples: []RemoteWriteSample{{Value: 10, Timestamp: 1700000000123}},
+		},
+		{
+			Labels: []RemoteWriteLabel{
+				{Name: "__name__", Value: "mem_bandwidth_tenant_node"},
+				{Name: "node", Value: "node1"},
+				{Name: "scope", Value: "node"},
+			},
+			Samples: []RemoteWriteSample{{Value: 100, Timestamp: 1700000000123}},
+		},
+	}, payload.Timeseries)
+
+	// series are labeled with the pool of node once it's resolved
+	payload = buildRemoteWritePayload(snapshot, "node1", "pool-a")
+	for _, series := range payload.Timeseries {
+		assert.Contains(t, series.Labels, RemoteWriteLabel{Name: metricTagKeyNodePool, Value: "pool-a"})
+	}
+}
+
+func TestRemoteWritePayload_Marshal(t *testing.T) {
+	t.Parallel()
+
+	payload := &RemoteWritePayload{Timeseries: []RemoteWriteTimeseries{
+		{
+			Labels:  []RemoteWriteLabel{{Name: "__name__", Value: "m1"}, {Name: "scope", Value: "node"}},
+			Samples: []RemoteWriteSample{{Value: 1.5, Timestamp: 1700000000123}},
+		},
+		{
+			Labels:  []RemoteWriteLabel{{Name: "__name__", Value: "m2"}},
+			Samples: []RemoteWriteSample{{Value: -2, Timestamp: 1700000000456}},
+		},
+	}}
+
+	decoded, err := unmarshalRemoteWritePayload(payload.Marshal())
+	assert.NoError(t, err)
+	assert.Equal(t, payload, decoded)
+}
+
+// unmarshalRemoteWritePayload decodes the protobuf of prompb.WriteRequest, and unknown fields are rejected
+func unmarshalRemoteWritePayload(b []byte) (*RemoteWritePayload, error) {
+	payload := &RemoteWritePayload{}
+	err := forEachRemoteWriteField(b, func(num protowire.Number, v []byte, _ uint64) error {
+		series := RemoteWriteTimeseries{}
+		if err := forEachRemoteWriteField(v, func(num protowire.Number, v []byte, _ uint64) error {
+			switch num {
+			case remoteWriteFieldTimeseriesLabels:
+				label := RemoteWriteLabel{}
+				if err := forEachRemoteWriteField(v, func(num protowire.Number, v []byte, _ uint64) error {
+					if num == remoteWriteFieldLabelName {
+						label.Name = string(v)
+					} else {
+						label.Value = string(v)
+					}
+					return nil
+				}); err != nil {
+					return err
+				}
+				series.Labels = append(series.Labels, label)
+			case remoteWriteFieldTimeseriesSamples:
+				sample := RemoteWriteSample{}
+				if err := forEachRemoteWriteField(v, func(num protowire.Number, _ []byte, n uint64) error {
+					if num == remoteWriteFieldSampleValue {
+						sample.Value = math.Float64frombits(n)
+					} else {
+						sample.Timestamp = int64(n)
+					}
+					return nil
+				}); err != nil {
+					return err
+				}
+				series.Samples = append(series.Samples, sample)
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		payload.Timeseries = append(payload.Timeseries, series)
+		return nil
+	})
+	return payload, err
+}
+
+func forEachRemoteWriteField(b []byte, handle func(num protowire.Number, v []byte, n uint64) error) error {
+	for len(b) > 0 {
+		num, typ, l := protowire.ConsumeTag(b)
+		if l < 0 {
+			return protowire.ParseError(l)
+		}
+		b = b[l:]
+
+		var (
+			v []byte
+			n uint64
+		)
+		switch typ {
+		case protowire.BytesType:
+			v, l = protowire.ConsumeBytes(b)
+		case protowire.Fixed64Type:
+			n, l = protowire.ConsumeFixed64(b)
+		case protowire.VarintType:
+			n, l = protowire.ConsumeVarint(b)
+		default:
+			return fmt.Errorf("unexpected wire type %v", typ)
+		}
+		if l < 0 {
+			return protowire.ParseError(l)
+		}
+		b = b[l:]
+
+		if err := handle(num, v, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestRemoteWriteQueue(t *testing.T) {
+	t.Parallel()
+
+	q := newRemoteWriteQueue(2)
+	assert.False(t, q.push([]byte("1")))
+	assert.False(t, q.push([]byte("2")))
+	// the oldest batch is dropped for the slow sink
+	assert.True(t, q.push([]byte("3")))
+
+	for _, want := range []string{"2", "3"} {
+		batch, ok := q.pop()
+		assert.True(t, ok)
+		assert.Equal(t, want, string(batch))
+	}
+	_, ok := q.pop()
+	assert.False(t, ok)
+}
+
+func TestMalachiteMetricsFetcher_runRemoteWrite(t *testing.T) {
+	t.Parallel()
+
+	received := make(chan *RemoteWritePayload, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+		assert.Equal(t, "snappy", r.Header.Get("Content-Encoding"))
+		assert.Equal(t, "0.1.0", r.Header.Get("X-Prometheus-Remote-Write-Version"))
+
+		compressed, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		raw, err := snappy.Decode(nil, compressed)
+		assert.NoError(t, err)
+		payload, err := unmarshalRemoteWritePayload(raw)
+		assert.NoError(t, err)
+		received <- payload
+	}))
+	defer server.Close()
+
+	conf := config.NewConfiguration()
+	conf.NodeName = "node1"
+	conf.MetricRemoteWriteURL = server.URL
+	conf.MetricRemoteWriteInterval = 10 * time.Millisecond
+	conf.MetricRemoteWriteQueueSize = 1
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, conf).(*MalachiteMetricsFetcher)
+	now := time.Now()
+	f.metricStore.SetNodeMetric(consts.MetricMemBandwidthTenantNode, utilmetric.MetricData{Value: 100, Time: &now})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	f.runRemoteWrite(ctx)
+
+	select {
+	case payload := <-received:
+		assert.Len(t, payload.Timeseries, 1)
+		assert.Contains(t, payload.Timeseries[0].Labels, RemoteWriteLabel{Name: "node", Value: "node1"})
+		assert.Equal(t, float64(100), payload.Timeseries[0].Samples[0].Value)
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no payload is received")
+	}
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package malachite
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/kubewharf/katalyst-core/pkg/consts"
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/metric"
+	"github.com/kubewharf/katalyst-core/pkg/metrics"
+	utilmetric "github.com/kubewharf/katalyst-core/pkg/util/metric"
+)
+
+// MemBandwidthConstants are the constants used to derive memory bandwidth from raw counters
+type MemBandwidthConstants struct {
+	// CacheLineSize is the number of bytes transferred for each counted memory access
+	CacheLineSize uint64
+}
+
+var defaultMemBandwidthConstants = MemBandwidthConstants{CacheLineSize: 64}
+
+// ReplayMemBandwidth re-derives memory bandwidth of all containers from the retained raw counters with
+// the given constants, and the results are set into a fresh named store (which replaces the previous
+// replay with the same name), so that they can be compared against the live store without disrupting it.
+// Stores registered for external metrics are never replaced.
+func (m *MalachiteMetricsFetcher) ReplayMemBandwidth(storeName string, constants MemBandwidthConstants) error {
+	metricConf := m.getMetricConf()
+	if storeName == "" || storeName == metric.DefaultMetricStoreName {
+		return fmt.Errorf("replay into the default metric store is not allowed")
+	} else if metricConf.MemBandwidthReplayCycles <= 0 {
+		return fmt.Errorf("raw counters are not retained for replay")
+	} else if m.isExternalMetricStore(storeName) {
+		return fmt.Errorf("metric store %v is registered for external metrics", storeName)
+	}
+
+	scratch := newMalachiteMetricsFetcher(metrics.DummyMetrics{}, m.podFetcher, m.conf, metricConf)
+	scratch.memBandwidthConstants = constants
+	// replayed rates are derived from samples that have already passed warm-up of the live fetcher
+	scratch.startTime = time.Time{}
+	store := scratch.metricStore
+
+	m.replayLock.Lock()
+	for podUID, containers := range m.replaySamples {
+		for containerName, samples := range containers {
+			var lastUpdateTimeInSec int64
+			for _, sample := range samples {
+				scratch.calculateContainerMemBandwidth(podUID, containerName, sample, lastUpdateTimeInSec)
+				scratch.setContainerMemBandwidthCounters(podUID, containerName, sample)
+				lastUpdateTimeInSec = sample.ocrReadDRAMs.updateTime
+			}
+		}
+	}
+	m.replayLock.Unlock()
+
+	m.Lock()
+	defer m.Unlock()
+	// the store may be registered during the replay
+	if _, ok := m.registeredStoreMetric[storeName]; ok {
+		return fmt.Errorf("metric store %v is registered for external metrics", storeName)
+	}
+	m.namedStores[storeName] = store
+	return nil
+}
+
+// isExternalMetricStore returns true if the named store is registered by RegisterExternalMetricToStore
+func (m *MalachiteMetricsFetcher) isExternalMetricStore(storeName string) bool {
+	m.RLock()
+	defer m.RUnlock()
+	_, ok := m.registeredStoreMetric[storeName]
+	return ok
+}
+
+// retainMemBandwidthReplaySample retains the raw counters of current cycle, and
+// only samples of the last cycles are kept for each container.
+func (m *MalachiteMetricsFetcher) retainMemBandwidthReplaySample(podUID, containerName string, counters containerMemBandwidthCounters) {
+	maxCycles := m.metricConf.MemBandwidthReplayCycles
+	if maxCycles <= 0 {
+		return
+	}
+
+	m.replayLock.Lock()
+	defer m.replayLock.Unlock()
+
+	if _, ok := m.replaySamples[podUID]; !ok {
+		m.replaySamples[podUID] = make(map[string][]containerMemBandwidthCounters)
+	}
+	samples := append(m.replaySamples[podUID][containerName], counters)
+	if len(samples) > maxCycles {
+		samples = samples[len(samples)-maxCycles:]
+	}
+	m.replaySamples[podUID][containerName] = samples
+}
+
+// gcMemBandwidthReplaySamples removes retained samples of pods not existing any more
+func (m *MalachiteMetricsFetcher) gcMemBandwidthReplaySamples(livingPodUIDSet map[string]bool) {
+	m.replayLock.Lock()
+	defer m.replayLock.Unlock()
+
+	for podUID := range m.replaySamples {
+		if !livingPodUIDSet[podUID] {
+			delete(m.replaySamples, podUID)
+		}
+	}
+}
+
+// setContainerMemBandwidthCounters sets the raw counters as the baseline for the next replayed sample, including
+// the precise sample time, so that replayed rates are divided by the same interval as the live ones.
+func (m *MalachiteMetricsFetcher) setContainerMemBandwidthCounters(podUID, containerName string, counters containerMemBandwidthCounters) {
+	for metricName, sample := range map[string]counterSample{
+		consts.MetricOCRReadDRAMsContainer: counters.ocrReadDRAMs,
+		consts.MetricIMCWriteContainer:     counters.imcWrites,
+		consts.MetricStoreAllInsContainer:  counters.storeAllIns,
+		consts.MetricStoreInsContainer:     counters.storeIns,
+	} {
+		updateTime := time.Unix(sample.updateTime, 0)
+		m.metricStore.SetContainerMetric(podUID, containerName, metricName,
+			utilmetric.MetricData{Value: float64(sample.value), Time: &updateTime})
+	}
+
+	// the same as the live path, precise time is shared by all memory bandwidth counters and only set if provided
+	sample := counters.ocrReadDRAMs
+	updateTime := time.Unix(sample.updateTime, 0)
+	if sample.monotonicTime > 0 {
+		m.metricStore.SetContainerMetric(podUID, containerName, consts.MetricCPUMonotonicTimeContainer,
+			utilmetric.MetricData{Value: float64(sample.monotonicTime), Time: &updateTime})
+	}
+	if sample.updateTimeNano > 0 {
+		m.metricStore.SetContainerMetric(podUID, containerName, consts.MetricCPUUpdateTimeNanoContainer,
+			utilmetric.MetricData{Value: float64(sample.updateTimeNano), Time: &updateTime})
+	}
+}
@@ -0,0 +1,145 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package malachite
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kubewharf/katalyst-core/pkg/config"
+	"github.com/kubewharf/katalyst-core/pkg/consts"
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/metric"
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/pod"
+	"github.com/kubewharf/katalyst-core/pkg/metrics"
+	utilmetric "github.com/kubewharf/katalyst-core/pkg/util/metric"
+)
+
+func TestMalachiteMetricsFetcher_ReplayMemBandwidth(t *testing.T) {
+	t.Parallel()
+
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+	assert.Error(t, f.ReplayMemBandwidth("whatif", MemBandwidthConstants{CacheLineSize: 128}))
+
+	f.metricConf.MemBandwidthReplayCycles = 2
+	// read bandwidth is 1MiB/s with 64 bytes cache line
+	for i := 0; i < 3; i++ {
+		f.processContainerCPUData("pod1", "c1", newTestCgroupInfoV2(int64(100+10*i), uint64(16384*10*i)))
+	}
+	assert.Len(t, f.replaySamples["pod1"]["c1"], 2)
+
+	assert.Error(t, f.ReplayMemBandwidth(metric.DefaultMetricStoreName, MemBandwidthConstants{CacheLineSize: 128}))
+	assert.NoError(t, f.ReplayMemBandwidth("whatif", MemBandwidthConstants{CacheLineSize: 128}))
+
+	store, err := f.GetMetricStore("whatif")
+	assert.NoError(t, err)
+	data, err := store.GetContainerMetric("pod1", "c1", consts.MetricMemBandwidthReadContainer)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(2), data.Value)
+
+	// the live store is not disrupted
+	data, err = f.GetContainerMetric("pod1", "c1", consts.MetricMemBandwidthReadContainer)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(1), data.Value)
+
+	// samples of deleted pods are dropped
+	f.gcMemBandwidthReplaySamples(map[string]bool{})
+	assert.Empty(t, f.replaySamples)
+}
+
+func TestMalachiteMetricsFetcher_ReplayMemBandwidthClockJump(t *testing.T) {
+	t.Parallel()
+
+	conf := config.NewConfiguration()
+	conf.MemBandwidthReplayCycles = 3
+	conf.RateClockJumpFactor = 2
+	conf.SampleInterval = 10 * time.Second
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, conf).(*MalachiteMetricsFetcher)
+
+	// the gap between the last two samples is regarded as a clock jump
+	for i, updateTime := range []int64{100, 110, 200} {
+		f.processContainerCPUData("pod1", "c1", newTestCgroupInfoV2(updateTime, uint64(16384*10*i)))
+	}
+	jumps := atomic.LoadInt64(&f.rateClockJumps)
+	assert.Positive(t, jumps)
+
+	assert.NoError(t, f.ReplayMemBandwidth("whatif", MemBandwidthConstants{CacheLineSize: 128}))
+	store, err := f.GetMetricStore("whatif")
+	assert.NoError(t, err)
+	data, err := store.GetContainerMetric("pod1", "c1", consts.MetricMemBandwidthReadContainer)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(2), data.Value)
+	assert.Equal(t, int64(110), data.Time.Unix())
+
+	// jumps detected in replay are not counted into the live fetcher
+	assert.Equal(t, jumps, atomic.LoadInt64(&f.rateClockJumps))
+}
+
+func TestMalachiteMetricsFetcher_ReplayMemBandwidthPreciseTime(t *testing.T) {
+	t.Parallel()
+
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+	f.metricConf.MemBandwidthReplayCycles = 3
+	f.metricConf.RateMonotonicInterval = true
+
+	// the precise interval (8s) differs from the interval of update times in seconds (10s)
+	for i := 0; i < 3; i++ {
+		cgStats := newTestCgroupInfoV2(int64(100+10*i), uint64(16384*8*i))
+		cgStats.V2.Cpu.MonotonicTime = uint64(i) * uint64(8*time.Second)
+		f.processContainerCPUData("pod1", "c1", cgStats)
+	}
+	live, err := f.GetContainerMetric("pod1", "c1", consts.MetricMemBandwidthReadContainer)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(1), live.Value)
+
+	// replay with the same constants reproduces the live value
+	assert.NoError(t, f.ReplayMemBandwidth("whatif", defaultMemBandwidthConstants))
+	store, err := f.GetMetricStore("whatif")
+	assert.NoError(t, err)
+	data, err := store.GetContainerMetric("pod1", "c1", consts.MetricMemBandwidthReadContainer)
+	assert.NoError(t, err)
+	assert.Equal(t, live.Value, data.Value)
+
+	// stores registered for external metrics are never replaced
+	f.RegisterExternalMetricToStore("plugin", func(_ *utilmetric.MetricStore) {})
+	assert.Error(t, f.ReplayMemBandwidth("plugin", defaultMemBandwidthConstants))
+}
+
+func TestMalachiteMetricsFetcher_ReplayMemBandwidthWarmUp(t *testing.T) {
+	t.Parallel()
+
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+	f.metricConf.MemBandwidthReplayCycles = 2
+	f.metricConf.RateWarmUpPeriod = time.Hour
+
+	for i := 0; i < 3; i++ {
+		f.processContainerCPUData("pod1", "c1", newTestCgroupInfoV2(int64(100+10*i), uint64(16384*10*i)))
+	}
+	// the live fetcher is still warming up
+	_, err := f.GetContainerMetric("pod1", "c1", consts.MetricMemBandwidthReadContainer)
+	assert.Error(t, err)
+
+	// replay is not held back by warm-up
+	assert.NoError(t, f.ReplayMemBandwidth("whatif", MemBandwidthConstants{CacheLineSize: 128}))
+	store, err := f.GetMetricStore("whatif")
+	assert.NoError(t, err)
+	data, err := store.GetContainerMetric("pod1", "c1", consts.MetricMemBandwidthReadContainer)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(2), data.Value)
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package malachite
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/metric/malachite/types"
+	"github.com/kubewharf/katalyst-core/pkg/metrics"
+)
+
+const metricsNameMalachiteSnapshotInconsistent = "malachite_snapshot_inconsistent"
+
+// fetchPodsContainersStats reads the snapshot of all containers, and containers partially updated by the
+// source (i.e. update times of fields skew more than SnapshotMaxTimeSkew) are rejected in the cycle. If
+// SnapshotSettleDelay is set, the snapshot is read again after the delay to let the source settle before
+// the rejection. Pods of rejected containers are kept, so that their metrics won't be GCed.
+func (m *MalachiteMetricsFetcher) fetchPodsContainersStats(ctx context.Context) (map[string]map[string]*types.MalachiteCgroupInfo, error) {
+	podsContainersStats, err := m.getAllPodContainersStats(ctx)
+	if err != nil || m.metricConf.SnapshotMaxTimeSkew <= 0 {
+		return podsContainersStats, err
+	}
+
+	inconsistent := m.getInconsistentContainers(podsContainersStats)
+	if len(inconsistent) > 0 && m.metricConf.SnapshotSettleDelay > 0 {
+		select {
+		case <-ctx.Done():
+		case <-time.After(m.metricConf.SnapshotSettleDelay):
+			if settled, err := m.getAllPodContainersStats(ctx); err != nil {
+				klog.Errorf("[malachite] read snapshot again after settle delay failed, error %v", err)
+			} else {
+				podsContainersStats = settled
+				inconsistent = m.getInconsistentContainers(podsContainersStats)
+			}
+		}
+	}
+
+	for _, key := range inconsistent {
+		klog.V(4).Infof("[malachite] reject inconsistent snapshot of pod %v container %v", key.podUID, key.containerName)
+		delete(podsContainersStats[key.podUID], key.containerName)
+	}
+	if len(inconsistent) > 0 {
+		_ = m.emitter.StoreInt64(metricsNameMalachiteSnapshotInconsistent, int64(len(inconsistent)), metrics.MetricTypeNameCount)
+	}
+	return podsContainersStats, nil
+}
+
+// getInconsistentContainers returns containers whose update times of fields skew more than SnapshotMaxTimeSkew,
+// and the skew is compared in seconds since update times are reported in seconds.
+func (m *MalachiteMetricsFetcher) getInconsistentContainers(podsContainersStats map[string]map[string]*types.MalachiteCgroupInfo) []containerMetricKey {
+	var res []containerMetricKey
+	maxSkew := int64(m.metricConf.SnapshotMaxTimeSkew / time.Second)
+	for podUID, containerStats := range podsContainersStats {
+		for containerName, cgStats := range containerStats {
+			if cgStats == nil {
+				continue
+			}
+
+			var minTime, maxTime int64
+			for _, updateTime := range getCgroupUpdateTimes(cgStats) {
+				if updateTime <= 0 {
+					continue
+				}
+				if minTime == 0 || updateTime < minTime {
+					minTime = updateTime
+				}
+				if updateTime > maxTime {
+					maxTime = updateTime
+				}
+			}
+			if maxTime-minTime > maxSkew {
+				res = append(res, containerMetricKey{podUID: podUID, containerName: containerName})
+			}
+		}
+	}
+	return res
+}
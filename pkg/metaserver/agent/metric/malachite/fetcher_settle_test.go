@@ -0,0 +1,98 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package malachite
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/metric/malachite/types"
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/pod"
+)
+
+func TestMalachiteMetricsFetcher_fetchPodsContainersStats(t *testing.T) {
+	t.Parallel()
+
+	// update time of memory lags behind that of cpu if it's partially updated
+	newStats := func(cpuUpdateTime, memUpdateTime int64) *types.MalachiteCgroupInfo {
+		cgStats := newTestCgroupInfoV2(cpuUpdateTime, 1<<20)
+		cgStats.V2.Memory = &types.MemoryCgDataV2{UpdateTime: memUpdateTime}
+		return cgStats
+	}
+
+	t.Run("settled after delay", func(t *testing.T) {
+		t.Parallel()
+
+		emitter := newCountingEmitter()
+		f := NewMalachiteMetricsFetcher(emitter, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+		f.metricConf.SnapshotMaxTimeSkew = time.Second
+		f.metricConf.SnapshotSettleDelay = 50 * time.Millisecond
+
+		var reads []time.Time
+		f.getAllPodContainersStats = func(_ context.Context) (map[string]map[string]*types.MalachiteCgroupInfo, error) {
+			reads = append(reads, time.Now())
+			if len(reads) == 1 {
+				return map[string]map[string]*types.MalachiteCgroupInfo{"pod1": {"c1": newStats(110, 100)}}, nil
+			}
+			return map[string]map[string]*types.MalachiteCgroupInfo{"pod1": {"c1": newStats(110, 110)}}, nil
+		}
+
+		stats, err := f.fetchPodsContainersStats(context.Background())
+		assert.NoError(t, err)
+		assert.Len(t, reads, 2)
+		assert.GreaterOrEqual(t, reads[1].Sub(reads[0]), 50*time.Millisecond)
+		assert.NotNil(t, stats["pod1"]["c1"])
+		assert.Equal(t, int64(0), emitter.count(metricsNameMalachiteSnapshotInconsistent))
+	})
+
+	t.Run("inconsistent containers rejected", func(t *testing.T) {
+		t.Parallel()
+
+		emitter := newCountingEmitter()
+		f := NewMalachiteMetricsFetcher(emitter, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+		f.metricConf.SnapshotMaxTimeSkew = time.Second
+
+		reads := 0
+		f.getAllPodContainersStats = func(_ context.Context) (map[string]map[string]*types.MalachiteCgroupInfo, error) {
+			reads++
+			return map[string]map[string]*types.MalachiteCgroupInfo{
+				"pod1": {"c1": newStats(110, 100), "c2": newStats(110, 109)},
+				"pod2": {"c1": newStats(110, 100)},
+			}, nil
+		}
+
+		// it's not read again without settle delay
+		stats, err := f.fetchPodsContainersStats(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, 1, reads)
+		assert.NotContains(t, stats["pod1"], "c1")
+		assert.Contains(t, stats["pod1"], "c2")
+		// pods are kept even if all containers are rejected
+		assert.Contains(t, stats, "pod2")
+		assert.Empty(t, stats["pod2"])
+		assert.Equal(t, int64(2), emitter.count(metricsNameMalachiteSnapshotInconsistent))
+
+		// the check is disabled by default
+		f.metricConf.SnapshotMaxTimeSkew = 0
+		stats, err = f.fetchPodsContainersStats(context.Background())
+		assert.NoError(t, err)
+		assert.Contains(t, stats["pod1"], "c1")
+	})
+}
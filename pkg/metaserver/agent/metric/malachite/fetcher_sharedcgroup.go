@@ -0,0 +1,113 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package malachite
+
+import (
+	"sort"
+
+	"k8s.io/klog/v2"
+
+	globalconfig "github.com/kubewharf/katalyst-core/pkg/config/agent/global"
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/metric/malachite/types"
+	"github.com/kubewharf/katalyst-core/pkg/metrics"
+)
+
+const metricsNameMalachiteSharedCgroup = "malachite_shared_cgroup_containers"
+
+// getSharedCgroupContainers returns names of containers reported with the same cgroup, keyed by the
+// cgroup path, and cgroups with only one container are absent. Names are sorted for each cgroup.
+func getSharedCgroupContainers(containerStats map[string]*types.MalachiteCgroupInfo) map[string][]string {
+	containersOfCgroup := make(map[string][]string)
+	for containerName, cgStats := range containerStats {
+		if cgroupPath, ok := getCgroupCPUFullPath(cgStats); ok && cgroupPath != "" {
+			containersOfCgroup[cgroupPath] = append(containersOfCgroup[cgroupPath], containerName)
+		}
+	}
+
+	for cgroupPath, containerNames := range containersOfCgroup {
+		if len(containerNames) < 2 {
+			delete(containersOfCgroup, cgroupPath)
+			continue
+		}
+		sort.Strings(containerNames)
+	}
+	return containersOfCgroup
+}
+
+// processSharedCgroupMemBandwidth decides the share of memory bandwidth attributed to each container whose cgroup
+// is shared by multiple containers of a pod with MemBandwidthSharedCgroupPolicy, since the bandwidth of the whole
+// cgroup is reported for each of them and will be counted more than once. It should be called before containers
+// are processed, so that the bandwidth is attributed when it's calculated, and all metrics derived from it
+// (i.e. per-numa bandwidth, intensity and pressure class) are based on the attributed bandwidth as well.
+func (m *MalachiteMetricsFetcher) processSharedCgroupMemBandwidth(podsContainersStats map[string]map[string]*types.MalachiteCgroupInfo) {
+	m.sharedCgroupShares = make(map[containerMetricKey]float64)
+
+	policy := m.metricConf.MemBandwidthSharedCgroupPolicy
+	for podUID, containerStats := range podsContainersStats {
+		for cgroupPath, containerNames := range getSharedCgroupContainers(containerStats) {
+			klog.V(4).Infof("[malachite] containers %v of pod %v share cgroup %v", containerNames, podUID, cgroupPath)
+			_ = m.emitter.StoreInt64(metricsNameMalachiteSharedCgroup, int64(len(containerNames)), metrics.MetricTypeNameRaw,
+				metrics.MetricTag{Key: "policy", Val: policy})
+
+			if policy == "" || policy == globalconfig.MemBandwidthSharedCgroupPolicyNamed {
+				continue
+			}
+
+			weights := getSharedCgroupWeights(containerStats, containerNames, policy)
+			for i, containerName := range containerNames {
+				m.sharedCgroupShares[containerMetricKey{podUID: podUID, containerName: containerName}] = weights[i]
+			}
+		}
+	}
+}
+
+// getSharedCgroupWeights returns the weight of each container in the shared bandwidth by cpu usage of
+// current cycle, and they sum up to 1
+func getSharedCgroupWeights(containerStats map[string]*types.MalachiteCgroupInfo, containerNames []string, policy string) []float64 {
+	var (
+		usages = make([]float64, len(containerNames))
+		total  float64
+	)
+	for i, containerName := range containerNames {
+		if usage, ok := getCgroupCPUUsage(containerStats[containerName]); ok && usage > 0 {
+			usages[i] = usage
+			total += usage
+		}
+	}
+
+	weights := make([]float64, len(containerNames))
+	if policy == globalconfig.MemBandwidthSharedCgroupPolicyPrimary {
+		// the first one in order wins if cpu usage is the same
+		primary := 0
+		for i := range usages {
+			if usages[i] > usages[primary] {
+				primary = i
+			}
+		}
+		weights[primary] = 1
+		return weights
+	}
+
+	for i := range usages {
+		if total > 0 {
+			weights[i] = usages[i] / total
+		} else {
+			weights[i] = 1 / float64(len(containerNames))
+		}
+	}
+	return weights
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package malachite
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	globalconfig "github.com/kubewharf/katalyst-core/pkg/config/agent/global"
+	"github.com/kubewharf/katalyst-core/pkg/consts"
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/metric/malachite/types"
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/pod"
+	"github.com/kubewharf/katalyst-core/pkg/metrics"
+	utilmetric "github.com/kubewharf/katalyst-core/pkg/util/metric"
+)
+
+func TestMalachiteMetricsFetcher_processSharedCgroupMemBandwidth(t *testing.T) {
+	t.Parallel()
+
+	// read bandwidth of each cgroup is 1MiB/s, and it's all read from numa 0 and 1 evenly
+	newCgStats := func(cgroupPath string, cpuUsage float64, updateTime int64, ocrReadDRAMs uint64) *types.MalachiteCgroupInfo {
+		cgStats := newTestCgroupInfoV2(updateTime, ocrReadDRAMs)
+		cgStats.V2.Cpu.FullPath = cgroupPath
+		cgStats.V2.Cpu.CPUUsageRatio = cpuUsage
+		cgStats.V2.CpuSet.Mems = types.Mems{Inner: []int{0, 1}}
+		return cgStats
+	}
+	// the sandbox and app share the pod cgroup, while the sidecar has its own one
+	newPodsContainersStats := func(i int) map[string]map[string]*types.MalachiteCgroupInfo {
+		updateTime, ocrReadDRAMs := int64(100+10*i), uint64(16384*10*i)
+		return map[string]map[string]*types.MalachiteCgroupInfo{
+			"pod1": {
+				"sandbox": newCgStats("/kubepods/pod1", 1, updateTime, ocrReadDRAMs),
+				"app":     newCgStats("/kubepods/pod1", 3, updateTime, ocrReadDRAMs),
+				"sidecar": newCgStats("/kubepods/pod1/sidecar", 2, updateTime, ocrReadDRAMs),
+			},
+		}
+	}
+	assert.Equal(t, map[string][]string{"/kubepods/pod1": {"app", "sandbox"}},
+		getSharedCgroupContainers(newPodsContainersStats(0)["pod1"]))
+
+	for _, tt := range []struct {
+		policy string
+		want   map[string]float64
+	}{
+		{policy: globalconfig.MemBandwidthSharedCgroupPolicyNamed, want: map[string]float64{"sandbox": 1, "app": 1, "sidecar": 1}},
+		{policy: globalconfig.MemBandwidthSharedCgroupPolicyPrimary, want: map[string]float64{"sandbox": 0, "app": 1, "sidecar": 1}},
+		{policy: globalconfig.MemBandwidthSharedCgroupPolicySplitByCPU, want: map[string]float64{"sandbox": 0.25, "app": 0.75, "sidecar": 1}},
+	} {
+		f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+		f.metricConf.MemBandwidthSharedCgroupPolicy = tt.policy
+
+		changes := make(chan utilmetric.MetricChangeEvent, 100)
+		f.metricStore.SubscribeChanges([]string{consts.MetricMemBandwidthReadContainer}, changes)
+		for i := 0; i < 3; i++ {
+			f.processPodsContainersStats(newPodsContainersStats(i))
+		}
+
+		for containerName, want := range tt.want {
+			data, err := f.GetContainerMetric("pod1", containerName, consts.MetricMemBandwidthReadContainer)
+			assert.NoError(t, err)
+			assert.Equal(t, want, data.Value, tt.policy+"/"+containerName)
+
+			// metrics derived from the bandwidth are based on the attributed one
+			data, err = f.GetContainerNumaMetric("pod1", containerName, "0", consts.MetricsMemBandwidthReadPerNumaContainer)
+			assert.NoError(t, err)
+			assert.Equal(t, want/2, data.Value, tt.policy+"/"+containerName)
+		}
+
+		// the attributed bandwidth is the only value published for each container
+		assert.NotZero(t, len(changes))
+		for len(changes) > 0 {
+			event := <-changes
+			assert.Equal(t, tt.want[event.ContainerName], event.Value, tt.policy+"/"+event.ContainerName)
+		}
+	}
+}
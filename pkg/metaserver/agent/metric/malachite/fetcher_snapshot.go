@@ -0,0 +1,124 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package malachite
+
+import (
+	"os"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"github.com/kubewharf/katalyst-core/pkg/consts"
+	utilmetric "github.com/kubewharf/katalyst-core/pkg/util/metric"
+)
+
+// snapshotBaseline is the raw counters of a derived container metric kept in the snapshot as its baseline
+type snapshotBaseline struct {
+	counters []string
+	// rate is true if the metric is calculated by the general rate path, whose baseline must be reset
+	// explicitly when counters are dropped, since the update time shared with others is still kept
+	rate bool
+}
+
+// snapshotBaselines are derived container metrics whose counters can be kept in the snapshot as baselines
+var snapshotBaselines = map[string]snapshotBaseline{
+	consts.MetricMemBandwidthReadContainer: {counters: []string{consts.MetricOCRReadDRAMsContainer}, rate: true},
+	consts.MetricMemBandwidthWriteContainer: {counters: []string{
+		consts.MetricIMCWriteContainer, consts.MetricStoreAllInsContainer, consts.MetricStoreInsContainer,
+	}, rate: true},
+	// cpi is skipped if the last counters are zero, so dropping them is enough
+	consts.MetricCPUCPIContainer: {counters: []string{consts.MetricCPUCyclesContainer, consts.MetricCPUInstructionsContainer}},
+}
+
+// loadSnapshot warms up metricStore with the snapshot persisted before restarting, so that
+// consumers can get the last known metrics before the first sampling cycle completes;
+// metrics keep their original collecting time, and stale ones will be dropped.
+func (m *MalachiteMetricsFetcher) loadSnapshot() {
+	if m.metricConf.MetricSnapshotFile == "" || !m.metricConf.MetricSnapshotPreload {
+		return
+	}
+
+	snapshot, err := utilmetric.ReadSnapshotFile(m.metricConf.MetricSnapshotFile)
+	if os.IsNotExist(err) {
+		return
+	} else if err != nil {
+		klog.Errorf("[malachite] load metric snapshot %v failed: %v", m.metricConf.MetricSnapshotFile, err)
+		return
+	}
+
+	// the snapshot may be written with other settings, and it's not trusted for counters not kept
+	m.dropUnkeptSnapshotBaselines(snapshot)
+	m.metricStore.Restore(snapshot, time.Now().Add(-m.metricConf.MetricSnapshotMaxAge))
+	m.resetUnkeptSnapshotBaselines(snapshot)
+	klog.Infof("[malachite] metric store is warmed up from snapshot %v", m.metricConf.MetricSnapshotFile)
+}
+
+// writeSnapshot persists all metrics in metricStore into the snapshot file
+func (m *MalachiteMetricsFetcher) writeSnapshot() {
+	if m.metricConf.MetricSnapshotFile == "" {
+		return
+	}
+
+	snapshot := m.metricStore.Snapshot()
+	m.dropUnkeptSnapshotBaselines(snapshot)
+	if err := utilmetric.WriteSnapshotFile(m.metricConf.MetricSnapshotFile, snapshot, m.metricConf.MetricSnapshotCompression); err != nil {
+		klog.Errorf("[malachite] write metric snapshot %v failed: %v", m.metricConf.MetricSnapshotFile, err)
+	}
+}
+
+// isSnapshotBaselineKept returns true if the counters of the derived metric are kept in the snapshot
+func (m *MalachiteMetricsFetcher) isSnapshotBaselineKept(metricName string) bool {
+	for _, name := range m.metricConf.MetricSnapshotBaselineMetrics {
+		if name == metricName {
+			return true
+		}
+	}
+	return false
+}
+
+// dropUnkeptSnapshotBaselines removes counters of derived metrics not in MetricSnapshotBaselineMetrics from
+// the snapshot to be written, which keeps the snapshot file small
+func (m *MalachiteMetricsFetcher) dropUnkeptSnapshotBaselines(snapshot *utilmetric.MetricStoreSnapshot) {
+	prefix := m.metricConf.MetricNamePrefix
+	for metricName, baseline := range snapshotBaselines {
+		if m.isSnapshotBaselineKept(metricName) {
+			continue
+		}
+		for _, containers := range snapshot.PodContainerMetrics {
+			for _, metrics := range containers {
+				for _, counter := range baseline.counters {
+					delete(metrics, prefix+counter)
+				}
+			}
+		}
+	}
+}
+
+// resetUnkeptSnapshotBaselines resets baselines of rate metrics of containers in the loaded snapshot if their
+// counters are not kept, so that they start fresh rather than being calculated against missing counters.
+func (m *MalachiteMetricsFetcher) resetUnkeptSnapshotBaselines(snapshot *utilmetric.MetricStoreSnapshot) {
+	for metricName, baseline := range snapshotBaselines {
+		if !baseline.rate || m.isSnapshotBaselineKept(metricName) {
+			continue
+		}
+		for podUID, containers := range snapshot.PodContainerMetrics {
+			for containerName := range containers {
+				m.ResetContainerMetricBaseline(podUID, containerName, metricName)
+			}
+		}
+	}
+}
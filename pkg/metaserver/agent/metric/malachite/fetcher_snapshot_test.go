@@ -0,0 +1,241 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package malachite
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kubewharf/katalyst-core/pkg/consts"
+	metric2 "github.com/kubewharf/katalyst-core/pkg/metaserver/agent/metric"
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/pod"
+	"github.com/kubewharf/katalyst-core/pkg/metrics"
+	"github.com/kubewharf/katalyst-core/pkg/util/metric"
+)
+
+func TestMalachiteMetricsFetcher_snapshot(t *testing.T) {
+	t.Parallel()
+
+	snapshotFile := filepath.Join(t.TempDir(), "metric-snapshot")
+	now := time.Now()
+	stale := now.Add(-time.Hour)
+
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+	f.metricConf.MetricSnapshotFile = snapshotFile
+	f.metricStore.SetNodeMetric("test-node-metric", metric.MetricData{Value: 1, Time: &now})
+	f.metricStore.SetNodeMetric("test-stale-node-metric", metric.MetricData{Value: 2, Time: &stale})
+	f.metricStore.SetNumaMetric(1, "test-numa-metric", metric.MetricData{Value: 3, Time: &now})
+	f.metricStore.SetContainerMetric("pod1", "container1", "test-container-metric", metric.MetricData{Value: 4, Time: &now})
+	f.metricStore.SetContainerMetric("pod1", "container2", "test-container-metric", metric.MetricData{Value: 5, Time: &stale})
+	f.metricStore.SetContainerNumaMetric("pod1", "container1", "0", "test-container-numa-metric", metric.MetricData{Value: 6, Time: &now})
+	f.metricStore.SetCgroupMetric("/kubepods", "test-cgroup-metric", metric.MetricData{Value: 7, Time: &now})
+	f.writeSnapshot()
+
+	// snapshot is not loaded unless preload is enabled
+	restarted := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+	restarted.metricConf.MetricSnapshotFile = snapshotFile
+	restarted.loadSnapshot()
+	_, err := restarted.GetNodeMetric("test-node-metric")
+	assert.Error(t, err)
+
+	restarted.metricConf.MetricSnapshotPreload = true
+	restarted.metricConf.MetricSnapshotMaxAge = 5 * time.Minute
+	restarted.loadSnapshot()
+
+	data, err := restarted.GetNodeMetric("test-node-metric")
+	assert.NoError(t, err)
+	assert.Equal(t, float64(1), data.Value)
+	assert.True(t, now.Equal(*data.Time))
+
+	data, err = restarted.GetNumaMetric(1, "test-numa-metric")
+	assert.NoError(t, err)
+	assert.Equal(t, float64(3), data.Value)
+	data, err = restarted.GetContainerMetric("pod1", "container1", "test-container-metric")
+	assert.NoError(t, err)
+	assert.Equal(t, float64(4), data.Value)
+	data, err = restarted.GetContainerNumaMetric("pod1", "container1", "0", "test-container-numa-metric")
+	assert.NoError(t, err)
+	assert.Equal(t, float64(6), data.Value)
+	data, err = restarted.GetCgroupMetric("/kubepods", "test-cgroup-metric")
+	assert.NoError(t, err)
+	assert.Equal(t, float64(7), data.Value)
+
+	// stale metrics are aged out
+	_, err = restarted.GetNodeMetric("test-stale-node-metric")
+	assert.Error(t, err)
+	_, err = restarted.GetContainerMetric("pod1", "container2", "test-container-metric")
+	assert.Error(t, err)
+}
+
+func TestMalachiteMetricsFetcher_snapshotCompression(t *testing.T) {
+	t.Parallel()
+
+	snapshotFile := filepath.Join(t.TempDir(), "metric-snapshot")
+	now := time.Now()
+
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+	f.metricConf.MetricSnapshotFile = snapshotFile
+	f.metricConf.MetricSnapshotCompression = true
+	for i := 0; i < 100; i++ {
+		f.metricStore.SetContainerMetric("pod1", fmt.Sprintf("container%d", i), "test-container-metric",
+			metric.MetricData{Value: float64(i), Time: &now})
+	}
+	f.writeSnapshot()
+
+	compressed, err := os.ReadFile(snapshotFile)
+	assert.NoError(t, err)
+	raw, err := json.Marshal(f.metricStore.Snapshot())
+	assert.NoError(t, err)
+	assert.Less(t, len(compressed), len(raw))
+
+	// compressed snapshot is detected regardless of the setting of the restarted one
+	restarted := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+	restarted.metricConf.MetricSnapshotFile = snapshotFile
+	restarted.metricConf.MetricSnapshotPreload = true
+	restarted.metricConf.MetricSnapshotMaxAge = 5 * time.Minute
+	restarted.loadSnapshot()
+	for i := 0; i < 100; i++ {
+		data, err := restarted.GetContainerMetric("pod1", fmt.Sprintf("container%d", i), "test-container-metric")
+		assert.NoError(t, err)
+		assert.Equal(t, float64(i), data.Value)
+		assert.True(t, now.Equal(*data.Time))
+	}
+
+	// uncompressed snapshot written by the restarted one can still be read
+	restarted.writeSnapshot()
+	snapshot, err := metric.ReadSnapshotFile(snapshotFile)
+	assert.NoError(t, err)
+	assert.Len(t, snapshot.PodContainerMetrics["pod1"], 100)
+}
+
+func TestMalachiteMetricsFetcher_snapshotBaselines(t *testing.T) {
+	t.Parallel()
+
+	snapshotFile := filepath.Join(t.TempDir(), "metric-snapshot")
+	now := time.Now()
+
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+	f.metricConf.MetricSnapshotFile = snapshotFile
+	f.metricConf.MetricSnapshotBaselineMetrics = []string{consts.MetricMemBandwidthReadContainer}
+	for _, metricName := range []string{
+		consts.MetricCPUUpdateTimeContainer, consts.MetricOCRReadDRAMsContainer, consts.MetricIMCWriteContainer,
+		consts.MetricStoreAllInsContainer, consts.MetricStoreInsContainer, consts.MetricCPUCyclesContainer,
+	} {
+		f.metricStore.SetContainerMetric("pod1", "c1", metricName, metric.MetricData{Value: 100, Time: &now})
+	}
+	f.writeSnapshot()
+
+	// only counters of the listed metrics are written
+	snapshot, err := metric.ReadSnapshotFile(snapshotFile)
+	assert.NoError(t, err)
+	var written []string
+	for metricName := range snapshot.PodContainerMetrics["pod1"]["c1"] {
+		written = append(written, metricName)
+	}
+	assert.ElementsMatch(t, []string{consts.MetricCPUUpdateTimeContainer, consts.MetricOCRReadDRAMsContainer}, written)
+
+	restarted := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+	restarted.metricConf.MetricSnapshotFile = snapshotFile
+	restarted.metricConf.MetricSnapshotPreload = true
+	restarted.metricConf.MetricSnapshotMaxAge = 5 * time.Minute
+	restarted.metricConf.MetricSnapshotBaselineMetrics = []string{consts.MetricMemBandwidthReadContainer}
+	restarted.loadSnapshot()
+
+	data, err := restarted.GetContainerMetric("pod1", "c1", consts.MetricOCRReadDRAMsContainer)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(100), data.Value)
+	_, err = restarted.GetContainerMetric("pod1", "c1", consts.MetricIMCWriteContainer)
+	assert.Error(t, err)
+	// the write bandwidth starts fresh though the update time is restored, while the read bandwidth doesn't
+	assert.True(t, restarted.consumeContainerBaselineReset("pod1", "c1", consts.MetricMemBandwidthWriteContainer))
+	assert.False(t, restarted.consumeContainerBaselineReset("pod1", "c1", consts.MetricMemBandwidthReadContainer))
+	assert.False(t, restarted.consumeContainerBaselineReset("pod1", "c1", consts.MetricCPUCPIContainer))
+
+	// counters written with other settings are not restored if they are not listed any more
+	restarted = NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+	restarted.metricConf.MetricSnapshotFile = snapshotFile
+	restarted.metricConf.MetricSnapshotPreload = true
+	restarted.metricConf.MetricSnapshotMaxAge = 5 * time.Minute
+	restarted.loadSnapshot()
+	_, err = restarted.GetContainerMetric("pod1", "c1", consts.MetricOCRReadDRAMsContainer)
+	assert.Error(t, err)
+	data, err = restarted.GetContainerMetric("pod1", "c1", consts.MetricCPUUpdateTimeContainer)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(100), data.Value)
+	assert.True(t, restarted.consumeContainerBaselineReset("pod1", "c1", consts.MetricMemBandwidthReadContainer))
+}
+
+func TestMalachiteMetricsFetcher_Close(t *testing.T) {
+	t.Parallel()
+
+	snapshotFile := filepath.Join(t.TempDir(), "metric-snapshot")
+	now := time.Now()
+
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+	f.metricConf.MetricSnapshotFile = snapshotFile
+	f.metricConf.MetricSnapshotBaselineMetrics = []string{consts.MetricMemBandwidthReadContainer}
+
+	response := make(chan metric2.NotifiedResponse, 1)
+	f.RegisterNotifier(metric2.MetricsScopeNode, metric2.NotifiedRequest{MetricName: "test-node-metric"}, response)
+	f.RegisterNotifier(metric2.MetricsScopeNuma, metric2.NotifiedRequest{MetricName: "test-numa-metric"}, response)
+	changes := make(chan metric.MetricChangeEvent, 10)
+	f.metricStore.SubscribeChanges(nil, changes)
+
+	// close waits for the in-flight sampling cycle
+	f.cycleLock.Lock()
+	closed := make(chan struct{})
+	go func() {
+		f.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+		t.Fatalf("close returns before the in-flight cycle finishes")
+	case <-time.After(100 * time.Millisecond):
+	}
+	f.metricStore.SetContainerMetric("pod1", "container1", consts.MetricOCRReadDRAMsContainer, metric.MetricData{Value: 100, Time: &now})
+	f.cycleLock.Unlock()
+	<-closed
+
+	// close is idempotent, and no cycle runs after close
+	f.Close()
+	f.sampleOnce(context.Background())
+
+	snapshot, err := metric.ReadSnapshotFile(snapshotFile)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(100), snapshot.PodContainerMetrics["pod1"]["container1"][consts.MetricOCRReadDRAMsContainer].Value)
+
+	// notifiers are deregistered without closing their channels
+	for _, notifiers := range f.registeredNotifier {
+		assert.Empty(t, notifiers)
+	}
+	select {
+	case <-response:
+		t.Fatalf("channel of notifier is closed")
+	default:
+	}
+	<-changes
+	_, ok := <-changes
+	assert.False(t, ok)
+}
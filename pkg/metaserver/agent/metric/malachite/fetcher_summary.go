@@ -0,0 +1,88 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package malachite
+
+import (
+	"time"
+
+	"github.com/kubewharf/katalyst-core/pkg/consts"
+	"github.com/kubewharf/katalyst-core/pkg/util/general"
+)
+
+// ContainerMetricFlags tells which metrics in ContainerMetricsSummary are present and fresh
+type ContainerMetricFlags uint32
+
+const (
+	ContainerMetricCPUUsage ContainerMetricFlags = 1 << iota
+	ContainerMetricMemUsage
+	ContainerMetricMemWorkingSet
+	ContainerMetricMemBandwidthRead
+	ContainerMetricMemBandwidthWrite
+)
+
+// Has returns true if all the given flags are set
+func (f ContainerMetricFlags) Has(flags ContainerMetricFlags) bool {
+	return f&flags == flags
+}
+
+// ContainerMetricsSummary is the commonly used metrics of the container, and values of metrics
+// absent or stale are left as zero, which should be told by Flags rather than the values.
+type ContainerMetricsSummary struct {
+	CPUUsage          float64
+	MemUsage          float64
+	MemWorkingSet     float64
+	MemBandwidthRead  float64
+	MemBandwidthWrite float64
+
+	// UpdateTime is the newest time among all present metrics, and it's nil if none is present
+	UpdateTime *time.Time
+	Flags      ContainerMetricFlags
+}
+
+// GetContainerMetricsSummary returns the commonly used metrics of the container in a single read of
+// the store, and metrics updated before maxAge ago are regarded as absent if maxAge is positive.
+func (m *MalachiteMetricsFetcher) GetContainerMetricsSummary(podUID, containerName string, maxAge time.Duration) ContainerMetricsSummary {
+	summary := ContainerMetricsSummary{}
+	fields := []struct {
+		metricName string
+		flag       ContainerMetricFlags
+		value      *float64
+	}{
+		{metricName: consts.MetricCPUUsageContainer, flag: ContainerMetricCPUUsage, value: &summary.CPUUsage},
+		{metricName: consts.MetricMemUsageContainer, flag: ContainerMetricMemUsage, value: &summary.MemUsage},
+		{metricName: consts.MetricMemWorkingSetContainer, flag: ContainerMetricMemWorkingSet, value: &summary.MemWorkingSet},
+		{metricName: consts.MetricMemBandwidthReadContainer, flag: ContainerMetricMemBandwidthRead, value: &summary.MemBandwidthRead},
+		{metricName: consts.MetricMemBandwidthWriteContainer, flag: ContainerMetricMemBandwidthWrite, value: &summary.MemBandwidthWrite},
+	}
+
+	metricNames := make([]string, 0, len(fields))
+	for _, field := range fields {
+		metricNames = append(metricNames, field.metricName)
+	}
+
+	metrics := m.metricStore.GetContainerMetrics(podUID, containerName, metricNames, maxAge)
+	for _, field := range fields {
+		data, ok := metrics[field.metricName]
+		if !ok {
+			continue
+		}
+		*field.value = data.Value
+		summary.Flags |= field.flag
+		summary.UpdateTime = general.MaxTimePtr(summary.UpdateTime, data.Time)
+	}
+	return summary
+}
@@ -0,0 +1,59 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package malachite
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kubewharf/katalyst-core/pkg/consts"
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/pod"
+	"github.com/kubewharf/katalyst-core/pkg/metrics"
+	utilmetric "github.com/kubewharf/katalyst-core/pkg/util/metric"
+)
+
+func TestMalachiteMetricsFetcher_GetContainerMetricsSummary(t *testing.T) {
+	t.Parallel()
+
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+
+	now := time.Now()
+	stale := now.Add(-time.Hour)
+	f.metricStore.SetContainerMetric("pod1", "c1", consts.MetricCPUUsageContainer, utilmetric.MetricData{Value: 2, Time: &now})
+	f.metricStore.SetContainerMetric("pod1", "c1", consts.MetricMemWorkingSetContainer, utilmetric.MetricData{Value: 1024, Time: &now})
+	f.metricStore.SetContainerMetric("pod1", "c1", consts.MetricMemBandwidthReadContainer, utilmetric.MetricData{Value: 100, Time: &stale})
+
+	summary := f.GetContainerMetricsSummary("pod1", "c1", time.Minute)
+	assert.Equal(t, ContainerMetricCPUUsage|ContainerMetricMemWorkingSet, summary.Flags)
+	assert.True(t, summary.Flags.Has(ContainerMetricCPUUsage))
+	assert.False(t, summary.Flags.Has(ContainerMetricCPUUsage|ContainerMetricMemBandwidthRead))
+	assert.Equal(t, float64(2), summary.CPUUsage)
+	assert.Equal(t, float64(1024), summary.MemWorkingSet)
+	assert.Equal(t, float64(0), summary.MemBandwidthRead)
+	assert.True(t, summary.UpdateTime.Equal(now))
+
+	// stale metrics are present if max age is not limited
+	summary = f.GetContainerMetricsSummary("pod1", "c1", 0)
+	assert.Equal(t, ContainerMetricCPUUsage|ContainerMetricMemWorkingSet|ContainerMetricMemBandwidthRead, summary.Flags)
+	assert.Equal(t, float64(100), summary.MemBandwidthRead)
+
+	summary = f.GetContainerMetricsSummary("pod1", "unknown", 0)
+	assert.Equal(t, ContainerMetricFlags(0), summary.Flags)
+	assert.Nil(t, summary.UpdateTime)
+}
@@ -17,6 +17,9 @@ limitations under the License.
 package malachite
 
 import (
+	"context"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -24,6 +27,8 @@ import (
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
+	globalconfig "github.com/kubewharf/katalyst-core/pkg/config/agent/global"
+	"github.com/kubewharf/katalyst-core/pkg/consts"
 	metric2 "github.com/kubewharf/katalyst-core/pkg/metaserver/agent/metric"
 	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/metric/malachite/types"
 	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/pod"
@@ -32,6 +37,31 @@ import (
 	"github.com/kubewharf/katalyst-core/pkg/util/metric"
 )
 
+// countingEmitter records the sum of int64 metrics emitted by their names
+type countingEmitter struct {
+	metrics.DummyMetrics
+
+	sync.Mutex
+	counts map[string]int64
+}
+
+func newCountingEmitter() *countingEmitter {
+	return &countingEmitter{counts: make(map[string]int64)}
+}
+
+func (c *countingEmitter) StoreInt64(key string, val int64, _ metrics.MetricTypeName, _ ...metrics.MetricTag) error {
+	c.Lock()
+	defer c.Unlock()
+	c.counts[key] += val
+	return nil
+}
+
+func (c *countingEmitter) count(key string) int64 {
+	c.Lock()
+	defer c.Unlock()
+	return c.counts[key]
+}
+
 func Test_noneExistMetricsFetcher(t *testing.T) {
 	t.Parallel()
 
@@ -203,6 +233,442 @@ func Test_notifySystem(t *testing.T) {
 	time.Sleep(time.Millisecond * 3)
 }
 
+func Test_notifyOnChange(t *testing.T) {
+	t.Parallel()
+
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+	f.metricConf.NotifierEmitOnChange = true
+	f.metricConf.NotifierChangeTolerance = 0.5
+	f.metricConf.NotifierKeepAliveInterval = time.Minute
+
+	rChan := make(chan metric2.NotifiedResponse, 20)
+	req := metric2.NotifiedRequest{MetricName: "test-node-metric"}
+	key := f.RegisterNotifier(metric2.MetricsScopeNode, req, rChan)
+	reg := f.registeredNotifier[metric2.MetricsScopeNode][key]
+
+	now := time.Now()
+	f.notify(key, reg, metric.MetricData{Value: 10, Time: &now}, now)
+	assert.Len(t, rChan, 1)
+
+	// changed
+	f.notify(key, reg, metric.MetricData{Value: 11, Time: &now}, now.Add(time.Second))
+	assert.Len(t, rChan, 2)
+
+	// unchanged within tolerance and keepalive interval
+	f.notify(key, reg, metric.MetricData{Value: 11.3, Time: &now}, now.Add(2*time.Second))
+	assert.Len(t, rChan, 2)
+
+	// unchanged but past keepalive interval
+	f.notify(key, reg, metric.MetricData{Value: 11.3, Time: &now}, now.Add(2*time.Minute))
+	assert.Len(t, rChan, 3)
+
+	for _, want := range []float64{10, 11, 11.3} {
+		response := <-rChan
+		assert.Equal(t, want, response.Value)
+	}
+
+	f.DeRegisterNotifier(metric2.MetricsScopeNode, key)
+	assert.Empty(t, f.lastNotified)
+}
+
+func Test_checkMalachiteSchemaVersion(t *testing.T) {
+	t.Parallel()
+
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+
+	// recognized versions
+	assert.True(t, f.checkMalachiteSchemaVersion(""))
+	assert.True(t, f.checkMalachiteSchemaVersion("v1"))
+
+	// unrecognized version only warns by default
+	assert.True(t, f.checkMalachiteSchemaVersion("v100"))
+
+	// unrecognized version holds the last metrics
+	f.metricConf.UnknownSchemaVersionPolicy = globalconfig.UnknownSchemaVersionPolicyHold
+	assert.True(t, f.checkMalachiteSchemaVersion("v1"))
+	assert.False(t, f.checkMalachiteSchemaVersion("v100"))
+}
+
+func Test_sampleOnce(t *testing.T) {
+	t.Parallel()
+
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+	f.malachiteClient.SetURL(map[string]string{})
+
+	// the previous cycle has not finished yet
+	atomic.StoreInt32(&f.sampling, 1)
+	f.sampleOnce(context.Background())
+	f.sampleOnce(context.Background())
+	assert.Equal(t, int64(2), atomic.LoadInt64(&f.skippedTicks))
+
+	atomic.StoreInt32(&f.sampling, 0)
+	f.sampleOnce(context.Background())
+	assert.Equal(t, int64(2), atomic.LoadInt64(&f.skippedTicks))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&f.sampling))
+}
+
+func Test_namedMetricStores(t *testing.T) {
+	t.Parallel()
+
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+	now := time.Now()
+
+	f.RegisterExternalMetricToStore("store-a", func(store *metric.MetricStore) {
+		store.SetNodeMetric("test-metric-name", metric.MetricData{Value: 1, Time: &now})
+	})
+	f.RegisterExternalMetricToStore("store-b", func(store *metric.MetricStore) {
+		store.SetNodeMetric("test-metric-name", metric.MetricData{Value: 2, Time: &now})
+		store.SetContainerMetric("pod1", "c1", "test-metric-name", metric.MetricData{Value: 2, Time: &now})
+	})
+	f.RegisterExternalMetric(func(store *metric.MetricStore) {
+		store.SetNodeMetric("test-metric-name", metric.MetricData{Value: 3, Time: &now})
+	})
+
+	f.updateExternalMetrics()
+
+	for storeName, want := range map[string]float64{"store-a": 1, "store-b": 2, "": 3, metric2.DefaultMetricStoreName: 3} {
+		store, err := f.GetMetricStore(storeName)
+		assert.NoError(t, err)
+		data, err := store.GetNodeMetric("test-metric-name")
+		assert.NoError(t, err)
+		assert.Equal(t, want, data.Value, storeName)
+	}
+
+	// stores are evicted independently
+	f.metricStore.GCPodsMetric(map[string]bool{})
+	storeB, _ := f.GetMetricStore("store-b")
+	_, err := storeB.GetContainerMetric("pod1", "c1", "test-metric-name")
+	assert.NoError(t, err)
+	storeB.GCPodsMetric(map[string]bool{})
+	_, err = storeB.GetContainerMetric("pod1", "c1", "test-metric-name")
+	assert.Error(t, err)
+
+	storeA, _ := f.GetMetricStore("store-a")
+	_, err = storeA.GetContainerMetric("pod1", "c1", "test-metric-name")
+	assert.Error(t, err)
+
+	_, err = f.GetMetricStore("store-not-exist")
+	assert.Error(t, err)
+}
+
+func Test_processContainerPidsData(t *testing.T) {
+	t.Parallel()
+
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+
+	f.processContainerPidsData("pod1", "v1", &types.MalachiteCgroupInfo{
+		CgroupType: "V1",
+		V1:         &types.MalachiteCgroupV1Info{Pids: &types.PidsCgData{PidsCurrent: 10, UpdateTime: 100}},
+	})
+	f.processContainerPidsData("pod1", "v2", &types.MalachiteCgroupInfo{
+		CgroupType: "V2",
+		V2:         &types.MalachiteCgroupV2Info{Pids: &types.PidsCgData{PidsCurrent: 20, UpdateTime: 100}},
+	})
+	// pids controller is absent
+	f.processContainerPidsData("pod1", "absent", &types.MalachiteCgroupInfo{
+		CgroupType: "V2",
+		V2:         &types.MalachiteCgroupV2Info{},
+	})
+
+	data, err := f.GetContainerMetric("pod1", "v1", consts.MetricThreadCountContainer)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(10), data.Value)
+	data, err = f.GetContainerMetric("pod1", "v2", consts.MetricThreadCountContainer)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(20), data.Value)
+	_, err = f.GetContainerMetric("pod1", "absent", consts.MetricThreadCountContainer)
+	assert.Error(t, err)
+}
+
+func Test_processContainerSchedLatencyData(t *testing.T) {
+	t.Parallel()
+
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+
+	// buckets are not reported in order
+	f.processContainerSchedLatencyData("pod1", "v2", &types.MalachiteCgroupInfo{
+		CgroupType: "V2",
+		V2: &types.MalachiteCgroupV2Info{Cpu: &types.CPUCgDataV2{UpdateTime: 100, SchedLatency: []types.SchedLatencyBucket{
+			{UpperBoundNs: 1000, Count: 50},
+			{UpperBoundNs: 0, Count: 1},
+			{UpperBoundNs: 100000, Count: 9},
+			{UpperBoundNs: 10000, Count: 40},
+		}}},
+	})
+	// p99 falls in the unbounded bucket
+	f.processContainerSchedLatencyData("pod1", "v1", &types.MalachiteCgroupInfo{
+		CgroupType: "V1",
+		V1: &types.MalachiteCgroupV1Info{Cpu: &types.CPUCgDataV1{UpdateTime: 100, SchedLatency: []types.SchedLatencyBucket{
+			{UpperBoundNs: 1000, Count: 90},
+			{UpperBoundNs: 0, Count: 10},
+		}}},
+	})
+	// schedstats are not enabled
+	f.processContainerSchedLatencyData("pod1", "absent", &types.MalachiteCgroupInfo{
+		CgroupType: "V2",
+		V2:         &types.MalachiteCgroupV2Info{Cpu: &types.CPUCgDataV2{UpdateTime: 100}},
+	})
+
+	for _, tt := range []struct {
+		containerName string
+		metricName    string
+		want          float64
+	}{
+		{containerName: "v2", metricName: consts.MetricSchedLatencyP50Container, want: 1000},
+		{containerName: "v2", metricName: consts.MetricSchedLatencyP99Container, want: 100000},
+		{containerName: "v1", metricName: consts.MetricSchedLatencyP50Container, want: 1000},
+		{containerName: "v1", metricName: consts.MetricSchedLatencyP99Container, want: 1000},
+	} {
+		data, err := f.GetContainerMetric("pod1", tt.containerName, tt.metricName)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.want, data.Value, tt.containerName+"/"+tt.metricName)
+	}
+	_, err := f.GetContainerMetric("pod1", "absent", consts.MetricSchedLatencyP99Container)
+	assert.Error(t, err)
+}
+
+func Test_processContainerHugePageData(t *testing.T) {
+	t.Parallel()
+
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+
+	// only 2Mi is configured on the host
+	f.processContainerHugePageData("pod1", "c1", &types.MalachiteCgroupInfo{
+		CgroupType: "V2",
+		V2: &types.MalachiteCgroupV2Info{Hugetlb: &types.HugetlbCgData{
+			Usage:      map[string]uint64{"2Mi": 4 << 20},
+			UpdateTime: 100,
+		}},
+	})
+	// hugetlb controller is absent
+	f.processContainerHugePageData("pod1", "absent", &types.MalachiteCgroupInfo{
+		CgroupType: "V1",
+		V1:         &types.MalachiteCgroupV1Info{},
+	})
+
+	data, err := f.GetContainerMetric("pod1", "c1", hugePageUsageMetricName("2Mi"))
+	assert.NoError(t, err)
+	assert.Equal(t, float64(4<<20), data.Value)
+	_, err = f.GetContainerMetric("pod1", "c1", hugePageUsageMetricName("1Gi"))
+	assert.Error(t, err)
+	_, err = f.GetContainerMetric("pod1", "absent", hugePageUsageMetricName("2Mi"))
+	assert.Error(t, err)
+}
+
+func Test_processContainerIOPressure(t *testing.T) {
+	t.Parallel()
+
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+	f.processContainerBlkIOData("pod1", "c1", &types.MalachiteCgroupInfo{
+		CgroupType: "V2",
+		V2: &types.MalachiteCgroupV2Info{Blkio: &types.BlkIOCgDataV2{
+			IoPressure: &types.Pressure{
+				Some: types.Some{Avg10: 12.5, Avg60: 8, Avg300: 3},
+				Full: types.Full{Avg10: 6.5, Avg60: 4, Avg300: 1},
+			},
+			UpdateTime: 100,
+		}},
+	})
+
+	for metricName, want := range map[string]float64{
+		consts.MetricIOPressureSomeContainer:       12.5,
+		consts.MetricIOPressureSomeAvg60Container:  8,
+		consts.MetricIOPressureSomeAvg300Container: 3,
+		consts.MetricIOPressureFullContainer:       6.5,
+		consts.MetricIOPressureFullAvg60Container:  4,
+		consts.MetricIOPressureFullAvg300Container: 1,
+	} {
+		data, err := f.GetContainerMetric("pod1", "c1", metricName)
+		assert.NoError(t, err, metricName)
+		assert.Equal(t, want, data.Value, metricName)
+	}
+
+	// io pressure is not reported
+	f.processContainerBlkIOData("pod1", "absent", &types.MalachiteCgroupInfo{
+		CgroupType: "V2",
+		V2:         &types.MalachiteCgroupV2Info{Blkio: &types.BlkIOCgDataV2{UpdateTime: 100}},
+	})
+	for _, metricName := range []string{
+		consts.MetricIOPressureSomeContainer,
+		consts.MetricIOPressureSomeAvg60Container,
+		consts.MetricIOPressureSomeAvg300Container,
+		consts.MetricIOPressureFullContainer,
+		consts.MetricIOPressureFullAvg60Container,
+		consts.MetricIOPressureFullAvg300Container,
+	} {
+		_, err := f.GetContainerMetric("pod1", "absent", metricName)
+		assert.Error(t, err, metricName)
+	}
+	_, err := f.GetContainerMetric("pod1", "absent", consts.MetricBlkioUpdateTimeContainer)
+	assert.NoError(t, err)
+}
+
+func Test_processContainerStatsRecoverPanic(t *testing.T) {
+	t.Parallel()
+
+	emitter := newCountingEmitter()
+	f := NewMalachiteMetricsFetcher(emitter, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+
+	good := newTestCgroupInfoV2(100, 1<<20)
+	good.V2.Pids = &types.PidsCgData{PidsCurrent: 10, UpdateTime: 100}
+	podsContainersStats := map[string]map[string]*types.MalachiteCgroupInfo{
+		"pod1": {
+			// cpu sub-field is missing, which makes the processing panic
+			"bad":  {CgroupType: "V1", V1: &types.MalachiteCgroupV1Info{}},
+			"good": good,
+		},
+	}
+	f.processPodsContainersStats(podsContainersStats)
+
+	assert.Error(t, f.GetContainerLastError("pod1", "bad"))
+	assert.NoError(t, f.GetContainerLastError("pod1", "good"))
+	assert.Equal(t, int64(1), emitter.count(metricsNameMalachiteContainerFailed))
+	data, err := f.GetContainerMetric("pod1", "good", consts.MetricThreadCountContainer)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(10), data.Value)
+
+	// the error is cleared once the container is processed successfully
+	f.recordContainerError("pod1", "bad", nil)
+	assert.NoError(t, f.GetContainerLastError("pod1", "bad"))
+}
+
+func Test_processPodsContainersStatsCgroupVersionAllowList(t *testing.T) {
+	t.Parallel()
+
+	emitter := newCountingEmitter()
+	f := NewMalachiteMetricsFetcher(emitter, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+	f.metricConf.CgroupVersionAllowList = []string{globalconfig.CgroupVersionV2}
+
+	v1Stats := &types.MalachiteCgroupInfo{
+		CgroupType: "V1",
+		V1: &types.MalachiteCgroupV1Info{
+			Memory:    &types.MemoryCgDataV1{},
+			Blkio:     &types.BlkIOCgDataV1{},
+			NetCls:    &types.NetClsCgData{},
+			PerfEvent: &types.PerfEventData{},
+			CpuSet:    &types.CPUSetCgDataV1{},
+			Cpu:       &types.CPUCgDataV1{},
+			Pids:      &types.PidsCgData{PidsCurrent: 5, UpdateTime: 100},
+		},
+	}
+	v2Stats := newTestCgroupInfoV2(100, 1<<20)
+	v2Stats.V2.Pids = &types.PidsCgData{PidsCurrent: 10, UpdateTime: 100}
+
+	for i := 0; i < 2; i++ {
+		f.processPodsContainersStats(map[string]map[string]*types.MalachiteCgroupInfo{
+			"pod1": {"v1": v1Stats, "v2": v2Stats},
+		})
+	}
+
+	_, err := f.GetContainerMetric("pod1", "v1", consts.MetricThreadCountContainer)
+	assert.Error(t, err)
+	data, err := f.GetContainerMetric("pod1", "v2", consts.MetricThreadCountContainer)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(10), data.Value)
+	assert.Equal(t, int64(2), f.cgroupVersionSkipped)
+	assert.Equal(t, int64(2), emitter.count(metricsNameMalachiteCgroupVersionSkipped))
+
+	// both versions are processed by default
+	f.metricConf.CgroupVersionAllowList = nil
+	f.processPodsContainersStats(map[string]map[string]*types.MalachiteCgroupInfo{
+		"pod1": {"v1": v1Stats},
+	})
+	data, err = f.GetContainerMetric("pod1", "v1", consts.MetricThreadCountContainer)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(5), data.Value)
+}
+
+func Test_processPodsContainersStatsContainersProcessed(t *testing.T) {
+	t.Parallel()
+
+	emitter := newCountingEmitter()
+	f := NewMalachiteMetricsFetcher(emitter, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+	f.metricConf.CgroupVersionAllowList = []string{globalconfig.CgroupVersionV2}
+
+	v1Stats := &types.MalachiteCgroupInfo{CgroupType: "V1", V1: &types.MalachiteCgroupV1Info{}}
+	f.processPodsContainersStats(map[string]map[string]*types.MalachiteCgroupInfo{
+		"pod1": {"c1": newTestCgroupInfoV2(100, 0), "c2": newTestCgroupInfoV2(100, 0)},
+		"pod2": {"c1": newTestCgroupInfoV2(100, 0), "skipped": v1Stats},
+	})
+	lastCycle, total := f.GetContainersProcessed()
+	assert.Equal(t, int64(3), lastCycle)
+	assert.Equal(t, int64(3), total)
+
+	f.processPodsContainersStats(map[string]map[string]*types.MalachiteCgroupInfo{
+		"pod1": {"c1": newTestCgroupInfoV2(110, 0)},
+	})
+	lastCycle, total = f.GetContainersProcessed()
+	assert.Equal(t, int64(1), lastCycle)
+	assert.Equal(t, int64(4), total)
+	assert.Equal(t, int64(4), emitter.count(metricsNameMalachiteProcessedTotal))
+}
+
+func Test_processPodsContainersStatsCgroupTypeCase(t *testing.T) {
+	t.Parallel()
+
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+
+	newStats := func(cgroupType string, pids uint64) *types.MalachiteCgroupInfo {
+		return &types.MalachiteCgroupInfo{
+			CgroupType: cgroupType,
+			V1: &types.MalachiteCgroupV1Info{
+				Memory:    &types.MemoryCgDataV1{},
+				Blkio:     &types.BlkIOCgDataV1{},
+				NetCls:    &types.NetClsCgData{},
+				PerfEvent: &types.PerfEventData{},
+				CpuSet:    &types.CPUSetCgDataV1{},
+				Cpu:       &types.CPUCgDataV1{},
+				Pids:      &types.PidsCgData{PidsCurrent: pids, UpdateTime: 100},
+			},
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		f.processPodsContainersStats(map[string]map[string]*types.MalachiteCgroupInfo{
+			"pod1": {"lower": newStats("v1", 5), "spaced": newStats("V1 ", 6), "unknown": newStats("v3", 7)},
+		})
+	}
+
+	data, err := f.GetContainerMetric("pod1", "lower", consts.MetricThreadCountContainer)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(5), data.Value)
+	data, err = f.GetContainerMetric("pod1", "spaced", consts.MetricThreadCountContainer)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(6), data.Value)
+	_, err = f.GetContainerMetric("pod1", "unknown", consts.MetricThreadCountContainer)
+	assert.Error(t, err)
+
+	// unknown type is only recorded once
+	assert.Equal(t, []string{"v3"}, f.unknownCgroupTypes.List())
+
+	// allow list is matched with the normalized version
+	f.metricConf.CgroupVersionAllowList = []string{globalconfig.CgroupVersionV1}
+	assert.NoError(t, f.ProcessContainerStats("pod1", "lower", newStats(" v1", 8)))
+}
+
+func TestMalachiteMetricsFetcher_ProcessContainerStats(t *testing.T) {
+	t.Parallel()
+
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+
+	// 1MB read in 5 seconds
+	assert.NoError(t, f.ProcessContainerStats("pod1", "container1", newTestCgroupInfoV2(100, 1<<20)))
+	assert.NoError(t, f.ProcessContainerStats("pod1", "container1", newTestCgroupInfoV2(105, 1<<20+16384)))
+	data, err := f.GetContainerMetric("pod1", "container1", consts.MetricMemBandwidthReadContainer)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.2, data.Value)
+
+	assert.Error(t, f.ProcessContainerStats("pod1", "container1", nil))
+	assert.Error(t, f.GetContainerLastError("pod1", "container1"))
+
+	f.metricConf.CgroupVersionAllowList = []string{globalconfig.CgroupVersionV1}
+	assert.Error(t, f.ProcessContainerStats("pod1", "container1", newTestCgroupInfoV2(110, 1<<20)))
+
+	f.Close()
+	f.metricConf.CgroupVersionAllowList = nil
+	assert.Error(t, f.ProcessContainerStats("pod1", "container1", newTestCgroupInfoV2(110, 1<<20)))
+}
+
 func TestStore_Aggregate(t *testing.T) {
 	t.Parallel()
 
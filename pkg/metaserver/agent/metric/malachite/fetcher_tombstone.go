@@ -0,0 +1,74 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package malachite
+
+import (
+	"time"
+)
+
+// tombstoneMissingPods marks pods not reported in this cycle as tombstones, and returns the pods whose
+// metrics and states should be kept, including both living pods and those tombstoned within the grace
+// period. Tombstones of pods reported again are cleared, so their baselines are kept.
+func (m *MalachiteMetricsFetcher) tombstoneMissingPods(livingPodUIDSet map[string]bool, now time.Time) map[string]bool {
+	m.podTombstoneLock.Lock()
+	defer m.podTombstoneLock.Unlock()
+
+	for podUID := range m.podTombstones {
+		if livingPodUIDSet[podUID] {
+			delete(m.podTombstones, podUID)
+		}
+	}
+
+	grace := m.metricConf.PodMetricGCGracePeriod
+	if grace <= 0 {
+		m.podTombstones = make(map[string]time.Time)
+		m.keptPodUIDSet = livingPodUIDSet
+		return livingPodUIDSet
+	}
+
+	for podUID := range m.keptPodUIDSet {
+		if !livingPodUIDSet[podUID] {
+			if _, ok := m.podTombstones[podUID]; !ok {
+				m.podTombstones[podUID] = now
+			}
+		}
+	}
+
+	keptPodUIDSet := make(map[string]bool, len(livingPodUIDSet)+len(m.podTombstones))
+	for podUID := range livingPodUIDSet {
+		keptPodUIDSet[podUID] = true
+	}
+	for podUID, missingTime := range m.podTombstones {
+		if now.Sub(missingTime) >= grace {
+			delete(m.podTombstones, podUID)
+			continue
+		}
+		keptPodUIDSet[podUID] = true
+	}
+	m.keptPodUIDSet = keptPodUIDSet
+	return keptPodUIDSet
+}
+
+// IsPodTombstoned returns whether the pod is no longer reported by malachite but its metrics
+// are still kept as stale ones within the grace period.
+func (m *MalachiteMetricsFetcher) IsPodTombstoned(podUID string) bool {
+	m.podTombstoneLock.RLock()
+	defer m.podTombstoneLock.RUnlock()
+
+	_, ok := m.podTombstones[podUID]
+	return ok
+}
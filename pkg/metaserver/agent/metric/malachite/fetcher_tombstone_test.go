@@ -0,0 +1,77 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package malachite
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kubewharf/katalyst-core/pkg/consts"
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/pod"
+	"github.com/kubewharf/katalyst-core/pkg/metrics"
+	utilmetric "github.com/kubewharf/katalyst-core/pkg/util/metric"
+)
+
+func TestMalachiteMetricsFetcher_tombstoneMissingPods(t *testing.T) {
+	t.Parallel()
+
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+	f.metricConf.PodMetricGCGracePeriod = time.Minute
+	now := time.Now()
+	for _, podUID := range []string{"pod1", "pod2"} {
+		f.metricStore.SetContainerMetric(podUID, "c1", consts.MetricOCRReadDRAMsContainer, utilmetric.MetricData{Value: 100, Time: &now})
+	}
+	gc := func(podUIDSet map[string]bool, now time.Time) {
+		f.metricStore.GCPodsMetric(f.tombstoneMissingPods(podUIDSet, now))
+	}
+
+	gc(map[string]bool{"pod1": true, "pod2": true}, now)
+	assert.False(t, f.IsPodTombstoned("pod1"))
+
+	// pod1 disappears transiently, and its baseline is kept as a stale metric
+	gc(map[string]bool{"pod2": true}, now.Add(10*time.Second))
+	assert.True(t, f.IsPodTombstoned("pod1"))
+	data, err := f.GetContainerMetric("pod1", "c1", consts.MetricOCRReadDRAMsContainer)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(100), data.Value)
+
+	gc(map[string]bool{"pod1": true, "pod2": true}, now.Add(20*time.Second))
+	assert.False(t, f.IsPodTombstoned("pod1"))
+	_, err = f.GetContainerMetric("pod1", "c1", consts.MetricOCRReadDRAMsContainer)
+	assert.NoError(t, err)
+
+	// pod2 is deleted once the grace period passes since it was found missing
+	gc(map[string]bool{"pod1": true}, now.Add(30*time.Second))
+	assert.True(t, f.IsPodTombstoned("pod2"))
+	gc(map[string]bool{"pod1": true}, now.Add(80*time.Second))
+	assert.True(t, f.IsPodTombstoned("pod2"))
+	_, err = f.GetContainerMetric("pod2", "c1", consts.MetricOCRReadDRAMsContainer)
+	assert.NoError(t, err)
+	gc(map[string]bool{"pod1": true}, now.Add(90*time.Second))
+	assert.False(t, f.IsPodTombstoned("pod2"))
+	_, err = f.GetContainerMetric("pod2", "c1", consts.MetricOCRReadDRAMsContainer)
+	assert.Error(t, err)
+
+	// pods are deleted at once without grace period
+	f.metricConf.PodMetricGCGracePeriod = 0
+	gc(map[string]bool{}, now.Add(100*time.Second))
+	assert.False(t, f.IsPodTombstoned("pod1"))
+	_, err = f.GetContainerMetric("pod1", "c1", consts.MetricOCRReadDRAMsContainer)
+	assert.Error(t, err)
+}
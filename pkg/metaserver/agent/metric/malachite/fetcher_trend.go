@@ -0,0 +1,130 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package malachite
+
+import (
+	"time"
+
+	"github.com/kubewharf/katalyst-core/pkg/consts"
+	"github.com/kubewharf/katalyst-core/pkg/util/general"
+	"github.com/kubewharf/katalyst-core/pkg/util/metric"
+)
+
+// memBandwidthTrendMinSamples is the minimum number of samples in the window to fit the trend
+const memBandwidthTrendMinSamples = 3
+
+// memBandwidthSample is the total memory bandwidth of the container at the time
+type memBandwidthSample struct {
+	time  time.Time
+	value float64
+}
+
+// processContainerMemBandwidthTrend fits the total memory bandwidth samples of the container in the trend
+// window with least squares, and sets the direction of the slope as the trend. Slopes within the minimum
+// slope are regarded as flat, and it's skipped until enough samples are retained in the window.
+func (m *MalachiteMetricsFetcher) processContainerMemBandwidthTrend(podUID, containerName string, now time.Time) {
+	window := m.metricConf.MemBandwidthTrendWindow
+	if window <= 0 || !m.isDerivationDue(consts.MetricMemBandwidthTrendContainer) {
+		return
+	}
+
+	var (
+		readBandwidth, readErr   = m.metricStore.GetContainerMetric(podUID, containerName, consts.MetricMemBandwidthReadContainer)
+		writeBandwidth, writeErr = m.metricStore.GetContainerMetric(podUID, containerName, consts.MetricMemBandwidthWriteContainer)
+	)
+	if readErr != nil || writeErr != nil {
+		return
+	}
+	for _, data := range []metric.MetricData{readBandwidth, writeBandwidth} {
+		if data.Time == nil || now.Sub(*data.Time) > derivedMetricFreshness {
+			return
+		}
+	}
+
+	if _, ok := m.memBandwidthTrends[podUID]; !ok {
+		m.memBandwidthTrends[podUID] = make(map[string][]memBandwidthSample)
+	}
+	samples := m.memBandwidthTrends[podUID][containerName]
+
+	sampleTime := general.MaxTimePtr(readBandwidth.Time, writeBandwidth.Time)
+	if len(samples) > 0 && !sampleTime.After(samples[len(samples)-1].time) {
+		return
+	}
+	samples = append(samples, memBandwidthSample{time: *sampleTime, value: readBandwidth.Value + writeBandwidth.Value})
+
+	start := 0
+	for start < len(samples) && sampleTime.Sub(samples[start].time) > window {
+		start++
+	}
+	samples = samples[start:]
+	m.memBandwidthTrends[podUID][containerName] = samples
+
+	if len(samples) < memBandwidthTrendMinSamples {
+		return
+	}
+
+	slope, ok := linearSlopeOf(samples)
+	if !ok {
+		return
+	}
+
+	trend := 0.
+	if slope > m.metricConf.MemBandwidthTrendMinSlope {
+		trend = 1
+	} else if slope < -m.metricConf.MemBandwidthTrendMinSlope {
+		trend = -1
+	}
+	m.metricStore.SetContainerMetric(podUID, containerName, consts.MetricMemBandwidthTrendContainer,
+		metric.MetricData{Value: trend, Time: sampleTime})
+}
+
+// linearSlopeOf returns the slope (per second) of the least squares line fitting the samples, and it
+// returns false if the slope is undefined, i.e. all samples are at the same time.
+func linearSlopeOf(samples []memBandwidthSample) (float64, bool) {
+	n := float64(len(samples))
+	if n == 0 {
+		return 0, false
+	}
+
+	// offsets of time are relative to the first sample to keep precision
+	var sumX, sumY float64
+	for _, sample := range samples {
+		sumX += sample.time.Sub(samples[0].time).Seconds()
+		sumY += sample.value
+	}
+	meanX, meanY := sumX/n, sumY/n
+
+	var covXY, varX float64
+	for _, sample := range samples {
+		dx := sample.time.Sub(samples[0].time).Seconds() - meanX
+		covXY += dx * (sample.value - meanY)
+		varX += dx * dx
+	}
+	if varX == 0 {
+		return 0, false
+	}
+	return covXY / varX, true
+}
+
+// gcMemBandwidthTrends removes bandwidth trend samples of pods not existing any more
+func (m *MalachiteMetricsFetcher) gcMemBandwidthTrends(livingPodUIDSet map[string]bool) {
+	for podUID := range m.memBandwidthTrends {
+		if !livingPodUIDSet[podUID] {
+			delete(m.memBandwidthTrends, podUID)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package malachite
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kubewharf/katalyst-core/pkg/consts"
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/pod"
+	"github.com/kubewharf/katalyst-core/pkg/metrics"
+	utilmetric "github.com/kubewharf/katalyst-core/pkg/util/metric"
+)
+
+func TestMalachiteMetricsFetcher_processContainerMemBandwidthTrend(t *testing.T) {
+	t.Parallel()
+
+	for _, tt := range []struct {
+		name   string
+		series []float64
+		want   float64
+	}{
+		{name: "rising", series: []float64{100, 120, 135, 160}, want: 1},
+		{name: "flat within min slope", series: []float64{100, 101, 99, 100}, want: 0},
+		{name: "falling", series: []float64{160, 140, 125, 100}, want: -1},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+			f.metricConf.MemBandwidthTrendWindow = time.Minute
+			f.metricConf.MemBandwidthTrendMinSlope = 1
+
+			now := time.Now()
+			for i, bandwidth := range tt.series {
+				sampleTime := now.Add(time.Duration(i-len(tt.series)) * time.Second)
+				f.metricStore.SetContainerMetric("pod1", "c1", consts.MetricMemBandwidthReadContainer,
+					utilmetric.MetricData{Value: bandwidth, Time: &sampleTime})
+				f.metricStore.SetContainerMetric("pod1", "c1", consts.MetricMemBandwidthWriteContainer,
+					utilmetric.MetricData{Value: 0, Time: &sampleTime})
+				f.processContainerMemBandwidthTrend("pod1", "c1", now)
+
+				// skipped until enough history is retained
+				_, err := f.GetContainerMetric("pod1", "c1", consts.MetricMemBandwidthTrendContainer)
+				assert.Equal(t, i+1 < memBandwidthTrendMinSamples, err != nil)
+			}
+
+			data, err := f.GetContainerMetric("pod1", "c1", consts.MetricMemBandwidthTrendContainer)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, data.Value)
+
+			f.gcMemBandwidthTrends(map[string]bool{})
+			assert.Empty(t, f.memBandwidthTrends)
+		})
+	}
+}
+
+func Test_linearSlopeOf(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	slope, ok := linearSlopeOf([]memBandwidthSample{
+		{time: now, value: 10},
+		{time: now.Add(2 * time.Second), value: 14},
+		{time: now.Add(4 * time.Second), value: 18},
+	})
+	assert.True(t, ok)
+	assert.InDelta(t, 2, slope, 1e-9)
+
+	_, ok = linearSlopeOf([]memBandwidthSample{{time: now, value: 10}, {time: now, value: 20}})
+	assert.False(t, ok)
+}
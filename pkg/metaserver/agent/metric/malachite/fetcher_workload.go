@@ -0,0 +1,113 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package malachite
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/kubewharf/katalyst-core/pkg/consts"
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/metric/malachite/types"
+	"github.com/kubewharf/katalyst-core/pkg/util/general"
+	utilmetric "github.com/kubewharf/katalyst-core/pkg/util/metric"
+)
+
+// WorkloadStandalone is the workload of pods without a recognizable workload identity,
+// i.e. neither labeled with MemBandwidthWorkloadLabel nor owned by a controller.
+const WorkloadStandalone = "standalone"
+
+// updatePodWorkloads refreshes the workload identity of pods
+func (m *MalachiteMetricsFetcher) updatePodWorkloads(pods []*v1.Pod) {
+	podWorkloads := make(map[string]string, len(pods))
+	for _, p := range pods {
+		podWorkloads[string(p.UID)] = m.workloadOf(p)
+	}
+	m.podWorkloads = podWorkloads
+}
+
+// workloadOf returns the workload identity of the pod as "namespace/name". The value of
+// MemBandwidthWorkloadLabel is preferred as the name, otherwise the controller owner is used,
+// and pods owned by ReplicaSets are identified by their Deployments.
+func (m *MalachiteMetricsFetcher) workloadOf(pod *v1.Pod) string {
+	if label := m.metricConf.MemBandwidthWorkloadLabel; label != "" {
+		if name, ok := pod.Labels[label]; ok && name != "" {
+			return fmt.Sprintf("%s/%s", pod.Namespace, name)
+		}
+	}
+
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return WorkloadStandalone
+	}
+
+	name := owner.Name
+	if hash, ok := pod.Labels[appsv1.DefaultDeploymentUniqueLabelKey]; ok && owner.Kind == "ReplicaSet" {
+		name = strings.TrimSuffix(name, "-"+hash)
+	}
+	return fmt.Sprintf("%s/%s", pod.Namespace, name)
+}
+
+// processWorkloadMemBandwidth sums up the read bandwidth of containers in current cycle by the workload of
+// their pods, and pods not found in the pod list are counted as standalone. Containers without fresh
+// bandwidth are not counted.
+func (m *MalachiteMetricsFetcher) processWorkloadMemBandwidth(podsContainersStats map[string]map[string]*types.MalachiteCgroupInfo) {
+	now := time.Now()
+	workloadMetrics := make(map[string]map[string]utilmetric.MetricData)
+	for podUID, containerStats := range podsContainersStats {
+		workload, ok := m.podWorkloads[podUID]
+		if !ok {
+			workload = WorkloadStandalone
+		}
+
+		for containerName := range containerStats {
+			data, err := m.metricStore.GetContainerMetric(podUID, containerName, consts.MetricMemBandwidthReadContainer)
+			if err != nil || data.Time == nil || now.Sub(*data.Time) > derivedMetricFreshness {
+				continue
+			}
+
+			if _, ok := workloadMetrics[workload]; !ok {
+				workloadMetrics[workload] = make(map[string]utilmetric.MetricData)
+			}
+			sum := workloadMetrics[workload][consts.MetricMemBandwidthReadWorkload]
+			sum.Value += data.Value
+			sum.Time = general.MaxTimePtr(sum.Time, data.Time)
+			workloadMetrics[workload][consts.MetricMemBandwidthReadWorkload] = sum
+		}
+	}
+
+	m.workloadMetricLock.Lock()
+	defer m.workloadMetricLock.Unlock()
+	m.workloadMetrics = workloadMetrics
+}
+
+// GetWorkloadMetric returns the metric aggregated by workload, and the workload is identified as
+// "namespace/name" or WorkloadStandalone.
+func (m *MalachiteMetricsFetcher) GetWorkloadMetric(workload, metricName string) (utilmetric.MetricData, error) {
+	m.workloadMetricLock.RLock()
+	defer m.workloadMetricLock.RUnlock()
+
+	data, ok := m.workloadMetrics[workload][metricName]
+	if !ok {
+		return utilmetric.MetricData{}, fmt.Errorf("metric %v of workload %v not found", metricName, workload)
+	}
+	return data, nil
+}
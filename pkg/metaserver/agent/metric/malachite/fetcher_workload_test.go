@@ -0,0 +1,96 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package malachite
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/kubewharf/katalyst-core/pkg/consts"
+	malachitetypes "github.com/kubewharf/katalyst-core/pkg/metaserver/agent/metric/malachite/types"
+	"github.com/kubewharf/katalyst-core/pkg/metaserver/agent/pod"
+	"github.com/kubewharf/katalyst-core/pkg/metrics"
+	utilmetric "github.com/kubewharf/katalyst-core/pkg/util/metric"
+)
+
+func TestMalachiteMetricsFetcher_processWorkloadMemBandwidth(t *testing.T) {
+	t.Parallel()
+
+	isController := true
+	newPod := func(uid, name string) *v1.Pod {
+		return &v1.Pod{ObjectMeta: metav1.ObjectMeta{
+			UID:       types.UID(uid),
+			Name:      name,
+			Namespace: "default",
+			Labels:    map[string]string{"pod-template-hash": "5d8f7c"},
+			OwnerReferences: []metav1.OwnerReference{
+				{Kind: "ReplicaSet", Name: "web-5d8f7c", Controller: &isController},
+			},
+		}}
+	}
+
+	f := NewMalachiteMetricsFetcher(metrics.DummyMetrics{}, &pod.PodFetcherStub{}, nil).(*MalachiteMetricsFetcher)
+	f.updatePodWorkloads([]*v1.Pod{
+		newPod("pod1", "web-5d8f7c-a"),
+		newPod("pod2", "web-5d8f7c-b"),
+		{ObjectMeta: metav1.ObjectMeta{UID: "pod3", Name: "single", Namespace: "default"}},
+	})
+
+	now := time.Now()
+	podsContainersStats := map[string]map[string]*malachitetypes.MalachiteCgroupInfo{
+		"pod1": {"c1": nil, "c2": nil},
+		"pod2": {"c1": nil},
+		"pod3": {"c1": nil},
+		"pod4": {"c1": nil},
+	}
+	for podUID, containerStats := range podsContainersStats {
+		for containerName := range containerStats {
+			f.metricStore.SetContainerMetric(podUID, containerName, consts.MetricMemBandwidthReadContainer,
+				utilmetric.MetricData{Value: 10, Time: &now})
+		}
+	}
+	// stale bandwidth of containers is not counted
+	stale := now.Add(-2 * derivedMetricFreshness)
+	podsContainersStats["pod2"]["stale"] = nil
+	f.metricStore.SetContainerMetric("pod2", "stale", consts.MetricMemBandwidthReadContainer,
+		utilmetric.MetricData{Value: 100, Time: &stale})
+	f.processWorkloadMemBandwidth(podsContainersStats)
+
+	data, err := f.GetWorkloadMetric("default/web", consts.MetricMemBandwidthReadWorkload)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(30), data.Value)
+	assert.Equal(t, now, *data.Time)
+
+	// pods without owners and those unknown in the pod list are both standalone
+	data, err = f.GetWorkloadMetric(WorkloadStandalone, consts.MetricMemBandwidthReadWorkload)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(20), data.Value)
+
+	_, err = f.GetWorkloadMetric("default/single", consts.MetricMemBandwidthReadWorkload)
+	assert.Error(t, err)
+
+	// workload label is preferred to the owner
+	f.metricConf.MemBandwidthWorkloadLabel = "app"
+	labeled := newPod("pod1", "web-5d8f7c-a")
+	labeled.Labels["app"] = "frontend"
+	assert.Equal(t, "default/frontend", f.workloadOf(labeled))
+}
@@ -33,21 +33,27 @@ type CgroupDataInner struct {
 }
 
 type MalachiteCgroupV1Info struct {
-	Memory    *MemoryCgDataV1 `json:"memory"`
-	Blkio     *BlkIOCgDataV1  `json:"blkio"`
-	NetCls    *NetClsCgData   `json:"net_cls"`
-	PerfEvent *PerfEventData  `json:"perf_event"`
-	CpuSet    *CPUSetCgDataV1 `json:"cpuset"`
-	Cpu       *CPUCgDataV1    `json:"cpu"`
+	Memory    *MemoryCgDataV1  `json:"memory"`
+	Blkio     *BlkIOCgDataV1   `json:"blkio"`
+	NetCls    *NetClsCgData    `json:"net_cls"`
+	PerfEvent *PerfEventData   `json:"perf_event"`
+	CpuSet    *CPUSetCgDataV1  `json:"cpuset"`
+	Cpu       *CPUCgDataV1     `json:"cpu"`
+	Pids      *PidsCgData      `json:"pids"`
+	Hugetlb   *HugetlbCgData   `json:"hugetlb"`
+	Freezer   *FreezerCgDataV1 `json:"freezer"`
 }
 
 type MalachiteCgroupV2Info struct {
-	Memory    *MemoryCgDataV2 `json:"memory"`
-	Blkio     *BlkIOCgDataV2  `json:"blkio"`
-	NetCls    *NetClsCgData   `json:"net_cls"`
-	PerfEvent *PerfEventData  `json:"perf_event"`
-	CpuSet    *CPUSetCgDataV2 `json:"cpuset"`
-	Cpu       *CPUCgDataV2    `json:"cpu"`
+	Memory    *MemoryCgDataV2  `json:"memory"`
+	Blkio     *BlkIOCgDataV2   `json:"blkio"`
+	NetCls    *NetClsCgData    `json:"net_cls"`
+	PerfEvent *PerfEventData   `json:"perf_event"`
+	CpuSet    *CPUSetCgDataV2  `json:"cpuset"`
+	Cpu       *CPUCgDataV2     `json:"cpu"`
+	Pids      *PidsCgData      `json:"pids"`
+	Hugetlb   *HugetlbCgData   `json:"hugetlb"`
+	Freezer   *FreezerCgDataV2 `json:"freezer"`
 }
 
 type MalachiteCgroupInfo struct {
@@ -65,6 +71,9 @@ type SubSystemGroupsV1 struct {
 	PerfEvent PerfEventCg `json:"perf_event"`
 	Cpuset    CpusetCg    `json:"cpuset"`
 	Cpuacct   CpuacctCg   `json:"cpuacct"`
+	Pids      *PidsCg     `json:"pids,omitempty"`    // absent if pids controller is not mounted
+	Hugetlb   *HugetlbCg  `json:"hugetlb,omitempty"` // absent if hugetlb controller is not mounted
+	Freezer   *FreezerCg  `json:"freezer,omitempty"` // absent if freezer controller is not mounted
 }
 
 type MemoryCg struct {
@@ -91,6 +100,31 @@ type CpuacctCg struct {
 	} `json:"Cpu"`
 }
 
+type PidsCg struct {
+	V1 struct {
+		PidsData PidsCgData `json:"V1"`
+	} `json:"Pids"`
+}
+
+type HugetlbCg struct {
+	V1 struct {
+		HugetlbData HugetlbCgData `json:"V1"`
+	} `json:"Hugetlb"`
+}
+
+type FreezerCg struct {
+	V1 struct {
+		FreezerData FreezerCgDataV1 `json:"V1"`
+	} `json:"Freezer"`
+}
+
+// FreezerCgDataV1 is the state of freezer controller in cgroup v1
+type FreezerCgDataV1 struct {
+	FullPath   string `json:"full_path"`
+	State      string `json:"state"` // freezer.state, one of THAWED, FREEZING and FROZEN
+	UpdateTime int64  `json:"update_time"`
+}
+
 type NetClsCg struct {
 	NetData NetClsCgData `json:"Net"`
 }
@@ -123,12 +157,21 @@ type MemoryCgDataV1 struct {
 	TotalPgfault           uint64        `json:"total_pgfault"`
 	TotalPgmajfault        uint64        `json:"total_pgmajfault"`
 	TotalAllocstall        uint64        `json:"total_allocstall"`
+	TotalInactiveFile      uint64        `json:"total_inactive_file"`
+	TotalSwap              *uint64       `json:"total_swap,omitempty"` // swap usage in memory.stat, absent if swap accounting is disabled
 	WatermarkScaleFactor   *uint         `json:"watermark_scale_factor"`
 	OomCnt                 int           `json:"oom_cnt"`
 	NumaStats              []NumaStatsV1 `json:"numa_stat"`
+	MemPolicy              *MemPolicy    `json:"mem_policy,omitempty"` // absent if not reported by malachite
 	UpdateTime             int64         `json:"update_time"`
 }
 
+// MemPolicy is the numa memory policy assigned to tasks of the cgroup
+type MemPolicy struct {
+	Mode  string `json:"mode"`  // i.e. default, bind, interleave, preferred or local
+	Nodes string `json:"nodes"` // the node mask in list format, i.e. 0-1,3
+}
+
 type NumaStatsV1 struct {
 	NumaName                string `json:"numa_name"`
 	Total                   int    `json:"total"`
@@ -169,6 +212,12 @@ type BlkIOCgDataV1 struct {
 	BpfFsData    BpfFsData                  `json:"bpf_fs_data"`
 	OldBpfFsData BpfFsData                  `json:"old_bpf_fs_data"`
 	UpdateTime   int64                      `json:"update_time"`
+
+	// throttles are lines of blkio.throttle.* files, e.g. "8:16 1048576", and they are nil if not reported
+	ThrottleReadBpsDevice   []string `json:"throttle_read_bps_device,omitempty"`
+	ThrottleWriteBpsDevice  []string `json:"throttle_write_bps_device,omitempty"`
+	ThrottleReadIopsDevice  []string `json:"throttle_read_iops_device,omitempty"`
+	ThrottleWriteIopsDevice []string `json:"throttle_write_iops_device,omitempty"`
 }
 
 type BpfNetData struct {
@@ -216,6 +265,13 @@ type CPUSetCgDataV1 struct {
 	UpdateTime int64  `json:"update_time"`
 }
 
+// SchedLatencyBucket is a bucket of the distribution of runqueue wait of tasks in the cgroup, and
+// Count is the number of waits in the bucket rather than the cumulative one of all lower buckets.
+type SchedLatencyBucket struct {
+	UpperBoundNs uint64 `json:"le_ns"` // 0 means the bucket is unbounded
+	Count        uint64 `json:"count"`
+}
+
 type CPUBasicInfo struct {
 	CPUUsage    uint64 `json:"cpu_usage"`
 	CPUUserTime uint64 `json:"cpu_user_time"`
@@ -247,18 +303,32 @@ type CPUCgDataV1 struct {
 	IMCWrites             uint64       `json:"imc_writes"`
 	StoreAllInstructions  uint64       `json:"store_all_ins"`
 	StoreInstructions     uint64       `json:"store_ins"`
+	MBALimit              *uint64      `json:"mba_limit,omitempty"`      // only reported on hosts with RDT-MBA
+	MonotonicTime         uint64       `json:"monotonic_time,omitempty"` // boot-relative nanoseconds when sampled, zero if not reported
 	UpdateTime            int64        `json:"update_time"`
+	UpdateTimeNano        int64        `json:"update_time_nano,omitempty"` // unix nanoseconds of UpdateTime, zero if not reported
 	Cycles                uint64       `json:"cycles"`
 	Instructions          uint64       `json:"instructions"`
+
+	// per-numa counters are only reported on hosts supporting them, keyed by numa name, e.g. N0
+	NumaOCRReadDRAMs map[string]uint64 `json:"numa_ocr_read_drams,omitempty"`
+	// page-walk counters are only reported on hosts supporting them
+	DTLBWalkCycles *uint64 `json:"dtlb_walk_cycles,omitempty"`
+	ITLBWalkCycles *uint64 `json:"itlb_walk_cycles,omitempty"`
+	// scheduler latency distribution is only reported on hosts with schedstats enabled
+	SchedLatency []SchedLatencyBucket `json:"sched_latency,omitempty"`
 }
 
 type SubSystemGroupsV2 struct {
-	Memory    MemoryCgV2  `json:"memory"`
-	Blkio     BlkioCgV2   `json:"blkio"`
-	NetCls    NetClsCg    `json:"net_cls"`
-	PerfEvent PerfEventCg `json:"perf_event"`
-	Cpuset    CpusetCgV2  `json:"cpuset"`
-	Cpuacct   CpuacctCgV2 `json:"cpuacct"`
+	Memory    MemoryCgV2   `json:"memory"`
+	Blkio     BlkioCgV2    `json:"blkio"`
+	NetCls    NetClsCg     `json:"net_cls"`
+	PerfEvent PerfEventCg  `json:"perf_event"`
+	Cpuset    CpusetCgV2   `json:"cpuset"`
+	Cpuacct   CpuacctCgV2  `json:"cpuacct"`
+	Pids      *PidsCgV2    `json:"pids,omitempty"`    // absent if pids controller is not enabled
+	Hugetlb   *HugetlbCgV2 `json:"hugetlb,omitempty"` // absent if hugetlb controller is not enabled
+	Freezer   *FreezerCgV2 `json:"freezer,omitempty"` // absent if not reported by malachite
 }
 
 type MemoryCgV2 struct {
@@ -285,6 +355,48 @@ type CpuacctCgV2 struct {
 	} `json:"Cpu"`
 }
 
+type PidsCgV2 struct {
+	V2 struct {
+		PidsData PidsCgData `json:"V2"`
+	} `json:"Pids"`
+}
+
+// PidsCgData is shared by V1 and V2 since pids controller has the same interface files in both
+type PidsCgData struct {
+	FullPath    string `json:"full_path"`
+	PidsCurrent uint64 `json:"pids_current"`
+	PidsMax     uint64 `json:"pids_max"` // 18446744073709551615(u64_max) means unlimited
+	UpdateTime  int64  `json:"update_time"`
+}
+
+type FreezerCgV2 struct {
+	V2 struct {
+		FreezerData FreezerCgDataV2 `json:"V2"`
+	} `json:"Freezer"`
+}
+
+// FreezerCgDataV2 is the freeze state of the cgroup in cgroup v2, which is a core interface rather than a controller
+type FreezerCgDataV2 struct {
+	FullPath   string `json:"full_path"`
+	Freeze     uint64 `json:"freeze"` // cgroup.freeze, 1 if the cgroup is requested to be frozen
+	Frozen     uint64 `json:"frozen"` // frozen in cgroup.events, 1 if the cgroup has been frozen
+	UpdateTime int64  `json:"update_time"`
+}
+
+type HugetlbCgV2 struct {
+	V2 struct {
+		HugetlbData HugetlbCgData `json:"V2"`
+	} `json:"Hugetlb"`
+}
+
+// HugetlbCgData is shared by V1 and V2, and only page sizes configured on the host
+// are present in Usage, e.g. "2Mi" and "1Gi"
+type HugetlbCgData struct {
+	FullPath   string            `json:"full_path"`
+	Usage      map[string]uint64 `json:"usage"` // page size -> usage in bytes
+	UpdateTime int64             `json:"update_time"`
+}
+
 type MemoryCgDataV2 struct {
 	FullPath             string                 `json:"full_path"`
 	UserPath             string                 `json:"user_path"`
@@ -296,10 +408,12 @@ type MemoryCgDataV2 struct {
 	High                 uint64                 `json:"high"` //18446744073709551615(u64_max) means unlimited
 	Low                  uint64                 `json:"low"`
 	Min                  uint64                 `json:"min"`
-	SwapMax              uint64                 `json:"swap_max"` //18446744073709551615(u64_max) means unlimited
+	SwapMax              uint64                 `json:"swap_max"`               //18446744073709551615(u64_max) means unlimited
+	SwapCurrent          *uint64                `json:"swap_current,omitempty"` // absent if swap accounting is disabled
 	WatermarkScaleFactor *uint64                `json:"watermark_scale_factor"`
 	OomCnt               uint64                 `json:"oom_cnt"`
 	MemoryUsageInBytes   uint64                 `json:"memory_usage_in_bytes"`
+	MemPolicy            *MemPolicy             `json:"mem_policy,omitempty"` // absent if not reported by malachite
 	UpdateTime           int64                  `json:"update_time"`
 }
 
@@ -308,13 +422,16 @@ type BlkIOCgDataV2 struct {
 	UserPath     string                     `json:"user_path"`
 	IoStat       map[string]DeviceIoDetails `json:"io_stat"`
 	IoMax        map[string]uint64          `json:"io_max"`
-	IoPressure   Pressure                   `json:"io_pressure"`
+	IoPressure   *Pressure                  `json:"io_pressure,omitempty"` // absent if psi is not enabled for io
 	IoLatency    map[string]uint64          `json:"io_latency"`
 	IoWeight     map[string]uint64          `json:"io_weight"`
 	BpfFsData    BpfFsData                  `json:"bpf_fs_data"`
 	OldBpfFsData BpfFsData                  `json:"old_bpf_fs_data"`
 	BpfIoLatency BpfIoLatency               `json:"bpf_io_latency"`
 	UpdateTime   int64                      `json:"update_time"`
+
+	// IoMaxRaw is lines of io.max, e.g. "8:16 rbps=2097152 wbps=max riops=max wiops=120", and it's nil if not reported
+	IoMaxRaw []string `json:"io_max_raw,omitempty"`
 }
 
 // CPUCgDataV2
@@ -340,9 +457,20 @@ type CPUCgDataV2 struct {
 	IMCWrites             uint64   `json:"imc_writes"`
 	StoreAllInstructions  uint64   `json:"store_all_ins"`
 	StoreInstructions     uint64   `json:"store_ins"`
+	MBALimit              *uint64  `json:"mba_limit,omitempty"`      // only reported on hosts with RDT-MBA
+	MonotonicTime         uint64   `json:"monotonic_time,omitempty"` // boot-relative nanoseconds when sampled, zero if not reported
 	UpdateTime            int64    `json:"update_time"`
+	UpdateTimeNano        int64    `json:"update_time_nano,omitempty"` // unix nanoseconds of UpdateTime, zero if not reported
 	Cycles                uint64   `json:"cycles"`
 	Instructions          uint64   `json:"instructions"`
+
+	// per-numa counters are only reported on hosts supporting them, keyed by numa name, e.g. N0
+	NumaOCRReadDRAMs map[string]uint64 `json:"numa_ocr_read_drams,omitempty"`
+	// page-walk counters are only reported on hosts supporting them
+	DTLBWalkCycles *uint64 `json:"dtlb_walk_cycles,omitempty"`
+	ITLBWalkCycles *uint64 `json:"itlb_walk_cycles,omitempty"`
+	// scheduler latency distribution is only reported on hosts with schedstats enabled
+	SchedLatency []SchedLatencyBucket `json:"sched_latency,omitempty"`
 }
 
 type CPUSetCgDataV2 struct {
@@ -353,38 +481,40 @@ type CPUSetCgDataV2 struct {
 }
 
 type MemStats struct {
-	Anon                  uint64 `json:"anon"`
-	File                  uint64 `json:"file"`
-	KernelStack           uint64 `json:"kernel_stack"`
-	Sock                  uint64 `json:"sock"`
-	Shmem                 uint64 `json:"shmem"`
-	FileMapped            uint64 `json:"file_mapped"`
-	FileDirty             uint64 `json:"file_dirty"`
-	FileWriteback         uint64 `json:"file_writeback"`
-	AnonThp               uint64 `json:"anon_thp"`
-	InactiveAnon          uint64 `json:"inactive_anon"`
-	ActiveAnon            uint64 `json:"active_anon"`
-	InactiveFile          uint64 `json:"inactive_file"`
-	ActiveFile            uint64 `json:"active_file"`
-	Unevictable           uint64 `json:"unevictable"`
-	SlabReclaimable       uint64 `json:"slab_reclaimable"`
-	SlabUnreclaimable     uint64 `json:"slab_unreclaimable"`
-	Slab                  uint64 `json:"slab"`
-	BgdReclaim            uint64 `json:"bgd_reclaim"`
-	WorkingsetRefault     uint64 `json:"workingset_refault"`
-	WorkingsetActivate    uint64 `json:"workingset_activate"`
-	WorkingsetNodereclaim uint64 `json:"workingset_nodereclaim"`
-	Pgfault               uint64 `json:"pgfault"`
-	Pgmajfault            uint64 `json:"pgmajfault"`
-	Pgrefill              uint64 `json:"pgrefill"`
-	Pgscan                uint64 `json:"pgscan"`
-	Pgsteal               uint64 `json:"pgsteal"`
-	Pgactivate            uint64 `json:"pgactivate"`
-	Pgdeactivate          uint64 `json:"pgdeactivate"`
-	Pglazyfree            uint64 `json:"pglazyfree"`
-	Pglazyfreed           uint64 `json:"pglazyfreed"`
-	ThpFaultAlloc         uint64 `json:"thp_fault_alloc"`
-	ThpCollapseAlloc      uint64 `json:"thp_collapse_alloc"`
+	Anon                  uint64  `json:"anon"`
+	File                  uint64  `json:"file"`
+	KernelStack           uint64  `json:"kernel_stack"`
+	Sock                  uint64  `json:"sock"`
+	Shmem                 uint64  `json:"shmem"`
+	FileMapped            uint64  `json:"file_mapped"`
+	FileDirty             uint64  `json:"file_dirty"`
+	FileWriteback         uint64  `json:"file_writeback"`
+	AnonThp               uint64  `json:"anon_thp"`
+	InactiveAnon          uint64  `json:"inactive_anon"`
+	ActiveAnon            uint64  `json:"active_anon"`
+	InactiveFile          uint64  `json:"inactive_file"`
+	ActiveFile            uint64  `json:"active_file"`
+	Unevictable           uint64  `json:"unevictable"`
+	SlabReclaimable       uint64  `json:"slab_reclaimable"`
+	SlabUnreclaimable     uint64  `json:"slab_unreclaimable"`
+	Slab                  uint64  `json:"slab"`
+	BgdReclaim            uint64  `json:"bgd_reclaim"`
+	WorkingsetRefault     uint64  `json:"workingset_refault"`
+	WorkingsetActivate    uint64  `json:"workingset_activate"`
+	WorkingsetNodereclaim uint64  `json:"workingset_nodereclaim"`
+	Pgfault               uint64  `json:"pgfault"`
+	Pgmajfault            uint64  `json:"pgmajfault"`
+	Pgrefill              uint64  `json:"pgrefill"`
+	Pgscan                uint64  `json:"pgscan"`
+	Pgsteal               uint64  `json:"pgsteal"`
+	Pgactivate            uint64  `json:"pgactivate"`
+	Pgdeactivate          uint64  `json:"pgdeactivate"`
+	Pglazyfree            uint64  `json:"pglazyfree"`
+	Pglazyfreed           uint64  `json:"pglazyfreed"`
+	ThpFaultAlloc         uint64  `json:"thp_fault_alloc"`
+	ThpCollapseAlloc      uint64  `json:"thp_collapse_alloc"`
+	Pswpin                *uint64 `json:"pswpin,omitempty"`  // absent if not supported by kernel
+	Pswpout               *uint64 `json:"pswpout,omitempty"` // absent if not supported by kernel
 }
 
 type NumaStatsV2 struct {
@@ -86,10 +86,21 @@ type MalachiteSystemComputeResponse struct {
 }
 
 type SystemComputeData struct {
-	Load       Load  `json:"load"`
-	CPU        []CPU `json:"cpu"`
-	GlobalCPU  CPU   `json:"global_cpu"`
-	UpdateTime int64 `json:"update_time"`
+	// SchemaVersion is the version of response schema for all resources,
+	// and it's empty for those malachite not reporting its version.
+	SchemaVersion string `json:"schema_version,omitempty"`
+	Load          Load   `json:"load"`
+	CPU           []CPU  `json:"cpu"`
+	GlobalCPU     CPU    `json:"global_cpu"`
+	// Socket is only reported on hosts exposing RAPL
+	Socket     []ComputeSocket `json:"socket,omitempty"`
+	UpdateTime int64           `json:"update_time"`
+}
+
+// ComputeSocket contains the accumulated package energy of each cpu socket read from RAPL
+type ComputeSocket struct {
+	ID       int     `json:"id"`
+	EnergyUJ *uint64 `json:"energy_uj,omitempty"` // in microjoules
 }
 
 type Load struct {
@@ -104,6 +115,11 @@ type CPU struct {
 	CPUIowaitRatio float64  `json:"cpu_iowait_ratio"`
 	CPUSchedWait   float64  `json:"cpu_sched_wait"`
 	CpiData        *CpiData `json:"cpi_data"`
+	// CPUStealTime is the accumulated cpu steal time in nanoseconds,
+	// and it's only reported in virtualized environment.
+	CPUStealTime *uint64 `json:"cpu_steal_time,omitempty"`
+	// FrequencyMHz is the current frequency of the cpu, and it's only reported on hosts exposing cpufreq.
+	FrequencyMHz *float64 `json:"frequency_mhz,omitempty"`
 }
 
 type CpiData struct {
@@ -120,9 +136,10 @@ type MalachiteSystemMemoryResponse struct {
 }
 
 type SystemMemoryData struct {
-	System     System `json:"system"`
-	Numa       []Numa `json:"numa"`
-	UpdateTime int64  `json:"update_time"`
+	System     System   `json:"system"`
+	Numa       []Numa   `json:"numa"`
+	Socket     []Socket `json:"socket"`
+	UpdateTime int64    `json:"update_time"`
 }
 
 type System struct {
@@ -166,6 +183,14 @@ type Numa struct {
 	MemWriteLatency         float64 `json:"mem_write_latency"`
 }
 
+// Socket contains the accumulated counters of memory accesses served by
+// DRAM for each cpu socket, and the counters are calculated in cache lines.
+type Socket struct {
+	ID              int     `json:"id"`
+	LocalDRAMReads  *uint64 `json:"local_dram_reads,omitempty"`
+	RemoteDRAMReads *uint64 `json:"remote_dram_reads,omitempty"`
+}
+
 type Some struct {
 	Avg10  float64 `json:"avg10"`
 	Avg60  float64 `json:"avg60"`
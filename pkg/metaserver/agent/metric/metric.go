@@ -18,6 +18,8 @@ package metric
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	v1 "k8s.io/api/core/v1"
 
@@ -35,6 +37,9 @@ const (
 	MetricsScopeContainer MetricsScope = "container"
 )
 
+// DefaultMetricStoreName is the name of store for built-in metrics
+const DefaultMetricStoreName = "default"
+
 // NotifiedRequest defines the structure as requests for notifier
 type NotifiedRequest struct {
 	MetricName string
@@ -60,20 +65,50 @@ type NotifiedResponse struct {
 	metric.MetricData
 }
 
+// ExternalContainerMetric is a per-container metric provided by a source other than the fetcher
+// itself, e.g. GPU utilization from DCGM, to be correlated with built-in metrics.
+type ExternalContainerMetric struct {
+	PodUID        string
+	ContainerName string
+	MetricName    string
+	Value         float64
+	// Time is when the value is sampled by the provider, and the ingestion time is used if it's zero
+	Time time.Time
+}
+
+// Validate returns error if the metric can't be identified
+func (e ExternalContainerMetric) Validate() error {
+	if e.PodUID == "" || e.ContainerName == "" || e.MetricName == "" {
+		return fmt.Errorf("invalid external metric %q of pod %q container %q: all of them must be set",
+			e.MetricName, e.PodUID, e.ContainerName)
+	}
+	return nil
+}
+
 type MetricsReader interface {
 	// GetNodeMetric get metric of node.
 	GetNodeMetric(metricName string) (metric.MetricData, error)
+	// GetNodeMetricSeries get retained samples of node metric within the window, ordered by time.
+	GetNodeMetricSeries(metricName string, window time.Duration) []metric.MetricData
 	// GetNumaMetric get metric of numa.
 	GetNumaMetric(numaID int, metricName string) (metric.MetricData, error)
 	// GetDeviceMetric get metric of device.
 	GetDeviceMetric(deviceName string, metricName string) (metric.MetricData, error)
 	// GetCPUMetric get metric of cpu.
 	GetCPUMetric(coreID int, metricName string) (metric.MetricData, error)
+	// GetSocketMetric get metric of cpu socket.
+	GetSocketMetric(socketID int, metricName string) (metric.MetricData, error)
 	// GetContainerMetric get metric of container.
 	GetContainerMetric(podUID, containerName, metricName string) (metric.MetricData, error)
+	// GetPodContainerMetrics get metric of all containers in the pod, keyed by container name.
+	// metrics older than maxAge are skipped if maxAge is positive.
+	GetPodContainerMetrics(podUID, metricName string, maxAge time.Duration) map[string]metric.MetricData
 	// GetContainerNumaMetric get metric of container per numa.
 	GetContainerNumaMetric(podUID, containerName, numaNode, metricName string) (metric.MetricData, error)
 
+	// GetMetricUnit get the unit of metric, it's only recorded for some metrics.
+	GetMetricUnit(metricName string) (string, error)
+
 	// AggregatePodNumaMetric handles numa-level metric for all pods
 	AggregatePodNumaMetric(podList []*v1.Pod, numaNode, metricName string, agg metric.Aggregator, filter metric.ContainerMetricFilter) metric.MetricData
 	// AggregatePodMetric handles metric for all pods
@@ -106,6 +141,29 @@ type MetricsFetcher interface {
 	// RegisterExternalMetric register a function to set metric that can
 	// only be obtained from external sources
 	RegisterExternalMetric(f func(store *metric.MetricStore))
+	// RegisterExternalMetricToStore is like RegisterExternalMetric, but metrics will be set into the
+	// named store to be isolated from built-in metrics, and the store will be created if not exists.
+	RegisterExternalMetricToStore(storeName string, f func(store *metric.MetricStore))
+	// GetMetricStore returns the named store to read metrics from, and empty name or
+	// DefaultMetricStoreName refers to the store of built-in metrics.
+	GetMetricStore(storeName string) (*metric.MetricStore, error)
+
+	// IngestContainerMetrics sets per-container metrics pushed by the external provider into the store of
+	// built-in metrics, so that they can be read, aggregated and exported the same as built-in ones. Metric
+	// names should not collide with built-in metrics, otherwise they'll be overwritten in the next cycle.
+	// Invalid samples are rejected with an aggregated error, and valid ones are still ingested unless they
+	// are older than the stored ones, the provider is recorded as the source of ingested metrics.
+	IngestContainerMetrics(provider string, samples []ExternalContainerMetric) error
+
+	// ResetContainerMetricBaseline drops the previous counters used to calculate the given
+	// rate metric of container, so that the next sample will only be used as baseline, and
+	// the rate will not be smeared across a known workload transition. The metric value
+	// published already will be kept.
+	ResetContainerMetricBaseline(podUID, containerName, metricName string)
+
+	// Close stops collecting metrics, flushes the latest metrics to disk if persistence
+	// is enabled, and deregisters all notifiers without closing their channels. It's idempotent.
+	Close()
 
 	MetricsReader
 }
@@ -28,6 +28,7 @@ import (
 	"github.com/google/cadvisor/utils/sysfs"
 
 	"github.com/kubewharf/katalyst-core/pkg/config/agent/global"
+	"github.com/kubewharf/katalyst-core/pkg/util/general"
 )
 
 // GetKatalystMachineInfo returns KatalystMachineInfo by collecting machine info
@@ -53,12 +54,21 @@ func GetKatalystMachineInfo(conf *global.MachineInfoConfiguration) (*KatalystMac
 		return nil, err
 	}
 
+	// numa distances are optional, and those relying on them should be
+	// skipped rather than failing the whole machine info
+	extraTopologyInfo, err := GetExtraTopologyInfo()
+	if err != nil {
+		general.Warningf("get extra topology info failed: %v", err)
+		extraTopologyInfo = &ExtraTopologyInfo{}
+	}
+
 	return &KatalystMachineInfo{
-		MachineInfo:      machineInfo,
-		CPUTopology:      cpuTopology,
-		MemoryTopology:   memoryTopology,
-		ExtraCPUInfo:     extraCPUInfo,
-		ExtraNetworkInfo: extraNetworkInfo,
+		MachineInfo:       machineInfo,
+		CPUTopology:       cpuTopology,
+		MemoryTopology:    memoryTopology,
+		ExtraCPUInfo:      extraCPUInfo,
+		ExtraNetworkInfo:  extraNetworkInfo,
+		ExtraTopologyInfo: extraTopologyInfo,
 	}, nil
 }
 
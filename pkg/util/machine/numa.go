@@ -0,0 +1,88 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package machine
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const numaNodeSysFSDir = "/sys/devices/system/node"
+
+// ExtraTopologyInfo is extra topology info not in MachineInfo, such as numa distances
+type ExtraTopologyInfo struct {
+	// NumaDistanceMap is the distance between numa nodes, map[srcNumaID]map[dstNumaID]distance,
+	// the distance of local access is 10 by convention, and larger distance means more costly access.
+	NumaDistanceMap map[int]map[int]int
+}
+
+// GetExtraTopologyInfo get numa distances from sys fs
+func GetExtraTopologyInfo() (*ExtraTopologyInfo, error) {
+	return getExtraTopologyInfo(numaNodeSysFSDir)
+}
+
+func getExtraTopologyInfo(nodeDir string) (*ExtraTopologyInfo, error) {
+	entries, err := ioutil.ReadDir(nodeDir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not read dir %s", nodeDir)
+	}
+
+	var numaIDs []int
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), "node") {
+			continue
+		}
+		numaID, err := strconv.Atoi(strings.TrimPrefix(entry.Name(), "node"))
+		if err != nil {
+			continue
+		}
+		numaIDs = append(numaIDs, numaID)
+	}
+	sort.Ints(numaIDs)
+
+	// distances in each file are listed in the order of numa ids
+	numaDistanceMap := make(map[int]map[int]int, len(numaIDs))
+	for _, numaID := range numaIDs {
+		distanceFile := filepath.Join(nodeDir, fmt.Sprintf("node%d", numaID), "distance")
+		content, err := ioutil.ReadFile(distanceFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not read file %s", distanceFile)
+		}
+
+		fields := strings.Fields(string(content))
+		if len(fields) != len(numaIDs) {
+			return nil, fmt.Errorf("invalid distances %q in %s for %d numa nodes", content, distanceFile, len(numaIDs))
+		}
+
+		numaDistanceMap[numaID] = make(map[int]int, len(numaIDs))
+		for i, field := range fields {
+			distance, err := strconv.Atoi(field)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid distance in %s", distanceFile)
+			}
+			numaDistanceMap[numaID][numaIDs[i]] = distance
+		}
+	}
+
+	return &ExtraTopologyInfo{NumaDistanceMap: numaDistanceMap}, nil
+}
@@ -0,0 +1,52 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package machine
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetExtraTopologyInfo(t *testing.T) {
+	t.Parallel()
+
+	nodeDir := t.TempDir()
+	for name, distance := range map[string]string{
+		"node0": "10 21\n",
+		"node1": "21 10\n",
+	} {
+		assert.NoError(t, os.MkdirAll(filepath.Join(nodeDir, name), 0755))
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(nodeDir, name, "distance"), []byte(distance), 0644))
+	}
+	// entries other than numa nodes are ignored
+	assert.NoError(t, os.MkdirAll(filepath.Join(nodeDir, "power"), 0755))
+
+	info, err := getExtraTopologyInfo(nodeDir)
+	assert.NoError(t, err)
+	assert.Equal(t, map[int]map[int]int{
+		0: {0: 10, 1: 21},
+		1: {0: 21, 1: 10},
+	}, info.NumaDistanceMap)
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(nodeDir, "node1", "distance"), []byte("21\n"), 0644))
+	_, err = getExtraTopologyInfo(nodeDir)
+	assert.Error(t, err)
+}
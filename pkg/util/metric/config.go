@@ -0,0 +1,45 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metric
+
+import (
+	"fmt"
+
+	"github.com/kubewharf/katalyst-core/pkg/config/agent/global"
+)
+
+func init() {
+	global.RegisterMetricConfigurationValidator(validateMetricConfiguration)
+}
+
+// validateMetricConfiguration checks settings of the metric configuration parsed by this package
+func validateMetricConfiguration(c *global.MetricConfiguration) error {
+	if _, err := GetMemBandwidthUnitScale(c.MemBandwidthUnit); err != nil {
+		return fmt.Errorf("invalid metric-mem-bandwidth-unit: %v", err)
+	}
+
+	if _, err := NewValueRounder(c.StoreRoundingMode, c.StoreRoundingDigits); err != nil {
+		return fmt.Errorf("invalid metric store rounding: %v", err)
+	}
+
+	for metricName, retention := range c.NodeMetricRetentionOverrides {
+		if _, err := ParseMetricRetention(retention); err != nil {
+			return fmt.Errorf("invalid metric-node-metric-retention-overrides for %v: %v", metricName, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metric
+
+import (
+	"fmt"
+	"math"
+)
+
+// those modes are supported to round metric values on the write path of MetricStore,
+// so that the stored values are stable rather than carrying full float noise.
+const (
+	RoundingModeNone               = ""
+	RoundingModeDecimalPlaces      = "decimal-places"
+	RoundingModeSignificantFigures = "significant-figures"
+)
+
+// ValueRounder rounds the metric value to the configured precision
+type ValueRounder func(value float64) float64
+
+// NewValueRounder returns the ValueRounder for the given mode and digits,
+// and nil will be returned for RoundingModeNone which means no rounding.
+func NewValueRounder(mode string, digits int) (ValueRounder, error) {
+	switch mode {
+	case RoundingModeNone:
+		return nil, nil
+	case RoundingModeDecimalPlaces:
+		if digits < 0 {
+			return nil, fmt.Errorf("invalid decimal places %v", digits)
+		}
+		return func(value float64) float64 {
+			return roundToDecimalPlaces(value, digits)
+		}, nil
+	case RoundingModeSignificantFigures:
+		if digits <= 0 {
+			return nil, fmt.Errorf("invalid significant figures %v", digits)
+		}
+		return func(value float64) float64 {
+			if value == 0 || math.IsNaN(value) || math.IsInf(value, 0) {
+				return value
+			}
+			magnitude := int(math.Floor(math.Log10(math.Abs(value)))) + 1
+			return roundToDecimalPlaces(value, digits-magnitude)
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown rounding mode %q", mode)
+}
+
+// roundToDecimalPlaces rounds the value to the given decimal places,
+// and negative places mean rounding to tens, hundreds and so on.
+func roundToDecimalPlaces(value float64, places int) float64 {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return value
+	}
+	if places >= 0 {
+		factor := math.Pow10(places)
+		return math.Round(value*factor) / factor
+	}
+	factor := math.Pow10(-places)
+	return math.Round(value/factor) * factor
+}
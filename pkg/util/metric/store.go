@@ -17,10 +17,16 @@ limitations under the License.
 package metric
 
 import (
+	"container/list"
 	"errors"
 	"fmt"
+	"math"
+	"sort"
+	"strings"
 	"sync"
 	"time"
+
+	"k8s.io/apimachinery/pkg/util/sets"
 )
 
 // MetricData represents the standard response data for metric getter functions
@@ -33,6 +39,16 @@ type MetricData struct {
 	Time *time.Time
 }
 
+// deepCopy returns a copy of MetricData which doesn't share Time with the original one,
+// so that callers can't mutate the data kept in MetricStore through the returned value.
+func (d MetricData) deepCopy() MetricData {
+	if d.Time != nil {
+		t := *d.Time
+		d.Time = &t
+	}
+	return d
+}
+
 // MetricStore stores those metric data. Including:
 // 1. raw data collected from agent.MetricsFetcher.
 // 2. data calculated based on raw data.
@@ -43,10 +59,56 @@ type MetricStore struct {
 	numaMetricMap             map[int]map[string]MetricData                          // map[numaID]map[metricName]data
 	deviceMetricMap           map[string]map[string]MetricData                       // map[deviceName]map[metricName]data
 	cpuMetricMap              map[int]map[string]MetricData                          // map[cpuID]map[metricName]data
+	socketMetricMap           map[int]map[string]MetricData                          // map[socketID]map[metricName]data
 	podContainerMetricMap     map[string]map[string]map[string]MetricData            // map[podUID]map[containerName]map[metricName]data
 	podContainerNumaMetricMap map[string]map[string]map[string]map[string]MetricData // map[podUID]map[containerName]map[numaNode]map[metricName]data
 	cgroupMetricMap           map[string]map[string]MetricData                       // map[cgroupPath]map[metricName]value
 	cgroupNumaMetricMap       map[string]map[string]map[string]MetricData            // map[cgroupPath]map[numaNode]map[metricName]value
+
+	metricUnitMap map[string]string // map[metricName]unit
+
+	// rounder is applied to all metric values on write path, nil means no rounding
+	rounder ValueRounder
+
+	// valueTransforms are applied to values of the metrics on write path before rounding
+	valueTransforms map[string]ValueTransform // map[metricName]transform
+
+	// minWriteIntervals skip writes of unchanged values within the interval for each metric
+	minWriteIntervals map[string]time.Duration // map[metricName]interval
+
+	// nodeMetricSeriesMap retains samples of node metrics within nodeMetricRetention,
+	// and no sample will be retained if the retention is not positive.
+	nodeMetricSeriesMap map[string][]MetricData // map[metricName]samples ordered by time
+	nodeMetricRetention time.Duration
+	// nodeMetricRetentions overrides nodeMetricRetention for each metric, map[metricName]retention
+	nodeMetricRetentions map[string]MetricRetention
+
+	// changeSubscribers receive events when metric values change
+	changeSubscribers   map[string]*changeSubscriber // map[subscriberID]subscriber
+	changeSubscriberSeq int
+	// thresholdSubscribers receive events when metric values cross thresholds
+	thresholdSubscribers map[string]*thresholdSubscriber // map[subscriberID]subscriber
+
+	// metricKeyList orders metric keys by update time (the front is the least-recently-updated one),
+	// and those keys will be evicted once the number of keys exceeds maxMetricKeys if it's positive.
+	metricKeyList     *list.List
+	metricKeyElements map[MetricKey]*list.Element
+	maxMetricKeys     int
+	// unloggedEvictions counts keys evicted since lastEvictionLog, since evictions are
+	// logged at most once per metricKeyEvictionLogInterval
+	unloggedEvictions int
+	lastEvictionLog   time.Time
+
+	// metricSources records which source produced the metric value in merges,
+	// and it's empty for metrics set directly.
+	metricSources map[MetricKey]string
+
+	// metricNamePrefix is prepended to names of all metrics stored, and it's transparent to
+	// readers and subscribers, while snapshots and exporters see those prefixed names.
+	metricNamePrefix string
+
+	// disabledMetrics are metrics not to be stored, and writes of them are ignored
+	disabledMetrics sets.String
 }
 
 func NewMetricStore() *MetricStore {
@@ -55,49 +117,169 @@ func NewMetricStore() *MetricStore {
 		numaMetricMap:             make(map[int]map[string]MetricData),
 		deviceMetricMap:           make(map[string]map[string]MetricData),
 		cpuMetricMap:              make(map[int]map[string]MetricData),
+		socketMetricMap:           make(map[int]map[string]MetricData),
 		podContainerMetricMap:     make(map[string]map[string]map[string]MetricData),
 		podContainerNumaMetricMap: make(map[string]map[string]map[string]map[string]MetricData),
 		cgroupMetricMap:           make(map[string]map[string]MetricData),
 		cgroupNumaMetricMap:       make(map[string]map[string]map[string]MetricData),
+		metricUnitMap:             make(map[string]string),
+		valueTransforms:           make(map[string]ValueTransform),
+		nodeMetricSeriesMap:       make(map[string][]MetricData),
+		nodeMetricRetentions:      make(map[string]MetricRetention),
+		changeSubscribers:         make(map[string]*changeSubscriber),
+		thresholdSubscribers:      make(map[string]*thresholdSubscriber),
+		metricKeyList:             list.New(),
+		metricKeyElements:         make(map[MetricKey]*list.Element),
+		metricSources:             make(map[MetricKey]string),
+	}
+}
+
+// onMetricSet handles the bookkeeping after a metric is set, it must be called with lock held.
+func (c *MetricStore) onMetricSet(event MetricChangeEvent, prev MetricData, existed bool) {
+	c.touchMetricKey(event)
+	if len(c.metricSources) > 0 {
+		delete(c.metricSources, newMetricKey(event))
 	}
+	c.publishChange(event, prev, existed)
+	c.publishThresholdCrossing(event)
 }
 
 func (c *MetricStore) SetNodeMetric(metricName string, data MetricData) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
+	c.setNodeMetric(metricName, data)
+}
+
+// setNodeMetric and other unexported setters below return false if the write is dropped, and they must
+// be called with lock held.
+func (c *MetricStore) setNodeMetric(metricName string, data MetricData) bool {
+	metricName = c.prefixedMetricName(metricName)
+	if c.isMetricDisabled(metricName) {
+		return false
+	}
+	data = c.transformData(metricName, data)
+	prev, existed := c.nodeMetricMap[metricName]
+	event := MetricChangeEvent{Scope: MetricChangeScopeNode, MetricName: metricName, MetricData: data}
+	if c.isWriteSkipped(event, prev, existed) {
+		return false
+	}
 	c.nodeMetricMap[metricName] = data
+	c.retainNodeMetricSample(metricName, data)
+	c.onMetricSet(event, prev, existed)
+	return true
 }
 
 func (c *MetricStore) SetNumaMetric(numaID int, metricName string, data MetricData) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
+	c.setNumaMetric(numaID, metricName, data)
+}
+
+func (c *MetricStore) setNumaMetric(numaID int, metricName string, data MetricData) bool {
+	metricName = c.prefixedMetricName(metricName)
+	if c.isMetricDisabled(metricName) {
+		return false
+	}
 	if _, ok := c.numaMetricMap[numaID]; !ok {
 		c.numaMetricMap[numaID] = make(map[string]MetricData)
 	}
+	data = c.transformData(metricName, data)
+	prev, existed := c.numaMetricMap[numaID][metricName]
+	event := MetricChangeEvent{Scope: MetricChangeScopeNuma, NumaID: numaID, MetricName: metricName, MetricData: data}
+	if c.isWriteSkipped(event, prev, existed) {
+		return false
+	}
 	c.numaMetricMap[numaID][metricName] = data
+	c.onMetricSet(event, prev, existed)
+	return true
 }
 
 func (c *MetricStore) SetDeviceMetric(deviceName string, metricName string, data MetricData) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
+	c.setDeviceMetric(deviceName, metricName, data)
+}
+
+func (c *MetricStore) setDeviceMetric(deviceName string, metricName string, data MetricData) bool {
+	metricName = c.prefixedMetricName(metricName)
+	if c.isMetricDisabled(metricName) {
+		return false
+	}
 	if _, ok := c.deviceMetricMap[deviceName]; !ok {
 		c.deviceMetricMap[deviceName] = make(map[string]MetricData)
 	}
+	data = c.transformData(metricName, data)
+	prev, existed := c.deviceMetricMap[deviceName][metricName]
+	event := MetricChangeEvent{Scope: MetricChangeScopeDevice, DeviceName: deviceName, MetricName: metricName, MetricData: data}
+	if c.isWriteSkipped(event, prev, existed) {
+		return false
+	}
 	c.deviceMetricMap[deviceName][metricName] = data
+	c.onMetricSet(event, prev, existed)
+	return true
 }
 
 func (c *MetricStore) SetCPUMetric(cpuID int, metricName string, data MetricData) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
+	c.setCPUMetric(cpuID, metricName, data)
+}
+
+func (c *MetricStore) setCPUMetric(cpuID int, metricName string, data MetricData) bool {
+	metricName = c.prefixedMetricName(metricName)
+	if c.isMetricDisabled(metricName) {
+		return false
+	}
 	if _, ok := c.cpuMetricMap[cpuID]; !ok {
 		c.cpuMetricMap[cpuID] = make(map[string]MetricData)
 	}
+	data = c.transformData(metricName, data)
+	prev, existed := c.cpuMetricMap[cpuID][metricName]
+	event := MetricChangeEvent{Scope: MetricChangeScopeCPU, CPUID: cpuID, MetricName: metricName, MetricData: data}
+	if c.isWriteSkipped(event, prev, existed) {
+		return false
+	}
 	c.cpuMetricMap[cpuID][metricName] = data
+	c.onMetricSet(event, prev, existed)
+	return true
+}
+
+func (c *MetricStore) SetSocketMetric(socketID int, metricName string, data MetricData) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.setSocketMetric(socketID, metricName, data)
+}
+
+func (c *MetricStore) setSocketMetric(socketID int, metricName string, data MetricData) bool {
+	metricName = c.prefixedMetricName(metricName)
+	if c.isMetricDisabled(metricName) {
+		return false
+	}
+	if _, ok := c.socketMetricMap[socketID]; !ok {
+		c.socketMetricMap[socketID] = make(map[string]MetricData)
+	}
+	data = c.transformData(metricName, data)
+	prev, existed := c.socketMetricMap[socketID][metricName]
+	event := MetricChangeEvent{Scope: MetricChangeScopeSocket, SocketID: socketID, MetricName: metricName, MetricData: data}
+	if c.isWriteSkipped(event, prev, existed) {
+		return false
+	}
+	c.socketMetricMap[socketID][metricName] = data
+	c.onMetricSet(event, prev, existed)
+	return true
 }
 
 func (c *MetricStore) SetContainerMetric(podUID, containerName, metricName string, data MetricData) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
+	c.setContainerMetric(podUID, containerName, metricName, data)
+}
+
+func (c *MetricStore) setContainerMetric(podUID, containerName, metricName string, data MetricData) bool {
+	metricName = c.prefixedMetricName(metricName)
+	if c.isMetricDisabled(metricName) {
+		return false
+	}
 	if _, ok := c.podContainerMetricMap[podUID]; !ok {
 		c.podContainerMetricMap[podUID] = make(map[string]map[string]MetricData)
 	}
@@ -105,12 +287,29 @@ func (c *MetricStore) SetContainerMetric(podUID, containerName, metricName strin
 	if _, ok := c.podContainerMetricMap[podUID][containerName]; !ok {
 		c.podContainerMetricMap[podUID][containerName] = make(map[string]MetricData)
 	}
+	data = c.transformData(metricName, data)
+	prev, existed := c.podContainerMetricMap[podUID][containerName][metricName]
+	event := MetricChangeEvent{Scope: MetricChangeScopeContainer, PodUID: podUID, ContainerName: containerName,
+		MetricName: metricName, MetricData: data}
+	if c.isWriteSkipped(event, prev, existed) {
+		return false
+	}
 	c.podContainerMetricMap[podUID][containerName][metricName] = data
+	c.onMetricSet(event, prev, existed)
+	return true
 }
 
 func (c *MetricStore) SetContainerNumaMetric(podUID, containerName, numaNode, metricName string, data MetricData) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
+	c.setContainerNumaMetric(podUID, containerName, numaNode, metricName, data)
+}
+
+func (c *MetricStore) setContainerNumaMetric(podUID, containerName, numaNode, metricName string, data MetricData) bool {
+	metricName = c.prefixedMetricName(metricName)
+	if c.isMetricDisabled(metricName) {
+		return false
+	}
 
 	if _, ok := c.podContainerNumaMetricMap[podUID]; !ok {
 		c.podContainerNumaMetricMap[podUID] = make(map[string]map[string]map[string]MetricData)
@@ -123,12 +322,22 @@ func (c *MetricStore) SetContainerNumaMetric(podUID, containerName, numaNode, me
 	if _, ok := c.podContainerNumaMetricMap[podUID][containerName][numaNode]; !ok {
 		c.podContainerNumaMetricMap[podUID][containerName][numaNode] = make(map[string]MetricData)
 	}
+	data = c.transformData(metricName, data)
+	prev, existed := c.podContainerNumaMetricMap[podUID][containerName][numaNode][metricName]
+	event := MetricChangeEvent{Scope: MetricChangeScopeContainerNuma, PodUID: podUID, ContainerName: containerName,
+		NumaNode: numaNode, MetricName: metricName, MetricData: data}
+	if c.isWriteSkipped(event, prev, existed) {
+		return false
+	}
 	c.podContainerNumaMetricMap[podUID][containerName][numaNode][metricName] = data
+	c.onMetricSet(event, prev, existed)
+	return true
 }
 
 func (c *MetricStore) GetNodeMetric(metricName string) (MetricData, error) {
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
+	metricName = c.prefixedMetricName(metricName)
 	if data, ok := c.nodeMetricMap[metricName]; ok {
 		return data, nil
 	} else {
@@ -139,6 +348,7 @@ func (c *MetricStore) GetNodeMetric(metricName string) (MetricData, error) {
 func (c *MetricStore) GetNumaMetric(numaID int, metricName string) (MetricData, error) {
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
+	metricName = c.prefixedMetricName(metricName)
 	if c.numaMetricMap[numaID] != nil {
 		if data, ok := c.numaMetricMap[numaID][metricName]; ok {
 			return data, nil
@@ -152,6 +362,7 @@ func (c *MetricStore) GetNumaMetric(numaID int, metricName string) (MetricData,
 func (c *MetricStore) GetDeviceMetric(deviceName string, metricName string) (MetricData, error) {
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
+	metricName = c.prefixedMetricName(metricName)
 	if c.deviceMetricMap[deviceName] != nil {
 		if data, ok := c.deviceMetricMap[deviceName][metricName]; ok {
 			return data, nil
@@ -165,6 +376,7 @@ func (c *MetricStore) GetDeviceMetric(deviceName string, metricName string) (Met
 func (c *MetricStore) GetCPUMetric(coreID int, metricName string) (MetricData, error) {
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
+	metricName = c.prefixedMetricName(metricName)
 	if c.cpuMetricMap[coreID] != nil {
 		if data, ok := c.cpuMetricMap[coreID][metricName]; ok {
 			return data, nil
@@ -175,13 +387,28 @@ func (c *MetricStore) GetCPUMetric(coreID int, metricName string) (MetricData, e
 	return MetricData{}, errors.New("[MetricStore] empty map")
 }
 
+func (c *MetricStore) GetSocketMetric(socketID int, metricName string) (MetricData, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	metricName = c.prefixedMetricName(metricName)
+	if c.socketMetricMap[socketID] != nil {
+		if data, ok := c.socketMetricMap[socketID][metricName]; ok {
+			return data, nil
+		} else {
+			return MetricData{}, errors.New("[MetricStore] load value failed")
+		}
+	}
+	return MetricData{}, errors.New("[MetricStore] empty map")
+}
+
 func (c *MetricStore) GetContainerMetric(podUID, containerName, metricName string) (MetricData, error) {
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
+	metricName = c.prefixedMetricName(metricName)
 	if c.podContainerMetricMap[podUID] != nil {
 		if c.podContainerMetricMap[podUID][containerName] != nil {
 			if data, ok := c.podContainerMetricMap[podUID][containerName][metricName]; ok {
-				return data, nil
+				return data.deepCopy(), nil
 			} else {
 				return MetricData{}, errors.New("[MetricStore] load value failed")
 			}
@@ -190,9 +417,112 @@ func (c *MetricStore) GetContainerMetric(podUID, containerName, metricName strin
 	return MetricData{}, errors.New("[MetricStore] empty map")
 }
 
+// GetPodContainerMetrics returns the given metric for all containers in the pod, and
+// metrics updated before maxAge ago are skipped if maxAge is positive.
+// An empty map is returned if no container in the pod has the metric.
+func (c *MetricStore) GetPodContainerMetrics(podUID, metricName string, maxAge time.Duration) map[string]MetricData {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	metricName = c.prefixedMetricName(metricName)
+
+	now := time.Now()
+	res := make(map[string]MetricData)
+	for containerName, metrics := range c.podContainerMetricMap[podUID] {
+		data, ok := metrics[metricName]
+		if !ok {
+			continue
+		}
+		if maxAge > 0 && (data.Time == nil || now.Sub(*data.Time) > maxAge) {
+			continue
+		}
+		res[containerName] = data
+	}
+	return res
+}
+
+// GetContainerMetrics returns the given metrics of the container in a single read, and metrics
+// not existed or updated before maxAge ago (if maxAge is positive) are absent in the result.
+func (c *MetricStore) GetContainerMetrics(podUID, containerName string, metricNames []string, maxAge time.Duration) map[string]MetricData {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	now := time.Now()
+	res := make(map[string]MetricData, len(metricNames))
+	metrics := c.podContainerMetricMap[podUID][containerName]
+	for _, metricName := range metricNames {
+		data, ok := metrics[c.prefixedMetricName(metricName)]
+		if !ok {
+			continue
+		}
+		if maxAge > 0 && (data.Time == nil || now.Sub(*data.Time) > maxAge) {
+			continue
+		}
+		res[metricName] = data.deepCopy()
+	}
+	return res
+}
+
+// GetAllContainerMetrics returns all metrics of the container in a single read, keyed by names without the prefix
+func (c *MetricStore) GetAllContainerMetrics(podUID, containerName string) map[string]MetricData {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	metrics := c.podContainerMetricMap[podUID][containerName]
+	res := make(map[string]MetricData, len(metrics))
+	for metricName, data := range metrics {
+		res[strings.TrimPrefix(metricName, c.metricNamePrefix)] = data.deepCopy()
+	}
+	return res
+}
+
+// TrackedContainer identifies a container with metrics in MetricStore
+type TrackedContainer struct {
+	PodUID        string
+	ContainerName string
+}
+
+// ListTrackedContainers returns all containers with at least one metric (including per-numa ones) in a
+// single read, and they are sorted by pod uid and then container name.
+func (c *MetricStore) ListTrackedContainers() []TrackedContainer {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	tracked := make(map[TrackedContainer]struct{})
+	for podUID, containers := range c.podContainerMetricMap {
+		for containerName, metrics := range containers {
+			if len(metrics) > 0 {
+				tracked[TrackedContainer{PodUID: podUID, ContainerName: containerName}] = struct{}{}
+			}
+		}
+	}
+	for podUID, containers := range c.podContainerNumaMetricMap {
+		for containerName, numaMetrics := range containers {
+			for _, metrics := range numaMetrics {
+				if len(metrics) > 0 {
+					tracked[TrackedContainer{PodUID: podUID, ContainerName: containerName}] = struct{}{}
+					break
+				}
+			}
+		}
+	}
+
+	res := make([]TrackedContainer, 0, len(tracked))
+	for container := range tracked {
+		res = append(res, container)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].PodUID != res[j].PodUID {
+			return res[i].PodUID < res[j].PodUID
+		}
+		return res[i].ContainerName < res[j].ContainerName
+	})
+	return res
+}
+
 func (c *MetricStore) GetContainerNumaMetric(podUID, containerName, numaNode, metricName string) (MetricData, error) {
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
+	metricName = c.prefixedMetricName(metricName)
 	if c.podContainerNumaMetricMap[podUID] != nil {
 		if c.podContainerNumaMetricMap[podUID][containerName] != nil {
 			if c.podContainerNumaMetricMap[podUID][containerName][numaNode] != nil {
@@ -210,10 +540,19 @@ func (c *MetricStore) GetContainerNumaMetric(podUID, containerName, numaNode, me
 func (c *MetricStore) GCPodsMetric(livingPodUIDSet map[string]bool) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
+	deletedPodUIDs := make(map[string]bool)
 	for podUID := range c.podContainerMetricMap {
 		if _, ok := livingPodUIDSet[podUID]; !ok {
 			delete(c.podContainerMetricMap, podUID)
 			delete(c.podContainerNumaMetricMap, podUID)
+			deletedPodUIDs[podUID] = true
+		}
+	}
+	c.untrackPodMetricKeys(deletedPodUIDs)
+	c.gcThresholdCrossingStates(deletedPodUIDs)
+	for key := range c.metricSources {
+		if deletedPodUIDs[key.PodUID] {
+			delete(c.metricSources, key)
 		}
 	}
 }
@@ -221,17 +560,34 @@ func (c *MetricStore) GCPodsMetric(livingPodUIDSet map[string]bool) {
 func (c *MetricStore) SetCgroupMetric(cgroupPath, metricName string, data MetricData) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
+	c.setCgroupMetric(cgroupPath, metricName, data)
+}
+
+func (c *MetricStore) setCgroupMetric(cgroupPath, metricName string, data MetricData) bool {
+	metricName = c.prefixedMetricName(metricName)
+	if c.isMetricDisabled(metricName) {
+		return false
+	}
 	metrics, ok := c.cgroupMetricMap[cgroupPath]
 	if !ok {
 		metrics = make(map[string]MetricData)
 		c.cgroupMetricMap[cgroupPath] = metrics
 	}
+	data = c.transformData(metricName, data)
+	prev, existed := metrics[metricName]
+	event := MetricChangeEvent{Scope: MetricChangeScopeCgroup, CgroupPath: cgroupPath, MetricName: metricName, MetricData: data}
+	if c.isWriteSkipped(event, prev, existed) {
+		return false
+	}
 	metrics[metricName] = data
+	c.onMetricSet(event, prev, existed)
+	return true
 }
 
 func (c *MetricStore) GetCgroupMetric(cgroupPath, metricName string) (MetricData, error) {
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
+	metricName = c.prefixedMetricName(metricName)
 
 	metrics, ok := c.cgroupMetricMap[cgroupPath]
 	if !ok {
@@ -247,6 +603,14 @@ func (c *MetricStore) GetCgroupMetric(cgroupPath, metricName string) (MetricData
 func (c *MetricStore) SetCgroupNumaMetric(cgroupPath, numaNode, metricName string, data MetricData) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
+	c.setCgroupNumaMetric(cgroupPath, numaNode, metricName, data)
+}
+
+func (c *MetricStore) setCgroupNumaMetric(cgroupPath, numaNode, metricName string, data MetricData) bool {
+	metricName = c.prefixedMetricName(metricName)
+	if c.isMetricDisabled(metricName) {
+		return false
+	}
 
 	numaMetrics, ok := c.cgroupNumaMetricMap[cgroupPath]
 	if !ok {
@@ -258,12 +622,22 @@ func (c *MetricStore) SetCgroupNumaMetric(cgroupPath, numaNode, metricName strin
 		metrics = make(map[string]MetricData)
 		numaMetrics[numaNode] = metrics
 	}
+	data = c.transformData(metricName, data)
+	prev, existed := metrics[metricName]
+	event := MetricChangeEvent{Scope: MetricChangeScopeCgroupNuma, CgroupPath: cgroupPath, NumaNode: numaNode,
+		MetricName: metricName, MetricData: data}
+	if c.isWriteSkipped(event, prev, existed) {
+		return false
+	}
 	metrics[metricName] = data
+	c.onMetricSet(event, prev, existed)
+	return true
 }
 
 func (c *MetricStore) GetCgroupNumaMetric(cgroupPath, numaNode, metricName string) (MetricData, error) {
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
+	metricName = c.prefixedMetricName(metricName)
 	numaMetrics, ok := c.cgroupNumaMetricMap[cgroupPath]
 	if !ok {
 		return MetricData{}, fmt.Errorf("[MetricStore] load value for %v failed", cgroupPath)
@@ -278,3 +652,39 @@ func (c *MetricStore) GetCgroupNumaMetric(cgroupPath, numaNode, metricName strin
 	}
 	return metric, nil
 }
+
+// SetMetricUnit records the unit of metric values, it's only used as metadata
+// to tell consumers how to interpret the metric.
+func (c *MetricStore) SetMetricUnit(metricName, unit string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	metricName = c.prefixedMetricName(metricName)
+	c.metricUnitMap[metricName] = unit
+}
+
+func (c *MetricStore) GetMetricUnit(metricName string) (string, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	metricName = c.prefixedMetricName(metricName)
+	if unit, ok := c.metricUnitMap[metricName]; ok {
+		return unit, nil
+	}
+	return "", errors.New("[MetricStore] unit not found")
+}
+
+// SetValueRounder sets the rounder for metric values written since then.
+func (c *MetricStore) SetValueRounder(rounder ValueRounder) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.rounder = rounder
+}
+
+// roundData returns the data with value rounded, and it must be called with lock held.
+// Integral values are kept as they are, since raw counters are also stored as metrics,
+// and rounding them may break the deltas calculated based on them.
+func (c *MetricStore) roundData(data MetricData) MetricData {
+	if c.rounder != nil && data.Value != math.Trunc(data.Value) {
+		data.Value = c.rounder(data.Value)
+	}
+	return data
+}
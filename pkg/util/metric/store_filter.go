@@ -0,0 +1,55 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metric
+
+import (
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// SetDisabledMetrics sets the metrics not to be stored, and writes of them are ignored since then,
+// while values already in the store are removed. It's used to turn off metrics at runtime, and raw
+// counters should not be disabled, otherwise derivations based on their deltas will be broken.
+func (c *MetricStore) SetDisabledMetrics(metricNames []string) {
+	snapshot := c.Snapshot()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.disabledMetrics = sets.NewString(metricNames...)
+	if c.disabledMetrics.Len() == 0 {
+		return
+	}
+
+	forEachSnapshotMetric(snapshot, func(key MetricKey, _ MetricData) {
+		if !c.isMetricDisabled(key.MetricName) {
+			return
+		}
+		if elem, ok := c.metricKeyElements[key]; ok {
+			c.metricKeyList.Remove(elem)
+			delete(c.metricKeyElements, key)
+		}
+		c.deleteMetric(key)
+	})
+}
+
+// isMetricDisabled returns true if writes of the metric should be ignored, it must be called with
+// lock held. The metric name is the prefixed one, while disabled metrics are set without prefix.
+func (c *MetricStore) isMetricDisabled(metricName string) bool {
+	return c.disabledMetrics.Has(strings.TrimPrefix(metricName, c.metricNamePrefix))
+}
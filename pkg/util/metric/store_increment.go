@@ -0,0 +1,61 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metric
+
+// IncrementNodeMetric adds the value of delta to the node metric atomically, and the metric is regarded as
+// zero if it's absent. The time of the metric is replaced by that of delta, and the result is returned.
+// Value transforms are not applied since the delta is accumulated on the stored value, and nothing is
+// stored if the metric is disabled.
+func (c *MetricStore) IncrementNodeMetric(metricName string, delta MetricData) MetricData {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	metricName = c.prefixedMetricName(metricName)
+	if c.isMetricDisabled(metricName) {
+		return MetricData{}
+	}
+	prev, existed := c.nodeMetricMap[metricName]
+	data := MetricData{Value: prev.Value + delta.Value, Time: delta.Time}
+	c.nodeMetricMap[metricName] = data
+	c.retainNodeMetricSample(metricName, data)
+	event := MetricChangeEvent{Scope: MetricChangeScopeNode, MetricName: metricName, MetricData: data}
+	c.onMetricSet(event, prev, existed)
+	return data.deepCopy()
+}
+
+// IncrementContainerMetric is the same as IncrementNodeMetric except that it's for the container metric
+func (c *MetricStore) IncrementContainerMetric(podUID, containerName, metricName string, delta MetricData) MetricData {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	metricName = c.prefixedMetricName(metricName)
+	if c.isMetricDisabled(metricName) {
+		return MetricData{}
+	}
+	if _, ok := c.podContainerMetricMap[podUID]; !ok {
+		c.podContainerMetricMap[podUID] = make(map[string]map[string]MetricData)
+	}
+
+	if _, ok := c.podContainerMetricMap[podUID][containerName]; !ok {
+		c.podContainerMetricMap[podUID][containerName] = make(map[string]MetricData)
+	}
+	prev, existed := c.podContainerMetricMap[podUID][containerName][metricName]
+	data := MetricData{Value: prev.Value + delta.Value, Time: delta.Time}
+	c.podContainerMetricMap[podUID][containerName][metricName] = data
+	event := MetricChangeEvent{Scope: MetricChangeScopeContainer, PodUID: podUID, ContainerName: containerName,
+		MetricName: metricName, MetricData: data}
+	c.onMetricSet(event, prev, existed)
+	return data.deepCopy()
+}
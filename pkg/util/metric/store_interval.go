@@ -0,0 +1,56 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metric
+
+import (
+	"strings"
+	"time"
+)
+
+// SetMinWriteIntervals sets the min interval between writes of each metric (without prefix), and a write is
+// skipped if its value is the same as the stored one collected within the interval, so rarely changed gauges
+// (i.e. memory limit) are not rewritten in each cycle. The stored value keeps its collecting time until it's
+// refreshed, so the interval should be shorter than the freshness required by consumers. All writes are
+// applied for metrics not in intervals.
+func (c *MetricStore) SetMinWriteIntervals(intervals map[string]time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.minWriteIntervals = make(map[string]time.Duration, len(intervals))
+	for metricName, interval := range intervals {
+		if interval > 0 {
+			c.minWriteIntervals[metricName] = interval
+		}
+	}
+}
+
+// isWriteSkipped returns true if the data of event is unchanged from the stored one and collected within the
+// min write interval since it, and it must be called with lock held. The key of a skipped write is still touched,
+// since the metric is live and shouldn't be evicted as the least-recently-updated one.
+func (c *MetricStore) isWriteSkipped(event MetricChangeEvent, prev MetricData, existed bool) bool {
+	data := event.MetricData
+	if !existed || len(c.minWriteIntervals) == 0 || prev.Value != data.Value || prev.Time == nil || data.Time == nil {
+		return false
+	}
+
+	interval, ok := c.minWriteIntervals[strings.TrimPrefix(event.MetricName, c.metricNamePrefix)]
+	if !ok || data.Time.Sub(*prev.Time) >= interval {
+		return false
+	}
+	c.touchMetricKey(event)
+	return true
+}
@@ -0,0 +1,231 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metric
+
+import (
+	"container/list"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// metricKeyEvictionLogInterval is the min interval to log evictions of metric keys, since
+// a key may be evicted for each write once the limit is reached.
+const metricKeyEvictionLogInterval = time.Minute
+
+// MetricKey identifies a metric in MetricStore, and only those fields related to the scope are set.
+type MetricKey struct {
+	Scope      string `json:"scope"`
+	MetricName string `json:"metricName"`
+
+	NumaID        int    `json:"numaID,omitempty"`
+	CPUID         int    `json:"cpuID,omitempty"`
+	SocketID      int    `json:"socketID,omitempty"`
+	DeviceName    string `json:"deviceName,omitempty"`
+	PodUID        string `json:"podUID,omitempty"`
+	ContainerName string `json:"containerName,omitempty"`
+	NumaNode      string `json:"numaNode,omitempty"`
+	CgroupPath    string `json:"cgroupPath,omitempty"`
+}
+
+// String returns the scope, identifiers (only those related to the scope) and metric name of the key joined by "/",
+// i.e. "container/<podUID>/<containerName>/<metricName>", which is used when metrics are exported as plain text.
+func (k MetricKey) String() string {
+	var ids []string
+	switch k.Scope {
+	case MetricChangeScopeNuma:
+		ids = []string{strconv.Itoa(k.NumaID)}
+	case MetricChangeScopeDevice:
+		ids = []string{k.DeviceName}
+	case MetricChangeScopeCPU:
+		ids = []string{strconv.Itoa(k.CPUID)}
+	case MetricChangeScopeSocket:
+		ids = []string{strconv.Itoa(k.SocketID)}
+	case MetricChangeScopeContainer:
+		ids = []string{k.PodUID, k.ContainerName}
+	case MetricChangeScopeContainerNuma:
+		ids = []string{k.PodUID, k.ContainerName, k.NumaNode}
+	case MetricChangeScopeCgroup:
+		ids = []string{k.CgroupPath}
+	case MetricChangeScopeCgroupNuma:
+		ids = []string{k.CgroupPath, k.NumaNode}
+	}
+	return strings.Join(append(append([]string{k.Scope}, ids...), k.MetricName), "/")
+}
+
+func newMetricKey(event MetricChangeEvent) MetricKey {
+	return MetricKey{
+		Scope:         event.Scope,
+		MetricName:    event.MetricName,
+		NumaID:        event.NumaID,
+		CPUID:         event.CPUID,
+		SocketID:      event.SocketID,
+		DeviceName:    event.DeviceName,
+		PodUID:        event.PodUID,
+		ContainerName: event.ContainerName,
+		NumaNode:      event.NumaNode,
+		CgroupPath:    event.CgroupPath,
+	}
+}
+
+// SetMaxMetricKeys sets the max number of metric keys in MetricStore, and the least-recently-updated
+// keys will be evicted once it's exceeded. It's a safety backstop to bound the memory under container
+// churn, and no limit is applied if maxKeys is not positive. Keys already in the store (or restored
+// from snapshot) are only counted after they are updated again. Keys tracked under the previous limit
+// are kept, and they are only evicted if the new limit is lower than the number of them.
+func (c *MetricStore) SetMaxMetricKeys(maxKeys int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.maxMetricKeys = maxKeys
+	if maxKeys <= 0 {
+		c.resetMetricKeys()
+		return
+	}
+	c.trimMetricKeys()
+}
+
+// resetMetricKeys clears all tracked keys, it must be called with lock held.
+func (c *MetricStore) resetMetricKeys() {
+	c.metricKeyList = list.New()
+	c.metricKeyElements = make(map[MetricKey]*list.Element)
+}
+
+// touchMetricKey marks the key as the most recently updated one, and evicts the least-recently-updated
+// keys if the number of keys exceeds the limit, it must be called with lock held.
+func (c *MetricStore) touchMetricKey(event MetricChangeEvent) {
+	if c.maxMetricKeys <= 0 {
+		return
+	}
+
+	key := newMetricKey(event)
+	if elem, ok := c.metricKeyElements[key]; ok {
+		c.metricKeyList.MoveToBack(elem)
+	} else {
+		c.metricKeyElements[key] = c.metricKeyList.PushBack(key)
+	}
+	c.trimMetricKeys()
+}
+
+// trimMetricKeys evicts the least-recently-updated keys until the number of keys doesn't exceed
+// the limit, it must be called with lock held.
+func (c *MetricStore) trimMetricKeys() {
+	var (
+		oldest  MetricKey
+		evicted bool
+	)
+	for c.metricKeyList.Len() > c.maxMetricKeys {
+		oldest = c.metricKeyList.Remove(c.metricKeyList.Front()).(MetricKey)
+		delete(c.metricKeyElements, oldest)
+		c.deleteMetric(oldest)
+		c.unloggedEvictions++
+		evicted = true
+	}
+
+	if !evicted {
+		return
+	}
+	if now := time.Now(); now.Sub(c.lastEvictionLog) >= metricKeyEvictionLogInterval {
+		klog.Warningf("[MetricStore] metric keys exceed limit %v, %v least-recently-updated metrics are evicted "+
+			"since last log, and the last one is %v", c.maxMetricKeys, c.unloggedEvictions, oldest)
+		c.unloggedEvictions = 0
+		c.lastEvictionLog = now
+	}
+}
+
+// untrackPodMetricKeys stops tracking keys of the given pods, it must be called with lock held.
+func (c *MetricStore) untrackPodMetricKeys(podUIDs map[string]bool) {
+	if c.maxMetricKeys <= 0 || len(podUIDs) == 0 {
+		return
+	}
+
+	for elem := c.metricKeyList.Front(); elem != nil; {
+		next := elem.Next()
+		if key := elem.Value.(MetricKey); podUIDs[key.PodUID] {
+			c.metricKeyList.Remove(elem)
+			delete(c.metricKeyElements, key)
+		}
+		elem = next
+	}
+}
+
+// deleteMetric removes the metric identified by the key, and those maps left empty
+// are removed as well, it must be called with lock held.
+func (c *MetricStore) deleteMetric(key MetricKey) {
+	delete(c.metricSources, key)
+	switch key.Scope {
+	case MetricChangeScopeNode:
+		delete(c.nodeMetricMap, key.MetricName)
+		delete(c.nodeMetricSeriesMap, key.MetricName)
+	case MetricChangeScopeNuma:
+		deleteIntKeyMetric(c.numaMetricMap, key.NumaID, key.MetricName)
+	case MetricChangeScopeDevice:
+		deleteNestedMetric(c.deviceMetricMap, key.DeviceName, key.MetricName)
+	case MetricChangeScopeCPU:
+		deleteIntKeyMetric(c.cpuMetricMap, key.CPUID, key.MetricName)
+	case MetricChangeScopeSocket:
+		deleteIntKeyMetric(c.socketMetricMap, key.SocketID, key.MetricName)
+	case MetricChangeScopeContainer:
+		if containers, ok := c.podContainerMetricMap[key.PodUID]; ok {
+			deleteNestedMetric(containers, key.ContainerName, key.MetricName)
+			if len(containers) == 0 {
+				delete(c.podContainerMetricMap, key.PodUID)
+			}
+		}
+	case MetricChangeScopeContainerNuma:
+		if containers, ok := c.podContainerNumaMetricMap[key.PodUID]; ok {
+			if numas, ok := containers[key.ContainerName]; ok {
+				deleteNestedMetric(numas, key.NumaNode, key.MetricName)
+				if len(numas) == 0 {
+					delete(containers, key.ContainerName)
+				}
+			}
+			if len(containers) == 0 {
+				delete(c.podContainerNumaMetricMap, key.PodUID)
+			}
+		}
+	case MetricChangeScopeCgroup:
+		deleteNestedMetric(c.cgroupMetricMap, key.CgroupPath, key.MetricName)
+	case MetricChangeScopeCgroupNuma:
+		if numas, ok := c.cgroupNumaMetricMap[key.CgroupPath]; ok {
+			deleteNestedMetric(numas, key.NumaNode, key.MetricName)
+			if len(numas) == 0 {
+				delete(c.cgroupNumaMetricMap, key.CgroupPath)
+			}
+		}
+	}
+}
+
+func deleteIntKeyMetric(m map[int]map[string]MetricData, id int, metricName string) {
+	if metrics, ok := m[id]; ok {
+		delete(metrics, metricName)
+		if len(metrics) == 0 {
+			delete(m, id)
+		}
+	}
+}
+
+func deleteNestedMetric(m map[string]map[string]MetricData, name, metricName string) {
+	if metrics, ok := m[name]; ok {
+		delete(metrics, metricName)
+		if len(metrics) == 0 {
+			delete(m, name)
+		}
+	}
+}
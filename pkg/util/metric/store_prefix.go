@@ -0,0 +1,31 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metric
+
+// SetMetricNamePrefix sets the prefix prepended to names of metrics written since then, so that
+// metrics of different deployments can be namespaced in a shared monitoring system. Read APIs
+// account for the prefix transparently, and metrics already in the store are not renamed.
+func (c *MetricStore) SetMetricNamePrefix(prefix string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.metricNamePrefix = prefix
+}
+
+// prefixedMetricName returns the name used to store the metric, it must be called with lock held.
+func (c *MetricStore) prefixedMetricName(metricName string) string {
+	return c.metricNamePrefix + metricName
+}
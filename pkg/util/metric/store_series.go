@@ -0,0 +1,150 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metric
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// MetricRetention limits the retained samples of a metric by age and (or) by count,
+// and the retention is disabled if neither of them is positive.
+type MetricRetention struct {
+	Duration time.Duration
+	Samples  int
+}
+
+func (r MetricRetention) enabled() bool {
+	return r.Duration > 0 || r.Samples > 0
+}
+
+// ParseMetricRetention parses the retention in the format of a duration (i.e. 10m)
+// or the number of samples (i.e. 300).
+func ParseMetricRetention(s string) (MetricRetention, error) {
+	if samples, err := strconv.Atoi(s); err == nil {
+		if samples < 0 {
+			return MetricRetention{}, fmt.Errorf("negative samples %v in retention", samples)
+		}
+		return MetricRetention{Samples: samples}, nil
+	}
+
+	duration, err := time.ParseDuration(s)
+	if err != nil {
+		return MetricRetention{}, fmt.Errorf("invalid retention %q: neither a duration nor a number of samples", s)
+	} else if duration < 0 {
+		return MetricRetention{}, fmt.Errorf("negative duration %v in retention", duration)
+	}
+	return MetricRetention{Duration: duration}, nil
+}
+
+// SetNodeMetricRetention sets how long samples of node metrics are retained,
+// and retained samples will be cleared if the retention is not positive.
+func (c *MetricStore) SetNodeMetricRetention(retention time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.nodeMetricRetention = retention
+	if retention <= 0 {
+		for metricName := range c.nodeMetricSeriesMap {
+			if _, ok := c.nodeMetricRetentions[metricName]; !ok {
+				delete(c.nodeMetricSeriesMap, metricName)
+			}
+		}
+	}
+}
+
+// SetNodeMetricRetentionOf sets the retention of the node metric, which overrides the one set by
+// SetNodeMetricRetention, and the metric falls back to it if the retention given is zero value.
+func (c *MetricStore) SetNodeMetricRetentionOf(metricName string, retention MetricRetention) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	metricName = c.prefixedMetricName(metricName)
+
+	if retention == (MetricRetention{}) {
+		delete(c.nodeMetricRetentions, metricName)
+		if c.nodeMetricRetention <= 0 {
+			delete(c.nodeMetricSeriesMap, metricName)
+		}
+		return
+	}
+	c.nodeMetricRetentions[metricName] = retention
+}
+
+// nodeMetricRetentionOf returns the retention of the node metric, and it must be called with lock held.
+func (c *MetricStore) nodeMetricRetentionOf(metricName string) MetricRetention {
+	if retention, ok := c.nodeMetricRetentions[metricName]; ok {
+		return retention
+	}
+	return MetricRetention{Duration: c.nodeMetricRetention}
+}
+
+// GetNodeMetricSeries returns the retained samples of node metric collected within
+// the window, and the samples are ordered by collecting time.
+func (c *MetricStore) GetNodeMetricSeries(metricName string, window time.Duration) []MetricData {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	metricName = c.prefixedMetricName(metricName)
+
+	series := c.nodeMetricSeriesMap[metricName]
+	since := time.Now().Add(-window)
+	start := sort.Search(len(series), func(i int) bool {
+		return !series[i].Time.Before(since)
+	})
+
+	res := make([]MetricData, 0, len(series)-start)
+	for _, data := range series[start:] {
+		t := *data.Time
+		res = append(res, MetricData{Value: data.Value, Time: &t})
+	}
+	return res
+}
+
+// retainNodeMetricSample adds the sample into series of node metric, and drop those
+// samples out of retention, it must be called with lock held.
+func (c *MetricStore) retainNodeMetricSample(metricName string, data MetricData) {
+	retention := c.nodeMetricRetentionOf(metricName)
+	if !retention.enabled() || data.Time == nil {
+		return
+	}
+
+	series := c.nodeMetricSeriesMap[metricName]
+	i := sort.Search(len(series), func(i int) bool {
+		return !series[i].Time.Before(*data.Time)
+	})
+	if i < len(series) && series[i].Time.Equal(*data.Time) {
+		// the metric is not updated by source, just keep the latest value
+		series[i] = data
+	} else {
+		series = append(series, MetricData{})
+		copy(series[i+1:], series[i:])
+		series[i] = data
+	}
+
+	start := 0
+	if retention.Duration > 0 {
+		expired := series[len(series)-1].Time.Add(-retention.Duration)
+		start = sort.Search(len(series), func(i int) bool {
+			return !series[i].Time.Before(expired)
+		})
+	}
+	if retention.Samples > 0 && len(series)-start > retention.Samples {
+		start = len(series) - retention.Samples
+	}
+	c.nodeMetricSeriesMap[metricName] = series[start:]
+}
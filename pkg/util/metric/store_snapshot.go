@@ -0,0 +1,204 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metric
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// MetricStoreSnapshot is the serializable form of all metric data in MetricStore,
+// and the layout of each map is the same as that in MetricStore.
+type MetricStoreSnapshot struct {
+	NodeMetrics             map[string]MetricData                                  `json:"nodeMetrics,omitempty"`
+	NumaMetrics             map[int]map[string]MetricData                          `json:"numaMetrics,omitempty"`
+	DeviceMetrics           map[string]map[string]MetricData                       `json:"deviceMetrics,omitempty"`
+	CPUMetrics              map[int]map[string]MetricData                          `json:"cpuMetrics,omitempty"`
+	SocketMetrics           map[int]map[string]MetricData                          `json:"socketMetrics,omitempty"`
+	PodContainerMetrics     map[string]map[string]map[string]MetricData            `json:"podContainerMetrics,omitempty"`
+	PodContainerNumaMetrics map[string]map[string]map[string]map[string]MetricData `json:"podContainerNumaMetrics,omitempty"`
+	CgroupMetrics           map[string]map[string]MetricData                       `json:"cgroupMetrics,omitempty"`
+	CgroupNumaMetrics       map[string]map[string]map[string]MetricData            `json:"cgroupNumaMetrics,omitempty"`
+
+	MetricSources []MetricSourceTag `json:"metricSources,omitempty"`
+}
+
+// Snapshot returns a deep copy of all metric data in MetricStore
+func (c *MetricStore) Snapshot() *MetricStoreSnapshot {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	keep := func(MetricData) bool { return true }
+	return &MetricStoreSnapshot{
+		NodeMetrics:             copyMetricMap(c.nodeMetricMap, keep),
+		NumaMetrics:             copyIntKeyMetricMap(c.numaMetricMap, keep),
+		DeviceMetrics:           copyNestedMetricMap(c.deviceMetricMap, keep),
+		CPUMetrics:              copyIntKeyMetricMap(c.cpuMetricMap, keep),
+		SocketMetrics:           copyIntKeyMetricMap(c.socketMetricMap, keep),
+		PodContainerMetrics:     copyPodContainerMetricMap(c.podContainerMetricMap, keep),
+		PodContainerNumaMetrics: copyPodContainerNumaMetricMap(c.podContainerNumaMetricMap, keep),
+		CgroupMetrics:           copyNestedMetricMap(c.cgroupMetricMap, keep),
+		CgroupNumaMetrics:       copyPodContainerMetricMap(c.cgroupNumaMetricMap, keep),
+		MetricSources:           c.listMetricSources(),
+	}
+}
+
+// ForEach calls f for each metric data in the snapshot along with its key
+func (s *MetricStoreSnapshot) ForEach(f func(key MetricKey, data MetricData)) {
+	forEachSnapshotMetric(s, f)
+}
+
+// Restore replaces all metric data in MetricStore with those in the snapshot, and metric data
+// collected before expiredTime (or without collecting time) will be dropped as stale data.
+func (c *MetricStore) Restore(snapshot *MetricStoreSnapshot, expiredTime time.Time) {
+	fresh := func(data MetricData) bool { return data.Time != nil && !data.Time.Before(expiredTime) }
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.nodeMetricMap = copyMetricMap(snapshot.NodeMetrics, fresh)
+	c.numaMetricMap = copyIntKeyMetricMap(snapshot.NumaMetrics, fresh)
+	c.deviceMetricMap = copyNestedMetricMap(snapshot.DeviceMetrics, fresh)
+	c.cpuMetricMap = copyIntKeyMetricMap(snapshot.CPUMetrics, fresh)
+	c.socketMetricMap = copyIntKeyMetricMap(snapshot.SocketMetrics, fresh)
+	c.podContainerMetricMap = copyPodContainerMetricMap(snapshot.PodContainerMetrics, fresh)
+	c.podContainerNumaMetricMap = copyPodContainerNumaMetricMap(snapshot.PodContainerNumaMetrics, fresh)
+	c.cgroupMetricMap = copyNestedMetricMap(snapshot.CgroupMetrics, fresh)
+	c.cgroupNumaMetricMap = copyPodContainerMetricMap(snapshot.CgroupNumaMetrics, fresh)
+	c.resetMetricKeys()
+	c.restoreMetricSources(snapshot.MetricSources)
+}
+
+// WriteSnapshotFile writes the snapshot into the given file, compressed with gzip if compress is set, and
+// the file will be replaced atomically to avoid leaving corrupted contents.
+func WriteSnapshotFile(path string, snapshot *MetricStoreSnapshot, compress bool) error {
+	contents, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to marshal metric snapshot: %v", err)
+	}
+	if compress {
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(contents); err != nil {
+			return fmt.Errorf("failed to compress metric snapshot: %v", err)
+		}
+		if err := w.Close(); err != nil {
+			return fmt.Errorf("failed to compress metric snapshot: %v", err)
+		}
+		contents = buf.Bytes()
+	}
+
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file for metric snapshot: %v", err)
+	}
+	defer func() { _ = os.Remove(tmpFile.Name()) }()
+
+	if _, err := tmpFile.Write(contents); err != nil {
+		_ = tmpFile.Close()
+		return fmt.Errorf("failed to write metric snapshot: %v", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("failed to close metric snapshot: %v", err)
+	}
+	return os.Rename(tmpFile.Name(), path)
+}
+
+// ReadSnapshotFile reads the snapshot from the given file, which is decompressed if it's compressed
+func ReadSnapshotFile(path string) (*MetricStoreSnapshot, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// compressed snapshots are detected by the magic number of gzip, which is never the start of json
+	if len(contents) >= 2 && contents[0] == 0x1f && contents[1] == 0x8b {
+		r, err := gzip.NewReader(bytes.NewReader(contents))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress metric snapshot: %v", err)
+		}
+		if contents, err = io.ReadAll(r); err != nil {
+			return nil, fmt.Errorf("failed to decompress metric snapshot: %v", err)
+		}
+	}
+
+	snapshot := &MetricStoreSnapshot{}
+	if err := json.Unmarshal(contents, snapshot); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal metric snapshot: %v", err)
+	}
+	return snapshot, nil
+}
+
+func copyMetricMap(src map[string]MetricData, filter func(MetricData) bool) map[string]MetricData {
+	dst := make(map[string]MetricData, len(src))
+	for metricName, data := range src {
+		if !filter(data) {
+			continue
+		}
+
+		dst[metricName] = data.deepCopy()
+	}
+	return dst
+}
+
+func copyIntKeyMetricMap(src map[int]map[string]MetricData, filter func(MetricData) bool) map[int]map[string]MetricData {
+	dst := make(map[int]map[string]MetricData, len(src))
+	for key, metrics := range src {
+		if copied := copyMetricMap(metrics, filter); len(copied) > 0 {
+			dst[key] = copied
+		}
+	}
+	return dst
+}
+
+func copyNestedMetricMap(src map[string]map[string]MetricData, filter func(MetricData) bool) map[string]map[string]MetricData {
+	dst := make(map[string]map[string]MetricData, len(src))
+	for key, metrics := range src {
+		if copied := copyMetricMap(metrics, filter); len(copied) > 0 {
+			dst[key] = copied
+		}
+	}
+	return dst
+}
+
+func copyPodContainerMetricMap(src map[string]map[string]map[string]MetricData,
+	filter func(MetricData) bool) map[string]map[string]map[string]MetricData {
+	dst := make(map[string]map[string]map[string]MetricData, len(src))
+	for key, metrics := range src {
+		if copied := copyNestedMetricMap(metrics, filter); len(copied) > 0 {
+			dst[key] = copied
+		}
+	}
+	return dst
+}
+
+func copyPodContainerNumaMetricMap(src map[string]map[string]map[string]map[string]MetricData,
+	filter func(MetricData) bool) map[string]map[string]map[string]map[string]MetricData {
+	dst := make(map[string]map[string]map[string]map[string]MetricData, len(src))
+	for key, metrics := range src {
+		if copied := copyPodContainerMetricMap(metrics, filter); len(copied) > 0 {
+			dst[key] = copied
+		}
+	}
+	return dst
+}
@@ -0,0 +1,194 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metric
+
+import "sort"
+
+// MetricSourceTag records the source which produced the value of metric in merges
+type MetricSourceTag struct {
+	MetricKey
+	Source string `json:"source"`
+}
+
+// MergeMetrics merges all metrics in the other store (collected from the given source) into this one,
+// and for metrics existing in both stores, the one collected later wins. The source of winning values
+// is recorded as diagnostic metadata to debug conflicts among multiple sources.
+func (c *MetricStore) MergeMetrics(source string, other *MetricStore) {
+	snapshot := other.Snapshot()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	forEachSnapshotMetric(snapshot, func(key MetricKey, data MetricData) {
+		storedKey := key
+		storedKey.MetricName = c.prefixedMetricName(key.MetricName)
+		if cur, ok := c.lookupMetric(storedKey); ok && !isNewerMetricData(data, cur) {
+			return
+		}
+
+		if c.setMetric(key, data) {
+			c.metricSources[storedKey] = source
+		}
+	})
+}
+
+// GetMetricSource returns the source which produced the value of metric in merges,
+// and it's empty if the metric is set directly rather than merged from other stores.
+func (c *MetricStore) GetMetricSource(key MetricKey) string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.metricSources[key]
+}
+
+// listMetricSources returns all source tags ordered by metric name, it must be called with lock held.
+func (c *MetricStore) listMetricSources() []MetricSourceTag {
+	if len(c.metricSources) == 0 {
+		return nil
+	}
+
+	tags := make([]MetricSourceTag, 0, len(c.metricSources))
+	for key, source := range c.metricSources {
+		tags = append(tags, MetricSourceTag{MetricKey: key, Source: source})
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		return tags[i].MetricName < tags[j].MetricName
+	})
+	return tags
+}
+
+// restoreMetricSources replaces all source tags with those of existing metrics, it must be called with lock held.
+func (c *MetricStore) restoreMetricSources(tags []MetricSourceTag) {
+	c.metricSources = make(map[MetricKey]string, len(tags))
+	for _, tag := range tags {
+		if _, ok := c.lookupMetric(tag.MetricKey); ok {
+			c.metricSources[tag.MetricKey] = tag.Source
+		}
+	}
+}
+
+// lookupMetric returns the metric identified by the key, it must be called with lock held.
+func (c *MetricStore) lookupMetric(key MetricKey) (data MetricData, ok bool) {
+	switch key.Scope {
+	case MetricChangeScopeNode:
+		data, ok = c.nodeMetricMap[key.MetricName]
+	case MetricChangeScopeNuma:
+		data, ok = c.numaMetricMap[key.NumaID][key.MetricName]
+	case MetricChangeScopeDevice:
+		data, ok = c.deviceMetricMap[key.DeviceName][key.MetricName]
+	case MetricChangeScopeCPU:
+		data, ok = c.cpuMetricMap[key.CPUID][key.MetricName]
+	case MetricChangeScopeSocket:
+		data, ok = c.socketMetricMap[key.SocketID][key.MetricName]
+	case MetricChangeScopeContainer:
+		data, ok = c.podContainerMetricMap[key.PodUID][key.ContainerName][key.MetricName]
+	case MetricChangeScopeContainerNuma:
+		data, ok = c.podContainerNumaMetricMap[key.PodUID][key.ContainerName][key.NumaNode][key.MetricName]
+	case MetricChangeScopeCgroup:
+		data, ok = c.cgroupMetricMap[key.CgroupPath][key.MetricName]
+	case MetricChangeScopeCgroupNuma:
+		data, ok = c.cgroupNumaMetricMap[key.CgroupPath][key.NumaNode][key.MetricName]
+	}
+	return data, ok
+}
+
+// setMetric sets the metric identified by the key with the setter of its scope, and returns false if the
+// write is dropped, it must be called with lock held.
+func (c *MetricStore) setMetric(key MetricKey, data MetricData) bool {
+	switch key.Scope {
+	case MetricChangeScopeNode:
+		return c.setNodeMetric(key.MetricName, data)
+	case MetricChangeScopeNuma:
+		return c.setNumaMetric(key.NumaID, key.MetricName, data)
+	case MetricChangeScopeDevice:
+		return c.setDeviceMetric(key.DeviceName, key.MetricName, data)
+	case MetricChangeScopeCPU:
+		return c.setCPUMetric(key.CPUID, key.MetricName, data)
+	case MetricChangeScopeSocket:
+		return c.setSocketMetric(key.SocketID, key.MetricName, data)
+	case MetricChangeScopeContainer:
+		return c.setContainerMetric(key.PodUID, key.ContainerName, key.MetricName, data)
+	case MetricChangeScopeContainerNuma:
+		return c.setContainerNumaMetric(key.PodUID, key.ContainerName, key.NumaNode, key.MetricName, data)
+	case MetricChangeScopeCgroup:
+		return c.setCgroupMetric(key.CgroupPath, key.MetricName, data)
+	case MetricChangeScopeCgroupNuma:
+		return c.setCgroupNumaMetric(key.CgroupPath, key.NumaNode, key.MetricName, data)
+	}
+	return false
+}
+
+// forEachSnapshotMetric calls the function for each metric in the snapshot
+func forEachSnapshotMetric(snapshot *MetricStoreSnapshot, f func(key MetricKey, data MetricData)) {
+	for metricName, data := range snapshot.NodeMetrics {
+		f(MetricKey{Scope: MetricChangeScopeNode, MetricName: metricName}, data)
+	}
+	for numaID, metrics := range snapshot.NumaMetrics {
+		for metricName, data := range metrics {
+			f(MetricKey{Scope: MetricChangeScopeNuma, NumaID: numaID, MetricName: metricName}, data)
+		}
+	}
+	for deviceName, metrics := range snapshot.DeviceMetrics {
+		for metricName, data := range metrics {
+			f(MetricKey{Scope: MetricChangeScopeDevice, DeviceName: deviceName, MetricName: metricName}, data)
+		}
+	}
+	for cpuID, metrics := range snapshot.CPUMetrics {
+		for metricName, data := range metrics {
+			f(MetricKey{Scope: MetricChangeScopeCPU, CPUID: cpuID, MetricName: metricName}, data)
+		}
+	}
+	for socketID, metrics := range snapshot.SocketMetrics {
+		for metricName, data := range metrics {
+			f(MetricKey{Scope: MetricChangeScopeSocket, SocketID: socketID, MetricName: metricName}, data)
+		}
+	}
+	for podUID, containers := range snapshot.PodContainerMetrics {
+		for containerName, metrics := range containers {
+			for metricName, data := range metrics {
+				f(MetricKey{Scope: MetricChangeScopeContainer, PodUID: podUID, ContainerName: containerName,
+					MetricName: metricName}, data)
+			}
+		}
+	}
+	for podUID, containers := range snapshot.PodContainerNumaMetrics {
+		for containerName, numas := range containers {
+			for numaNode, metrics := range numas {
+				for metricName, data := range metrics {
+					f(MetricKey{Scope: MetricChangeScopeContainerNuma, PodUID: podUID, ContainerName: containerName,
+						NumaNode: numaNode, MetricName: metricName}, data)
+				}
+			}
+		}
+	}
+	for cgroupPath, metrics := range snapshot.CgroupMetrics {
+		for metricName, data := range metrics {
+			f(MetricKey{Scope: MetricChangeScopeCgroup, CgroupPath: cgroupPath, MetricName: metricName}, data)
+		}
+	}
+	for cgroupPath, numas := range snapshot.CgroupNumaMetrics {
+		for numaNode, metrics := range numas {
+			for metricName, data := range metrics {
+				f(MetricKey{Scope: MetricChangeScopeCgroupNuma, CgroupPath: cgroupPath, NumaNode: numaNode,
+					MetricName: metricName}, data)
+			}
+		}
+	}
+}
+
+// isNewerMetricData returns true if data is collected later than the current one
+func isNewerMetricData(data, cur MetricData) bool {
+	return data.Time != nil && (cur.Time == nil || data.Time.After(*cur.Time))
+}
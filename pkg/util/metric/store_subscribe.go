@@ -0,0 +1,128 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metric
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// those scopes tell which level the changed metric belongs to
+const (
+	MetricChangeScopeNode          = "node"
+	MetricChangeScopeNuma          = "numa"
+	MetricChangeScopeDevice        = "device"
+	MetricChangeScopeCPU           = "cpu"
+	MetricChangeScopeSocket        = "socket"
+	MetricChangeScopeContainer     = "container"
+	MetricChangeScopeContainerNuma = "container-numa"
+	MetricChangeScopeCgroup        = "cgroup"
+	MetricChangeScopeCgroupNuma    = "cgroup-numa"
+)
+
+// MetricChangeEvent is sent to subscribers when the value of metric changes, and
+// only those fields related to the scope are set to identify the metric.
+type MetricChangeEvent struct {
+	Scope      string
+	MetricName string
+
+	NumaID        int
+	CPUID         int
+	SocketID      int
+	DeviceName    string
+	PodUID        string
+	ContainerName string
+	NumaNode      string
+	CgroupPath    string
+
+	MetricData
+}
+
+type changeSubscriber struct {
+	// metricNames is the filter of metrics to be delivered, empty means all metrics
+	metricNames sets.String
+	ch          chan<- MetricChangeEvent
+}
+
+// SubscribeChanges registers a channel to receive events when metric values change, and only
+// metrics in metricNames will be delivered if it's not empty. The events are sent without blocking,
+// so they will be dropped if the channel is full. It returns an id to unsubscribe.
+func (c *MetricStore) SubscribeChanges(metricNames []string, ch chan<- MetricChangeEvent) string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.changeSubscriberSeq++
+	id := fmt.Sprintf("subscriber-%d", c.changeSubscriberSeq)
+	c.changeSubscribers[id] = &changeSubscriber{metricNames: sets.NewString(metricNames...), ch: ch}
+	return id
+}
+
+func (c *MetricStore) UnsubscribeChanges(id string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.changeSubscribers, id)
+}
+
+// CloseChangeSubscriptions closes channels of all subscribers (including those of threshold crossings) and
+// removes them, and it's used when the owner of MetricStore shuts down. Channels shared by subscribers are
+// only closed once.
+func (c *MetricStore) CloseChangeSubscriptions() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	closed := make(map[chan<- MetricChangeEvent]struct{})
+	for _, subscriber := range c.changeSubscribers {
+		if _, ok := closed[subscriber.ch]; !ok {
+			close(subscriber.ch)
+			closed[subscriber.ch] = struct{}{}
+		}
+	}
+	c.changeSubscribers = make(map[string]*changeSubscriber)
+
+	closedThreshold := make(map[chan<- ThresholdCrossingEvent]struct{})
+	for _, subscriber := range c.thresholdSubscribers {
+		if _, ok := closedThreshold[subscriber.ch]; !ok {
+			close(subscriber.ch)
+			closedThreshold[subscriber.ch] = struct{}{}
+		}
+	}
+	c.thresholdSubscribers = make(map[string]*thresholdSubscriber)
+}
+
+// publishChange sends the event to matching subscribers if the metric is new or its value
+// is changed, and it must be called with lock held.
+func (c *MetricStore) publishChange(event MetricChangeEvent, prev MetricData, existed bool) {
+	if len(c.changeSubscribers) == 0 || (existed && prev.Value == event.Value) {
+		return
+	}
+
+	// subscribers are not aware of the prefix, the same as readers
+	event.MetricName = strings.TrimPrefix(event.MetricName, c.metricNamePrefix)
+	for _, subscriber := range c.changeSubscribers {
+		// filter is evaluated before enqueue to reduce the traffic of channel
+		if subscriber.metricNames.Len() > 0 && !subscriber.metricNames.Has(event.MetricName) {
+			continue
+		}
+
+		select {
+		case subscriber.ch <- event:
+		default:
+		}
+	}
+}
@@ -17,6 +17,8 @@ limitations under the License.
 package metric
 
 import (
+	"math"
+	"sync"
 	"testing"
 	"time"
 
@@ -75,6 +77,46 @@ func TestStore_SetAndGetCPUMetric(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestStore_SetAndGetSocketMetric(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+
+	store := NewMetricStore()
+	store.SetSocketMetric(0, "test-metric-name", MetricData{Value: 1.0, Time: &now})
+	value, _ := store.GetSocketMetric(0, "test-metric-name")
+	assert.Equal(t, MetricData{Value: 1.0, Time: &now}, value)
+	_, err := store.GetSocketMetric(1, "test-not-exist")
+	assert.Error(t, err)
+}
+
+func TestStore_GetPodContainerMetrics(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	stale := now.Add(-time.Minute)
+
+	store := NewMetricStore()
+	store.SetContainerMetric("pod1", "c1", "test-metric-name", MetricData{Value: 1.0, Time: &now})
+	store.SetContainerMetric("pod1", "c2", "test-metric-name", MetricData{Value: 2.0, Time: &stale})
+	store.SetContainerMetric("pod1", "c3", "test-other-metric", MetricData{Value: 3.0, Time: &now})
+
+	assert.Equal(t, map[string]MetricData{
+		"c1": {Value: 1.0, Time: &now},
+		"c2": {Value: 2.0, Time: &stale},
+	}, store.GetPodContainerMetrics("pod1", "test-metric-name", 0))
+	assert.Equal(t, map[string]MetricData{
+		"c1": {Value: 1.0, Time: &now},
+	}, store.GetPodContainerMetrics("pod1", "test-metric-name", 10*time.Second))
+
+	res := store.GetPodContainerMetrics("pod1", "test-not-exist", 0)
+	assert.NotNil(t, res)
+	assert.Empty(t, res)
+	res = store.GetPodContainerMetrics("pod-not-exist", "test-metric-name", 0)
+	assert.NotNil(t, res)
+	assert.Empty(t, res)
+}
+
 func TestStore_ContainerMetric(t *testing.T) {
 	t.Parallel()
 
@@ -93,3 +135,587 @@ func TestStore_ContainerMetric(t *testing.T) {
 	value, _ = store.GetContainerMetric("pod2", "container1", "test-metric-name")
 	assert.Equal(t, MetricData{Value: 1.0, Time: &now}, value)
 }
+
+func TestStore_GetContainerMetricCopy(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	store := NewMetricStore()
+	store.SetContainerMetric("pod1", "container1", "test-metric-name", MetricData{Value: 1.0, Time: &now})
+
+	value, err := store.GetContainerMetric("pod1", "container1", "test-metric-name")
+	assert.NoError(t, err)
+	*value.Time = now.Add(time.Hour)
+	value.Value = 2.0
+
+	value, err = store.GetContainerMetric("pod1", "container1", "test-metric-name")
+	assert.NoError(t, err)
+	assert.Equal(t, 1.0, value.Value)
+	assert.True(t, value.Time.Equal(now))
+}
+
+func TestStore_ValueRounder(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+
+	tests := []struct {
+		mode   string
+		digits int
+		value  float64
+		want   float64
+	}{
+		{mode: RoundingModeNone, value: 1.23456789, want: 1.23456789},
+		{mode: RoundingModeDecimalPlaces, digits: 2, value: 1.23456789, want: 1.23},
+		{mode: RoundingModeDecimalPlaces, digits: 0, value: 2.5, want: 3},
+		{mode: RoundingModeSignificantFigures, digits: 3, value: 1234.5678, want: 1230},
+		{mode: RoundingModeSignificantFigures, digits: 3, value: 0.00123456, want: 0.00123},
+		{mode: RoundingModeSignificantFigures, digits: 3, value: -12.3456, want: -12.3},
+		// integral values like raw counters are kept
+		{mode: RoundingModeSignificantFigures, digits: 3, value: 123456789, want: 123456789},
+	}
+
+	for _, tt := range tests {
+		rounder, err := NewValueRounder(tt.mode, tt.digits)
+		assert.NoError(t, err)
+
+		store := NewMetricStore()
+		store.SetValueRounder(rounder)
+		store.SetNodeMetric("test-metric-name", MetricData{Value: tt.value, Time: &now})
+		store.SetContainerMetric("pod1", "c1", "test-metric-name", MetricData{Value: tt.value, Time: &now})
+
+		value, _ := store.GetNodeMetric("test-metric-name")
+		assert.InDelta(t, tt.want, value.Value, 1e-12, "%v %v %v", tt.mode, tt.digits, tt.value)
+		value, _ = store.GetContainerMetric("pod1", "c1", "test-metric-name")
+		assert.InDelta(t, tt.want, value.Value, 1e-12, "%v %v %v", tt.mode, tt.digits, tt.value)
+	}
+
+	_, err := NewValueRounder("unknown", 1)
+	assert.Error(t, err)
+	_, err = NewValueRounder(RoundingModeSignificantFigures, 0)
+	assert.Error(t, err)
+}
+
+func TestStore_GetNodeMetricSeries(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	at := func(d time.Duration) *time.Time {
+		t := now.Add(d)
+		return &t
+	}
+
+	store := NewMetricStore()
+	store.SetNodeMetric("test-metric-name", MetricData{Value: 1, Time: at(-3 * time.Minute)})
+	assert.Empty(t, store.GetNodeMetricSeries("test-metric-name", time.Hour))
+
+	store.SetNodeMetricRetention(2 * time.Minute)
+	store.SetNodeMetric("test-metric-name", MetricData{Value: 1, Time: at(-3 * time.Minute)})
+	store.SetNodeMetric("test-metric-name", MetricData{Value: 2, Time: at(-90 * time.Second)})
+	store.SetNodeMetric("test-metric-name", MetricData{Value: 4, Time: at(-30 * time.Second)})
+	store.SetNodeMetric("test-metric-name", MetricData{Value: 3, Time: at(-time.Minute)})
+	// the metric is not updated by source
+	store.SetNodeMetric("test-metric-name", MetricData{Value: 5, Time: at(-30 * time.Second)})
+
+	// samples out of retention are dropped
+	series := store.GetNodeMetricSeries("test-metric-name", time.Hour)
+	assert.Equal(t, []MetricData{
+		{Value: 2, Time: at(-90 * time.Second)},
+		{Value: 3, Time: at(-time.Minute)},
+		{Value: 5, Time: at(-30 * time.Second)},
+	}, series)
+
+	series = store.GetNodeMetricSeries("test-metric-name", 70*time.Second)
+	assert.Equal(t, []MetricData{
+		{Value: 3, Time: at(-time.Minute)},
+		{Value: 5, Time: at(-30 * time.Second)},
+	}, series)
+
+	assert.Empty(t, store.GetNodeMetricSeries("test-not-exist", time.Hour))
+}
+
+func TestStore_SetNodeMetricRetentionOf(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	at := func(d time.Duration) *time.Time {
+		t := now.Add(d)
+		return &t
+	}
+
+	retention, err := ParseMetricRetention("1")
+	assert.NoError(t, err)
+	assert.Equal(t, MetricRetention{Samples: 1}, retention)
+	retention, err = ParseMetricRetention("10m")
+	assert.NoError(t, err)
+	assert.Equal(t, MetricRetention{Duration: 10 * time.Minute}, retention)
+	_, err = ParseMetricRetention("-1")
+	assert.Error(t, err)
+	_, err = ParseMetricRetention("abc")
+	assert.Error(t, err)
+
+	store := NewMetricStore()
+	store.SetNodeMetricRetention(time.Minute)
+	store.SetNodeMetricRetentionOf("bandwidth", MetricRetention{Duration: 10 * time.Minute})
+	store.SetNodeMetricRetentionOf("cpi", MetricRetention{Samples: 1})
+	for i := 5; i > 0; i-- {
+		for _, metricName := range []string{"bandwidth", "cpi", "default"} {
+			store.SetNodeMetric(metricName, MetricData{Value: float64(i), Time: at(-time.Duration(i) * 30 * time.Second)})
+		}
+	}
+
+	assert.Len(t, store.GetNodeMetricSeries("bandwidth", time.Hour), 5)
+	assert.Equal(t, []MetricData{{Value: 1, Time: at(-30 * time.Second)}}, store.GetNodeMetricSeries("cpi", time.Hour))
+	assert.Len(t, store.GetNodeMetricSeries("default", time.Hour), 3)
+
+	// overridden metrics are still retained when the default retention is disabled
+	store.SetNodeMetricRetention(0)
+	assert.Len(t, store.GetNodeMetricSeries("bandwidth", time.Hour), 5)
+	assert.Empty(t, store.GetNodeMetricSeries("default", time.Hour))
+
+	// falls back to the default retention once the override is removed
+	store.SetNodeMetricRetentionOf("bandwidth", MetricRetention{})
+	assert.Empty(t, store.GetNodeMetricSeries("bandwidth", time.Hour))
+}
+
+func TestStore_SubscribeChanges(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	store := NewMetricStore()
+
+	all := make(chan MetricChangeEvent, 10)
+	filtered := make(chan MetricChangeEvent, 10)
+	store.SubscribeChanges(nil, all)
+	id := store.SubscribeChanges([]string{"mem.bandwidth.read.container"}, filtered)
+
+	store.SetContainerMetric("pod1", "c1", "mem.bandwidth.read.container", MetricData{Value: 1, Time: &now})
+	store.SetContainerMetric("pod1", "c1", "mem.bandwidth.write.container", MetricData{Value: 2, Time: &now})
+	store.SetNodeMetric("mem.bandwidth.read.container", MetricData{Value: 3, Time: &now})
+	// unchanged value is not delivered
+	store.SetContainerMetric("pod1", "c1", "mem.bandwidth.read.container", MetricData{Value: 1, Time: &now})
+
+	assert.Len(t, all, 3)
+	assert.Len(t, filtered, 2)
+	assert.Equal(t, MetricChangeEvent{
+		Scope:         MetricChangeScopeContainer,
+		MetricName:    "mem.bandwidth.read.container",
+		PodUID:        "pod1",
+		ContainerName: "c1",
+		MetricData:    MetricData{Value: 1, Time: &now},
+	}, <-filtered)
+	event := <-filtered
+	assert.Equal(t, MetricChangeScopeNode, event.Scope)
+	assert.Equal(t, float64(3), event.Value)
+
+	store.UnsubscribeChanges(id)
+	store.SetContainerMetric("pod1", "c1", "mem.bandwidth.read.container", MetricData{Value: 4, Time: &now})
+	assert.Len(t, filtered, 0)
+	assert.Len(t, all, 4)
+}
+
+func TestStore_SubscribeThresholdCrossings(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	store := NewMetricStore()
+
+	_, err := store.SubscribeThresholdCrossings("mem.bandwidth.read.container", 50, 80, make(chan ThresholdCrossingEvent))
+	assert.Error(t, err)
+
+	ch := make(chan ThresholdCrossingEvent, 10)
+	id, err := store.SubscribeThresholdCrossings("mem.bandwidth.read.container", 80, 50, ch)
+	assert.NoError(t, err)
+
+	set := func(value float64) {
+		store.SetContainerMetric("pod1", "c1", "mem.bandwidth.read.container", MetricData{Value: value, Time: &now})
+	}
+	set(40)
+	assert.Len(t, ch, 0)
+
+	// rising edge
+	set(85)
+	assert.Len(t, ch, 1)
+	event := <-ch
+	assert.Equal(t, ThresholdCrossingRising, event.Direction)
+	assert.Equal(t, float64(80), event.Threshold)
+	assert.Equal(t, "c1", event.ContainerName)
+	assert.Equal(t, float64(85), event.Value)
+
+	// staying high, and dropping within hysteresis doesn't fall
+	set(90)
+	set(60)
+	set(82)
+	assert.Len(t, ch, 0)
+	// other metrics and containers are not affected
+	store.SetContainerMetric("pod1", "c1", "mem.bandwidth.write.container", MetricData{Value: 100, Time: &now})
+	assert.Len(t, ch, 0)
+
+	// falling edge
+	set(50)
+	assert.Len(t, ch, 1)
+	event = <-ch
+	assert.Equal(t, ThresholdCrossingFalling, event.Direction)
+	assert.Equal(t, float64(50), event.Threshold)
+
+	set(30)
+	assert.Len(t, ch, 0)
+
+	store.UnsubscribeThresholdCrossings(id)
+	set(100)
+	assert.Len(t, ch, 0)
+
+	// the edge dropped on a full channel is sent with the next sample still beyond the threshold
+	set(30)
+	full := make(chan ThresholdCrossingEvent, 1)
+	_, err = store.SubscribeThresholdCrossings("mem.bandwidth.read.container", 80, 50, full)
+	assert.NoError(t, err)
+	full <- ThresholdCrossingEvent{}
+	set(85)
+	<-full
+	set(90)
+	assert.Len(t, full, 1)
+	event = <-full
+	assert.Equal(t, ThresholdCrossingRising, event.Direction)
+	assert.Equal(t, float64(90), event.Value)
+}
+
+func TestStore_SetMaxMetricKeys(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	store := NewMetricStore()
+	store.SetMaxMetricKeys(3)
+
+	store.SetContainerMetric("pod1", "c1", "cpu.usage.container", MetricData{Value: 1, Time: &now})
+	store.SetContainerMetric("pod2", "c1", "cpu.usage.container", MetricData{Value: 2, Time: &now})
+	store.SetNodeMetric("cpu.usage.node", MetricData{Value: 3, Time: &now})
+	// update makes pod1 the most recently updated one
+	store.SetContainerMetric("pod1", "c1", "cpu.usage.container", MetricData{Value: 4, Time: &now})
+	store.SetCgroupMetric("/kubepods", "cpu.usage.cgroup", MetricData{Value: 5, Time: &now})
+
+	_, err := store.GetContainerMetric("pod2", "c1", "cpu.usage.container")
+	assert.Error(t, err)
+	data, err := store.GetContainerMetric("pod1", "c1", "cpu.usage.container")
+	assert.NoError(t, err)
+	assert.Equal(t, float64(4), data.Value)
+	_, err = store.GetNodeMetric("cpu.usage.node")
+	assert.NoError(t, err)
+
+	store.SetNumaMetric(0, "mem.bandwidth.numa", MetricData{Value: 6, Time: &now})
+	_, err = store.GetNodeMetric("cpu.usage.node")
+	assert.Error(t, err)
+	// only the first eviction is logged within the interval, and others are counted for the next log
+	assert.Equal(t, 1, store.unloggedEvictions)
+
+	// keys of deleted pods are not counted any more
+	store.GCPodsMetric(map[string]bool{})
+	store.SetNumaMetric(1, "mem.bandwidth.numa", MetricData{Value: 7, Time: &now})
+	_, err = store.GetCgroupMetric("/kubepods", "cpu.usage.cgroup")
+	assert.NoError(t, err)
+	_, err = store.GetNumaMetric(0, "mem.bandwidth.numa")
+	assert.NoError(t, err)
+
+	// keys are still tracked after the limit is set again
+	store.SetMaxMetricKeys(3)
+	store.SetNodeMetric("cpu.usage.node", MetricData{Value: 8, Time: &now})
+	_, err = store.GetCgroupMetric("/kubepods", "cpu.usage.cgroup")
+	assert.Error(t, err)
+	_, err = store.GetNumaMetric(0, "mem.bandwidth.numa")
+	assert.NoError(t, err)
+
+	// the least-recently-updated keys are evicted once the limit is lowered
+	store.SetMaxMetricKeys(2)
+	_, err = store.GetNumaMetric(0, "mem.bandwidth.numa")
+	assert.Error(t, err)
+	_, err = store.GetNumaMetric(1, "mem.bandwidth.numa")
+	assert.NoError(t, err)
+	_, err = store.GetNodeMetric("cpu.usage.node")
+	assert.NoError(t, err)
+}
+
+func TestStore_MergeMetrics(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	later := now.Add(time.Second)
+
+	store := NewMetricStore()
+	store.SetContainerMetric("pod1", "c1", "cpu.usage.container", MetricData{Value: 1, Time: &now})
+	store.SetNodeMetric("cpu.usage.node", MetricData{Value: 1, Time: &later})
+
+	nodeKey := MetricKey{Scope: MetricChangeScopeNode, MetricName: "cpu.usage.node"}
+	containerKey := MetricKey{Scope: MetricChangeScopeContainer, PodUID: "pod1", ContainerName: "c1", MetricName: "cpu.usage.container"}
+	// metrics set directly have no source
+	assert.Empty(t, store.GetMetricSource(containerKey))
+
+	source1 := NewMetricStore()
+	source1.SetContainerMetric("pod1", "c1", "cpu.usage.container", MetricData{Value: 2, Time: &later})
+	source1.SetNodeMetric("cpu.usage.node", MetricData{Value: 2, Time: &now})
+	source2 := NewMetricStore()
+	source2.SetContainerMetric("pod1", "c1", "cpu.usage.container", MetricData{Value: 3, Time: &now})
+
+	store.MergeMetrics("source1", source1)
+	store.MergeMetrics("source2", source2)
+
+	data, err := store.GetContainerMetric("pod1", "c1", "cpu.usage.container")
+	assert.NoError(t, err)
+	assert.Equal(t, float64(2), data.Value)
+	assert.Equal(t, "source1", store.GetMetricSource(containerKey))
+
+	data, err = store.GetNodeMetric("cpu.usage.node")
+	assert.NoError(t, err)
+	assert.Equal(t, float64(1), data.Value)
+	assert.Empty(t, store.GetMetricSource(nodeKey))
+
+	snapshot := store.Snapshot()
+	assert.Equal(t, []MetricSourceTag{{MetricKey: containerKey, Source: "source1"}}, snapshot.MetricSources)
+
+	// the source is cleared once the metric is set directly
+	store.SetContainerMetric("pod1", "c1", "cpu.usage.container", MetricData{Value: 4, Time: &later})
+	assert.Empty(t, store.GetMetricSource(containerKey))
+
+	restored := NewMetricStore()
+	restored.Restore(snapshot, now.Add(-time.Minute))
+	assert.Equal(t, "source1", restored.GetMetricSource(containerKey))
+}
+
+func TestStore_SetMetricNamePrefix(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	store := NewMetricStore()
+	store.SetMetricNamePrefix("teamA_")
+
+	ch := make(chan MetricChangeEvent, 1)
+	store.SubscribeChanges([]string{"cpu.usage.container"}, ch)
+
+	store.SetContainerMetric("pod1", "c1", "cpu.usage.container", MetricData{Value: 1, Time: &now})
+	store.SetNodeMetric("cpu.usage.node", MetricData{Value: 2, Time: &now})
+
+	data, err := store.GetContainerMetric("pod1", "c1", "cpu.usage.container")
+	assert.NoError(t, err)
+	assert.Equal(t, float64(1), data.Value)
+	data, err = store.GetNodeMetric("cpu.usage.node")
+	assert.NoError(t, err)
+	assert.Equal(t, float64(2), data.Value)
+	assert.Equal(t, "cpu.usage.container", (<-ch).MetricName)
+
+	// metrics are stored with prefixed names, which are seen by exporters
+	_, ok := store.podContainerMetricMap["pod1"]["c1"]["teamA_cpu.usage.container"]
+	assert.True(t, ok)
+	_, ok = store.Snapshot().NodeMetrics["teamA_cpu.usage.node"]
+	assert.True(t, ok)
+}
+
+func TestStore_RegisterValueTransform(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	store := NewMetricStore()
+	store.SetMetricNamePrefix("teamA_")
+	rounder, err := NewValueRounder(RoundingModeDecimalPlaces, 2)
+	assert.NoError(t, err)
+	store.SetValueRounder(rounder)
+	store.RegisterValueTransform("cpu.cpi.container", func(value float64) float64 { return math.Min(value, 5) })
+	store.RegisterValueTransform("mem.bandwidth.read.container", math.Log2)
+
+	store.SetContainerMetric("pod1", "c1", "cpu.cpi.container", MetricData{Value: 8, Time: &now})
+	store.SetContainerMetric("pod1", "c1", "mem.bandwidth.read.container", MetricData{Value: 10, Time: &now})
+	store.SetContainerMetric("pod1", "c1", "cpu.usage.container", MetricData{Value: 8, Time: &now})
+
+	for metricName, want := range map[string]float64{
+		"cpu.cpi.container":            5,
+		"mem.bandwidth.read.container": 3.32,
+		"cpu.usage.container":          8,
+	} {
+		data, err := store.GetContainerMetric("pod1", "c1", metricName)
+		assert.NoError(t, err)
+		assert.Equal(t, want, data.Value, metricName)
+	}
+
+	// values written after the transform is removed are stored as they are
+	store.RegisterValueTransform("cpu.cpi.container", nil)
+	store.SetContainerMetric("pod1", "c1", "cpu.cpi.container", MetricData{Value: 8, Time: &now})
+	data, err := store.GetContainerMetric("pod1", "c1", "cpu.cpi.container")
+	assert.NoError(t, err)
+	assert.Equal(t, float64(8), data.Value)
+}
+
+func TestStore_SetDisabledMetrics(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	store := NewMetricStore()
+	store.SetMetricNamePrefix("teamA_")
+	store.SetMaxMetricKeys(10)
+	store.SetNodeMetric("mem.bandwidth.tenant.node", MetricData{Value: 1, Time: &now})
+	store.SetContainerMetric("pod1", "c1", "cpu.cpi.container", MetricData{Value: 2, Time: &now})
+	store.SetContainerMetric("pod1", "c1", "cpu.usage.container", MetricData{Value: 3, Time: &now})
+
+	// values already stored are removed
+	store.SetDisabledMetrics([]string{"cpu.cpi.container", "mem.bandwidth.tenant.node"})
+	_, err := store.GetContainerMetric("pod1", "c1", "cpu.cpi.container")
+	assert.Error(t, err)
+	_, err = store.GetNodeMetric("mem.bandwidth.tenant.node")
+	assert.Error(t, err)
+	data, err := store.GetContainerMetric("pod1", "c1", "cpu.usage.container")
+	assert.NoError(t, err)
+	assert.Equal(t, float64(3), data.Value)
+
+	// writes are ignored until it's enabled again
+	store.SetContainerMetric("pod1", "c1", "cpu.cpi.container", MetricData{Value: 4, Time: &now})
+	_, err = store.GetContainerMetric("pod1", "c1", "cpu.cpi.container")
+	assert.Error(t, err)
+
+	store.SetDisabledMetrics(nil)
+	store.SetContainerMetric("pod1", "c1", "cpu.cpi.container", MetricData{Value: 4, Time: &now})
+	data, err = store.GetContainerMetric("pod1", "c1", "cpu.cpi.container")
+	assert.NoError(t, err)
+	assert.Equal(t, float64(4), data.Value)
+}
+
+func TestStore_IncrementMetric(t *testing.T) {
+	t.Parallel()
+
+	store := NewMetricStore()
+	store.SetMetricNamePrefix("teamA_")
+
+	const goroutines, increments = 20, 100
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < increments; j++ {
+				now := time.Now()
+				store.IncrementNodeMetric("skip.count", MetricData{Value: 1, Time: &now})
+				store.IncrementContainerMetric("pod1", "c1", "skip.count", MetricData{Value: 2, Time: &now})
+			}
+		}()
+	}
+	wg.Wait()
+
+	data, err := store.GetNodeMetric("skip.count")
+	assert.NoError(t, err)
+	assert.Equal(t, float64(goroutines*increments), data.Value)
+	assert.NotNil(t, data.Time)
+	data, err = store.GetContainerMetric("pod1", "c1", "skip.count")
+	assert.NoError(t, err)
+	assert.Equal(t, float64(2*goroutines*increments), data.Value)
+
+	// the result is returned, and disabled metrics are not created
+	now := time.Now()
+	assert.Equal(t, float64(2*goroutines*increments+1),
+		store.IncrementContainerMetric("pod1", "c1", "skip.count", MetricData{Value: 1, Time: &now}).Value)
+	store.SetDisabledMetrics([]string{"disabled.count"})
+	store.IncrementNodeMetric("disabled.count", MetricData{Value: 1, Time: &now})
+	_, err = store.GetNodeMetric("disabled.count")
+	assert.Error(t, err)
+}
+
+func TestStore_SetMinWriteIntervals(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	at := func(d time.Duration) *time.Time {
+		ts := now.Add(d)
+		return &ts
+	}
+
+	store := NewMetricStore()
+	store.SetMinWriteIntervals(map[string]time.Duration{"mem.limit.container": time.Minute})
+	events := make(chan MetricChangeEvent, 10)
+	store.SubscribeChanges(nil, events)
+
+	store.SetContainerMetric("pod1", "c1", "mem.limit.container", MetricData{Value: 100, Time: at(0)})
+	store.SetContainerMetric("pod1", "c1", "mem.usage.container", MetricData{Value: 10, Time: at(0)})
+	<-events
+	<-events
+
+	// unchanged gauge is not rewritten within the interval
+	store.SetContainerMetric("pod1", "c1", "mem.limit.container", MetricData{Value: 100, Time: at(30 * time.Second)})
+	data, err := store.GetContainerMetric("pod1", "c1", "mem.limit.container")
+	assert.NoError(t, err)
+	assert.Equal(t, now, *data.Time)
+
+	// metrics without intervals are always written
+	store.SetContainerMetric("pod1", "c1", "mem.usage.container", MetricData{Value: 10, Time: at(30 * time.Second)})
+	data, err = store.GetContainerMetric("pod1", "c1", "mem.usage.container")
+	assert.NoError(t, err)
+	assert.Equal(t, now.Add(30*time.Second), *data.Time)
+
+	// changed value is written at once
+	store.SetContainerMetric("pod1", "c1", "mem.limit.container", MetricData{Value: 200, Time: at(40 * time.Second)})
+	data, err = store.GetContainerMetric("pod1", "c1", "mem.limit.container")
+	assert.NoError(t, err)
+	assert.Equal(t, float64(200), data.Value)
+	assert.Equal(t, float64(200), (<-events).Value)
+
+	// unchanged gauge is refreshed after the interval
+	store.SetContainerMetric("pod1", "c1", "mem.limit.container", MetricData{Value: 200, Time: at(90 * time.Second)})
+	data, err = store.GetContainerMetric("pod1", "c1", "mem.limit.container")
+	assert.NoError(t, err)
+	assert.Equal(t, now.Add(40*time.Second), *data.Time)
+	store.SetContainerMetric("pod1", "c1", "mem.limit.container", MetricData{Value: 200, Time: at(100 * time.Second)})
+	data, err = store.GetContainerMetric("pod1", "c1", "mem.limit.container")
+	assert.NoError(t, err)
+	assert.Equal(t, now.Add(100*time.Second), *data.Time)
+}
+
+func TestStore_ListTrackedContainers(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	store := NewMetricStore()
+	assert.Empty(t, store.ListTrackedContainers())
+
+	store.SetDisabledMetrics([]string{"disabled.container"})
+	store.SetContainerMetric("pod2", "c1", "mem.usage.container", MetricData{Value: 1, Time: &now})
+	store.SetContainerMetric("pod1", "c2", "mem.usage.container", MetricData{Value: 1, Time: &now})
+	store.SetContainerMetric("pod1", "c1", "mem.usage.container", MetricData{Value: 1, Time: &now})
+	store.SetContainerMetric("pod1", "c1", "cpu.usage.container", MetricData{Value: 1, Time: &now})
+	// containers with only per-numa metrics are tracked as well
+	store.SetContainerNumaMetric("pod3", "c1", "0", "mem.usage.numa.container", MetricData{Value: 1, Time: &now})
+	// containers without any metric present are not tracked
+	store.SetContainerMetric("pod4", "c1", "disabled.container", MetricData{Value: 1, Time: &now})
+
+	assert.Equal(t, []TrackedContainer{
+		{PodUID: "pod1", ContainerName: "c1"},
+		{PodUID: "pod1", ContainerName: "c2"},
+		{PodUID: "pod2", ContainerName: "c1"},
+		{PodUID: "pod3", ContainerName: "c1"},
+	}, store.ListTrackedContainers())
+
+	store.GCPodsMetric(map[string]bool{"pod1": true, "pod3": true})
+	assert.Equal(t, []TrackedContainer{
+		{PodUID: "pod1", ContainerName: "c1"},
+		{PodUID: "pod1", ContainerName: "c2"},
+		{PodUID: "pod3", ContainerName: "c1"},
+	}, store.ListTrackedContainers())
+}
+
+func TestStore_SetMinWriteIntervalsWithMaxMetricKeys(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	at := func(d time.Duration) *time.Time {
+		ts := now.Add(d)
+		return &ts
+	}
+
+	store := NewMetricStore()
+	store.SetMaxMetricKeys(2)
+	store.SetMinWriteIntervals(map[string]time.Duration{"mem.limit.container": time.Minute})
+
+	store.SetContainerMetric("pod1", "c1", "mem.limit.container", MetricData{Value: 100, Time: at(0)})
+	store.SetContainerMetric("pod1", "c1", "mem.usage.container", MetricData{Value: 10, Time: at(0)})
+	// the skipped write of the live gauge still refreshes its key
+	store.SetContainerMetric("pod1", "c1", "mem.limit.container", MetricData{Value: 100, Time: at(30 * time.Second)})
+	store.SetContainerMetric("pod1", "c1", "cpu.usage.container", MetricData{Value: 1, Time: at(30 * time.Second)})
+
+	_, err := store.GetContainerMetric("pod1", "c1", "mem.limit.container")
+	assert.NoError(t, err)
+	_, err = store.GetContainerMetric("pod1", "c1", "mem.usage.container")
+	assert.Error(t, err)
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metric
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ThresholdCrossingDirection tells which edge the metric crosses the threshold on
+type ThresholdCrossingDirection string
+
+const (
+	ThresholdCrossingRising  = ThresholdCrossingDirection("rising")
+	ThresholdCrossingFalling = ThresholdCrossingDirection("falling")
+)
+
+// ThresholdCrossingEvent is sent to subscribers when the metric rises to the high threshold
+// or falls to the low one, and Threshold is the one crossed.
+type ThresholdCrossingEvent struct {
+	MetricChangeEvent
+	Direction ThresholdCrossingDirection
+	Threshold float64
+}
+
+type thresholdSubscriber struct {
+	metricName string
+	high, low  float64
+	ch         chan<- ThresholdCrossingEvent
+	// above records the metric keys that have risen to high and not fallen to low yet
+	above map[MetricKey]bool
+}
+
+// SubscribeThresholdCrossings registers a channel to receive events when the metric (of any scope) rises
+// to high or falls to low, and the gap between them works as hysteresis, so that only edge transitions are
+// delivered, rather than each sample beyond the thresholds. Metrics are regarded as below the thresholds
+// before the first sample. The events are sent without blocking, and an edge dropped on a full channel is
+// sent again with the next sample still beyond the threshold. It returns an id to unsubscribe.
+func (c *MetricStore) SubscribeThresholdCrossings(metricName string, high, low float64, ch chan<- ThresholdCrossingEvent) (string, error) {
+	if low > high {
+		return "", fmt.Errorf("low threshold %v is greater than high threshold %v", low, high)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.changeSubscriberSeq++
+	id := fmt.Sprintf("threshold-subscriber-%d", c.changeSubscriberSeq)
+	c.thresholdSubscribers[id] = &thresholdSubscriber{
+		metricName: metricName,
+		high:       high,
+		low:        low,
+		ch:         ch,
+		above:      make(map[MetricKey]bool),
+	}
+	return id, nil
+}
+
+func (c *MetricStore) UnsubscribeThresholdCrossings(id string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.thresholdSubscribers, id)
+}
+
+// publishThresholdCrossing sends the event to subscribers of the metric if it crosses
+// their thresholds, and it must be called with lock held.
+func (c *MetricStore) publishThresholdCrossing(event MetricChangeEvent) {
+	if len(c.thresholdSubscribers) == 0 {
+		return
+	}
+
+	event.MetricName = strings.TrimPrefix(event.MetricName, c.metricNamePrefix)
+	key := newMetricKey(event)
+	for _, subscriber := range c.thresholdSubscribers {
+		if subscriber.metricName != event.MetricName {
+			continue
+		}
+
+		crossing := ThresholdCrossingEvent{MetricChangeEvent: event}
+		above := subscriber.above[key]
+		switch {
+		case !above && event.Value >= subscriber.high:
+			crossing.Direction, crossing.Threshold = ThresholdCrossingRising, subscriber.high
+		case above && event.Value <= subscriber.low:
+			crossing.Direction, crossing.Threshold = ThresholdCrossingFalling, subscriber.low
+		default:
+			continue
+		}
+
+		// the state is only flipped once the edge is delivered, otherwise it's sent again with the next sample
+		// still beyond the threshold, rather than being lost when the channel is full
+		select {
+		case subscriber.ch <- crossing:
+			if above {
+				delete(subscriber.above, key)
+			} else {
+				subscriber.above[key] = true
+			}
+		default:
+		}
+	}
+}
+
+// gcThresholdCrossingStates removes states of metrics belonging to the deleted pods,
+// and it must be called with lock held.
+func (c *MetricStore) gcThresholdCrossingStates(deletedPodUIDs map[string]bool) {
+	for _, subscriber := range c.thresholdSubscribers {
+		for key := range subscriber.above {
+			if deletedPodUIDs[key.PodUID] {
+				delete(subscriber.above, key)
+			}
+		}
+	}
+}
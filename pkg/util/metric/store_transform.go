@@ -0,0 +1,46 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metric
+
+import "strings"
+
+// ValueTransform converts the metric value into the one to be stored
+type ValueTransform func(value float64) float64
+
+// RegisterValueTransform registers the transform for values of the metric written since then,
+// i.e. log-scaling bandwidth or capping CPI, and the transform is removed if it's nil.
+// Transforms are applied before rounding and storage, so they affect all consumers of the store,
+// and they should not be registered for raw counters, otherwise deltas based on them will be broken.
+func (c *MetricStore) RegisterValueTransform(metricName string, transform ValueTransform) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if transform == nil {
+		delete(c.valueTransforms, metricName)
+		return
+	}
+	c.valueTransforms[metricName] = transform
+}
+
+// transformData returns the data with value transformed and rounded, and it must be called with
+// lock held. The metric name is the prefixed one, while transforms are registered without prefix.
+func (c *MetricStore) transformData(metricName string, data MetricData) MetricData {
+	if transform, ok := c.valueTransforms[strings.TrimPrefix(metricName, c.metricNamePrefix)]; ok {
+		data.Value = transform(data.Value)
+	}
+	return c.roundData(data)
+}
@@ -141,3 +141,32 @@ func (c *MetricStore) AggregateCoreMetric(cpuset machine.CPUSet, metricName stri
 	}
 	return data
 }
+
+// AggregateNumaMetric handles metric for all numa nodes
+func (c *MetricStore) AggregateNumaMetric(metricName string, agg Aggregator) MetricData {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	now := time.Now()
+	data := MetricData{Value: .0, Time: &now}
+
+	numaCount := 0.
+	for _, metrics := range c.numaMetricMap {
+		metric, ok := metrics[metricName]
+		if !ok {
+			continue
+		}
+
+		numaCount++
+		data.Value += metric.Value
+		data.Time = general.MaxTimePtr(data.Time, metric.Time)
+	}
+
+	switch agg {
+	case AggregatorAvg:
+		if numaCount > 0 {
+			data.Value /= numaCount
+		}
+	}
+	return data
+}
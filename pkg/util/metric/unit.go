@@ -0,0 +1,51 @@
+/*
+Copyright 2022 The Katalyst Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metric
+
+import "fmt"
+
+// those units are used by memory bandwidth metrics, and all of them are in per second
+const (
+	MemBandwidthUnitBytes = "bytes"
+	MemBandwidthUnitKiB   = "KiB"
+	MemBandwidthUnitMiB   = "MiB"
+	MemBandwidthUnitGiB   = "GiB"
+
+	// DefaultMemBandwidthUnit is used if no unit is specified
+	DefaultMemBandwidthUnit = MemBandwidthUnitMiB
+)
+
+var memBandwidthUnitScales = map[string]float64{
+	MemBandwidthUnitBytes: 1,
+	MemBandwidthUnitKiB:   1 << 10,
+	MemBandwidthUnitMiB:   1 << 20,
+	MemBandwidthUnitGiB:   1 << 30,
+}
+
+// GetMemBandwidthUnitScale returns the number of bytes in the given memory bandwidth unit,
+// and DefaultMemBandwidthUnit is used if the unit is empty.
+func GetMemBandwidthUnitScale(unit string) (float64, error) {
+	if unit == "" {
+		unit = DefaultMemBandwidthUnit
+	}
+
+	scale, ok := memBandwidthUnitScales[unit]
+	if !ok {
+		return 0, fmt.Errorf("unknown memory bandwidth unit %q", unit)
+	}
+	return scale, nil
+}